@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultDormantDays is the number of days without use after which an access key is dormant
+const defaultDormantDays = 90
+
+// dormantAccessKeys finds the access keys of the repository users in the org that haven't been used since the
+// cutoff.  Keys that have never been used are dormant if they were created before the cutoff.
+func (o *iamOrchestrator) dormantAccessKeys(ctx context.Context, cutoff time.Time) ([]*DormantAccessKey, error) {
+	path := fmt.Sprintf("/spinup/%s/", o.org)
+
+	log.Infof("finding access keys not used since %s for users in %s", cutoff.Format(time.RFC3339), path)
+
+	users, err := o.client.ListUsersWithPath(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	dormant := []*DormantAccessKey{}
+	for _, u := range users {
+		iamUserName := aws.StringValue(u.UserName)
+
+		repository, userName := repositoryUserFromIAM(o.org, u)
+		if group, _ := repositoryUserScope(repository); group == "" {
+			continue
+		}
+
+		// other users can be created under the org path, only the keys of repository users are reported
+		ok, err := o.isRepositoryUser(ctx, u, repository)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			log.Debugf("user %s in path %s isn't a repository user", iamUserName, aws.StringValue(u.Path))
+			continue
+		}
+
+		keys, err := o.client.ListAccessKeys(ctx, iamUserName)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, k := range keys {
+			out, err := o.client.GetAccessKeyLastUsed(ctx, aws.StringValue(k.AccessKeyId))
+			if err != nil {
+				return nil, err
+			}
+
+			lastUsedDate, service, region := accessKeyLastUsed(out)
+
+			key := &DormantAccessKey{
+				UserName:        userName,
+				Repository:      repository,
+				IAMUserName:     iamUserName,
+				AccessKeyId:     aws.StringValue(k.AccessKeyId),
+				Status:          aws.StringValue(k.Status),
+				CreatedAt:       aws.TimeValue(k.CreateDate),
+				NeverUsed:       lastUsedDate == nil,
+				LastUsedDate:    lastUsedDate,
+				LastUsedService: service,
+				LastUsedRegion:  region,
+			}
+
+			if key.NeverUsed && !key.CreatedAt.Before(cutoff) {
+				continue
+			}
+
+			if !key.NeverUsed && !lastUsedDate.Before(cutoff) {
+				continue
+			}
+
+			dormant = append(dormant, key)
+		}
+	}
+
+	return dormant, nil
+}
+
+// startDormantAccessKeysReport starts finding the access keys of the users in the org that haven't been used in
+// the number of days in the background
+func (s *server) startDormantAccessKeysReport(ctx context.Context, account string, days int) (*Report, error) {
+	// IAM doesn't support resource tags, so we can't pass the s.orgPolicy here
+	job := s.newJobSession(account, "", "arn:aws:iam::aws:policy/IAMReadOnlyAccess")
+
+	return s.startReport(ctx, job, reportDormantKeys, func(ctx context.Context) (interface{}, error) {
+		return s.dormantAccessKeysReport(ctx, job.orchestrators, account, days)
+	})
+}
+
+// dormantAccessKeysReport reports the access keys of the users in the org that haven't been used in the number
+// of days
+func (s *server) dormantAccessKeysReport(ctx context.Context, orchestrators orchestratorsFunc, account string, days int) (*DormantAccessKeysReport, error) {
+	_, orch, err := orchestrators(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	keys, err := orch.dormantAccessKeys(ctx, now.AddDate(0, 0, -days))
+	if err != nil {
+		return nil, err
+	}
+
+	return &DormantAccessKeysReport{
+		Account:     account,
+		Days:        days,
+		GeneratedAt: now,
+		Keys:        keys,
+	}, nil
+}
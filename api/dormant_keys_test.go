@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ecr-api/iam"
+	"github.com/aws/aws-sdk-go/aws"
+	awsiam "github.com/aws/aws-sdk-go/service/iam"
+)
+
+func TestIamOrchestrator_dormantAccessKeys(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	client := newFakeIAM()
+	orch := newIamOrchestrator(iam.IAM{Service: client}, "testOrg")
+
+	roleGroups, err := orch.prepareAccount(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// user, key age in days, last used days ago (-1 is never)
+	keys := []struct {
+		user     string
+		age      int
+		lastUsed int
+	}{
+		{user: "active", age: 200, lastUsed: 1},
+		{user: "stale", age: 200, lastUsed: 120},
+		{user: "unused", age: 100, lastUsed: -1},
+		{user: "fresh", age: 5, lastUsed: -1},
+	}
+
+	for _, k := range keys {
+		if _, err := orch.repositoryUserCreate(ctx, "rudolph", "spindev-00001", roleGroups["pull"], &RepositoryUserCreateRequest{UserName: k.user, Role: "pull"}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		out, err := client.CreateAccessKeyWithContext(ctx, &awsiam.CreateAccessKeyInput{UserName: aws.String("rudolph-" + k.user)})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		client.ageAccessKeys("rudolph-"+k.user, now.AddDate(0, 0, -k.age))
+		if k.lastUsed >= 0 {
+			client.useAccessKey(aws.StringValue(out.AccessKey.AccessKeyId), "ecr", now.AddDate(0, 0, -k.lastUsed))
+		}
+	}
+
+	// an unused key of a user in the org path that isn't a repository user
+	if _, err := client.CreateUserWithContext(ctx, &awsiam.CreateUserInput{
+		Path:     aws.String("/spinup/testOrg/spindev-00001/vixen/"),
+		UserName: aws.String("deploy-bot"),
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := client.CreateAccessKeyWithContext(ctx, &awsiam.CreateAccessKeyInput{UserName: aws.String("deploy-bot")}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	client.ageAccessKeys("deploy-bot", now.AddDate(0, 0, -200))
+
+	dormant, err := orch.dormantAccessKeys(ctx, now.AddDate(0, 0, -90))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(dormant) != 2 {
+		t.Fatalf("expected 2 dormant keys, got %d", len(dormant))
+	}
+
+	// users are listed by name
+	stale, unused := dormant[0], dormant[1]
+	if stale.UserName != "stale" || stale.NeverUsed || stale.LastUsedService != "ecr" || stale.Repository != "spindev-00001/rudolph" {
+		t.Errorf("unexpected stale key %+v", stale)
+	}
+
+	if unused.UserName != "unused" || !unused.NeverUsed || unused.LastUsedDate != nil || unused.LastUsedRegion != "" {
+		t.Errorf("unexpected unused key %+v", unused)
+	}
+
+	user, err := orch.getRepositoryUser(ctx, "spindev-00001", "rudolph", "active")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(user.AccessKeys) != 1 || user.AccessKeys[0].LastUsedDate == nil || user.AccessKeys[0].LastUsedService != "ecr" || user.AccessKeys[0].LastUsedRegion != "us-east-1" {
+		t.Errorf("expected the access key last used, got %+v", user.AccessKeys)
+	}
+
+	users, err := orch.listRepositoryUsersWithDetails(ctx, "spindev-00001", "rudolph")
+	if err != nil || len(users) != len(keys) {
+		t.Errorf("expected %d users with details, got %d (%v)", len(keys), len(users), err)
+	}
+}
@@ -0,0 +1,683 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
+)
+
+// fakeECR is an in-memory ecr service for testing orchestration against
+type fakeECR struct {
+	ecriface.ECRAPI
+
+	mu       sync.Mutex
+	account  string
+	repos    map[string]*ecr.Repository
+	policies map[string]string
+	tags     map[string][]*ecr.Tag
+	images   map[string][]*ecr.ImageDetail
+	// manifests are the image manifests by repository and digest
+	manifests map[string]string
+	// putErr is returned by PutImage when it's set
+	putErr error
+	// deleteErrs are returned by DeleteRepository by repository name
+	deleteErrs map[string]error
+	// replication is the registry replication configuration
+	replication *ecr.ReplicationConfiguration
+	// replicationStatuses are the image replication statuses by repository and digest
+	replicationStatuses map[string][]*ecr.ImageReplicationStatus
+	// scanFindings are the image scan findings by repository and digest
+	scanFindings map[string]*ecr.ImageScanFindings
+	// layers are the layer blobs by repository and digest, downloaded from layerURL
+	layers   map[string][]byte
+	layerURL string
+	// uploads are the layer uploads in progress by upload id
+	uploads map[string]*fakeLayerUpload
+}
+
+// fakeLayerUpload is a layer upload in progress
+type fakeLayerUpload struct {
+	repository string
+	data       []byte
+}
+
+func newFakeECR(account string) *fakeECR {
+	return &fakeECR{
+		account:    account,
+		repos:      map[string]*ecr.Repository{},
+		policies:   map[string]string{},
+		tags:       map[string][]*ecr.Tag{},
+		images:     map[string][]*ecr.ImageDetail{},
+		manifests:  map[string]string{},
+		deleteErrs: map[string]error{},
+
+		replicationStatuses: map[string][]*ecr.ImageReplicationStatus{},
+		scanFindings:        map[string]*ecr.ImageScanFindings{},
+		layers:              map[string][]byte{},
+		uploads:             map[string]*fakeLayerUpload{},
+	}
+}
+
+func repositoryNotFound(name string) error {
+	return awserr.New(ecr.ErrCodeRepositoryNotFoundException, fmt.Sprintf("repository %s not found", name), nil)
+}
+
+// addRepository adds a repository with the policy and tags
+func (f *fakeECR) addRepository(name, policy string, tags ...*ecr.Tag) *ecr.Repository {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	repo := &ecr.Repository{
+		CreatedAt:      aws.Time(time.Now()),
+		RegistryId:     aws.String(f.account),
+		RepositoryArn:  aws.String(fmt.Sprintf("arn:aws:ecr:us-east-1:%s:repository/%s", f.account, name)),
+		RepositoryName: aws.String(name),
+		RepositoryUri:  aws.String(fmt.Sprintf("%s.dkr.ecr.us-east-1.amazonaws.com/%s", f.account, name)),
+	}
+
+	f.repos[name] = repo
+	if policy != "" {
+		f.policies[name] = policy
+	}
+	f.tags[aws.StringValue(repo.RepositoryArn)] = tags
+
+	return repo
+}
+
+// addImage adds an image with the tag to the repository
+func (f *fakeECR) addImage(name, tag, digest string, size int64, pushedAt time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	tags := []string{}
+	if tag != "" {
+		tags = append(tags, tag)
+	}
+
+	f.manifests[name+"@"+digest] = fmt.Sprintf(`{"schemaVersion":2,"digest":"%s"}`, digest)
+	f.images[name] = append(f.images[name], &ecr.ImageDetail{
+		ImageDigest:      aws.String(digest),
+		ImagePushedAt:    aws.Time(pushedAt),
+		ImageSizeInBytes: aws.Int64(size),
+		ImageTags:        aws.StringSlice(tags),
+		RegistryId:       aws.String(f.account),
+		RepositoryName:   aws.String(name),
+	})
+}
+
+// addImageWithLayers adds an image with the tag to the repository, with a config and a layer for each of the
+// layer contents.  It returns the image digest.
+func (f *fakeECR) addImageWithLayers(name, tag string, pushedAt time.Time, contents ...string) string {
+	manifest := imageManifest{
+		MediaType: "application/vnd.oci.image.manifest.v1+json",
+		Config:    f.putLayer(name, fmt.Sprintf(`{"architecture":"amd64","tag":"%s"}`, tag)),
+	}
+
+	for _, c := range contents {
+		manifest.Layers = append(manifest.Layers, f.putLayer(name, c))
+	}
+
+	b, _ := json.Marshal(manifest)
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(b))
+
+	f.addImage(name, tag, digest, int64(len(b)), pushedAt)
+
+	f.mu.Lock()
+	f.manifests[name+"@"+digest] = string(b)
+	f.mu.Unlock()
+
+	return digest
+}
+
+// putLayer stores the layer contents in the repository
+func (f *fakeECR) putLayer(name, contents string) *ImageLayer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(contents)))
+	f.layers[name+"@"+digest] = []byte(contents)
+
+	return &ImageLayer{Digest: digest, Size: int64(len(contents))}
+}
+
+// ServeHTTP serves the layer downloads, the path is the repository and digest
+func (f *fakeECR) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	layer, ok := f.layers[strings.TrimPrefix(r.URL.Path, "/")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Write(layer)
+}
+
+// tagValue returns the value of the repository tag, or the empty string
+func (f *fakeECR) tagValue(name, key string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	repo, ok := f.repos[name]
+	if !ok {
+		return ""
+	}
+
+	for _, t := range f.tags[aws.StringValue(repo.RepositoryArn)] {
+		if aws.StringValue(t.Key) == key {
+			return aws.StringValue(t.Value)
+		}
+	}
+
+	return ""
+}
+
+func (f *fakeECR) repositoryByArn(repoArn string) (*ecr.Repository, bool) {
+	for _, r := range f.repos {
+		if aws.StringValue(r.RepositoryArn) == repoArn {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+func (f *fakeECR) CreateRepositoryWithContext(ctx aws.Context, input *ecr.CreateRepositoryInput, opts ...request.Option) (*ecr.CreateRepositoryOutput, error) {
+	name := aws.StringValue(input.RepositoryName)
+
+	f.mu.Lock()
+	_, exists := f.repos[name]
+	f.mu.Unlock()
+
+	if exists {
+		return nil, awserr.New(ecr.ErrCodeRepositoryAlreadyExistsException, fmt.Sprintf("repository %s exists", name), nil)
+	}
+
+	repo := f.addRepository(name, "", input.Tags...)
+	repo.EncryptionConfiguration = input.EncryptionConfiguration
+	repo.ImageScanningConfiguration = input.ImageScanningConfiguration
+	repo.ImageTagMutability = input.ImageTagMutability
+
+	return &ecr.CreateRepositoryOutput{Repository: repo}, nil
+}
+
+func (f *fakeECR) DescribeRepositoriesWithContext(ctx aws.Context, input *ecr.DescribeRepositoriesInput, opts ...request.Option) (*ecr.DescribeRepositoriesOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out := &ecr.DescribeRepositoriesOutput{}
+	for _, n := range input.RepositoryNames {
+		repo, ok := f.repos[aws.StringValue(n)]
+		if !ok {
+			return nil, repositoryNotFound(aws.StringValue(n))
+		}
+		out.Repositories = append(out.Repositories, repo)
+	}
+
+	return out, nil
+}
+
+func (f *fakeECR) DescribeRepositoriesPagesWithContext(ctx aws.Context, input *ecr.DescribeRepositoriesInput, fn func(*ecr.DescribeRepositoriesOutput, bool) bool, opts ...request.Option) error {
+	f.mu.Lock()
+	names := make([]string, 0, len(f.repos))
+	for n := range f.repos {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	out := &ecr.DescribeRepositoriesOutput{}
+	for _, n := range names {
+		out.Repositories = append(out.Repositories, f.repos[n])
+	}
+	f.mu.Unlock()
+
+	fn(out, true)
+	return nil
+}
+
+func (f *fakeECR) DeleteRepositoryWithContext(ctx aws.Context, input *ecr.DeleteRepositoryInput, opts ...request.Option) (*ecr.DeleteRepositoryOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.StringValue(input.RepositoryName)
+	if err, ok := f.deleteErrs[name]; ok {
+		return nil, err
+	}
+
+	repo, ok := f.repos[name]
+	if !ok {
+		return nil, repositoryNotFound(name)
+	}
+
+	if len(f.images[name]) > 0 && !aws.BoolValue(input.Force) {
+		return nil, awserr.New(ecr.ErrCodeRepositoryNotEmptyException, fmt.Sprintf("repository %s has images", name), nil)
+	}
+
+	delete(f.repos, name)
+	delete(f.policies, name)
+	delete(f.images, name)
+	delete(f.tags, aws.StringValue(repo.RepositoryArn))
+
+	return &ecr.DeleteRepositoryOutput{Repository: repo}, nil
+}
+
+func (f *fakeECR) SetRepositoryPolicyWithContext(ctx aws.Context, input *ecr.SetRepositoryPolicyInput, opts ...request.Option) (*ecr.SetRepositoryPolicyOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.StringValue(input.RepositoryName)
+	if _, ok := f.repos[name]; !ok {
+		return nil, repositoryNotFound(name)
+	}
+
+	f.policies[name] = aws.StringValue(input.PolicyText)
+
+	return &ecr.SetRepositoryPolicyOutput{PolicyText: input.PolicyText, RepositoryName: input.RepositoryName}, nil
+}
+
+func (f *fakeECR) GetRepositoryPolicyWithContext(ctx aws.Context, input *ecr.GetRepositoryPolicyInput, opts ...request.Option) (*ecr.GetRepositoryPolicyOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.StringValue(input.RepositoryName)
+	if _, ok := f.repos[name]; !ok {
+		return nil, repositoryNotFound(name)
+	}
+
+	policy, ok := f.policies[name]
+	if !ok {
+		return nil, awserr.New(ecr.ErrCodeRepositoryPolicyNotFoundException, "policy not found", nil)
+	}
+
+	return &ecr.GetRepositoryPolicyOutput{PolicyText: aws.String(policy), RepositoryName: input.RepositoryName}, nil
+}
+
+func (f *fakeECR) DeleteRepositoryPolicyWithContext(ctx aws.Context, input *ecr.DeleteRepositoryPolicyInput, opts ...request.Option) (*ecr.DeleteRepositoryPolicyOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.StringValue(input.RepositoryName)
+	if _, ok := f.repos[name]; !ok {
+		return nil, repositoryNotFound(name)
+	}
+
+	if _, ok := f.policies[name]; !ok {
+		return nil, awserr.New(ecr.ErrCodeRepositoryPolicyNotFoundException, "policy not found", nil)
+	}
+	delete(f.policies, name)
+
+	return &ecr.DeleteRepositoryPolicyOutput{RepositoryName: input.RepositoryName}, nil
+}
+
+func (f *fakeECR) ListTagsForResourceWithContext(ctx aws.Context, input *ecr.ListTagsForResourceInput, opts ...request.Option) (*ecr.ListTagsForResourceOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.repositoryByArn(aws.StringValue(input.ResourceArn)); !ok {
+		return nil, repositoryNotFound(aws.StringValue(input.ResourceArn))
+	}
+
+	tags := []*ecr.Tag{}
+	for _, t := range f.tags[aws.StringValue(input.ResourceArn)] {
+		tags = append(tags, &ecr.Tag{Key: t.Key, Value: t.Value})
+	}
+
+	return &ecr.ListTagsForResourceOutput{Tags: tags}, nil
+}
+
+func (f *fakeECR) TagResourceWithContext(ctx aws.Context, input *ecr.TagResourceInput, opts ...request.Option) (*ecr.TagResourceOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	repoArn := aws.StringValue(input.ResourceArn)
+	if _, ok := f.repositoryByArn(repoArn); !ok {
+		return nil, repositoryNotFound(repoArn)
+	}
+
+	for _, t := range input.Tags {
+		replaced := false
+		for _, existing := range f.tags[repoArn] {
+			if aws.StringValue(existing.Key) == aws.StringValue(t.Key) {
+				existing.Value = t.Value
+				replaced = true
+			}
+		}
+
+		if !replaced {
+			f.tags[repoArn] = append(f.tags[repoArn], &ecr.Tag{Key: t.Key, Value: t.Value})
+		}
+	}
+
+	return &ecr.TagResourceOutput{}, nil
+}
+
+func (f *fakeECR) UntagResourceWithContext(ctx aws.Context, input *ecr.UntagResourceInput, opts ...request.Option) (*ecr.UntagResourceOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	repoArn := aws.StringValue(input.ResourceArn)
+	if _, ok := f.repositoryByArn(repoArn); !ok {
+		return nil, repositoryNotFound(repoArn)
+	}
+
+	remove := map[string]bool{}
+	for _, k := range input.TagKeys {
+		remove[aws.StringValue(k)] = true
+	}
+
+	tags := []*ecr.Tag{}
+	for _, t := range f.tags[repoArn] {
+		if !remove[aws.StringValue(t.Key)] {
+			tags = append(tags, t)
+		}
+	}
+	f.tags[repoArn] = tags
+
+	return &ecr.UntagResourceOutput{}, nil
+}
+
+func (f *fakeECR) DescribeImagesWithContext(ctx aws.Context, input *ecr.DescribeImagesInput, opts ...request.Option) (*ecr.DescribeImagesOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.StringValue(input.RepositoryName)
+	if _, ok := f.repos[name]; !ok {
+		return nil, repositoryNotFound(name)
+	}
+
+	if len(input.ImageIds) == 0 {
+		return &ecr.DescribeImagesOutput{ImageDetails: append([]*ecr.ImageDetail{}, f.images[name]...)}, nil
+	}
+
+	details := []*ecr.ImageDetail{}
+	for _, id := range input.ImageIds {
+		for _, i := range f.images[name] {
+			if id.ImageDigest != nil && aws.StringValue(id.ImageDigest) == aws.StringValue(i.ImageDigest) {
+				details = append(details, i)
+				continue
+			}
+
+			for _, t := range i.ImageTags {
+				if id.ImageTag != nil && aws.StringValue(id.ImageTag) == aws.StringValue(t) {
+					details = append(details, i)
+				}
+			}
+		}
+	}
+
+	return &ecr.DescribeImagesOutput{ImageDetails: details}, nil
+}
+
+func (f *fakeECR) DescribeImageScanFindingsWithContext(ctx aws.Context, input *ecr.DescribeImageScanFindingsInput, opts ...request.Option) (*ecr.DescribeImageScanFindingsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.StringValue(input.RepositoryName)
+	if _, ok := f.repos[name]; !ok {
+		return nil, repositoryNotFound(name)
+	}
+
+	findings, ok := f.scanFindings[name+"@"+aws.StringValue(input.ImageId.ImageDigest)]
+	if !ok {
+		return nil, awserr.New(ecr.ErrCodeScanNotFoundException, "scan not found", nil)
+	}
+
+	return &ecr.DescribeImageScanFindingsOutput{
+		ImageId:           input.ImageId,
+		ImageScanFindings: findings,
+		RepositoryName:    input.RepositoryName,
+	}, nil
+}
+
+func (f *fakeECR) BatchGetImageWithContext(ctx aws.Context, input *ecr.BatchGetImageInput, opts ...request.Option) (*ecr.BatchGetImageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.StringValue(input.RepositoryName)
+	if _, ok := f.repos[name]; !ok {
+		return nil, repositoryNotFound(name)
+	}
+
+	out := &ecr.BatchGetImageOutput{}
+	for _, id := range input.ImageIds {
+		manifest, ok := f.manifests[name+"@"+aws.StringValue(id.ImageDigest)]
+		if !ok {
+			out.Failures = append(out.Failures, &ecr.ImageFailure{
+				FailureCode:   aws.String(ecr.ImageFailureCodeImageNotFound),
+				FailureReason: aws.String("Requested image not found"),
+				ImageId:       id,
+			})
+			continue
+		}
+
+		out.Images = append(out.Images, &ecr.Image{
+			ImageId:                id,
+			ImageManifest:          aws.String(manifest),
+			ImageManifestMediaType: aws.String("application/vnd.oci.image.manifest.v1+json"),
+			RepositoryName:         input.RepositoryName,
+		})
+	}
+
+	return out, nil
+}
+
+func (f *fakeECR) PutImageWithContext(ctx aws.Context, input *ecr.PutImageInput, opts ...request.Option) (*ecr.PutImageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.putErr != nil {
+		return nil, f.putErr
+	}
+
+	name := aws.StringValue(input.RepositoryName)
+	if _, ok := f.repos[name]; !ok {
+		return nil, repositoryNotFound(name)
+	}
+
+	digest := aws.StringValue(input.ImageDigest)
+	tag := aws.StringValue(input.ImageTag)
+
+	// the layers and images referenced by the manifest have to be in the repository
+	manifest := imageManifest{}
+	if err := json.Unmarshal([]byte(aws.StringValue(input.ImageManifest)), &manifest); err != nil {
+		return nil, awserr.New(ecr.ErrCodeInvalidParameterException, "invalid manifest", err)
+	}
+
+	for _, d := range manifest.blobs() {
+		if _, ok := f.layers[name+"@"+d]; !ok {
+			return nil, awserr.New(ecr.ErrCodeLayersNotFoundException, fmt.Sprintf("layer %s not found", d), nil)
+		}
+	}
+
+	for _, m := range manifest.Manifests {
+		if _, ok := f.manifests[name+"@"+m.Digest]; !ok {
+			return nil, awserr.New(ecr.ErrCodeReferencedImagesNotFoundException, fmt.Sprintf("image %s not found", m.Digest), nil)
+		}
+	}
+
+	var detail *ecr.ImageDetail
+	for _, i := range f.images[name] {
+		if aws.StringValue(i.ImageDigest) == digest {
+			detail = i
+		}
+	}
+
+	if detail == nil {
+		detail = &ecr.ImageDetail{
+			ImageDigest:    input.ImageDigest,
+			ImagePushedAt:  aws.Time(time.Now()),
+			ImageTags:      []*string{},
+			RegistryId:     aws.String(f.account),
+			RepositoryName: input.RepositoryName,
+		}
+		f.images[name] = append(f.images[name], detail)
+		f.manifests[name+"@"+digest] = aws.StringValue(input.ImageManifest)
+	} else if tag == "" {
+		return nil, awserr.New(ecr.ErrCodeImageAlreadyExistsException, "image exists", nil)
+	}
+
+	if tag != "" {
+		for _, t := range detail.ImageTags {
+			if aws.StringValue(t) == tag {
+				return nil, awserr.New(ecr.ErrCodeImageAlreadyExistsException, "image exists", nil)
+			}
+		}
+		detail.ImageTags = append(detail.ImageTags, aws.String(tag))
+	}
+
+	return &ecr.PutImageOutput{
+		Image: &ecr.Image{
+			ImageId:                &ecr.ImageIdentifier{ImageDigest: input.ImageDigest, ImageTag: input.ImageTag},
+			ImageManifest:          input.ImageManifest,
+			ImageManifestMediaType: input.ImageManifestMediaType,
+			RepositoryName:         input.RepositoryName,
+		},
+	}, nil
+}
+
+func (f *fakeECR) DescribeRegistryWithContext(ctx aws.Context, input *ecr.DescribeRegistryInput, opts ...request.Option) (*ecr.DescribeRegistryOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return &ecr.DescribeRegistryOutput{RegistryId: aws.String(f.account), ReplicationConfiguration: f.replication}, nil
+}
+
+func (f *fakeECR) PutReplicationConfigurationWithContext(ctx aws.Context, input *ecr.PutReplicationConfigurationInput, opts ...request.Option) (*ecr.PutReplicationConfigurationOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.replication = input.ReplicationConfiguration
+
+	return &ecr.PutReplicationConfigurationOutput{ReplicationConfiguration: f.replication}, nil
+}
+
+func (f *fakeECR) DescribeImageReplicationStatusWithContext(ctx aws.Context, input *ecr.DescribeImageReplicationStatusInput, opts ...request.Option) (*ecr.DescribeImageReplicationStatusOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.StringValue(input.RepositoryName)
+	if _, ok := f.repos[name]; !ok {
+		return nil, repositoryNotFound(name)
+	}
+
+	return &ecr.DescribeImageReplicationStatusOutput{
+		ImageId:             input.ImageId,
+		RepositoryName:      input.RepositoryName,
+		ReplicationStatuses: f.replicationStatuses[name+"@"+aws.StringValue(input.ImageId.ImageDigest)],
+	}, nil
+}
+
+// GetAuthorizationTokenWithContext returns a token for the AWS user that expires in 12 hours
+func (f *fakeECR) GetAuthorizationTokenWithContext(ctx aws.Context, input *ecr.GetAuthorizationTokenInput, opts ...request.Option) (*ecr.GetAuthorizationTokenOutput, error) {
+	return &ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{
+			{
+				AuthorizationToken: aws.String("QVdTOnNlY3JldA=="),
+				ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+				ProxyEndpoint:      aws.String(fmt.Sprintf("https://%s.dkr.ecr.us-east-1.amazonaws.com", f.account)),
+			},
+		},
+	}, nil
+}
+
+func (f *fakeECR) GetDownloadUrlForLayerWithContext(ctx aws.Context, input *ecr.GetDownloadUrlForLayerInput, opts ...request.Option) (*ecr.GetDownloadUrlForLayerOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := aws.StringValue(input.RepositoryName) + "@" + aws.StringValue(input.LayerDigest)
+	if _, ok := f.layers[key]; !ok {
+		return nil, awserr.New(ecr.ErrCodeLayersNotFoundException, "layer not found", nil)
+	}
+
+	return &ecr.GetDownloadUrlForLayerOutput{
+		DownloadUrl: aws.String(f.layerURL + "/" + key),
+		LayerDigest: input.LayerDigest,
+	}, nil
+}
+
+func (f *fakeECR) BatchCheckLayerAvailabilityWithContext(ctx aws.Context, input *ecr.BatchCheckLayerAvailabilityInput, opts ...request.Option) (*ecr.BatchCheckLayerAvailabilityOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out := &ecr.BatchCheckLayerAvailabilityOutput{}
+	for _, d := range input.LayerDigests {
+		if _, ok := f.layers[aws.StringValue(input.RepositoryName)+"@"+aws.StringValue(d)]; !ok {
+			out.Failures = append(out.Failures, &ecr.LayerFailure{
+				FailureCode: aws.String(ecr.LayerFailureCodeMissingLayerDigest),
+				LayerDigest: d,
+			})
+			continue
+		}
+
+		out.Layers = append(out.Layers, &ecr.Layer{
+			LayerAvailability: aws.String(ecr.LayerAvailabilityAvailable),
+			LayerDigest:       d,
+		})
+	}
+
+	return out, nil
+}
+
+// InitiateLayerUploadWithContext starts an upload with small parts, so layers are uploaded in several parts
+func (f *fakeECR) InitiateLayerUploadWithContext(ctx aws.Context, input *ecr.InitiateLayerUploadInput, opts ...request.Option) (*ecr.InitiateLayerUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := fmt.Sprintf("upload-%d", len(f.uploads)+1)
+	f.uploads[id] = &fakeLayerUpload{repository: aws.StringValue(input.RepositoryName)}
+
+	return &ecr.InitiateLayerUploadOutput{PartSize: aws.Int64(8), UploadId: aws.String(id)}, nil
+}
+
+func (f *fakeECR) UploadLayerPartWithContext(ctx aws.Context, input *ecr.UploadLayerPartInput, opts ...request.Option) (*ecr.UploadLayerPartOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	upload, ok := f.uploads[aws.StringValue(input.UploadId)]
+	if !ok || upload.repository != aws.StringValue(input.RepositoryName) {
+		return nil, awserr.New(ecr.ErrCodeUploadNotFoundException, "upload not found", nil)
+	}
+
+	if aws.Int64Value(input.PartFirstByte) != int64(len(upload.data)) {
+		return nil, awserr.New(ecr.ErrCodeInvalidLayerPartException, "unexpected first byte", nil)
+	}
+	upload.data = append(upload.data, input.LayerPartBlob...)
+
+	return &ecr.UploadLayerPartOutput{LastByteReceived: aws.Int64(int64(len(upload.data)) - 1), UploadId: input.UploadId}, nil
+}
+
+func (f *fakeECR) CompleteLayerUploadWithContext(ctx aws.Context, input *ecr.CompleteLayerUploadInput, opts ...request.Option) (*ecr.CompleteLayerUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := aws.StringValue(input.UploadId)
+	upload, ok := f.uploads[id]
+	if !ok {
+		return nil, awserr.New(ecr.ErrCodeUploadNotFoundException, "upload not found", nil)
+	}
+	delete(f.uploads, id)
+
+	digest := aws.StringValue(input.LayerDigests[0])
+	if digest != fmt.Sprintf("sha256:%x", sha256.Sum256(upload.data)) {
+		return nil, awserr.New(ecr.ErrCodeInvalidLayerException, "digest doesn't match", nil)
+	}
+
+	key := upload.repository + "@" + digest
+	if _, ok := f.layers[key]; ok {
+		return nil, awserr.New(ecr.ErrCodeLayerAlreadyExistsException, "layer exists", nil)
+	}
+	f.layers[key] = upload.data
+
+	return &ecr.CompleteLayerUploadOutput{LayerDigest: aws.String(digest), UploadId: input.UploadId}, nil
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/ecr-api/ecr"
+	"github.com/YaleSpinup/ecr-api/events"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// handleEvent handles an ECR EventBridge event from the event consumer.  Errors are only returned when the
+// event should be retried.
+func (s *server) handleEvent(ctx context.Context, e *events.Event) error {
+	switch e.DetailType {
+	case events.DetailTypeImageScan, events.DetailTypeInspectorScan:
+		return s.handleImageScanEvent(ctx, e)
+	case events.DetailTypeImageAction:
+		return s.handleImageActionEvent(ctx, e)
+	default:
+		log.Debugf("ignoring %s event %s", e.DetailType, e.Id)
+		return nil
+	}
+}
+
+// handleImageScanEvent fetches the findings for a completed basic or enhanced scan and processes them.  ECR
+// returns the Inspector findings of enhanced scans the same way as the basic scan findings.
+func (s *server) handleImageScanEvent(ctx context.Context, e *events.Event) error {
+	detail, err := e.ImageScan()
+	if err != nil {
+		log.Errorf("failed to parse image scan event %s: %s", e.Id, err)
+		return nil
+	}
+
+	if !detail.Complete() {
+		log.Infof("image scan of %s@%s in account %s finished with status %s", detail.RepositoryName, detail.ImageDigest, e.Account, detail.ScanStatus)
+		return nil
+	}
+
+	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", e.Account, s.session.RoleName)
+
+	session, err := s.assumeRole(
+		ctx,
+		s.session.ExternalID,
+		role,
+		s.orgPolicy,
+		"arn:aws:iam::aws:policy/AmazonEC2ContainerRegistryReadOnly",
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to assume role in account: %s", e.Account)
+	}
+
+	service := ecr.New(ecr.WithSession(session.Session))
+
+	out, extras, err := service.GetImageScanFindingsByImageDigest(ctx, detail.RepositoryName, detail.ImageDigest)
+	if err != nil {
+		// the org session policy denies access to repositories in other orgs
+		if aerr, ok := errors.Cause(err).(apierror.Error); ok && (aerr.Code == apierror.ErrForbidden || aerr.Code == apierror.ErrNotFound) {
+			log.Infof("skipping image scan event for %s@%s: %s", detail.RepositoryName, detail.ImageDigest, err)
+			return nil
+		}
+		return err
+	}
+
+	return s.scanCompleted(ctx, e.Account, detail.RepositoryName, detail.ImageDigest, detail.ImageTags, imageScanFindingsFromECR(out.ImageScanFindings, extras))
+}
+
+// scanCompleted applies exceptions to the findings of a completed scan, records them in the findings history,
+// evaluates the gate and sends the scan completed notification.  The threshold exceeded notification is only sent
+// if the scan wasn't already recorded when its findings were fetched.
+func (s *server) scanCompleted(ctx context.Context, account, repository, digest string, tags []string, findings *ImageScanFindings) error {
+	now := time.Now()
+
+	exceptions, err := s.listExceptions(ctx, account)
+	if err != nil {
+		return errors.Wrap(err, "failed to list exceptions")
+	}
+
+	group, name := splitRepositoryName(repository)
+	applyExceptions(exceptions, group, name, digest, findings, now)
+
+	snapshot := newFindingsSnapshot(repository, digest, tags, findings, now)
+	recorded, err := s.recordFindings(ctx, account, snapshot)
+	if err != nil {
+		return errors.Wrap(err, "failed to record findings history")
+	}
+
+	gate := evaluateGate(s.scanThresholds, snapshot)
+	if !gate.Passed {
+		log.Warnf("image %s@%s in account %s failed the scan gate: %v", repository, digest, account, gate.Violations)
+	}
+
+	s.notifier.notify(ctx, &Notification{
+		Type:    notificationScanCompleted,
+		Account: account,
+		Group:   group,
+		Time:    now.UTC(),
+		Data: &ScanCompletedNotification{
+			Repository:     repository,
+			ImageDigest:    digest,
+			ImageTags:      tags,
+			SeverityCounts: findings.severityCounts(),
+			Gate:           gate,
+		},
+	})
+
+	if recorded {
+		s.notifyScanGate(ctx, account, snapshot, gate)
+	}
+
+	return nil
+}
+
+// handleImageActionEvent sends notifications for successful image pushes and deletes
+func (s *server) handleImageActionEvent(ctx context.Context, e *events.Event) error {
+	detail, err := e.ImageAction()
+	if err != nil {
+		log.Errorf("failed to parse image action event %s: %s", e.Id, err)
+		return nil
+	}
+
+	if detail.Result != events.ResultSuccess {
+		log.Debugf("ignoring %s image action event %s with result %s", detail.ActionType, e.Id, detail.Result)
+		return nil
+	}
+
+	var notificationType string
+	switch detail.ActionType {
+	case events.ActionTypePush:
+		notificationType = notificationImagePushed
+	case events.ActionTypeDelete:
+		notificationType = notificationImageDeleted
+	default:
+		log.Debugf("ignoring %s image action event %s", detail.ActionType, e.Id)
+		return nil
+	}
+
+	group, _ := splitRepositoryName(detail.RepositoryName)
+
+	s.notifier.notify(ctx, &Notification{
+		Type:    notificationType,
+		Account: e.Account,
+		Group:   group,
+		Time:    e.Time.UTC(),
+		Data: &ImageActionNotification{
+			Repository:  detail.RepositoryName,
+			ImageDigest: detail.ImageDigest,
+			ImageTag:    detail.ImageTag,
+		},
+	})
+
+	return nil
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ecr-api/events"
+	"github.com/YaleSpinup/ecr-api/store"
+)
+
+// recordingNotifier keeps the notifications it's sent
+type recordingNotifier struct {
+	mu            sync.Mutex
+	notifications []*Notification
+}
+
+func (r *recordingNotifier) notify(ctx context.Context, n *Notification) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notifications = append(r.notifications, n)
+}
+
+func TestServer_scanCompleted(t *testing.T) {
+	ctx := context.Background()
+	n := &recordingNotifier{}
+	s := &server{
+		store:          store.NewMemoryStore(),
+		notifier:       n,
+		scanThresholds: map[string]int64{"HIGH": 0},
+	}
+
+	if _, err := s.createException(ctx, "12345", &CVEExceptionCreateRequest{
+		CVE:           "CVE-0000-0001",
+		Scope:         "repository",
+		Group:         "spindev-00001",
+		Repository:    "rudolph",
+		Justification: "not exploitable",
+		Approver:      "santa",
+		ExpiresAt:     time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("unexpected error creating exception: %s", err)
+	}
+
+	findings := testSnapshotFindings(testNow, map[string]int64{"HIGH": 2}, "CVE-0000-0001", "CVE-0000-0002")
+	if err := s.scanCompleted(ctx, "12345", "spindev-00001/rudolph", "sha256:0000", []string{"latest"}, findings); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	history, err := s.findingsHistory(ctx, "12345", "spindev-00001/rudolph")
+	if err != nil || len(history) != 1 {
+		t.Fatalf("expected 1 findings snapshot, got %d (%v)", len(history), err)
+	}
+
+	if history[0].SuppressedSeverityCounts["HIGH"] != 1 {
+		t.Errorf("expected 1 suppressed high finding in the snapshot, got %+v", history[0].SuppressedSeverityCounts)
+	}
+
+	if len(n.notifications) != 2 {
+		t.Fatalf("expected 2 notifications, got %d", len(n.notifications))
+	}
+
+	if n.notifications[1].Type != notificationScanThresholdExceeded {
+		t.Errorf("expected %s notification for the failed gate, got %s", notificationScanThresholdExceeded, n.notifications[1].Type)
+	}
+
+	notification := n.notifications[0]
+	if notification.Type != notificationScanCompleted || notification.Group != "spindev-00001" {
+		t.Errorf("unexpected notification %+v", notification)
+	}
+
+	data, ok := notification.Data.(*ScanCompletedNotification)
+	if !ok {
+		t.Fatalf("expected scan completed notification data, got %T", notification.Data)
+	}
+
+	if data.Gate.Passed || data.Gate.Violations["HIGH"] != 1 {
+		t.Errorf("expected gate to fail with 1 unsuppressed high finding, got %+v", data.Gate)
+	}
+
+	// the threshold isn't notified again for a scan that's already recorded
+	if err := s.scanCompleted(ctx, "12345", "spindev-00001/rudolph", "sha256:0000", []string{"latest"}, findings); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(n.notifications) != 3 || n.notifications[2].Type != notificationScanCompleted {
+		t.Errorf("expected only a scan completed notification for the recorded scan, got %d notifications", len(n.notifications))
+	}
+}
+
+func TestServer_handleEvent(t *testing.T) {
+	detail := func(action, result string) json.RawMessage {
+		b, _ := json.Marshal(events.ImageActionDetail{
+			ActionType:     action,
+			Result:         result,
+			RepositoryName: "spindev-00001/rudolph",
+			ImageDigest:    "sha256:0000",
+			ImageTag:       "latest",
+		})
+		return b
+	}
+
+	tests := []struct {
+		name  string
+		event *events.Event
+		want  string
+	}{
+		{
+			name:  "push",
+			event: &events.Event{DetailType: events.DetailTypeImageAction, Account: "12345", Detail: detail("PUSH", "SUCCESS")},
+			want:  notificationImagePushed,
+		},
+		{
+			name:  "delete",
+			event: &events.Event{DetailType: events.DetailTypeImageAction, Account: "12345", Detail: detail("DELETE", "SUCCESS")},
+			want:  notificationImageDeleted,
+		},
+		{
+			name:  "failed push",
+			event: &events.Event{DetailType: events.DetailTypeImageAction, Account: "12345", Detail: detail("PUSH", "FAILURE")},
+		},
+		{
+			name:  "bad detail",
+			event: &events.Event{DetailType: events.DetailTypeImageAction, Account: "12345", Detail: json.RawMessage(`"nope"`)},
+		},
+		{
+			name:  "failed scan",
+			event: &events.Event{DetailType: events.DetailTypeImageScan, Account: "12345", Detail: json.RawMessage(`{"scan-status":"FAILED","repository-name":"spindev-00001/rudolph"}`)},
+		},
+		{
+			name:  "failed inspector scan",
+			event: &events.Event{DetailType: events.DetailTypeInspectorScan, Account: "12345", Detail: json.RawMessage(`{"scan-status":"FAILED","repository-name":"arn:aws:ecr:us-east-1:12345:repository/spindev-00001/rudolph"}`)},
+		},
+		{
+			name:  "other event",
+			event: &events.Event{DetailType: "ECR Replication Action", Account: "12345"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := &recordingNotifier{}
+			s := &server{notifier: n}
+
+			if err := s.handleEvent(context.Background(), tt.event); err != nil {
+				t.Errorf("unexpected error handling event: %s", err)
+			}
+
+			if tt.want == "" {
+				if len(n.notifications) != 0 {
+					t.Errorf("expected no notifications, got %+v", n.notifications)
+				}
+				return
+			}
+
+			if len(n.notifications) != 1 || n.notifications[0].Type != tt.want || n.notifications[0].Group != "spindev-00001" {
+				t.Errorf("expected %s notification, got %+v", tt.want, n.notifications)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/ecr-api/store"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// exceptionsBucket is the store bucket for CVE exceptions, keyed by {account}/{id}
+const exceptionsBucket = "exceptions"
+
+const (
+	exceptionScopeOrg        = "org"
+	exceptionScopeGroup      = "group"
+	exceptionScopeRepository = "repository"
+	exceptionScopeImage      = "image"
+)
+
+// validate checks the CVE exception create request
+func (req *CVEExceptionCreateRequest) validate(now time.Time) error {
+	if req.CVE == "" {
+		return apierror.New(apierror.ErrBadRequest, "cve is required", nil)
+	}
+
+	if req.Justification == "" {
+		return apierror.New(apierror.ErrBadRequest, "justification is required", nil)
+	}
+
+	if req.Approver == "" {
+		return apierror.New(apierror.ErrBadRequest, "approver is required", nil)
+	}
+
+	if req.ExpiresAt.IsZero() || !req.ExpiresAt.After(now) {
+		return apierror.New(apierror.ErrBadRequest, "expiresat is required and must be in the future", nil)
+	}
+
+	switch req.Scope {
+	case exceptionScopeOrg:
+	case exceptionScopeGroup:
+		if req.Group == "" {
+			return apierror.New(apierror.ErrBadRequest, "group is required for group scope", nil)
+		}
+	case exceptionScopeRepository:
+		if req.Group == "" || req.Repository == "" {
+			return apierror.New(apierror.ErrBadRequest, "group and repository are required for repository scope", nil)
+		}
+	case exceptionScopeImage:
+		if req.Group == "" || req.Repository == "" || req.ImageDigest == "" {
+			return apierror.New(apierror.ErrBadRequest, "group, repository and imagedigest are required for image scope", nil)
+		}
+	default:
+		msg := fmt.Sprintf("invalid scope '%s', must be one of org, group, repository or image", req.Scope)
+		return apierror.New(apierror.ErrBadRequest, msg, nil)
+	}
+
+	return nil
+}
+
+// matches returns true if the exception is active and applies to the cve in the given image
+func (e *CVEException) matches(cve, group, name, digest string, now time.Time) bool {
+	if !now.Before(e.ExpiresAt) {
+		return false
+	}
+
+	if !strings.EqualFold(e.CVE, cve) {
+		return false
+	}
+
+	switch e.Scope {
+	case exceptionScopeOrg:
+		return true
+	case exceptionScopeGroup:
+		return e.Group == group
+	case exceptionScopeRepository:
+		return e.Group == group && e.Repository == name
+	case exceptionScopeImage:
+		return e.Group == group && e.Repository == name && e.ImageDigest == digest
+	}
+
+	return false
+}
+
+// applyExceptions marks the findings that match an active exception as suppressed and
+// tallies the suppressed severity counts
+func applyExceptions(exceptions []*CVEException, group, name, digest string, findings *ImageScanFindings, now time.Time) {
+	if findings == nil || len(exceptions) == 0 {
+		return
+	}
+
+	suppressed := map[string]int64{}
+	for _, f := range findings.Findings {
+		if f.ImageScanFinding == nil {
+			continue
+		}
+
+		for _, e := range exceptions {
+			if !e.matches(aws.StringValue(f.Name), group, name, digest, now) {
+				continue
+			}
+
+			log.Debugf("finding %s in %s/%s@%s suppressed by exception %s", aws.StringValue(f.Name), group, name, digest, e.Id)
+
+			f.Suppressed = true
+			f.ExceptionId = e.Id
+			f.ExceptionJustification = e.Justification
+			suppressed[aws.StringValue(f.Severity)]++
+			break
+		}
+	}
+
+	for _, f := range findings.EnhancedFindings {
+		cve := f.VulnerabilityId()
+		if cve == "" {
+			continue
+		}
+
+		for _, e := range exceptions {
+			if !e.matches(cve, group, name, digest, now) {
+				continue
+			}
+
+			log.Debugf("enhanced finding %s in %s/%s@%s suppressed by exception %s", cve, group, name, digest, e.Id)
+
+			f.Suppressed = true
+			f.ExceptionId = e.Id
+			f.ExceptionJustification = e.Justification
+			suppressed[aws.StringValue(f.Severity)]++
+			break
+		}
+	}
+
+	if len(suppressed) > 0 {
+		findings.SuppressedSeverityCounts = suppressed
+	}
+}
+
+// splitRepositoryName splits a repository name in the format {group}/{name}
+func splitRepositoryName(repository string) (string, string) {
+	parts := strings.SplitN(repository, "/", 2)
+	if len(parts) != 2 {
+		return "", repository
+	}
+	return parts[0], parts[1]
+}
+
+// createException validates and stores a new CVE exception
+func (s *server) createException(ctx context.Context, account string, req *CVEExceptionCreateRequest) (*CVEException, error) {
+	now := time.Now().UTC()
+	if err := req.validate(now); err != nil {
+		return nil, err
+	}
+
+	e := &CVEException{
+		Id:            uuid.New().String(),
+		Account:       account,
+		CVE:           req.CVE,
+		Scope:         req.Scope,
+		Justification: req.Justification,
+		Approver:      req.Approver,
+		CreatedAt:     now,
+		ExpiresAt:     req.ExpiresAt.UTC(),
+	}
+
+	// only keep the fields relevant to the scope
+	switch req.Scope {
+	case exceptionScopeImage:
+		e.ImageDigest = req.ImageDigest
+		fallthrough
+	case exceptionScopeRepository:
+		e.Repository = req.Repository
+		fallthrough
+	case exceptionScopeGroup:
+		e.Group = req.Group
+	}
+
+	log.Infof("creating %s exception %s for %s approved by %s", e.Scope, e.Id, e.CVE, e.Approver)
+
+	if err := store.PutJSON(ctx, s.store, exceptionsBucket, account+"/"+e.Id, e); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// getException gets a CVE exception by id
+func (s *server) getException(ctx context.Context, account, id string) (*CVEException, error) {
+	e := &CVEException{}
+	if err := store.GetJSON(ctx, s.store, exceptionsBucket, account+"/"+id, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// deleteException deletes a CVE exception by id
+func (s *server) deleteException(ctx context.Context, account, id string) error {
+	if _, err := s.getException(ctx, account, id); err != nil {
+		return err
+	}
+
+	log.Infof("deleting exception %s", id)
+
+	return s.store.Delete(ctx, exceptionsBucket, account+"/"+id)
+}
+
+// listExceptions lists the CVE exceptions for an account, sorted by creation time
+func (s *server) listExceptions(ctx context.Context, account string) ([]*CVEException, error) {
+	items, err := s.store.List(ctx, exceptionsBucket, account+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	exceptions := make([]*CVEException, 0, len(items))
+	for k, v := range items {
+		e := &CVEException{}
+		if err := json.Unmarshal(v, e); err != nil {
+			log.Errorf("failed to decode exception %s: %s", k, err)
+			continue
+		}
+		exceptions = append(exceptions, e)
+	}
+
+	sort.Slice(exceptions, func(i, j int) bool {
+		return exceptions[i].CreatedAt.Before(exceptions[j].CreatedAt)
+	})
+
+	return exceptions, nil
+}
@@ -0,0 +1,312 @@
+package api
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ecr-api/store"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+var testNow = time.Date(2021, time.March, 11, 17, 27, 30, 0, time.UTC)
+
+func TestCVEExceptionCreateRequest_validate(t *testing.T) {
+	expires := testNow.Add(24 * time.Hour)
+
+	tests := []struct {
+		name    string
+		req     CVEExceptionCreateRequest
+		wantErr bool
+	}{
+		{
+			name:    "empty",
+			req:     CVEExceptionCreateRequest{},
+			wantErr: true,
+		},
+		{
+			name: "org scope",
+			req: CVEExceptionCreateRequest{
+				CVE:           "CVE-2019-25013",
+				Scope:         "org",
+				Justification: "not exploitable",
+				Approver:      "santa",
+				ExpiresAt:     expires,
+			},
+		},
+		{
+			name: "expired",
+			req: CVEExceptionCreateRequest{
+				CVE:           "CVE-2019-25013",
+				Scope:         "org",
+				Justification: "not exploitable",
+				Approver:      "santa",
+				ExpiresAt:     testNow.Add(-1 * time.Hour),
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing approver",
+			req: CVEExceptionCreateRequest{
+				CVE:           "CVE-2019-25013",
+				Scope:         "org",
+				Justification: "not exploitable",
+				ExpiresAt:     expires,
+			},
+			wantErr: true,
+		},
+		{
+			name: "group scope without group",
+			req: CVEExceptionCreateRequest{
+				CVE:           "CVE-2019-25013",
+				Scope:         "group",
+				Justification: "not exploitable",
+				Approver:      "santa",
+				ExpiresAt:     expires,
+			},
+			wantErr: true,
+		},
+		{
+			name: "repository scope",
+			req: CVEExceptionCreateRequest{
+				CVE:           "CVE-2019-25013",
+				Scope:         "repository",
+				Group:         "spindev-00001",
+				Repository:    "rudolph",
+				Justification: "not exploitable",
+				Approver:      "santa",
+				ExpiresAt:     expires,
+			},
+		},
+		{
+			name: "image scope without digest",
+			req: CVEExceptionCreateRequest{
+				CVE:           "CVE-2019-25013",
+				Scope:         "image",
+				Group:         "spindev-00001",
+				Repository:    "rudolph",
+				Justification: "not exploitable",
+				Approver:      "santa",
+				ExpiresAt:     expires,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid scope",
+			req: CVEExceptionCreateRequest{
+				CVE:           "CVE-2019-25013",
+				Scope:         "universe",
+				Justification: "not exploitable",
+				Approver:      "santa",
+				ExpiresAt:     expires,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.req.validate(testNow); (err != nil) != tt.wantErr {
+				t.Errorf("CVEExceptionCreateRequest.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_applyExceptions(t *testing.T) {
+	exceptions := []*CVEException{
+		{
+			Id:            "org",
+			CVE:           "CVE-0000-0001",
+			Scope:         "org",
+			Justification: "not exploitable",
+			ExpiresAt:     testNow.Add(time.Hour),
+		},
+		{
+			Id:        "expired",
+			CVE:       "CVE-0000-0002",
+			Scope:     "org",
+			ExpiresAt: testNow.Add(-1 * time.Hour),
+		},
+		{
+			Id:        "group",
+			CVE:       "CVE-0000-0003",
+			Scope:     "group",
+			Group:     "spindev-00001",
+			ExpiresAt: testNow.Add(time.Hour),
+		},
+		{
+			Id:         "repository",
+			CVE:        "cve-0000-0004",
+			Scope:      "repository",
+			Group:      "spindev-00001",
+			Repository: "rudolph",
+			ExpiresAt:  testNow.Add(time.Hour),
+		},
+		{
+			Id:          "image",
+			CVE:         "CVE-0000-0005",
+			Scope:       "image",
+			Group:       "spindev-00001",
+			Repository:  "rudolph",
+			ImageDigest: "sha256:0000",
+			ExpiresAt:   testNow.Add(time.Hour),
+		},
+		{
+			Id:          "otherimage",
+			CVE:         "CVE-0000-0006",
+			Scope:       "image",
+			Group:       "spindev-00001",
+			Repository:  "rudolph",
+			ImageDigest: "sha256:1111",
+			ExpiresAt:   testNow.Add(time.Hour),
+		},
+		{
+			Id:        "othergroup",
+			CVE:       "CVE-0000-0007",
+			Scope:     "group",
+			Group:     "spindev-00002",
+			ExpiresAt: testNow.Add(time.Hour),
+		},
+	}
+
+	findings := imageScanFindingsFromECR(&ecr.ImageScanFindings{
+		Findings: []*ecr.ImageScanFinding{
+			{Name: aws.String("CVE-0000-0001"), Severity: aws.String("HIGH")},
+			{Name: aws.String("CVE-0000-0002"), Severity: aws.String("HIGH")},
+			{Name: aws.String("CVE-0000-0003"), Severity: aws.String("MEDIUM")},
+			{Name: aws.String("CVE-0000-0004"), Severity: aws.String("LOW")},
+			{Name: aws.String("CVE-0000-0005"), Severity: aws.String("HIGH")},
+			{Name: aws.String("CVE-0000-0006"), Severity: aws.String("HIGH")},
+			{Name: aws.String("CVE-0000-0007"), Severity: aws.String("HIGH")},
+			{Name: aws.String("CVE-0000-0008"), Severity: aws.String("HIGH")},
+		},
+		EnhancedFindings: []*ecr.EnhancedImageScanFinding{
+			{
+				FindingArn: aws.String("arn:aws:inspector2:us-east-1:12345:finding/0001"),
+				PackageVulnerabilityDetails: &ecr.PackageVulnerabilityDetails{
+					VulnerabilityId: aws.String("CVE-0000-0001"),
+				},
+				Severity: aws.String("CRITICAL"),
+			},
+			{
+				FindingArn: aws.String("arn:aws:inspector2:us-east-1:12345:finding/0009"),
+				PackageVulnerabilityDetails: &ecr.PackageVulnerabilityDetails{
+					VulnerabilityId: aws.String("CVE-0000-0009"),
+				},
+				Severity: aws.String("CRITICAL"),
+			},
+		},
+	}, nil)
+
+	applyExceptions(exceptions, "spindev-00001", "rudolph", "sha256:0000", findings, testNow)
+
+	expected := map[string]string{
+		"CVE-0000-0001": "org",
+		"CVE-0000-0002": "",
+		"CVE-0000-0003": "group",
+		"CVE-0000-0004": "repository",
+		"CVE-0000-0005": "image",
+		"CVE-0000-0006": "",
+		"CVE-0000-0007": "",
+		"CVE-0000-0008": "",
+	}
+
+	for _, f := range findings.Findings {
+		name := aws.StringValue(f.Name)
+		if f.ExceptionId != expected[name] {
+			t.Errorf("expected finding %s to have exception '%s', got '%s'", name, expected[name], f.ExceptionId)
+		}
+
+		if f.Suppressed != (expected[name] != "") {
+			t.Errorf("unexpected suppressed value %t for finding %s", f.Suppressed, name)
+		}
+	}
+
+	if !findings.EnhancedFindings[0].Suppressed || findings.EnhancedFindings[0].ExceptionId != "org" || findings.EnhancedFindings[0].ExceptionJustification != "not exploitable" {
+		t.Errorf("expected enhanced finding CVE-0000-0001 to be suppressed by org exception, got %+v", findings.EnhancedFindings[0])
+	}
+
+	if findings.EnhancedFindings[1].Suppressed {
+		t.Errorf("expected enhanced finding CVE-0000-0009 not to be suppressed")
+	}
+
+	expectedCounts := map[string]int64{"CRITICAL": 1, "HIGH": 2, "MEDIUM": 1, "LOW": 1}
+	if !reflect.DeepEqual(findings.SuppressedSeverityCounts, expectedCounts) {
+		t.Errorf("expected suppressed counts %v, got %v", expectedCounts, findings.SuppressedSeverityCounts)
+	}
+
+	// nil findings shouldn't panic
+	applyExceptions(exceptions, "spindev-00001", "rudolph", "sha256:0000", nil, testNow)
+}
+
+func Test_splitRepositoryName(t *testing.T) {
+	tests := []struct {
+		repository string
+		group      string
+		name       string
+	}{
+		{"spindev-00001/rudolph", "spindev-00001", "rudolph"},
+		{"spindev-00001/reindeer/rudolph", "spindev-00001", "reindeer/rudolph"},
+		{"rudolph", "", "rudolph"},
+	}
+	for _, tt := range tests {
+		group, name := splitRepositoryName(tt.repository)
+		if group != tt.group || name != tt.name {
+			t.Errorf("splitRepositoryName(%s) = %s, %s, want %s, %s", tt.repository, group, name, tt.group, tt.name)
+		}
+	}
+}
+
+func TestServer_exceptions(t *testing.T) {
+	ctx := context.Background()
+	s := &server{store: store.NewMemoryStore()}
+
+	e, err := s.createException(ctx, "12345", &CVEExceptionCreateRequest{
+		CVE:           "CVE-2019-25013",
+		Scope:         "group",
+		Group:         "spindev-00001",
+		Repository:    "ignored",
+		Justification: "glibc false positive",
+		Approver:      "santa",
+		ExpiresAt:     time.Now().Add(24 * time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating exception: %s", err)
+	}
+
+	if e.Repository != "" {
+		t.Errorf("expected repository to be dropped for group scope, got %s", e.Repository)
+	}
+
+	if _, err := s.createException(ctx, "12345", &CVEExceptionCreateRequest{}); err == nil {
+		t.Error("expected error for invalid exception, got nil")
+	}
+
+	list, err := s.listExceptions(ctx, "12345")
+	if err != nil {
+		t.Errorf("unexpected error listing exceptions: %s", err)
+	}
+
+	if len(list) != 1 || list[0].Id != e.Id {
+		t.Errorf("expected list with exception %s, got %+v", e.Id, list)
+	}
+
+	list, err = s.listExceptions(ctx, "67890")
+	if err != nil {
+		t.Errorf("unexpected error listing exceptions: %s", err)
+	}
+
+	if len(list) != 0 {
+		t.Errorf("expected empty list for other account, got %+v", list)
+	}
+
+	if err := s.deleteException(ctx, "12345", e.Id); err != nil {
+		t.Errorf("unexpected error deleting exception: %s", err)
+	}
+
+	if err := s.deleteException(ctx, "12345", e.Id); err == nil {
+		t.Error("expected error deleting missing exception, got nil")
+	}
+}
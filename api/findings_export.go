@@ -0,0 +1,640 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/google/uuid"
+)
+
+const (
+	findingsFormatJSON  = "json"
+	findingsFormatSARIF = "sarif"
+	findingsFormatCSV   = "csv"
+	findingsFormatVEX   = "vex"
+)
+
+// findingsContentTypes maps the export formats to their media types
+var findingsContentTypes = map[string]string{
+	findingsFormatJSON:  "application/json",
+	findingsFormatSARIF: "application/sarif+json",
+	findingsFormatCSV:   "text/csv",
+	findingsFormatVEX:   "application/vnd.cyclonedx+json",
+}
+
+// findingsFormat determines the requested findings export format from the 'format' query
+// parameter, falling back to the Accept header and finally to the native JSON
+func findingsFormat(r *http.Request) (string, error) {
+	if f := r.URL.Query().Get("format"); f != "" {
+		f = strings.ToLower(f)
+		if f == "cyclonedx" {
+			f = findingsFormatVEX
+		}
+
+		if _, ok := findingsContentTypes[f]; !ok {
+			msg := fmt.Sprintf("unsupported findings format '%s', must be one of json, sarif, csv or vex", f)
+			return "", apierror.New(apierror.ErrBadRequest, msg, nil)
+		}
+
+		return f, nil
+	}
+
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(accept, ";", 2)[0])
+		for f, t := range findingsContentTypes {
+			if strings.EqualFold(mediaType, t) {
+				return f, nil
+			}
+		}
+	}
+
+	return findingsFormatJSON, nil
+}
+
+// findingRecord is a single scan finding flattened for export
+type findingRecord struct {
+	Repository     string
+	ImageDigest    string
+	Name           string
+	Description    string
+	Uri            string
+	Severity       string
+	PackageName    string
+	PackageVersion string
+	CVSS2Score     string
+	CVSS2Vector    string
+	CVSS3Score     string
+	CVSS3Vector    string
+	Suppressed     bool
+	ExceptionId    string
+	// ExceptionJustification is why the risk of a suppressed finding is accepted
+	ExceptionJustification string
+
+	// only set for enhanced findings
+	FixAvailable     string
+	FixedInVersion   string
+	ExploitAvailable string
+}
+
+// findingRecordsFromFindings flattens the scan findings of an image for export
+func findingRecordsFromFindings(repository, digest string, findings *ImageScanFindings) []*findingRecord {
+	if findings == nil {
+		return []*findingRecord{}
+	}
+
+	records := make([]*findingRecord, 0, len(findings.Findings))
+	for _, f := range findings.Findings {
+		if f.ImageScanFinding == nil {
+			continue
+		}
+
+		record := &findingRecord{
+			Repository:             repository,
+			ImageDigest:            digest,
+			Name:                   aws.StringValue(f.Name),
+			Description:            aws.StringValue(f.Description),
+			Uri:                    aws.StringValue(f.Uri),
+			Severity:               aws.StringValue(f.Severity),
+			Suppressed:             f.Suppressed,
+			ExceptionId:            f.ExceptionId,
+			ExceptionJustification: f.ExceptionJustification,
+		}
+
+		for _, a := range f.Attributes {
+			v := aws.StringValue(a.Value)
+			switch aws.StringValue(a.Key) {
+			case "package_name":
+				record.PackageName = v
+			case "package_version":
+				record.PackageVersion = v
+			case "CVSS2_SCORE":
+				record.CVSS2Score = v
+			case "CVSS2_VECTOR":
+				record.CVSS2Vector = v
+			case "CVSS3_SCORE":
+				record.CVSS3Score = v
+			case "CVSS3_VECTOR":
+				record.CVSS3Vector = v
+			}
+		}
+
+		records = append(records, record)
+	}
+
+	for _, f := range findings.EnhancedFindings {
+		if f.EnhancedImageScanFinding == nil {
+			continue
+		}
+		records = append(records, enhancedFindingRecords(repository, digest, f)...)
+	}
+
+	return records
+}
+
+// enhancedFindingRecords flattens an enhanced finding into a record per vulnerable package
+func enhancedFindingRecords(repository, digest string, f *EnhancedImageScanFinding) []*findingRecord {
+	record := findingRecord{
+		Repository:             repository,
+		ImageDigest:            digest,
+		Name:                   f.VulnerabilityId(),
+		Description:            aws.StringValue(f.Description),
+		Severity:               aws.StringValue(f.Severity),
+		Suppressed:             f.Suppressed,
+		ExceptionId:            f.ExceptionId,
+		FixAvailable:           f.FixAvailable,
+		ExploitAvailable:       f.ExploitAvailable,
+		ExceptionJustification: f.ExceptionJustification,
+	}
+
+	if record.Name == "" {
+		record.Name = aws.StringValue(f.Title)
+	}
+
+	details := f.PackageVulnerabilityDetails
+	if details == nil {
+		return []*findingRecord{&record}
+	}
+
+	record.Uri = aws.StringValue(details.SourceUrl)
+	for _, c := range details.Cvss {
+		score := strconv.FormatFloat(aws.Float64Value(c.BaseScore), 'f', -1, 64)
+		switch v := aws.StringValue(c.Version); {
+		case strings.HasPrefix(v, "2") && record.CVSS2Score == "":
+			record.CVSS2Score, record.CVSS2Vector = score, aws.StringValue(c.ScoringVector)
+		case strings.HasPrefix(v, "3") && record.CVSS3Score == "":
+			record.CVSS3Score, record.CVSS3Vector = score, aws.StringValue(c.ScoringVector)
+		}
+	}
+
+	if len(details.VulnerablePackages) == 0 {
+		return []*findingRecord{&record}
+	}
+
+	records := make([]*findingRecord, 0, len(details.VulnerablePackages))
+	for _, p := range details.VulnerablePackages {
+		r := record
+		r.PackageName = aws.StringValue(p.Name)
+		r.PackageVersion = aws.StringValue(p.Version)
+		r.FixedInVersion = f.FixedInVersions[r.PackageName]
+		records = append(records, &r)
+	}
+
+	return records
+}
+
+// findingRecordsFromOutputs flattens the scan findings for a list of images for export
+func findingRecordsFromOutputs(outputs []*ImageScanFindingsOutput) []*findingRecord {
+	records := []*findingRecord{}
+	for _, o := range outputs {
+		var digest string
+		if o.ImageId != nil {
+			digest = aws.StringValue(o.ImageId.ImageDigest)
+		}
+		records = append(records, findingRecordsFromFindings(o.RepositoryName, digest, o.ImageScanFindings)...)
+	}
+	return records
+}
+
+// writeFindings renders the finding records in the requested export format
+func writeFindings(w http.ResponseWriter, format string, records []*findingRecord) {
+	var out []byte
+	var err error
+
+	switch format {
+	case findingsFormatSARIF:
+		out, err = sarifReport(records)
+	case findingsFormatCSV:
+		out, err = csvReport(records)
+	case findingsFormatVEX:
+		out, err = vexReport(records, time.Now().UTC())
+	default:
+		err = fmt.Errorf("unsupported findings export format %s", format)
+	}
+
+	if err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to export findings", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", findingsContentTypes[format])
+	w.WriteHeader(http.StatusOK)
+	w.Write(out)
+}
+
+// csvReport renders the finding records as CSV with a header row
+func csvReport(records []*findingRecord) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	cw := csv.NewWriter(buf)
+
+	if err := cw.Write([]string{
+		"repository",
+		"image_digest",
+		"name",
+		"severity",
+		"package_name",
+		"package_version",
+		"cvss2_score",
+		"cvss2_vector",
+		"cvss3_score",
+		"cvss3_vector",
+		"uri",
+		"suppressed",
+		"exception_id",
+		"fix_available",
+		"fixed_in_version",
+		"exploit_available",
+		"description",
+	}); err != nil {
+		return nil, err
+	}
+
+	for _, r := range records {
+		if err := cw.Write([]string{
+			r.Repository,
+			r.ImageDigest,
+			r.Name,
+			r.Severity,
+			r.PackageName,
+			r.PackageVersion,
+			r.CVSS2Score,
+			r.CVSS2Vector,
+			r.CVSS3Score,
+			r.CVSS3Vector,
+			r.Uri,
+			strconv.FormatBool(r.Suppressed),
+			r.ExceptionId,
+			r.FixAvailable,
+			r.FixedInVersion,
+			r.ExploitAvailable,
+			r.Description,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationUri string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	Id                   string                 `json:"id"`
+	ShortDescription     sarifMessage           `json:"shortDescription"`
+	FullDescription      sarifMessage           `json:"fullDescription"`
+	HelpUri              string                 `json:"helpUri,omitempty"`
+	DefaultConfiguration sarifConfiguration     `json:"defaultConfiguration"`
+	Properties           map[string]interface{} `json:"properties"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleId       string             `json:"ruleId"`
+	Level        string             `json:"level"`
+	Message      sarifMessage       `json:"message"`
+	Locations    []sarifLocation    `json:"locations"`
+	Suppressions []sarifSuppression `json:"suppressions,omitempty"`
+	Properties   map[string]string  `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	Uri string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+type sarifSuppression struct {
+	Kind          string `json:"kind"`
+	Justification string `json:"justification,omitempty"`
+}
+
+// sarifLevel maps a finding severity to a SARIF result level
+func sarifLevel(severity string) string {
+	switch strings.ToUpper(severity) {
+	case "CRITICAL", "HIGH":
+		return "error"
+	case "MEDIUM":
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+// securitySeverity returns the numeric severity for a finding, preferring the CVSS3 score
+// and falling back to an approximation of the severity rating
+func securitySeverity(r *findingRecord) string {
+	if r.CVSS3Score != "" {
+		return r.CVSS3Score
+	}
+
+	if r.CVSS2Score != "" {
+		return r.CVSS2Score
+	}
+
+	switch strings.ToUpper(r.Severity) {
+	case "CRITICAL":
+		return "9.5"
+	case "HIGH":
+		return "8.0"
+	case "MEDIUM":
+		return "5.5"
+	case "LOW":
+		return "2.0"
+	}
+
+	return "0.0"
+}
+
+// sarifReport renders the finding records as a SARIF 2.1.0 log for code scanning tools
+func sarifReport(records []*findingRecord) ([]byte, error) {
+	rules := []sarifRule{}
+	seen := map[string]bool{}
+	results := make([]sarifResult, 0, len(records))
+
+	for _, r := range records {
+		if !seen[r.Name] {
+			seen[r.Name] = true
+			rules = append(rules, sarifRule{
+				Id:                   r.Name,
+				ShortDescription:     sarifMessage{Text: r.Name},
+				FullDescription:      sarifMessage{Text: r.Description},
+				HelpUri:              r.Uri,
+				DefaultConfiguration: sarifConfiguration{Level: sarifLevel(r.Severity)},
+				Properties: map[string]interface{}{
+					"security-severity": securitySeverity(r),
+					"tags":              []string{"security", "vulnerability", strings.ToLower(r.Severity)},
+				},
+			})
+		}
+
+		result := sarifResult{
+			RuleId:  r.Name,
+			Level:   sarifLevel(r.Severity),
+			Message: sarifMessage{Text: fmt.Sprintf("%s %s: %s severity vulnerability %s", r.PackageName, r.PackageVersion, r.Severity, r.Name)},
+			Locations: []sarifLocation{
+				{
+					PhysicalLocation: sarifPhysicalLocation{
+						ArtifactLocation: sarifArtifactLocation{Uri: r.Repository + "@" + r.ImageDigest},
+						Region:           sarifRegion{StartLine: 1},
+					},
+				},
+			},
+		}
+
+		if r.FixAvailable != "" || r.ExploitAvailable != "" {
+			result.Properties = map[string]string{
+				"fixAvailable":     r.FixAvailable,
+				"fixedInVersion":   r.FixedInVersion,
+				"exploitAvailable": r.ExploitAvailable,
+			}
+		}
+
+		if r.Suppressed {
+			result.Suppressions = []sarifSuppression{
+				{
+					Kind:          "external",
+					Justification: "suppressed by exception " + r.ExceptionId,
+				},
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	return json.Marshal(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{
+			{
+				Tool: sarifTool{
+					Driver: sarifDriver{
+						Name:           "ecr-api",
+						InformationUri: "https://github.com/YaleSpinup/ecr-api",
+						Rules:          rules,
+					},
+				},
+				Results: results,
+			},
+		},
+	})
+}
+
+type cycloneDXBOM struct {
+	BOMFormat       string                   `json:"bomFormat"`
+	SpecVersion     string                   `json:"specVersion"`
+	SerialNumber    string                   `json:"serialNumber"`
+	Version         int                      `json:"version"`
+	Metadata        cycloneDXMetadata        `json:"metadata"`
+	Components      []cycloneDXComponent     `json:"components"`
+	Vulnerabilities []cycloneDXVulnerability `json:"vulnerabilities"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string          `json:"timestamp"`
+	Tools     []cycloneDXTool `json:"tools"`
+}
+
+type cycloneDXTool struct {
+	Vendor string `json:"vendor"`
+	Name   string `json:"name"`
+}
+
+type cycloneDXComponent struct {
+	BOMRef  string `json:"bom-ref"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type cycloneDXVulnerability struct {
+	BOMRef         string            `json:"bom-ref"`
+	Id             string            `json:"id"`
+	Source         *cycloneDXSource  `json:"source,omitempty"`
+	Ratings        []cycloneDXRating `json:"ratings"`
+	Description    string            `json:"description,omitempty"`
+	Recommendation string            `json:"recommendation,omitempty"`
+	Analysis       cycloneDXAnalysis `json:"analysis"`
+	Affects        []cycloneDXAffect `json:"affects"`
+}
+
+type cycloneDXSource struct {
+	Url string `json:"url"`
+}
+
+type cycloneDXRating struct {
+	Score    float64 `json:"score,omitempty"`
+	Severity string  `json:"severity"`
+	Method   string  `json:"method,omitempty"`
+	Vector   string  `json:"vector,omitempty"`
+}
+
+type cycloneDXAnalysis struct {
+	State    string   `json:"state"`
+	Response []string `json:"response,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+type cycloneDXAffect struct {
+	Ref string `json:"ref"`
+}
+
+// cycloneDXSeverity maps a finding severity to a CycloneDX severity
+func cycloneDXSeverity(severity string) string {
+	switch s := strings.ToLower(severity); s {
+	case "critical", "high", "medium", "low":
+		return s
+	case "informational":
+		return "info"
+	default:
+		return "unknown"
+	}
+}
+
+// vexReport renders the finding records as a CycloneDX 1.4 VEX document.  Each image is a container
+// component and each vulnerable package a library component.  Suppressed findings are marked
+// as not affected, everything else is in triage.
+func vexReport(records []*findingRecord, now time.Time) ([]byte, error) {
+	components := []cycloneDXComponent{}
+	seen := map[string]bool{}
+	addComponent := func(c cycloneDXComponent) {
+		if seen[c.BOMRef] {
+			return
+		}
+		seen[c.BOMRef] = true
+		components = append(components, c)
+	}
+
+	vulnerabilities := make([]cycloneDXVulnerability, 0, len(records))
+	for _, r := range records {
+		image := r.Repository + "@" + r.ImageDigest
+		addComponent(cycloneDXComponent{
+			BOMRef:  image,
+			Type:    "container",
+			Name:    r.Repository,
+			Version: r.ImageDigest,
+		})
+
+		ref := image
+		if r.PackageName != "" {
+			ref = image + "#" + r.PackageName + "@" + r.PackageVersion
+			addComponent(cycloneDXComponent{
+				BOMRef:  ref,
+				Type:    "library",
+				Name:    r.PackageName,
+				Version: r.PackageVersion,
+			})
+		}
+
+		ratings := []cycloneDXRating{}
+		if score, err := strconv.ParseFloat(r.CVSS3Score, 64); err == nil {
+			ratings = append(ratings, cycloneDXRating{Score: score, Severity: cycloneDXSeverity(r.Severity), Method: "CVSSv3", Vector: r.CVSS3Vector})
+		}
+		if score, err := strconv.ParseFloat(r.CVSS2Score, 64); err == nil {
+			ratings = append(ratings, cycloneDXRating{Score: score, Severity: cycloneDXSeverity(r.Severity), Method: "CVSSv2", Vector: r.CVSS2Vector})
+		}
+		if len(ratings) == 0 {
+			ratings = append(ratings, cycloneDXRating{Severity: cycloneDXSeverity(r.Severity)})
+		}
+
+		// an exception accepts the risk of the vulnerability, it doesn't mean the image isn't affected
+		analysis := cycloneDXAnalysis{State: "in_triage"}
+		if r.Suppressed {
+			analysis = cycloneDXAnalysis{
+				State:    "exploitable",
+				Response: []string{"will_not_fix"},
+				Detail:   r.ExceptionJustification,
+			}
+		}
+
+		v := cycloneDXVulnerability{
+			BOMRef:      r.Name + "/" + ref,
+			Id:          r.Name,
+			Ratings:     ratings,
+			Description: r.Description,
+			Analysis:    analysis,
+			Affects:     []cycloneDXAffect{{Ref: ref}},
+		}
+
+		if r.FixedInVersion != "" {
+			v.Recommendation = fmt.Sprintf("Upgrade %s to version %s", r.PackageName, r.FixedInVersion)
+		}
+
+		if r.Uri != "" {
+			v.Source = &cycloneDXSource{Url: r.Uri}
+		}
+
+		vulnerabilities = append(vulnerabilities, v)
+	}
+
+	sort.SliceStable(components, func(i, j int) bool {
+		return components[i].BOMRef < components[j].BOMRef
+	})
+
+	return json.Marshal(cycloneDXBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.4",
+		SerialNumber: "urn:uuid:" + uuid.New().String(),
+		Version:      1,
+		Metadata: cycloneDXMetadata{
+			Timestamp: now.Format(time.RFC3339),
+			Tools: []cycloneDXTool{
+				{
+					Vendor: "Yale University",
+					Name:   "ecr-api",
+				},
+			},
+		},
+		Components:      components,
+		Vulnerabilities: vulnerabilities,
+	})
+}
@@ -0,0 +1,286 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+var testFindings = &ImageScanFindings{
+	Findings: []*ImageScanFinding{
+		{
+			ImageScanFinding: &ecr.ImageScanFinding{
+				Attributes: []*ecr.Attribute{
+					{Key: aws.String("package_version"), Value: aws.String("2.28-10")},
+					{Key: aws.String("package_name"), Value: aws.String("glibc")},
+					{Key: aws.String("CVSS2_VECTOR"), Value: aws.String("AV:N/AC:M/Au:N/C:N/I:N/A:C")},
+					{Key: aws.String("CVSS2_SCORE"), Value: aws.String("7.1")},
+				},
+				Description: aws.String("The iconv feature in the GNU C Library, may have a buffer over-read."),
+				Name:        aws.String("CVE-2019-25013"),
+				Severity:    aws.String("HIGH"),
+				Uri:         aws.String("https://security-tracker.debian.org/tracker/CVE-2019-25013"),
+			},
+			Suppressed:             true,
+			ExceptionId:            "abc123",
+			ExceptionJustification: "EUC-KR encoding is never used by the application",
+		},
+		{
+			ImageScanFinding: &ecr.ImageScanFinding{
+				Attributes: []*ecr.Attribute{
+					{Key: aws.String("package_version"), Value: aws.String("7.64.0-4+deb10u1")},
+					{Key: aws.String("package_name"), Value: aws.String("curl")},
+				},
+				Description: aws.String("curl is vulnerable to an improper check for certificate revocation"),
+				Name:        aws.String("CVE-2020-8286"),
+				Severity:    aws.String("MEDIUM"),
+			},
+		},
+	},
+}
+
+func Test_findingsFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		accept  string
+		want    string
+		wantErr bool
+	}{
+		{name: "default", want: "json"},
+		{name: "query sarif", query: "?format=sarif", want: "sarif"},
+		{name: "query uppercase csv", query: "?format=CSV", want: "csv"},
+		{name: "query cyclonedx", query: "?format=cyclonedx", want: "vex"},
+		{name: "query invalid", query: "?format=xml", wantErr: true},
+		{name: "accept sarif", accept: "application/sarif+json", want: "sarif"},
+		{name: "accept csv with params", accept: "text/html, text/csv;q=0.9", want: "csv"},
+		{name: "accept vex", accept: "application/vnd.cyclonedx+json", want: "vex"},
+		{name: "accept unknown", accept: "text/html", want: "json"},
+		{name: "query wins", query: "?format=csv", accept: "application/sarif+json", want: "csv"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, "/v1/ecr/12345/scanFindings"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Header.Set("Accept", tt.accept)
+
+			got, err := findingsFormat(r)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("findingsFormat() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("findingsFormat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_findingRecordsFromFindings(t *testing.T) {
+	got := findingRecordsFromFindings("spindev-00001/rudolph", "sha256:0000", testFindings)
+	want := []*findingRecord{
+		{
+			Repository:             "spindev-00001/rudolph",
+			ImageDigest:            "sha256:0000",
+			Name:                   "CVE-2019-25013",
+			Description:            "The iconv feature in the GNU C Library, may have a buffer over-read.",
+			Uri:                    "https://security-tracker.debian.org/tracker/CVE-2019-25013",
+			Severity:               "HIGH",
+			PackageName:            "glibc",
+			PackageVersion:         "2.28-10",
+			CVSS2Score:             "7.1",
+			CVSS2Vector:            "AV:N/AC:M/Au:N/C:N/I:N/A:C",
+			Suppressed:             true,
+			ExceptionId:            "abc123",
+			ExceptionJustification: "EUC-KR encoding is never used by the application",
+		},
+		{
+			Repository:     "spindev-00001/rudolph",
+			ImageDigest:    "sha256:0000",
+			Name:           "CVE-2020-8286",
+			Description:    "curl is vulnerable to an improper check for certificate revocation",
+			Severity:       "MEDIUM",
+			PackageName:    "curl",
+			PackageVersion: "7.64.0-4+deb10u1",
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findingRecordsFromFindings() = %+v, want %+v", got, want)
+	}
+
+	if got := findingRecordsFromFindings("spindev-00001/rudolph", "sha256:0000", nil); len(got) != 0 {
+		t.Errorf("expected empty records for nil findings, got %+v", got)
+	}
+}
+
+func Test_csvReport(t *testing.T) {
+	out, err := csvReport(findingRecordsFromFindings("spindev-00001/rudolph", "sha256:0000", testFindings))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d: %s", len(lines), string(out))
+	}
+
+	if !strings.HasPrefix(lines[0], "repository,image_digest,name,severity,package_name,package_version") {
+		t.Errorf("unexpected header %s", lines[0])
+	}
+
+	if !strings.HasPrefix(lines[1], "spindev-00001/rudolph,sha256:0000,CVE-2019-25013,HIGH,glibc,2.28-10,7.1,") {
+		t.Errorf("unexpected first row %s", lines[1])
+	}
+
+	if !strings.Contains(lines[1], ",true,abc123,") {
+		t.Errorf("expected first row to be suppressed, got %s", lines[1])
+	}
+}
+
+func Test_sarifReport(t *testing.T) {
+	out, err := sarifReport(findingRecordsFromFindings("spindev-00001/rudolph", "sha256:0000", testFindings))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	report := sarifLog{}
+	if err := json.Unmarshal(out, &report); err != nil {
+		t.Fatalf("failed to unmarshal sarif report: %s", err)
+	}
+
+	if report.Version != "2.1.0" || len(report.Runs) != 1 {
+		t.Fatalf("unexpected sarif report %s", string(out))
+	}
+
+	run := report.Runs[0]
+	if len(run.Tool.Driver.Rules) != 2 || len(run.Results) != 2 {
+		t.Fatalf("expected 2 rules and results, got %s", string(out))
+	}
+
+	if run.Tool.Driver.Rules[0].Properties["security-severity"] != "7.1" {
+		t.Errorf("expected security-severity 7.1, got %v", run.Tool.Driver.Rules[0].Properties["security-severity"])
+	}
+
+	if run.Results[0].Level != "error" || len(run.Results[0].Suppressions) != 1 {
+		t.Errorf("unexpected first result %+v", run.Results[0])
+	}
+
+	if run.Results[1].Level != "warning" || len(run.Results[1].Suppressions) != 0 {
+		t.Errorf("unexpected second result %+v", run.Results[1])
+	}
+
+	if uri := run.Results[1].Locations[0].PhysicalLocation.ArtifactLocation.Uri; uri != "spindev-00001/rudolph@sha256:0000" {
+		t.Errorf("unexpected artifact location %s", uri)
+	}
+}
+
+func Test_vexReport(t *testing.T) {
+	out, err := vexReport(findingRecordsFromFindings("spindev-00001/rudolph", "sha256:0000", testFindings), testNow)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	bom := cycloneDXBOM{}
+	if err := json.Unmarshal(out, &bom); err != nil {
+		t.Fatalf("failed to unmarshal vex document: %s", err)
+	}
+
+	if bom.BOMFormat != "CycloneDX" || bom.SpecVersion != "1.4" || bom.Metadata.Timestamp != "2021-03-11T17:27:30Z" {
+		t.Errorf("unexpected vex document %s", string(out))
+	}
+
+	// image, glibc and curl
+	if len(bom.Components) != 3 {
+		t.Errorf("expected 3 components, got %+v", bom.Components)
+	}
+
+	if len(bom.Vulnerabilities) != 2 {
+		t.Fatalf("expected 2 vulnerabilities, got %+v", bom.Vulnerabilities)
+	}
+
+	v := bom.Vulnerabilities[0]
+	if v.Affects[0].Ref != "spindev-00001/rudolph@sha256:0000#glibc@2.28-10" {
+		t.Errorf("unexpected first vulnerability %+v", v)
+	}
+
+	// the risk of the suppressed finding is accepted, the image is still affected
+	if v.Analysis.State != "exploitable" || !reflect.DeepEqual(v.Analysis.Response, []string{"will_not_fix"}) || v.Analysis.Detail != "EUC-KR encoding is never used by the application" {
+		t.Errorf("unexpected first vulnerability analysis %+v", v.Analysis)
+	}
+
+	if v := bom.Vulnerabilities[1]; v.Analysis.State != "in_triage" || len(v.Analysis.Response) != 0 {
+		t.Errorf("unexpected second vulnerability analysis %+v", v.Analysis)
+	}
+
+	if v.Ratings[0].Method != "CVSSv2" || v.Ratings[0].Score != 7.1 || v.Ratings[0].Severity != "high" {
+		t.Errorf("unexpected first vulnerability rating %+v", v.Ratings)
+	}
+
+	if bom.Vulnerabilities[1].Analysis.State != "in_triage" {
+		t.Errorf("expected second vulnerability to be in triage, got %+v", bom.Vulnerabilities[1].Analysis)
+	}
+}
+
+func Test_findingRecordsFromFindings_enhanced(t *testing.T) {
+	findings := &ImageScanFindings{
+		EnhancedFindings: []*EnhancedImageScanFinding{
+			{
+				EnhancedImageScanFinding: &ecr.EnhancedImageScanFinding{
+					Description: aws.String("An issue was discovered in OpenSSL."),
+					FindingArn:  aws.String("arn:aws:inspector2:us-east-1:12345:finding/0001"),
+					PackageVulnerabilityDetails: &ecr.PackageVulnerabilityDetails{
+						Cvss: []*ecr.CvssScore{
+							{BaseScore: aws.Float64(7.5), ScoringVector: aws.String("CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:N/I:N/A:H"), Version: aws.String("3.1")},
+						},
+						SourceUrl:       aws.String("https://nvd.nist.gov/vuln/detail/CVE-2022-0778"),
+						VulnerabilityId: aws.String("CVE-2022-0778"),
+						VulnerablePackages: []*ecr.VulnerablePackage{
+							{Name: aws.String("openssl"), Version: aws.String("1.1.1k")},
+							{Name: aws.String("libssl1.1"), Version: aws.String("1.1.1k")},
+						},
+					},
+					Severity: aws.String("HIGH"),
+				},
+				FixAvailable:     "PARTIAL",
+				ExploitAvailable: "NO",
+				FixedInVersions:  map[string]string{"openssl": "1.1.1n"},
+				Suppressed:       true,
+				ExceptionId:      "abc123",
+			},
+		},
+	}
+
+	base := findingRecord{
+		Repository:       "spindev-00001/rudolph",
+		ImageDigest:      "sha256:0000",
+		Name:             "CVE-2022-0778",
+		Description:      "An issue was discovered in OpenSSL.",
+		Uri:              "https://nvd.nist.gov/vuln/detail/CVE-2022-0778",
+		Severity:         "HIGH",
+		PackageVersion:   "1.1.1k",
+		CVSS3Score:       "7.5",
+		CVSS3Vector:      "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:N/I:N/A:H",
+		Suppressed:       true,
+		ExceptionId:      "abc123",
+		FixAvailable:     "PARTIAL",
+		ExploitAvailable: "NO",
+	}
+
+	openssl, libssl := base, base
+	openssl.PackageName, openssl.FixedInVersion = "openssl", "1.1.1n"
+	libssl.PackageName = "libssl1.1"
+
+	got := findingRecordsFromFindings("spindev-00001/rudolph", "sha256:0000", findings)
+	want := []*findingRecord{&openssl, &libssl}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findingRecordsFromFindings() = %+v, want %+v", got, want)
+	}
+}
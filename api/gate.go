@@ -0,0 +1,67 @@
+package api
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// GateResult is the outcome of evaluating an image scan against the configured severity thresholds
+type GateResult struct {
+	Passed bool
+	// Thresholds are the maximum number of unsuppressed findings allowed per severity
+	Thresholds map[string]int64
+	// Violations are the unsuppressed findings counts for the severities over their threshold
+	Violations map[string]int64 `json:",omitempty"`
+}
+
+// evaluateGate checks the unsuppressed severity counts of a findings snapshot against the thresholds.  Severities
+// without a threshold are not limited and an empty set of thresholds always passes.
+func evaluateGate(thresholds map[string]int64, snapshot *FindingsSnapshot) *GateResult {
+	result := &GateResult{
+		Passed:     true,
+		Thresholds: thresholds,
+	}
+
+	if snapshot == nil {
+		return result
+	}
+
+	for severity, max := range thresholds {
+		severity = strings.ToUpper(severity)
+
+		count := snapshot.SeverityCounts[severity] - snapshot.SuppressedSeverityCounts[severity]
+		if count > max {
+			if result.Violations == nil {
+				result.Violations = map[string]int64{}
+			}
+			result.Violations[severity] = count
+			result.Passed = false
+		}
+	}
+
+	return result
+}
+
+// notifyScanGate sends the scan threshold exceeded notification when the scan failed the gate
+func (s *server) notifyScanGate(ctx context.Context, account string, snapshot *FindingsSnapshot, gate *GateResult) {
+	if gate.Passed {
+		return
+	}
+
+	group, _ := splitRepositoryName(snapshot.Repository)
+
+	s.notifier.notify(ctx, &Notification{
+		Type:    notificationScanThresholdExceeded,
+		Account: account,
+		Group:   group,
+		Time:    time.Now().UTC(),
+		Data: &ScanCompletedNotification{
+			Repository:     snapshot.Repository,
+			ImageDigest:    snapshot.ImageDigest,
+			ImageTags:      snapshot.ImageTags,
+			SeverityCounts: snapshot.SeverityCounts,
+			Gate:           gate,
+		},
+	})
+}
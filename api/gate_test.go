@@ -0,0 +1,54 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_evaluateGate(t *testing.T) {
+	snapshot := &FindingsSnapshot{
+		SeverityCounts:           map[string]int64{"CRITICAL": 1, "HIGH": 6, "MEDIUM": 20},
+		SuppressedSeverityCounts: map[string]int64{"CRITICAL": 1},
+	}
+
+	tests := []struct {
+		name       string
+		thresholds map[string]int64
+		snapshot   *FindingsSnapshot
+		want       *GateResult
+	}{
+		{
+			name:     "no thresholds",
+			snapshot: snapshot,
+			want:     &GateResult{Passed: true},
+		},
+		{
+			name:       "suppressed critical passes",
+			thresholds: map[string]int64{"CRITICAL": 0},
+			snapshot:   snapshot,
+			want:       &GateResult{Passed: true, Thresholds: map[string]int64{"CRITICAL": 0}},
+		},
+		{
+			name:       "high over threshold",
+			thresholds: map[string]int64{"critical": 0, "high": 5},
+			snapshot:   snapshot,
+			want: &GateResult{
+				Passed:     false,
+				Thresholds: map[string]int64{"critical": 0, "high": 5},
+				Violations: map[string]int64{"HIGH": 6},
+			},
+		},
+		{
+			name:       "nil snapshot",
+			thresholds: map[string]int64{"HIGH": 0},
+			want:       &GateResult{Passed: true, Thresholds: map[string]int64{"HIGH": 0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := evaluateGate(tt.thresholds, tt.snapshot); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("evaluateGate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -18,9 +18,12 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/YaleSpinup/apierror"
+	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
@@ -51,6 +54,30 @@ func (s *server) VersionHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
+// ReportsShowHandler shows a report generated in the background, with the result once it's completed
+func (s *server) ReportsShowHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := vars["account"]
+	id := vars["id"]
+
+	report, err := s.getReport(r.Context(), account, id)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "failed to get report"))
+		return
+	}
+
+	j, err := json.Marshal(report)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "unable to marshal response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
 // handleError handles standard apierror return codes
 func handleError(w http.ResponseWriter, err error) {
 	log.Error(err.Error())
@@ -75,3 +102,19 @@ func handleError(w http.ResponseWriter, err error) {
 		w.Write([]byte(err.Error()))
 	}
 }
+
+// queryBool parses an optional boolean query parameter, false if it's missing
+func queryBool(r *http.Request, key string) (bool, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		msg := fmt.Sprintf("invalid value '%s' for %s, must be true or false", v, key)
+		return false, apierror.New(apierror.ErrBadRequest, msg, nil)
+	}
+
+	return b, nil
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// ExceptionsCreateHandler creates an accepted-risk exception for a CVE
+func (s *server) ExceptionsCreateHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := vars["account"]
+
+	req := CVEExceptionCreateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		msg := fmt.Sprintf("cannot decode body into create exception input: %s", err)
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	resp, err := s.createException(r.Context(), account, &req)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "failed to create exception"))
+		return
+	}
+
+	j, err := json.Marshal(resp)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "unable to marshal response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// ExceptionsListHandler lists the CVE exceptions for an account
+func (s *server) ExceptionsListHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := vars["account"]
+
+	resp, err := s.listExceptions(r.Context(), account)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "failed to list exceptions"))
+		return
+	}
+
+	j, err := json.Marshal(resp)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "unable to marshal response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// ExceptionsShowHandler gets the details about a CVE exception
+func (s *server) ExceptionsShowHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := vars["account"]
+	id := vars["id"]
+
+	resp, err := s.getException(r.Context(), account, id)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "failed to get exception"))
+		return
+	}
+
+	j, err := json.Marshal(resp)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "unable to marshal response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// ExceptionsDeleteHandler deletes a CVE exception
+func (s *server) ExceptionsDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := vars["account"]
+	id := vars["id"]
+
+	if err := s.deleteException(r.Context(), account, id); err != nil {
+		handleError(w, errors.Wrap(err, "failed to delete exception"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// RepositoriesTrendHandler returns the vulnerability trend of a repository from the recorded findings history
+func (s *server) RepositoriesTrendHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+	name := vars["name"]
+
+	repository := fmt.Sprintf("%s/%s", group, name)
+	from := r.URL.Query().Get("from")
+	to := r.URL.Query().Get("to")
+
+	resp, err := s.findingsTrend(r.Context(), account, repository, from, to)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "failed to get findings trend"))
+		return
+	}
+
+	j, err := json.Marshal(resp)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "unable to marshal response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
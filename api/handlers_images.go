@@ -4,12 +4,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/YaleSpinup/apierror"
 	"github.com/YaleSpinup/ecr-api/ecr"
+	"github.com/aws/aws-sdk-go/aws"
 	awsecr "github.com/aws/aws-sdk-go/service/ecr"
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 )
 
 // RepositoriesImageListHandler is the http handler for listing images in a repository
@@ -58,6 +61,60 @@ func (s *server) RepositoriesImageListHandler(w http.ResponseWriter, r *http.Req
 	w.Write(j)
 }
 
+// RepositoriesImageDiffHandler compares the vulnerabilities, size and layers of two images in a repository
+func (s *server) RepositoriesImageDiffHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := vars["account"]
+	name := vars["name"]
+	group := vars["group"]
+
+	repository := fmt.Sprintf("%s/%s", group, name)
+	from := r.URL.Query().Get("from")
+	to := r.URL.Query().Get("to")
+
+	if from == "" || to == "" {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "from and to query parameters are required", nil))
+		return
+	}
+
+	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
+
+	session, err := s.assumeRole(
+		r.Context(),
+		s.session.ExternalID,
+		role,
+		s.orgPolicy,
+		"arn:aws:iam::aws:policy/AmazonEC2ContainerRegistryReadOnly",
+	)
+	if err != nil {
+		msg := fmt.Sprintf("failed to assume role in account: %s", account)
+		handleError(w, apierror.New(apierror.ErrForbidden, msg, nil))
+		return
+	}
+
+	orch := newEcrOrchestrator(
+		ecr.New(ecr.WithSession(session.Session)),
+		s.org,
+	)
+
+	resp, err := orch.imageDiff(r.Context(), repository, from, to)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "failed to compare images"))
+		return
+	}
+
+	j, err := json.Marshal(resp)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "unable to marshal response from the ecr service"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
 // RepositoriesImageTagShowHandler returns information about an image tag, notably the detailed scan findings
 func (s *server) RepositoriesImageTagShowHandler(w http.ResponseWriter, r *http.Request) {
 	w = LogWriter{w}
@@ -69,6 +126,12 @@ func (s *server) RepositoriesImageTagShowHandler(w http.ResponseWriter, r *http.
 
 	repository := fmt.Sprintf("%s/%s", group, name)
 
+	format, err := findingsFormat(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
 	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
 
 	session, err := s.assumeRole(
@@ -98,25 +161,57 @@ func (s *server) RepositoriesImageTagShowHandler(w http.ResponseWriter, r *http.
 
 	// Create response structure
 	type ImageTagResponse struct {
-		ImageDetail   *awsecr.ImageDetail        `json:"imageDetail,omitempty"`
-		ScanFindings  *awsecr.ImageScanFindings  `json:"scanFindings,omitempty"`
-		ScanError     string                  `json:"scanError,omitempty"`
+		ImageDetail  *awsecr.ImageDetail `json:"imageDetail,omitempty"`
+		ScanFindings *ImageScanFindings  `json:"scanFindings,omitempty"`
+		ScanError    string              `json:"scanError,omitempty"`
 	}
 
 	response := ImageTagResponse{}
 
 	// Add image detail if found
+	var digest string
 	if len(images) > 0 {
 		response.ImageDetail = images[0]
+		digest = aws.StringValue(images[0].ImageDigest)
 	}
 
 	// Try to get scan findings, but don't fail if they're not available
-	findings, err := service.GetImageScanFindings(r.Context(), repository, tag)
+	findings, extras, err := service.GetImageScanFindings(r.Context(), repository, tag)
 	if err != nil {
+		// exported findings formats are only the findings, so there's nothing to return
+		if format != findingsFormatJSON {
+			handleError(w, err)
+			return
+		}
+
 		// Log the error but don't fail the request
 		response.ScanError = fmt.Sprintf("Unable to retrieve scan findings: %v", err)
 	} else {
-		response.ScanFindings = findings
+		// the findings are still returned without the exceptions applied
+		exceptions, err := s.listExceptions(r.Context(), account)
+		if err != nil {
+			log.Warnf("failed to list exceptions in account %s, not applying them to %s:%s: %s", account, repository, tag, err)
+		}
+
+		response.ScanFindings = imageScanFindingsFromECR(findings, extras)
+		applyExceptions(exceptions, group, name, digest, response.ScanFindings, time.Now())
+
+		var tags []string
+		if response.ImageDetail != nil {
+			tags = aws.StringValueSlice(response.ImageDetail.ImageTags)
+		}
+
+		snapshot := newFindingsSnapshot(repository, digest, tags, response.ScanFindings, time.Now())
+		if recorded, err := s.recordFindings(r.Context(), account, snapshot); err != nil {
+			log.Warnf("failed to record findings history for %s@%s: %s", repository, digest, err)
+		} else if recorded {
+			s.notifyScanGate(r.Context(), account, snapshot, evaluateGate(s.scanThresholds, snapshot))
+		}
+	}
+
+	if format != findingsFormatJSON {
+		writeFindings(w, format, findingRecordsFromFindings(repository, digest, response.ScanFindings))
+		return
 	}
 
 	j, err := json.Marshal(response)
@@ -170,6 +265,15 @@ func (s *server) RepositoriesImageTagDeleteHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
+	// image deletes are notified from the ECR events when they're consumed
+	if !s.imageEvents && len(output.ImageIds) > 0 {
+		s.notify(r.Context(), notificationImageDeleted, account, group, &ImageActionNotification{
+			Repository:  repository,
+			ImageDigest: aws.StringValue(output.ImageIds[0].ImageDigest),
+			ImageTag:    tag,
+		})
+	}
+
 	j, err := json.Marshal(output)
 	if err != nil {
 		handleError(w, errors.Wrap(err, "unable to marshal response from the ecr service"))
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// KeyRotationRunHandler starts applying the key rotation policy to the repository users in an account, the
+// access keys it acted on are in the report
+func (s *server) KeyRotationRunHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := vars["account"]
+
+	dryRun, err := queryBool(r, "dryrun")
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	resp, err := s.startKeyRotation(r.Context(), account, dryRun)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "failed to rotate access keys"))
+		return
+	}
+
+	j, err := json.Marshal(resp)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "unable to marshal response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(j)
+}
+
+// KeyRotationShowHandler returns the last key rotation report for an account
+func (s *server) KeyRotationShowHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := vars["account"]
+
+	resp, err := s.keyRotationReport(r.Context(), account)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "failed to get key rotation report"))
+		return
+	}
+
+	j, err := json.Marshal(resp)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "unable to marshal response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"sync"
@@ -10,12 +11,9 @@ import (
 
 	"github.com/YaleSpinup/apierror"
 	"github.com/YaleSpinup/ecr-api/ecr"
-	"github.com/YaleSpinup/ecr-api/iam"
 	"github.com/YaleSpinup/ecr-api/resourcegroupstaggingapi"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/arn"
-	"github.com/aws/aws-sdk-go/aws/awsutil"
-	awsecr "github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -61,6 +59,8 @@ func (s *server) RepositoriesCreateHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	s.notify(r.Context(), notificationRepositoryCreated, account, group, &RepositoryNotification{Repository: resp.RepositoryName})
+
 	j, err := json.Marshal(resp)
 	if err != nil {
 		handleError(w, errors.Wrap(err, "unable to marshal response from the ecr service"))
@@ -99,39 +99,11 @@ func (s *server) RepositoriesListHandler(w http.ResponseWriter, r *http.Request)
 			resourcegroupstaggingapi.WithSession(session.Session),
 		)
 
-		// build up tag filters starting with the org
-		tagFilters := []*resourcegroupstaggingapi.TagFilter{
-			{
-				Key:   "spinup:org",
-				Value: []string{s.org},
-			},
-			{
-				Key:   "spinup:spaceid",
-				Value: []string{group},
-			},
-		}
-
-		out, err := service.GetResourcesWithTags(r.Context(), []string{"ecr"}, tagFilters)
+		repos, err = s.groupRepositories(r.Context(), service, group)
 		if err != nil {
-			handleError(w, errors.Wrap(err, "failed to create repository"))
+			handleError(w, errors.Wrap(err, "failed to list repositories"))
 			return
 		}
-
-		log.Debugf("got output from resourcegroups tagging api %s", awsutil.Prettify(out))
-
-		repos = make([]string, 0, len(out))
-		for _, repo := range out {
-			a, err := arn.Parse(aws.StringValue(repo.ResourceARN))
-			if err != nil {
-				msg := fmt.Sprintf("failed to parse ARN %s: %s", repo, err)
-				handleError(w, errors.Wrap(err, msg))
-				return
-			}
-
-			prefix := fmt.Sprintf("repository/%s/", group)
-			rid := strings.TrimPrefix(a.Resource, prefix)
-			repos = append(repos, rid)
-		}
 	} else {
 		service := ecr.New(
 			ecr.WithSession(session.Session),
@@ -164,13 +136,19 @@ func (s *server) RepositoriesShowHandler(w http.ResponseWriter, r *http.Request)
 	name := vars["name"]
 	group := vars["group"]
 
+	policy, err := repositoryDetailsPolicy(s.org)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
 	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
 
 	session, err := s.assumeRole(
 		r.Context(),
 		s.session.ExternalID,
 		role,
-		s.orgPolicy,
+		policy,
 		"arn:aws:iam::aws:policy/AmazonEC2ContainerRegistryReadOnly",
 	)
 	if err != nil {
@@ -241,6 +219,8 @@ func (s *server) RepositoriesUpdateHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	s.notify(r.Context(), notificationRepositoryUpdated, account, group, &RepositoryNotification{Repository: resp.RepositoryName})
+
 	j, err := json.Marshal(resp)
 	if err != nil {
 		handleError(w, errors.Wrap(err, "unable to marshal response from the ecr service"))
@@ -252,7 +232,8 @@ func (s *server) RepositoriesUpdateHandler(w http.ResponseWriter, r *http.Reques
 	w.Write(j)
 }
 
-// RepositoriesDeleteHandler deletes a repository
+// RepositoriesDeleteHandler deletes a repository, or soft deletes it when a grace period is configured.  Repositories
+// with images or users must be deleted with force=true.
 func (s *server) RepositoriesDeleteHandler(w http.ResponseWriter, r *http.Request) {
 	w = LogWriter{w}
 	vars := mux.Vars(r)
@@ -260,24 +241,283 @@ func (s *server) RepositoriesDeleteHandler(w http.ResponseWriter, r *http.Reques
 	name := vars["name"]
 	group := vars["group"]
 
+	force, err := queryBool(r, "force")
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	// repositories with images or users are only deleted when forced, otherwise respond with what would be destroyed
+	if !force {
+		summary, err := s.repositoryDeleteSummary(r.Context(), account, group, name)
+		if err != nil {
+			handleError(w, errors.Wrap(err, "failed to summarize repository"))
+			return
+		}
+
+		if !summary.empty() {
+			response := struct {
+				Message string
+				RepositoryDeleteSummary
+			}{
+				fmt.Sprintf("repository %s has images or users, delete it with force=true", summary.Repository),
+				*summary,
+			}
+
+			j, err := json.Marshal(response)
+			if err != nil {
+				handleError(w, errors.Wrap(err, "unable to marshal response"))
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			w.Write(j)
+			return
+		}
+	}
+
+	var resp *RepositoryResponse
+	var users []string
+	if s.softDelete != nil {
+		resp, users, err = s.softDeleteRepository(r.Context(), account, group, name)
+	} else {
+		resp, users, err = s.deleteRepository(r.Context(), account, group, name)
+	}
+
+	if err != nil {
+		handleError(w, errors.Wrap(err, "failed to delete repository"))
+		return
+	}
+
+	response := struct {
+		RepositoryResponse
+		Users []string
+	}{*resp, users}
+
+	j, err := json.Marshal(response)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "unable to marshal response from the ecr service"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// RepositoriesGroupDeleteHandler starts deleting all of the repositories in a group, their users and the group-wide
+// users.  The group must be confirmed with confirm={group}, unless it's a dry run.
+func (s *server) RepositoriesGroupDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+
+	dryRun, err := queryBool(r, "dryrun")
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if !dryRun && r.URL.Query().Get("confirm") != group {
+		msg := fmt.Sprintf("deleting all of the repositories in %s must be confirmed with confirm=%s", group, group)
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, nil))
+		return
+	}
+
+	resp, err := s.startGroupRepositoriesDelete(r.Context(), account, group, dryRun)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "failed to delete repositories"))
+		return
+	}
+
+	j, err := json.Marshal(resp)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "unable to marshal response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(j)
+}
+
+// RepositoriesGroupDeleteShowHandler shows the progress of deleting all of the repositories in a group
+func (s *server) RepositoriesGroupDeleteShowHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := vars["account"]
+	id := vars["id"]
+
+	report, err := s.getGroupRepositoriesDelete(r.Context(), account, id)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "failed to get repository group delete"))
+		return
+	}
+
+	j, err := json.Marshal(report)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "unable to marshal response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// RepositoriesUndeleteHandler restores a soft deleted repository before its grace period ends
+func (s *server) RepositoriesUndeleteHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := vars["account"]
+	name := vars["name"]
+	group := vars["group"]
+
+	resp, users, err := s.restoreRepository(r.Context(), account, group, name)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "failed to restore repository"))
+		return
+	}
+
+	response := struct {
+		RepositoryResponse
+		Users []string
+	}{*resp, users}
+
+	j, err := json.Marshal(response)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "unable to marshal response from the ecr service"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// RepositoriesMoveHandler starts moving a repository to another group, or renaming it.  The move runs in
+// the background and its progress is available from the moves endpoint.
+func (s *server) RepositoriesMoveHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := vars["account"]
+	name := vars["name"]
+	group := vars["group"]
+
+	req := RepositoryMoveRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		msg := fmt.Sprintf("cannot decode body into move repository input: %s", err)
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	move, err := s.startRepositoryMove(r.Context(), account, group, name, &req)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "failed to move repository"))
+		return
+	}
+
+	j, err := json.Marshal(move)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "unable to marshal response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(j)
+}
+
+// RepositoriesMoveShowHandler shows the progress of a repository move
+func (s *server) RepositoriesMoveShowHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := vars["account"]
+	id := vars["id"]
+
+	move, err := s.getRepositoryMove(r.Context(), account, id)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "failed to get repository move"))
+		return
+	}
+
+	j, err := json.Marshal(move)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "unable to marshal response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// RepositoriesTokenHandler gets a short-lived docker login for a repository
+func (s *server) RepositoriesTokenHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := vars["account"]
+	name := vars["name"]
+	group := vars["group"]
+
+	req := RepositoryTokenRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		msg := fmt.Sprintf("cannot decode body into repository token input: %s", err)
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	access := strings.ToLower(req.Access)
+	if access == "" {
+		access = userRolePull
+	}
+
+	if access != userRolePull && access != userRolePush {
+		msg := fmt.Sprintf("invalid access '%s', expected one of [%s %s]", req.Access, userRolePull, userRolePush)
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, nil))
+		return
+	}
+
+	if req.DurationSeconds == 0 {
+		req.DurationSeconds = 3600
+	}
+
+	if req.DurationSeconds < 900 || req.DurationSeconds > 43200 {
+		msg := fmt.Sprintf("invalid duration %d, must be from 900 to 43200 seconds", req.DurationSeconds)
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, nil))
+		return
+	}
+
 	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
 
-	policy, err := s.repositoryDeletePolicy(s.org)
+	policy, err := s.repositoryTokenPolicy(account, fmt.Sprintf("%s/%s", group, name), access)
 	if err != nil {
 		handleError(w, apierror.New(apierror.ErrInternalError, "failed to generate policy", err))
 		return
 	}
 
-	session, err := s.assumeRole(
+	// the token has the permissions of the session and stops working when the session expires, so the role is
+	// assumed for the requested duration with only the scoped policy
+	session, sessionExpiresAt, err := s.assumeRoleWithDuration(
 		r.Context(),
 		s.session.ExternalID,
 		role,
 		policy,
-		"arn:aws:iam::aws:policy/AmazonEC2ContainerRegistryFullAccess",
+		time.Duration(req.DurationSeconds)*time.Second,
 	)
 	if err != nil {
+		// the duration is longer than the role allows
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "ValidationError" {
+			msg := fmt.Sprintf("invalid duration %d: %s", req.DurationSeconds, aerr.Message())
+			handleError(w, apierror.New(apierror.ErrBadRequest, msg, nil))
+			return
+		}
+
 		msg := fmt.Sprintf("failed to assume role in account: %s", account)
 		handleError(w, apierror.New(apierror.ErrForbidden, msg, nil))
+		return
 	}
 
 	orch := newEcrOrchestrator(
@@ -285,29 +525,13 @@ func (s *server) RepositoriesDeleteHandler(w http.ResponseWriter, r *http.Reques
 		s.org,
 	)
 
-	resp, err := orch.repositoryDelete(r.Context(), account, group, name)
+	resp, err := orch.repositoryToken(r.Context(), group, name, access, sessionExpiresAt)
 	if err != nil {
-		handleError(w, errors.Wrap(err, "failed to create repository"))
+		handleError(w, errors.Wrap(err, "failed to get repository token"))
 		return
 	}
 
-	iamOrch := newIamOrchestrator(
-		iam.New(iam.WithSession(session.Session)),
-		s.org,
-	)
-
-	users, err := iamOrch.repositoryUserDeleteAll(r.Context(), name, group)
-	if err != nil {
-		handleError(w, err)
-		return
-	}
-
-	response := struct {
-		RepositoryResponse
-		Users []string
-	}{*resp, users}
-
-	j, err := json.Marshal(response)
+	j, err := json.Marshal(resp)
 	if err != nil {
 		handleError(w, errors.Wrap(err, "unable to marshal response from the ecr service"))
 		return
@@ -400,6 +624,12 @@ func (s *server) ScanFindings(w http.ResponseWriter, r *http.Request) {
 	account := vars["account"]
 	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
 
+	format, err := findingsFormat(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
 	session, err := s.assumeRole(
 		r.Context(),
 		s.session.ExternalID,
@@ -423,9 +653,15 @@ func (s *server) ScanFindings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the findings are still returned without the exceptions applied
+	exceptions, err := s.listExceptions(r.Context(), account)
+	if err != nil {
+		log.Warnf("failed to list exceptions in account %s, not applying them to the scan findings: %s", account, err)
+	}
+
 	var wg sync.WaitGroup
 	var mu sync.Mutex
-	var scanResults []*awsecr.DescribeImageScanFindingsOutput
+	var scanResults []*ImageScanFindingsOutput
 	errChannel := make(chan error, len(repositories))
 	for _, repository := range repositories {
 		wg.Add(1)
@@ -446,13 +682,24 @@ func (s *server) ScanFindings(w http.ResponseWriter, r *http.Request) {
 					}
 				}
 
-				scanFindings, err := service.GetImageScanFindingsByImageDigest(r.Context(), repo, *latestImage.ImageDigest)
+				scanFindings, extras, err := service.GetImageScanFindingsByImageDigest(r.Context(), repo, *latestImage.ImageDigest)
 				if err != nil {
 					errChannel <- err
 					return
 				}
+				result := imageScanFindingsOutputFromECR(scanFindings, extras)
+				group, name := splitRepositoryName(repo)
+				applyExceptions(exceptions, group, name, aws.StringValue(latestImage.ImageDigest), result.ImageScanFindings, time.Now())
+
+				snapshot := newFindingsSnapshot(repo, aws.StringValue(latestImage.ImageDigest), aws.StringValueSlice(latestImage.ImageTags), result.ImageScanFindings, time.Now())
+				if recorded, err := s.recordFindings(r.Context(), account, snapshot); err != nil {
+					log.Warnf("failed to record findings history for %s@%s: %s", repo, aws.StringValue(latestImage.ImageDigest), err)
+				} else if recorded {
+					s.notifyScanGate(r.Context(), account, snapshot, evaluateGate(s.scanThresholds, snapshot))
+				}
+
 				mu.Lock()
-				scanResults = append(scanResults, scanFindings)
+				scanResults = append(scanResults, result)
 				mu.Unlock()
 			}
 		}(repository)
@@ -468,6 +715,11 @@ func (s *server) ScanFindings(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if format != findingsFormatJSON {
+		writeFindings(w, format, findingRecordsFromOutputs(scanResults))
+		return
+	}
+
 	data, err := json.Marshal(scanResults)
 	if err != nil {
 		handleError(w, errors.Wrap(err, "unable to marshal response from the ecr service"))
@@ -478,3 +730,36 @@ func (s *server) ScanFindings(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write(data)
 }
+
+// RepositoryPoliciesAuditHandler starts a report of the repositories in the org whose policy has drifted from the
+// policy generated for the access it grants
+func (s *server) RepositoryPoliciesAuditHandler(w http.ResponseWriter, r *http.Request) {
+	s.repositoryPoliciesAudit(w, r, false)
+}
+
+// RepositoryPoliciesRepairHandler starts rewriting the drifted policies of the repositories in the org and reporting them
+func (s *server) RepositoryPoliciesRepairHandler(w http.ResponseWriter, r *http.Request) {
+	s.repositoryPoliciesAudit(w, r, true)
+}
+
+func (s *server) repositoryPoliciesAudit(w http.ResponseWriter, r *http.Request, repair bool) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := vars["account"]
+
+	resp, err := s.startRepositoryPoliciesAudit(r.Context(), account, repair)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "failed to audit repository policies"))
+		return
+	}
+
+	j, err := json.Marshal(resp)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "unable to marshal response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(j)
+}
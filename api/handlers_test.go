@@ -73,3 +73,30 @@ func TestVersionHandler(t *testing.T) {
 			rr.Body.String(), expected)
 	}
 }
+
+func TestQueryBool(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    bool
+		wantErr bool
+	}{
+		{query: "", want: false},
+		{query: "?dryrun=true", want: true},
+		{query: "?dryrun=1", want: true},
+		{query: "?dryrun=false", want: false},
+		{query: "?dryrun=maybe", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/v1/ecr/12345/keyrotation"+tt.query, nil)
+		got, err := queryBool(req, "dryrun")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("queryBool(%s) error = %v, wantErr %v", tt.query, err, tt.wantErr)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("queryBool(%s) = %t, want %t", tt.query, got, tt.want)
+		}
+	}
+}
@@ -4,16 +4,21 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/ecr-api/ecr"
 	"github.com/YaleSpinup/ecr-api/iam"
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
-// UsersCreateHandler creates a user that can access the repository.  It first checks if the shared policy exists
-// in the account and creates it/updates it as needed.
+// UsersCreateHandler creates a user that can access the repository, or every repository in the group when
+// there's no repository name.  It first checks if the shared policy exists in the account and creates it/updates
+// it as needed.
 func (s *server) UsersCreateHandler(w http.ResponseWriter, r *http.Request) {
 	w = LogWriter{w}
 	vars := mux.Vars(r)
@@ -33,8 +38,20 @@ func (s *server) UsersCreateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(req.Groups) == 0 {
-		handleError(w, apierror.New(apierror.ErrBadRequest, "at least 1 group is required", nil))
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "expiresat must be in the future", nil))
+		return
+	}
+
+	req.Role = strings.ToLower(req.Role)
+	if req.Role != "" {
+		if _, ok := userRoleNames[req.Role]; !ok {
+			msg := fmt.Sprintf("invalid role '%s', must be one of pull, push or admin", req.Role)
+			handleError(w, apierror.New(apierror.ErrBadRequest, msg, nil))
+			return
+		}
+	} else if len(req.Groups) == 0 {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "a role or at least 1 group is required", nil))
 		return
 	}
 
@@ -58,23 +75,42 @@ func (s *server) UsersCreateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// users can't be added to a repository that's pending deletion
+	if name != "" {
+		ecrOrch := newEcrOrchestrator(ecr.New(ecr.WithSession(session.Session)), s.org)
+		if err := ecrOrch.repositoryPendingDeletion(r.Context(), group, name); err != nil {
+			handleError(w, err)
+			return
+		}
+	}
+
 	orch := newIamOrchestrator(
 		iam.New(iam.WithSession(session.Session)),
 		s.org,
 	)
 
-	groupName, err := orch.prepareAccount(r.Context())
+	prepare := orch.prepareAccount
+	if name == "" {
+		prepare = orch.prepareAccountForGroupUsers
+	}
+
+	roleGroups, err := prepare(r.Context())
 	if err != nil {
 		handleError(w, err)
 		return
 	}
 
-	out, err := orch.repositoryUserCreate(r.Context(), name, group, groupName, &req)
+	out, err := orch.repositoryUserCreate(r.Context(), name, group, roleGroups[req.Role], &req)
 	if err != nil {
 		handleError(w, err)
 		return
 	}
 
+	s.notify(r.Context(), notificationUserCreated, account, group, &UserNotification{
+		Repository: repositoryUserResource(group, name),
+		UserName:   out.UserName,
+	})
+
 	j, err := json.Marshal(out)
 	if err != nil {
 		log.Errorf("cannot marshal reasponse(%v) into JSON: %s", out, err)
@@ -87,8 +123,8 @@ func (s *server) UsersCreateHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(j)
 }
 
-// UserListHandler lists the users within a prefix.  Specific repositories, group name and
-// all managed users with an empty prefix are acceptable and expand the scope of the list.
+// UserListHandler lists the users of a repository, or the group-wide users when there's no repository name.
+// With details=true the details about each user are returned instead of the names.
 func (s *server) UsersListHandler(w http.ResponseWriter, r *http.Request) {
 	w = LogWriter{w}
 	vars := mux.Vars(r)
@@ -96,6 +132,12 @@ func (s *server) UsersListHandler(w http.ResponseWriter, r *http.Request) {
 	group := vars["group"]
 	name := vars["name"]
 
+	details, err := queryBool(r, "details")
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
 	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
 
 	// IAM doesn't support resource tags, so we can't pass the s.orgPolicy here
@@ -117,7 +159,13 @@ func (s *server) UsersListHandler(w http.ResponseWriter, r *http.Request) {
 		s.org,
 	)
 
-	output, err := orch.listRepositoryUsers(r.Context(), group, name)
+	var output interface{}
+	if details {
+		output, err = orch.listRepositoryUsersWithDetails(r.Context(), group, name)
+	} else {
+		output, err = orch.listRepositoryUsers(r.Context(), group, name)
+	}
+
 	if err != nil {
 		handleError(w, err)
 		return
@@ -219,6 +267,15 @@ func (s *server) UsersUpdateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the keys of the users of a repository pending deletion stay disabled until it's restored
+	if name != "" && (strings.EqualFold(req.Status, "active") || req.ResetKey) {
+		ecrOrch := newEcrOrchestrator(ecr.New(ecr.WithSession(session.Session)), s.org)
+		if err := ecrOrch.repositoryPendingDeletion(r.Context(), group, name); err != nil {
+			handleError(w, err)
+			return
+		}
+	}
+
 	orch := newIamOrchestrator(
 		iam.New(iam.WithSession(session.Session)),
 		s.org,
@@ -230,6 +287,13 @@ func (s *server) UsersUpdateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.ResetKey {
+		s.notify(r.Context(), notificationUserKeyRotated, account, group, &UserNotification{
+			Repository: repositoryUserResource(group, name),
+			UserName:   resp.UserName,
+		})
+	}
+
 	j, err := json.Marshal(resp)
 	if err != nil {
 		handleError(w, errors.Wrap(err, "unable to marshal response"))
@@ -280,7 +344,141 @@ func (s *server) UsersDeleteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.notify(r.Context(), notificationUserDeleted, account, group, &UserNotification{
+		Repository: repositoryUserResource(group, name),
+		UserName:   userName,
+	})
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
 }
+
+// UsersDormantHandler starts a report of the repository user access keys in the org that have never been
+// used or haven't been used in the given number of days
+func (s *server) UsersDormantHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := vars["account"]
+
+	days := defaultDormantDays
+	if d := r.URL.Query().Get("days"); d != "" {
+		var err error
+		if days, err = strconv.Atoi(d); err != nil || days <= 0 {
+			handleError(w, apierror.New(apierror.ErrBadRequest, "days must be a positive number", nil))
+			return
+		}
+	}
+
+	report, err := s.startDormantAccessKeysReport(r.Context(), account, days)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "failed to find dormant access keys"))
+		return
+	}
+
+	j, err := json.Marshal(report)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "unable to marshal response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(j)
+}
+
+// UsersExpiredHandler deletes the repository users in the org that are past their expiry
+func (s *server) UsersExpiredHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := vars["account"]
+
+	dryRun, err := queryBool(r, "dryrun")
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	resp, err := s.reapExpiredUsers(r.Context(), account, dryRun)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "failed to delete expired users"))
+		return
+	}
+
+	j, err := json.Marshal(resp)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "unable to marshal response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// UsersReconcileHandler repairs drift in the managed policies and groups of the user roles
+func (s *server) UsersReconcileHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := vars["account"]
+
+	dryRun, err := queryBool(r, "dryrun")
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	resp, err := s.reconcileUserPolicies(r.Context(), account, dryRun)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "failed to reconcile user policies"))
+		return
+	}
+
+	j, err := json.Marshal(resp)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "unable to marshal response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// UsersOrphanedListHandler starts a report of the repository users in the org whose repository no longer exists
+func (s *server) UsersOrphanedListHandler(w http.ResponseWriter, r *http.Request) {
+	s.usersOrphaned(w, r, true)
+}
+
+// UsersOrphanedDeleteHandler starts deleting the repository users in the org whose repository no longer exists
+func (s *server) UsersOrphanedDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := queryBool(r, "dryrun")
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	s.usersOrphaned(w, r, dryRun)
+}
+
+func (s *server) usersOrphaned(w http.ResponseWriter, r *http.Request, dryRun bool) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := vars["account"]
+
+	resp, err := s.startOrphanedUsersSweep(r.Context(), account, dryRun)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "failed to sweep orphaned users"))
+		return
+	}
+
+	j, err := json.Marshal(resp)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "unable to marshal response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(j)
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// WebhooksCreateHandler registers a webhook for a space.  The signing secret is only returned in this response.
+func (s *server) WebhooksCreateHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+
+	req := WebhookCreateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		msg := fmt.Sprintf("cannot decode body into create webhook input: %s", err)
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	resp, err := s.createWebhook(r.Context(), account, group, &req)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "failed to create webhook"))
+		return
+	}
+
+	j, err := json.Marshal(resp)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "unable to marshal response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// WebhooksListHandler lists the webhooks for a space
+func (s *server) WebhooksListHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+
+	resp, err := s.listWebhooks(r.Context(), account, group)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "failed to list webhooks"))
+		return
+	}
+
+	j, err := json.Marshal(resp)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "unable to marshal response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// WebhooksShowHandler gets the details about a webhook
+func (s *server) WebhooksShowHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+	id := vars["id"]
+
+	resp, err := s.getWebhook(r.Context(), account, group, id)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "failed to get webhook"))
+		return
+	}
+
+	j, err := json.Marshal(resp)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "unable to marshal response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// WebhooksDeleteHandler deletes a webhook and its delivery logs
+func (s *server) WebhooksDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+	id := vars["id"]
+
+	if err := s.deleteWebhook(r.Context(), account, group, id); err != nil {
+		handleError(w, errors.Wrap(err, "failed to delete webhook"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+// WebhooksDeliveriesHandler lists the delivery logs for a webhook, optionally only the failed deliveries
+func (s *server) WebhooksDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+	id := vars["id"]
+
+	failed, err := webhookFailuresOnly(r.URL.Query().Get("status"))
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	resp, err := s.listWebhookDeliveries(r.Context(), account, group, id, failed)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "failed to list webhook deliveries"))
+		return
+	}
+
+	j, err := json.Marshal(resp)
+	if err != nil {
+		handleError(w, errors.Wrap(err, "unable to marshal response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
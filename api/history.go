@@ -0,0 +1,269 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/ecr-api/store"
+	"github.com/aws/aws-sdk-go/aws"
+	log "github.com/sirupsen/logrus"
+)
+
+// findingsHistoryBucket is the store bucket for findings snapshots, keyed by
+// {account}/{repository}@{digest}/{scan completed at}
+const findingsHistoryBucket = "findings_history"
+
+// findingsHistoryRetention is the number of scans kept in the findings history of a repository
+const findingsHistoryRetention = 200
+
+// newFindingsSnapshot summarizes the findings of a completed image scan.  It returns nil if the
+// scan hasn't completed.
+func newFindingsSnapshot(repository, digest string, tags []string, findings *ImageScanFindings, now time.Time) *FindingsSnapshot {
+	if findings == nil || findings.ImageScanCompletedAt == nil || digest == "" {
+		return nil
+	}
+
+	return &FindingsSnapshot{
+		Repository:               repository,
+		ImageDigest:              digest,
+		ImageTags:                tags,
+		ImageScanCompletedAt:     findings.ImageScanCompletedAt.UTC(),
+		RecordedAt:               now.UTC(),
+		SeverityCounts:           findings.severityCounts(),
+		SuppressedSeverityCounts: findings.SuppressedSeverityCounts,
+		CVEs:                     findings.cves(),
+	}
+}
+
+// severityCounts returns the number of findings per severity
+func (findings *ImageScanFindings) severityCounts() map[string]int64 {
+	counts := map[string]int64{}
+	if findings == nil {
+		return counts
+	}
+
+	for severity, count := range findings.FindingSeverityCounts {
+		counts[severity] = aws.Int64Value(count)
+	}
+
+	return counts
+}
+
+// cves returns the sorted, unique CVEs (vulnerability ids) from the basic and enhanced findings
+func (findings *ImageScanFindings) cves() []string {
+	if findings == nil {
+		return []string{}
+	}
+
+	cves := map[string]bool{}
+	for _, f := range findings.Findings {
+		if f.ImageScanFinding != nil && f.Name != nil {
+			cves[aws.StringValue(f.Name)] = true
+		}
+	}
+
+	for _, f := range findings.EnhancedFindings {
+		if cve := f.VulnerabilityId(); cve != "" {
+			cves[cve] = true
+		}
+	}
+
+	return sortedKeys(cves)
+}
+
+// findingsHistoryKey returns the store key for a snapshot.  A scan is only recorded once, fetching its
+// findings again doesn't change the snapshot.
+func findingsHistoryKey(account string, snapshot *FindingsSnapshot) string {
+	return fmt.Sprintf("%s/%s@%s/%s", account, snapshot.Repository, snapshot.ImageDigest, snapshot.ImageScanCompletedAt.Format(time.RFC3339))
+}
+
+// recordFindings persists the findings snapshot for an image if the scan wasn't recorded before, it's a no-op
+// for a nil snapshot.  It returns true if the snapshot was recorded, the findings of the same scan can be
+// fetched by concurrent requests and only one of them records it.
+func (s *server) recordFindings(ctx context.Context, account string, snapshot *FindingsSnapshot) (bool, error) {
+	if snapshot == nil {
+		return false, nil
+	}
+
+	recorded, err := store.CreateJSON(ctx, s.store, findingsHistoryBucket, findingsHistoryKey(account, snapshot), snapshot)
+	if err != nil || !recorded {
+		return false, err
+	}
+
+	log.Debugf("recorded findings snapshot for %s@%s scanned at %s", snapshot.Repository, snapshot.ImageDigest, snapshot.ImageScanCompletedAt)
+
+	if err := s.pruneFindingsHistory(ctx, account, snapshot.Repository); err != nil {
+		log.Warnf("failed to prune the findings history of %s: %s", snapshot.Repository, err)
+	}
+
+	return true, nil
+}
+
+// pruneFindingsHistory deletes the snapshots of the oldest scans of a repository beyond the retention limit
+func (s *server) pruneFindingsHistory(ctx context.Context, account, repository string) error {
+	snapshots, err := s.findingsHistory(ctx, account, repository)
+	if err != nil {
+		return err
+	}
+
+	if len(snapshots) <= findingsHistoryRetention {
+		return nil
+	}
+
+	// snapshots are sorted oldest first
+	for _, snapshot := range snapshots[:len(snapshots)-findingsHistoryRetention] {
+		log.Debugf("pruning findings snapshot for %s@%s scanned at %s", snapshot.Repository, snapshot.ImageDigest, snapshot.ImageScanCompletedAt)
+
+		if err := s.store.Delete(ctx, findingsHistoryBucket, findingsHistoryKey(account, snapshot)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findingsHistory lists the findings snapshots for a repository, oldest scan first
+func (s *server) findingsHistory(ctx context.Context, account, repository string) ([]*FindingsSnapshot, error) {
+	items, err := s.store.List(ctx, findingsHistoryBucket, account+"/"+repository+"@")
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]*FindingsSnapshot, 0, len(items))
+	for key, item := range items {
+		snapshot := &FindingsSnapshot{}
+		if err := json.Unmarshal(item, snapshot); err != nil {
+			log.Warnf("failed to unmarshal findings snapshot %s: %s", key, err)
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].ImageScanCompletedAt.Before(snapshots[j].ImageScanCompletedAt)
+	})
+
+	return snapshots, nil
+}
+
+// findingsTrend returns the vulnerability trend for a repository from the recorded snapshots.  If from and to
+// image digests are given, the latest snapshots of the two images are also compared.
+func (s *server) findingsTrend(ctx context.Context, account, repository, from, to string) (*FindingsTrendResponse, error) {
+	if (from == "") != (to == "") {
+		return nil, apierror.New(apierror.ErrBadRequest, "both from and to are required to compare images", nil)
+	}
+
+	snapshots, err := s.findingsHistory(ctx, account, repository)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &FindingsTrendResponse{
+		Repository: repository,
+		Points:     make([]*FindingsTrendPoint, 0, len(snapshots)),
+	}
+
+	var previous []string
+	for _, snapshot := range snapshots {
+		introduced, fixed := cveDiff(previous, snapshot.CVEs)
+		resp.Points = append(resp.Points, &FindingsTrendPoint{
+			ImageDigest:          snapshot.ImageDigest,
+			ImageTags:            snapshot.ImageTags,
+			ImageScanCompletedAt: snapshot.ImageScanCompletedAt,
+			SeverityCounts:       snapshot.SeverityCounts,
+			Introduced:           introduced,
+			Fixed:                fixed,
+		})
+		previous = snapshot.CVEs
+	}
+
+	if from == "" {
+		return resp, nil
+	}
+
+	// snapshots are sorted oldest first, so the last match is the latest scan of the image
+	var fromSnapshot, toSnapshot *FindingsSnapshot
+	for _, snapshot := range snapshots {
+		if snapshot.ImageDigest == from {
+			fromSnapshot = snapshot
+		}
+
+		if snapshot.ImageDigest == to {
+			toSnapshot = snapshot
+		}
+	}
+
+	if fromSnapshot == nil || toSnapshot == nil {
+		msg := fmt.Sprintf("no findings history for both %s and %s in %s", from, to, repository)
+		return nil, apierror.New(apierror.ErrNotFound, msg, nil)
+	}
+
+	introduced, fixed := cveDiff(fromSnapshot.CVEs, toSnapshot.CVEs)
+	resp.Comparison = &FindingsComparison{
+		From:                 from,
+		To:                   to,
+		Introduced:           introduced,
+		Fixed:                fixed,
+		SeverityCountsDeltas: severityCountsDeltas(fromSnapshot.SeverityCounts, toSnapshot.SeverityCounts),
+	}
+
+	return resp, nil
+}
+
+// cveDiff returns the CVEs in to that aren't in from (introduced) and the CVEs in from that aren't in to (fixed)
+func cveDiff(from, to []string) ([]string, []string) {
+	fromSet := map[string]bool{}
+	for _, cve := range from {
+		fromSet[strings.ToUpper(cve)] = true
+	}
+
+	toSet := map[string]bool{}
+	for _, cve := range to {
+		toSet[strings.ToUpper(cve)] = true
+	}
+
+	introduced := []string{}
+	for _, cve := range to {
+		if !fromSet[strings.ToUpper(cve)] {
+			introduced = append(introduced, cve)
+		}
+	}
+
+	fixed := []string{}
+	for _, cve := range from {
+		if !toSet[strings.ToUpper(cve)] {
+			fixed = append(fixed, cve)
+		}
+	}
+
+	return introduced, fixed
+}
+
+// severityCountsDeltas returns the change in the count of each severity from one image to another
+func severityCountsDeltas(from, to map[string]int64) map[string]int64 {
+	deltas := map[string]int64{}
+	for severity, count := range to {
+		deltas[severity] += count
+	}
+
+	for severity, count := range from {
+		deltas[severity] -= count
+	}
+
+	return deltas
+}
+
+// sortedKeys returns the sorted keys of the set
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
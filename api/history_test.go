@@ -0,0 +1,211 @@
+package api
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ecr-api/store"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+func testSnapshotFindings(completedAt time.Time, counts map[string]int64, cves ...string) *ImageScanFindings {
+	findings := &ImageScanFindings{
+		FindingSeverityCounts: map[string]*int64{},
+		ImageScanCompletedAt:  aws.Time(completedAt),
+	}
+
+	for severity, count := range counts {
+		findings.FindingSeverityCounts[severity] = aws.Int64(count)
+	}
+
+	for _, cve := range cves {
+		findings.Findings = append(findings.Findings, &ImageScanFinding{
+			ImageScanFinding: &ecr.ImageScanFinding{Name: aws.String(cve), Severity: aws.String("HIGH")},
+		})
+	}
+
+	return findings
+}
+
+func Test_newFindingsSnapshot(t *testing.T) {
+	findings := testSnapshotFindings(testNow, map[string]int64{"HIGH": 2}, "CVE-0000-0002", "CVE-0000-0001", "CVE-0000-0002")
+	findings.EnhancedFindings = []*EnhancedImageScanFinding{
+		{
+			EnhancedImageScanFinding: &ecr.EnhancedImageScanFinding{
+				PackageVulnerabilityDetails: &ecr.PackageVulnerabilityDetails{VulnerabilityId: aws.String("CVE-0000-0003")},
+			},
+		},
+	}
+
+	got := newFindingsSnapshot("spindev-00001/rudolph", "sha256:0000", []string{"latest"}, findings, testNow)
+	want := &FindingsSnapshot{
+		Repository:           "spindev-00001/rudolph",
+		ImageDigest:          "sha256:0000",
+		ImageTags:            []string{"latest"},
+		ImageScanCompletedAt: testNow,
+		RecordedAt:           testNow,
+		SeverityCounts:       map[string]int64{"HIGH": 2},
+		CVEs:                 []string{"CVE-0000-0001", "CVE-0000-0002", "CVE-0000-0003"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("newFindingsSnapshot() = %+v, want %+v", got, want)
+	}
+
+	if got := newFindingsSnapshot("spindev-00001/rudolph", "sha256:0000", nil, &ImageScanFindings{}, testNow); got != nil {
+		t.Errorf("expected nil snapshot for incomplete scan, got %+v", got)
+	}
+}
+
+func TestServer_recordFindings(t *testing.T) {
+	ctx := context.Background()
+	s := &server{store: store.NewMemoryStore()}
+
+	// only one of the concurrent requests fetching the same scan records it
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	recorded := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			snapshot := newFindingsSnapshot("spindev-00001/rudolph", "sha256:0000", nil, testSnapshotFindings(testNow, map[string]int64{"HIGH": 1}, "CVE-0000-0001"), time.Now())
+			ok, err := s.recordFindings(ctx, "12345", snapshot)
+			if err != nil {
+				t.Errorf("unexpected error recording findings: %s", err)
+			}
+
+			if ok {
+				mu.Lock()
+				recorded++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if recorded != 1 {
+		t.Errorf("expected the scan to be recorded once, got %d", recorded)
+	}
+
+	// the oldest scans are pruned beyond the retention limit
+	for i := 1; i <= findingsHistoryRetention+1; i++ {
+		snapshot := newFindingsSnapshot("spindev-00001/rudolph", "sha256:0000", nil, testSnapshotFindings(testNow.Add(time.Duration(i)*time.Hour), nil), testNow)
+		if _, err := s.recordFindings(ctx, "12345", snapshot); err != nil {
+			t.Fatalf("unexpected error recording findings: %s", err)
+		}
+	}
+
+	snapshots, err := s.findingsHistory(ctx, "12345", "spindev-00001/rudolph")
+	if err != nil {
+		t.Fatalf("unexpected error getting history: %s", err)
+	}
+
+	if len(snapshots) != findingsHistoryRetention {
+		t.Fatalf("expected %d snapshots, got %d", findingsHistoryRetention, len(snapshots))
+	}
+
+	if !snapshots[0].ImageScanCompletedAt.Equal(testNow.Add(2 * time.Hour)) {
+		t.Errorf("expected the 2 oldest scans to be pruned, the oldest is %s", snapshots[0].ImageScanCompletedAt)
+	}
+}
+
+func Test_cveDiff(t *testing.T) {
+	introduced, fixed := cveDiff([]string{"CVE-0000-0001", "CVE-0000-0002"}, []string{"cve-0000-0002", "CVE-0000-0003"})
+	if !reflect.DeepEqual(introduced, []string{"CVE-0000-0003"}) {
+		t.Errorf("expected introduced [CVE-0000-0003], got %v", introduced)
+	}
+
+	if !reflect.DeepEqual(fixed, []string{"CVE-0000-0001"}) {
+		t.Errorf("expected fixed [CVE-0000-0001], got %v", fixed)
+	}
+}
+
+func TestServer_findingsTrend(t *testing.T) {
+	ctx := context.Background()
+	s := &server{store: store.NewMemoryStore()}
+
+	snapshots := []*FindingsSnapshot{
+		newFindingsSnapshot("spindev-00001/rudolph", "sha256:0000", nil, testSnapshotFindings(testNow, map[string]int64{"HIGH": 2}, "CVE-0000-0001", "CVE-0000-0002"), testNow),
+		newFindingsSnapshot("spindev-00001/rudolph", "sha256:1111", nil, testSnapshotFindings(testNow.Add(time.Hour), map[string]int64{"HIGH": 1, "LOW": 1}, "CVE-0000-0002", "CVE-0000-0003"), testNow),
+		// same scan fetched again shouldn't add a point
+		newFindingsSnapshot("spindev-00001/rudolph", "sha256:1111", nil, testSnapshotFindings(testNow.Add(time.Hour), map[string]int64{"HIGH": 1, "LOW": 1}, "CVE-0000-0002", "CVE-0000-0003"), testNow.Add(time.Minute)),
+		// a repository with a name sharing the prefix shouldn't be included
+		newFindingsSnapshot("spindev-00001/rudolph2", "sha256:2222", nil, testSnapshotFindings(testNow, map[string]int64{"HIGH": 1}, "CVE-0000-0009"), testNow),
+	}
+
+	for i, snapshot := range snapshots {
+		recorded, err := s.recordFindings(ctx, "12345", snapshot)
+		if err != nil {
+			t.Fatalf("unexpected error recording findings: %s", err)
+		}
+
+		if recorded != (i != 2) {
+			t.Errorf("expected snapshot %d to be recorded %t, got %t", i, i != 2, recorded)
+		}
+	}
+
+	if _, err := s.recordFindings(ctx, "12345", nil); err != nil {
+		t.Errorf("unexpected error recording nil snapshot: %s", err)
+	}
+
+	trend, err := s.findingsTrend(ctx, "12345", "spindev-00001/rudolph", "sha256:0000", "sha256:1111")
+	if err != nil {
+		t.Fatalf("unexpected error getting trend: %s", err)
+	}
+
+	if len(trend.Points) != 2 {
+		t.Fatalf("expected 2 trend points, got %d", len(trend.Points))
+	}
+
+	if p := trend.Points[0]; p.ImageDigest != "sha256:0000" || len(p.Introduced) != 2 || len(p.Fixed) != 0 {
+		t.Errorf("unexpected first point %+v", p)
+	}
+
+	if p := trend.Points[1]; !reflect.DeepEqual(p.Introduced, []string{"CVE-0000-0003"}) || !reflect.DeepEqual(p.Fixed, []string{"CVE-0000-0001"}) {
+		t.Errorf("unexpected second point %+v", p)
+	}
+
+	wantComparison := &FindingsComparison{
+		From:                 "sha256:0000",
+		To:                   "sha256:1111",
+		Introduced:           []string{"CVE-0000-0003"},
+		Fixed:                []string{"CVE-0000-0001"},
+		SeverityCountsDeltas: map[string]int64{"HIGH": -1, "LOW": 1},
+	}
+	if !reflect.DeepEqual(trend.Comparison, wantComparison) {
+		t.Errorf("expected comparison %+v, got %+v", wantComparison, trend.Comparison)
+	}
+
+	// comparing an image with itself has no differences
+	trend, err = s.findingsTrend(ctx, "12345", "spindev-00001/rudolph", "sha256:1111", "sha256:1111")
+	if err != nil {
+		t.Fatalf("unexpected error comparing an image with itself: %s", err)
+	}
+
+	if c := trend.Comparison; c == nil || len(c.Introduced) != 0 || len(c.Fixed) != 0 {
+		t.Errorf("expected an empty comparison, got %+v", c)
+	}
+
+	if _, err := s.findingsTrend(ctx, "12345", "spindev-00001/rudolph", "sha256:0000", ""); err == nil {
+		t.Error("expected error comparing without a to digest, got nil")
+	}
+
+	if _, err := s.findingsTrend(ctx, "12345", "spindev-00001/rudolph", "sha256:0000", "sha256:9999"); err == nil {
+		t.Error("expected error comparing with an unknown digest, got nil")
+	}
+
+	trend, err = s.findingsTrend(ctx, "67890", "spindev-00001/rudolph", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error getting trend: %s", err)
+	}
+
+	if len(trend.Points) != 0 || trend.Comparison != nil {
+		t.Errorf("expected empty trend for other account, got %+v", trend)
+	}
+}
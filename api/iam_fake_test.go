@@ -0,0 +1,549 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+)
+
+// fakeIAM is an in-memory iam service for testing orchestration against
+type fakeIAM struct {
+	iamiface.IAMAPI
+
+	mu          sync.Mutex
+	users       map[string]*iam.User
+	keys        map[string][]*iam.AccessKeyMetadata
+	groups      map[string]*iam.Group
+	members     map[string]map[string]bool
+	attached    map[string][]string
+	policies    map[string]*iam.Policy
+	versions    map[string][]*iam.PolicyVersion
+	lastVersion map[string]int
+	lastUsed    map[string]*iam.AccessKeyLastUsed
+	keyCount    int
+}
+
+func newFakeIAM() *fakeIAM {
+	return &fakeIAM{
+		users:       map[string]*iam.User{},
+		keys:        map[string][]*iam.AccessKeyMetadata{},
+		groups:      map[string]*iam.Group{},
+		members:     map[string]map[string]bool{},
+		attached:    map[string][]string{},
+		policies:    map[string]*iam.Policy{},
+		versions:    map[string][]*iam.PolicyVersion{},
+		lastVersion: map[string]int{},
+		lastUsed:    map[string]*iam.AccessKeyLastUsed{},
+	}
+}
+
+func noSuchEntity(kind, name string) error {
+	return awserr.New(iam.ErrCodeNoSuchEntityException, fmt.Sprintf("%s %s not found", kind, name), nil)
+}
+
+func (f *fakeIAM) CreateUserWithContext(ctx aws.Context, input *iam.CreateUserInput, opts ...request.Option) (*iam.CreateUserOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.StringValue(input.UserName)
+	if _, ok := f.users[name]; ok {
+		return nil, awserr.New(iam.ErrCodeEntityAlreadyExistsException, "user exists", nil)
+	}
+
+	u := &iam.User{
+		UserName:   input.UserName,
+		Path:       input.Path,
+		Arn:        aws.String(fmt.Sprintf("arn:aws:iam::12345:user%s%s", aws.StringValue(input.Path), name)),
+		CreateDate: aws.Time(time.Now()),
+		Tags:       input.Tags,
+	}
+	f.users[name] = u
+
+	return &iam.CreateUserOutput{User: u}, nil
+}
+
+func (f *fakeIAM) WaitUntilUserExistsWithContext(ctx aws.Context, input *iam.GetUserInput, opts ...request.WaiterOption) error {
+	return nil
+}
+
+func (f *fakeIAM) GetUserWithContext(ctx aws.Context, input *iam.GetUserInput, opts ...request.Option) (*iam.GetUserOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u, ok := f.users[aws.StringValue(input.UserName)]
+	if !ok {
+		return nil, noSuchEntity("user", aws.StringValue(input.UserName))
+	}
+
+	return &iam.GetUserOutput{User: u}, nil
+}
+
+func (f *fakeIAM) ListUsersWithContext(ctx aws.Context, input *iam.ListUsersInput, opts ...request.Option) (*iam.ListUsersOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	names := make([]string, 0, len(f.users))
+	for name, u := range f.users {
+		if strings.HasPrefix(aws.StringValue(u.Path), aws.StringValue(input.PathPrefix)) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	out := &iam.ListUsersOutput{}
+	for _, name := range names {
+		out.Users = append(out.Users, f.users[name])
+	}
+
+	return out, nil
+}
+
+func (f *fakeIAM) DeleteUserWithContext(ctx aws.Context, input *iam.DeleteUserInput, opts ...request.Option) (*iam.DeleteUserOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.StringValue(input.UserName)
+	if _, ok := f.users[name]; !ok {
+		return nil, noSuchEntity("user", name)
+	}
+
+	if len(f.keys[name]) > 0 {
+		return nil, awserr.New(iam.ErrCodeDeleteConflictException, "user has access keys", nil)
+	}
+
+	for _, members := range f.members {
+		if members[name] {
+			return nil, awserr.New(iam.ErrCodeDeleteConflictException, "user is in a group", nil)
+		}
+	}
+
+	delete(f.users, name)
+
+	return &iam.DeleteUserOutput{}, nil
+}
+
+func (f *fakeIAM) UpdateUserWithContext(ctx aws.Context, input *iam.UpdateUserInput, opts ...request.Option) (*iam.UpdateUserOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.StringValue(input.UserName)
+	u, ok := f.users[name]
+	if !ok {
+		return nil, noSuchEntity("user", name)
+	}
+
+	newName := aws.StringValue(input.NewUserName)
+	if _, ok := f.users[newName]; ok && newName != name {
+		return nil, awserr.New(iam.ErrCodeEntityAlreadyExistsException, "user exists", nil)
+	}
+
+	u.UserName = input.NewUserName
+	u.Path = input.NewPath
+	u.Arn = aws.String(fmt.Sprintf("arn:aws:iam::12345:user%s%s", aws.StringValue(input.NewPath), newName))
+
+	delete(f.users, name)
+	f.users[newName] = u
+
+	keys := f.keys[name]
+	delete(f.keys, name)
+	for _, k := range keys {
+		k.UserName = input.NewUserName
+	}
+	f.keys[newName] = keys
+
+	for _, members := range f.members {
+		if members[name] {
+			delete(members, name)
+			members[newName] = true
+		}
+	}
+
+	return &iam.UpdateUserOutput{}, nil
+}
+
+func (f *fakeIAM) TagUserWithContext(ctx aws.Context, input *iam.TagUserInput, opts ...request.Option) (*iam.TagUserOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u, ok := f.users[aws.StringValue(input.UserName)]
+	if !ok {
+		return nil, noSuchEntity("user", aws.StringValue(input.UserName))
+	}
+
+	for _, t := range input.Tags {
+		replaced := false
+		for _, ut := range u.Tags {
+			if aws.StringValue(ut.Key) == aws.StringValue(t.Key) {
+				ut.Value = t.Value
+				replaced = true
+			}
+		}
+
+		if !replaced {
+			u.Tags = append(u.Tags, &iam.Tag{Key: t.Key, Value: t.Value})
+		}
+	}
+
+	return &iam.TagUserOutput{}, nil
+}
+
+func (f *fakeIAM) CreateAccessKeyWithContext(ctx aws.Context, input *iam.CreateAccessKeyInput, opts ...request.Option) (*iam.CreateAccessKeyOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.StringValue(input.UserName)
+	if _, ok := f.users[name]; !ok {
+		return nil, noSuchEntity("user", name)
+	}
+
+	f.keyCount++
+	id := fmt.Sprintf("AKIA%012d", f.keyCount)
+	now := time.Now()
+
+	f.keys[name] = append(f.keys[name], &iam.AccessKeyMetadata{
+		AccessKeyId: aws.String(id),
+		CreateDate:  aws.Time(now),
+		Status:      aws.String(iam.StatusTypeActive),
+		UserName:    aws.String(name),
+	})
+
+	return &iam.CreateAccessKeyOutput{
+		AccessKey: &iam.AccessKey{
+			AccessKeyId:     aws.String(id),
+			CreateDate:      aws.Time(now),
+			SecretAccessKey: aws.String("secret-" + id),
+			Status:          aws.String(iam.StatusTypeActive),
+			UserName:        aws.String(name),
+		},
+	}, nil
+}
+
+func (f *fakeIAM) ListAccessKeysWithContext(ctx aws.Context, input *iam.ListAccessKeysInput, opts ...request.Option) (*iam.ListAccessKeysOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.StringValue(input.UserName)
+	if _, ok := f.users[name]; !ok {
+		return nil, noSuchEntity("user", name)
+	}
+
+	return &iam.ListAccessKeysOutput{AccessKeyMetadata: append([]*iam.AccessKeyMetadata{}, f.keys[name]...)}, nil
+}
+
+func (f *fakeIAM) DeleteAccessKeyWithContext(ctx aws.Context, input *iam.DeleteAccessKeyInput, opts ...request.Option) (*iam.DeleteAccessKeyOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.StringValue(input.UserName)
+	keys := f.keys[name]
+	for i, k := range keys {
+		if aws.StringValue(k.AccessKeyId) == aws.StringValue(input.AccessKeyId) {
+			f.keys[name] = append(keys[:i], keys[i+1:]...)
+			return &iam.DeleteAccessKeyOutput{}, nil
+		}
+	}
+
+	return nil, noSuchEntity("access key", aws.StringValue(input.AccessKeyId))
+}
+
+func (f *fakeIAM) CreateGroupWithContext(ctx aws.Context, input *iam.CreateGroupInput, opts ...request.Option) (*iam.CreateGroupOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.StringValue(input.GroupName)
+	if _, ok := f.groups[name]; ok {
+		return nil, awserr.New(iam.ErrCodeEntityAlreadyExistsException, "group exists", nil)
+	}
+
+	g := &iam.Group{GroupName: input.GroupName, Path: input.Path}
+	f.groups[name] = g
+	f.members[name] = map[string]bool{}
+
+	return &iam.CreateGroupOutput{Group: g}, nil
+}
+
+func (f *fakeIAM) GetGroupWithContext(ctx aws.Context, input *iam.GetGroupInput, opts ...request.Option) (*iam.GetGroupOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	g, ok := f.groups[aws.StringValue(input.GroupName)]
+	if !ok {
+		return nil, noSuchEntity("group", aws.StringValue(input.GroupName))
+	}
+
+	return &iam.GetGroupOutput{Group: g}, nil
+}
+
+func (f *fakeIAM) AddUserToGroupWithContext(ctx aws.Context, input *iam.AddUserToGroupInput, opts ...request.Option) (*iam.AddUserToGroupOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	group := aws.StringValue(input.GroupName)
+	if _, ok := f.groups[group]; !ok {
+		return nil, noSuchEntity("group", group)
+	}
+
+	if _, ok := f.users[aws.StringValue(input.UserName)]; !ok {
+		return nil, noSuchEntity("user", aws.StringValue(input.UserName))
+	}
+
+	f.members[group][aws.StringValue(input.UserName)] = true
+
+	return &iam.AddUserToGroupOutput{}, nil
+}
+
+func (f *fakeIAM) RemoveUserFromGroupWithContext(ctx aws.Context, input *iam.RemoveUserFromGroupInput, opts ...request.Option) (*iam.RemoveUserFromGroupOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	group := aws.StringValue(input.GroupName)
+	if !f.members[group][aws.StringValue(input.UserName)] {
+		return nil, noSuchEntity("group member", aws.StringValue(input.UserName))
+	}
+
+	delete(f.members[group], aws.StringValue(input.UserName))
+
+	return &iam.RemoveUserFromGroupOutput{}, nil
+}
+
+func (f *fakeIAM) ListGroupsForUserWithContext(ctx aws.Context, input *iam.ListGroupsForUserInput, opts ...request.Option) (*iam.ListGroupsForUserOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	names := []string{}
+	for group, members := range f.members {
+		if members[aws.StringValue(input.UserName)] {
+			names = append(names, group)
+		}
+	}
+	sort.Strings(names)
+
+	out := &iam.ListGroupsForUserOutput{}
+	for _, name := range names {
+		out.Groups = append(out.Groups, f.groups[name])
+	}
+
+	return out, nil
+}
+
+func (f *fakeIAM) AttachGroupPolicyWithContext(ctx aws.Context, input *iam.AttachGroupPolicyInput, opts ...request.Option) (*iam.AttachGroupPolicyOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	group := aws.StringValue(input.GroupName)
+	f.attached[group] = append(f.attached[group], aws.StringValue(input.PolicyArn))
+
+	return &iam.AttachGroupPolicyOutput{}, nil
+}
+
+func (f *fakeIAM) ListAttachedGroupPoliciesPagesWithContext(ctx aws.Context, input *iam.ListAttachedGroupPoliciesInput, fn func(*iam.ListAttachedGroupPoliciesOutput, bool) bool, opts ...request.Option) error {
+	f.mu.Lock()
+	out := &iam.ListAttachedGroupPoliciesOutput{}
+	for _, arn := range f.attached[aws.StringValue(input.GroupName)] {
+		out.AttachedPolicies = append(out.AttachedPolicies, &iam.AttachedPolicy{PolicyArn: aws.String(arn)})
+	}
+	f.mu.Unlock()
+
+	fn(out, true)
+	return nil
+}
+
+func (f *fakeIAM) CreatePolicyWithContext(ctx aws.Context, input *iam.CreatePolicyInput, opts ...request.Option) (*iam.CreatePolicyOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	arn := fmt.Sprintf("arn:aws:iam::12345:policy%s%s", aws.StringValue(input.Path), aws.StringValue(input.PolicyName))
+	if _, ok := f.policies[arn]; ok {
+		return nil, awserr.New(iam.ErrCodeEntityAlreadyExistsException, "policy exists", nil)
+	}
+
+	p := &iam.Policy{
+		Arn:              aws.String(arn),
+		Path:             input.Path,
+		PolicyName:       input.PolicyName,
+		DefaultVersionId: aws.String("v1"),
+	}
+	f.policies[arn] = p
+	f.lastVersion[arn] = 1
+	f.versions[arn] = []*iam.PolicyVersion{
+		{
+			VersionId:        aws.String("v1"),
+			IsDefaultVersion: aws.Bool(true),
+			Document:         aws.String(url.QueryEscape(aws.StringValue(input.PolicyDocument))),
+			CreateDate:       aws.Time(time.Now()),
+		},
+	}
+
+	return &iam.CreatePolicyOutput{Policy: p}, nil
+}
+
+func (f *fakeIAM) WaitUntilPolicyExistsWithContext(ctx aws.Context, input *iam.GetPolicyInput, opts ...request.WaiterOption) error {
+	return nil
+}
+
+func (f *fakeIAM) ListPoliciesPagesWithContext(ctx aws.Context, input *iam.ListPoliciesInput, fn func(*iam.ListPoliciesOutput, bool) bool, opts ...request.Option) error {
+	f.mu.Lock()
+	out := &iam.ListPoliciesOutput{}
+	for _, p := range f.policies {
+		if strings.HasPrefix(aws.StringValue(p.Path), aws.StringValue(input.PathPrefix)) {
+			out.Policies = append(out.Policies, p)
+		}
+	}
+	f.mu.Unlock()
+
+	fn(out, true)
+	return nil
+}
+
+func (f *fakeIAM) GetPolicyVersionWithContext(ctx aws.Context, input *iam.GetPolicyVersionInput, opts ...request.Option) (*iam.GetPolicyVersionOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, v := range f.versions[aws.StringValue(input.PolicyArn)] {
+		if aws.StringValue(v.VersionId) == aws.StringValue(input.VersionId) {
+			return &iam.GetPolicyVersionOutput{PolicyVersion: v}, nil
+		}
+	}
+
+	return nil, noSuchEntity("policy version", aws.StringValue(input.VersionId))
+}
+
+func (f *fakeIAM) CreatePolicyVersionWithContext(ctx aws.Context, input *iam.CreatePolicyVersionInput, opts ...request.Option) (*iam.CreatePolicyVersionOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	arn := aws.StringValue(input.PolicyArn)
+	p, ok := f.policies[arn]
+	if !ok {
+		return nil, noSuchEntity("policy", arn)
+	}
+
+	if len(f.versions[arn]) >= 5 {
+		return nil, awserr.New(iam.ErrCodeLimitExceededException, "policy version limit exceeded", nil)
+	}
+
+	f.lastVersion[arn]++
+	v := &iam.PolicyVersion{
+		VersionId:  aws.String(fmt.Sprintf("v%d", f.lastVersion[arn])),
+		Document:   aws.String(url.QueryEscape(aws.StringValue(input.PolicyDocument))),
+		CreateDate: aws.Time(time.Now()),
+	}
+
+	if aws.BoolValue(input.SetAsDefault) {
+		for _, old := range f.versions[arn] {
+			old.IsDefaultVersion = aws.Bool(false)
+		}
+		v.IsDefaultVersion = aws.Bool(true)
+		p.DefaultVersionId = v.VersionId
+	}
+	f.versions[arn] = append(f.versions[arn], v)
+
+	return &iam.CreatePolicyVersionOutput{PolicyVersion: v}, nil
+}
+
+func (f *fakeIAM) ListUsersPagesWithContext(ctx aws.Context, input *iam.ListUsersInput, fn func(*iam.ListUsersOutput, bool) bool, opts ...request.Option) error {
+	out, err := f.ListUsersWithContext(ctx, input)
+	if err != nil {
+		return err
+	}
+
+	fn(out, true)
+	return nil
+}
+
+func (f *fakeIAM) UpdateAccessKeyWithContext(ctx aws.Context, input *iam.UpdateAccessKeyInput, opts ...request.Option) (*iam.UpdateAccessKeyOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, k := range f.keys[aws.StringValue(input.UserName)] {
+		if aws.StringValue(k.AccessKeyId) == aws.StringValue(input.AccessKeyId) {
+			k.Status = input.Status
+			return &iam.UpdateAccessKeyOutput{}, nil
+		}
+	}
+
+	return nil, noSuchEntity("access key", aws.StringValue(input.AccessKeyId))
+}
+
+// ageAccessKeys sets the creation date of all of the user's access keys
+func (f *fakeIAM) ageAccessKeys(userName string, created time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, k := range f.keys[userName] {
+		k.CreateDate = aws.Time(created)
+	}
+}
+
+func (f *fakeIAM) GetAccessKeyLastUsedWithContext(ctx aws.Context, input *iam.GetAccessKeyLastUsedInput, opts ...request.Option) (*iam.GetAccessKeyLastUsedOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := aws.StringValue(input.AccessKeyId)
+	if lastUsed, ok := f.lastUsed[id]; ok {
+		return &iam.GetAccessKeyLastUsedOutput{AccessKeyLastUsed: lastUsed}, nil
+	}
+
+	// never used
+	return &iam.GetAccessKeyLastUsedOutput{
+		AccessKeyLastUsed: &iam.AccessKeyLastUsed{
+			Region:      aws.String("N/A"),
+			ServiceName: aws.String("N/A"),
+		},
+	}, nil
+}
+
+// useAccessKey records the last use of an access key
+func (f *fakeIAM) useAccessKey(keyId, service string, used time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.lastUsed[keyId] = &iam.AccessKeyLastUsed{
+		LastUsedDate: aws.Time(used),
+		Region:       aws.String("us-east-1"),
+		ServiceName:  aws.String(service),
+	}
+}
+
+func (f *fakeIAM) ListPolicyVersionsWithContext(ctx aws.Context, input *iam.ListPolicyVersionsInput, opts ...request.Option) (*iam.ListPolicyVersionsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	arn := aws.StringValue(input.PolicyArn)
+	if _, ok := f.policies[arn]; !ok {
+		return nil, noSuchEntity("policy", arn)
+	}
+
+	return &iam.ListPolicyVersionsOutput{Versions: f.versions[arn]}, nil
+}
+
+func (f *fakeIAM) DeletePolicyVersionWithContext(ctx aws.Context, input *iam.DeletePolicyVersionInput, opts ...request.Option) (*iam.DeletePolicyVersionOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	arn := aws.StringValue(input.PolicyArn)
+	versions := f.versions[arn]
+	for i, v := range versions {
+		if aws.StringValue(v.VersionId) != aws.StringValue(input.VersionId) {
+			continue
+		}
+
+		if aws.BoolValue(v.IsDefaultVersion) {
+			return nil, awserr.New(iam.ErrCodeDeleteConflictException, "can't delete the default policy version", nil)
+		}
+
+		f.versions[arn] = append(versions[:i:i], versions[i+1:]...)
+		return &iam.DeletePolicyVersionOutput{}, nil
+	}
+
+	return nil, noSuchEntity("policy version", aws.StringValue(input.VersionId))
+}
@@ -0,0 +1,446 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/ecr-api/common"
+	"github.com/YaleSpinup/ecr-api/store"
+	"github.com/aws/aws-sdk-go/aws"
+	awsiam "github.com/aws/aws-sdk-go/service/iam"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// keyRotationBucket is the store bucket for the last key rotation report, keyed by {account}
+	keyRotationBucket = "key_rotation"
+
+	keyRotationActionRotate  = "rotate"
+	keyRotationActionDisable = "disable"
+
+	keyRotationResultRotated  = "rotated"
+	keyRotationResultDisabled = "disabled"
+)
+
+// keyRotation is the access key rotation policy for the org
+type keyRotation struct {
+	maxKeyAge int
+	action    string
+	interval  time.Duration
+	accounts  []string
+	sink      keySink
+}
+
+// newKeyRotation validates the key rotation configuration, it returns nil if rotation is disabled
+func newKeyRotation(config common.KeyRotation) (*keyRotation, error) {
+	if config.MaxKeyAge <= 0 {
+		return nil, nil
+	}
+
+	k := &keyRotation{
+		maxKeyAge: config.MaxKeyAge,
+		action:    strings.ToLower(config.Action),
+		interval:  24 * time.Hour,
+		accounts:  config.Accounts,
+	}
+
+	if config.Interval != "" {
+		interval, err := time.ParseDuration(config.Interval)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid key rotation interval '%s'", config.Interval)
+		}
+		k.interval = interval
+	}
+
+	switch k.action {
+	case keyRotationActionRotate:
+		if config.Sink.Url == "" {
+			return nil, errors.New("a key rotation sink url is required to rotate keys")
+		}
+		k.sink = newHTTPKeySink(config.Sink.Url, config.Sink.Secret)
+	case keyRotationActionDisable:
+	default:
+		return nil, fmt.Errorf("invalid key rotation action '%s', must be one of rotate or disable", config.Action)
+	}
+
+	return k, nil
+}
+
+// RotatedAccessKey is a new access key delivered to the key sink
+type RotatedAccessKey struct {
+	Account         string
+	Repository      string
+	UserName        string
+	AccessKeyId     string
+	SecretAccessKey string
+	// ReplacedAccessKeyIds are the expired keys deleted once the new key is delivered
+	ReplacedAccessKeyIds []string
+	CreatedAt            time.Time
+}
+
+// keySink delivers new access keys to their consumers
+type keySink interface {
+	deliver(ctx context.Context, key *RotatedAccessKey) error
+}
+
+// httpKeySink posts new access keys, signed with the secret, to an endpoint
+type httpKeySink struct {
+	url      string
+	secret   string
+	client   *http.Client
+	attempts int
+	sleep    time.Duration
+}
+
+func newHTTPKeySink(url, secret string) *httpKeySink {
+	return &httpKeySink{
+		url:      url,
+		secret:   secret,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		attempts: 3,
+		sleep:    2 * time.Second,
+	}
+}
+
+func (h *httpKeySink) deliver(ctx context.Context, key *RotatedAccessKey) error {
+	body, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+
+	return retry(h.attempts, h.sleep, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+		if err != nil {
+			return stop{err}
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "ecr-api")
+		req.Header.Set(webhookSignatureHeader, signPayload(h.secret, body))
+
+		res, err := h.client.Do(req)
+		if err != nil {
+			return err
+		}
+		io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+		res.Body.Close()
+
+		if res.StatusCode < 200 || res.StatusCode >= 300 {
+			return fmt.Errorf("unexpected response status %d from key sink", res.StatusCode)
+		}
+
+		return nil
+	})
+}
+
+// repositoryUserFromIAM returns the repository and the repository user name from an iam user in
+// the path /spinup/{org}/{group}/{name}/, the repository is the group for group-wide users
+func repositoryUserFromIAM(org string, u *awsiam.User) (string, string) {
+	repository := strings.Trim(strings.TrimPrefix(aws.StringValue(u.Path), fmt.Sprintf("/spinup/%s/", org)), "/")
+
+	parts := strings.Split(repository, "/")
+	userName := strings.TrimPrefix(aws.StringValue(u.UserName), parts[len(parts)-1]+"-")
+
+	return repository, userName
+}
+
+// expiredAccessKeys returns the active keys created before the cutoff
+func expiredAccessKeys(keys []*awsiam.AccessKeyMetadata, cutoff time.Time) []*awsiam.AccessKeyMetadata {
+	expired := []*awsiam.AccessKeyMetadata{}
+	for _, k := range keys {
+		if aws.StringValue(k.Status) != awsiam.StatusTypeActive {
+			continue
+		}
+
+		if aws.TimeValue(k.CreateDate).Before(cutoff) {
+			expired = append(expired, k)
+		}
+	}
+	return expired
+}
+
+// rotateExpiredKeys finds the active access keys of the users in the org older than the max key age and either
+// disables them or rotates them.  When rotating, the new key is delivered to the sink before the expired keys
+// are deleted, if delivery fails the new key is deleted and the expired keys are left alone.
+func (o *iamOrchestrator) rotateExpiredKeys(ctx context.Context, account string, policy *keyRotation, dryRun bool, now time.Time) ([]*KeyRotationResult, error) {
+	path := fmt.Sprintf("/spinup/%s/", o.org)
+	cutoff := now.AddDate(0, 0, -policy.maxKeyAge)
+
+	log.Infof("finding access keys created before %s for users in %s", cutoff.Format(time.RFC3339), path)
+
+	users, err := o.client.ListUsersWithPath(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*KeyRotationResult{}
+	for _, u := range users {
+		iamUserName := aws.StringValue(u.UserName)
+
+		repository, userName := repositoryUserFromIAM(o.org, u)
+		if group, _ := repositoryUserScope(repository); group == "" {
+			continue
+		}
+
+		// other users can be created under the org path, only the keys of repository users are rotated
+		ok, err := o.isRepositoryUser(ctx, u, repository)
+		if err != nil {
+			return results, err
+		}
+
+		if !ok {
+			log.Debugf("user %s in path %s isn't a repository user", iamUserName, aws.StringValue(u.Path))
+			continue
+		}
+
+		keys, err := o.client.ListAccessKeys(ctx, iamUserName)
+		if err != nil {
+			return results, err
+		}
+
+		expired := expiredAccessKeys(keys, cutoff)
+		if len(expired) == 0 {
+			continue
+		}
+
+		userResults := make([]*KeyRotationResult, 0, len(expired))
+		for _, k := range expired {
+			userResults = append(userResults, &KeyRotationResult{
+				UserName:    userName,
+				Repository:  repository,
+				IAMUserName: iamUserName,
+				AccessKeyId: aws.StringValue(k.AccessKeyId),
+				CreatedAt:   aws.TimeValue(k.CreateDate),
+			})
+		}
+		results = append(results, userResults...)
+
+		switch policy.action {
+		case keyRotationActionDisable:
+			for _, r := range userResults {
+				r.Action = keyRotationResultDisabled
+				if dryRun {
+					continue
+				}
+
+				if err := o.client.UpdateAccessKey(ctx, iamUserName, r.AccessKeyId, awsiam.StatusTypeInactive); err != nil {
+					r.Error = err.Error()
+				}
+			}
+		case keyRotationActionRotate:
+			for _, r := range userResults {
+				r.Action = keyRotationResultRotated
+			}
+
+			if dryRun {
+				continue
+			}
+
+			if err := o.rotateUserKeys(ctx, account, repository, userName, iamUserName, keys, userResults, policy.sink, cutoff); err != nil {
+				log.Errorf("failed to rotate access keys for %s: %s", iamUserName, err)
+				for _, r := range userResults {
+					r.Error = err.Error()
+				}
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// rotateUserKeys creates a new access key for the user, delivers it to the sink and deletes the expired keys.  IAM
+// users can only have 2 access keys, when the user has 2 keys created before the cutoff the oldest is deleted first
+// to make room for the new key.
+func (o *iamOrchestrator) rotateUserKeys(ctx context.Context, account, repository, userName, iamUserName string, keys []*awsiam.AccessKeyMetadata, expired []*KeyRotationResult, sink keySink, cutoff time.Time) error {
+	var deleted string
+	if len(keys) >= 2 {
+		var oldest *awsiam.AccessKeyMetadata
+		for _, k := range keys {
+			if !aws.TimeValue(k.CreateDate).Before(cutoff) {
+				return apierror.New(apierror.ErrConflict, "user has the maximum number of access keys and one isn't expired", nil)
+			}
+
+			if oldest == nil || aws.TimeValue(k.CreateDate).Before(aws.TimeValue(oldest.CreateDate)) {
+				oldest = k
+			}
+		}
+
+		deleted = aws.StringValue(oldest.AccessKeyId)
+		log.Infof("deleting the oldest expired access key %s for %s to make room for the new key", deleted, iamUserName)
+
+		if err := o.client.DeleteAccessKey(ctx, iamUserName, deleted); err != nil {
+			return err
+		}
+	}
+
+	newKey, err := o.client.CreateAccessKey(ctx, iamUserName)
+	if err != nil {
+		return err
+	}
+
+	replaced := make([]string, 0, len(expired))
+	for _, r := range expired {
+		replaced = append(replaced, r.AccessKeyId)
+	}
+
+	if err := sink.deliver(ctx, &RotatedAccessKey{
+		Account:              account,
+		Repository:           repository,
+		UserName:             userName,
+		AccessKeyId:          aws.StringValue(newKey.AccessKeyId),
+		SecretAccessKey:      aws.StringValue(newKey.SecretAccessKey),
+		ReplacedAccessKeyIds: replaced,
+		CreatedAt:            aws.TimeValue(newKey.CreateDate),
+	}); err != nil {
+		if derr := o.client.DeleteAccessKey(ctx, iamUserName, aws.StringValue(newKey.AccessKeyId)); derr != nil {
+			log.Errorf("failed to delete undelivered access key %s for %s: %s", aws.StringValue(newKey.AccessKeyId), iamUserName, derr)
+		}
+		return errors.Wrap(err, "failed to deliver the new access key")
+	}
+
+	for _, r := range expired {
+		r.NewAccessKeyId = aws.StringValue(newKey.AccessKeyId)
+
+		if r.AccessKeyId == deleted {
+			continue
+		}
+
+		if err := o.client.UpdateAccessKey(ctx, iamUserName, r.AccessKeyId, awsiam.StatusTypeInactive); err != nil {
+			r.Error = err.Error()
+			continue
+		}
+
+		if err := o.client.DeleteAccessKey(ctx, iamUserName, r.AccessKeyId); err != nil {
+			r.Error = err.Error()
+		}
+	}
+
+	return nil
+}
+
+// keyRotationJobSession returns the job session to apply the key rotation policy to the repository users in the account
+func (s *server) keyRotationJobSession(account string) (*jobSession, error) {
+	if s.keyRotation == nil {
+		return nil, apierror.New(apierror.ErrBadRequest, "key rotation is not configured", nil)
+	}
+
+	policy, err := s.repositoryUserKeyRotationPolicy()
+	if err != nil {
+		return nil, apierror.New(apierror.ErrInternalError, "failed to generate policy", err)
+	}
+
+	// IAM doesn't support resource tags, so we can't pass the s.orgPolicy here
+	return s.newJobSession(account, policy), nil
+}
+
+// startKeyRotation starts applying the key rotation policy to the repository users in the account in the background
+func (s *server) startKeyRotation(ctx context.Context, account string, dryRun bool) (*Report, error) {
+	job, err := s.keyRotationJobSession(account)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.startReport(ctx, job, reportKeyRotation, func(ctx context.Context) (interface{}, error) {
+		return s.rotateKeysWithOrchestrators(ctx, job.orchestrators, account, dryRun)
+	})
+}
+
+// rotateKeys applies the key rotation policy to the repository users in the account and records the report
+func (s *server) rotateKeys(ctx context.Context, account string, dryRun bool) (*KeyRotationReport, error) {
+	job, err := s.keyRotationJobSession(account)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.rotateKeysWithOrchestrators(ctx, job.orchestrators, account, dryRun)
+}
+
+// rotateKeysWithOrchestrators rotates the keys, notifies the spaces of rotated keys and records the report
+func (s *server) rotateKeysWithOrchestrators(ctx context.Context, orchestrators orchestratorsFunc, account string, dryRun bool) (*KeyRotationReport, error) {
+	_, orch, err := orchestrators(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &KeyRotationReport{
+		Account:   account,
+		Action:    s.keyRotation.action,
+		MaxKeyAge: s.keyRotation.maxKeyAge,
+		DryRun:    dryRun,
+		StartedAt: time.Now().UTC(),
+	}
+
+	results, err := orch.rotateExpiredKeys(ctx, account, s.keyRotation, dryRun, report.StartedAt)
+	report.Keys = results
+	report.CompletedAt = time.Now().UTC()
+	if err != nil {
+		return report, err
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	notified := map[string]bool{}
+	for _, r := range results {
+		if r.Action != keyRotationResultRotated || r.Error != "" || notified[r.IAMUserName] {
+			continue
+		}
+		notified[r.IAMUserName] = true
+
+		group, _ := repositoryUserScope(r.Repository)
+		s.notify(ctx, notificationUserKeyRotated, account, group, &UserNotification{
+			Repository: r.Repository,
+			UserName:   r.UserName,
+		})
+	}
+
+	if err := store.PutJSON(ctx, s.store, keyRotationBucket, account, report); err != nil {
+		log.Errorf("failed to record key rotation report for %s: %s", account, err)
+	}
+
+	return report, nil
+}
+
+// keyRotationReport gets the last key rotation report for the account
+func (s *server) keyRotationReport(ctx context.Context, account string) (*KeyRotationReport, error) {
+	report := &KeyRotationReport{}
+	if err := store.GetJSON(ctx, s.store, keyRotationBucket, account, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// keyRotationJob periodically applies the key rotation policy to the configured accounts until the context is cancelled
+func (s *server) keyRotationJob(ctx context.Context) {
+	log.Infof("rotating access keys older than %d days every %s in %d accounts", s.keyRotation.maxKeyAge, s.keyRotation.interval, len(s.keyRotation.accounts))
+
+	ticker := time.NewTicker(s.keyRotation.interval)
+	defer ticker.Stop()
+
+	for {
+		for _, account := range s.keyRotation.accounts {
+			report, err := s.rotateKeys(ctx, account, false)
+			if err != nil {
+				log.Errorf("failed to rotate access keys in account %s: %s", account, err)
+				continue
+			}
+
+			log.Infof("key rotation acted on %d access keys in account %s", len(report.Keys), account)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ecr-api/common"
+	"github.com/YaleSpinup/ecr-api/iam"
+	"github.com/YaleSpinup/ecr-api/store"
+	"github.com/aws/aws-sdk-go/aws"
+	awsiam "github.com/aws/aws-sdk-go/service/iam"
+)
+
+func TestNewKeyRotation(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  common.KeyRotation
+		wantNil bool
+		wantErr bool
+	}{
+		{
+			name:    "disabled",
+			config:  common.KeyRotation{Action: "rotate"},
+			wantNil: true,
+		},
+		{
+			name:   "disable keys",
+			config: common.KeyRotation{MaxKeyAge: 90, Action: "disable"},
+		},
+		{
+			name:    "rotate without a sink",
+			config:  common.KeyRotation{MaxKeyAge: 90, Action: "rotate"},
+			wantErr: true,
+		},
+		{
+			name:   "rotate",
+			config: common.KeyRotation{MaxKeyAge: 90, Action: "Rotate", Interval: "1h", Sink: common.KeySink{Url: "https://keys.example.com"}},
+		},
+		{
+			name:    "invalid action",
+			config:  common.KeyRotation{MaxKeyAge: 90, Action: "delete"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid interval",
+			config:  common.KeyRotation{MaxKeyAge: 90, Action: "disable", Interval: "daily"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newKeyRotation(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newKeyRotation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && (got == nil) != tt.wantNil {
+				t.Errorf("newKeyRotation() = %+v, wantNil %t", got, tt.wantNil)
+			}
+		})
+	}
+}
+
+// recordingKeySink keeps the keys it's delivered or fails
+type recordingKeySink struct {
+	mu   sync.Mutex
+	keys []*RotatedAccessKey
+	err  error
+}
+
+func (r *recordingKeySink) deliver(ctx context.Context, key *RotatedAccessKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+
+	r.keys = append(r.keys, key)
+	return nil
+}
+
+// newKeyRotationTestUsers creates a repository user with an expired key and one with a new key
+func newKeyRotationTestUsers(t *testing.T, client *fakeIAM, orch *iamOrchestrator, now time.Time) {
+	ctx := context.Background()
+
+	roleGroups, err := orch.prepareAccount(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, u := range []string{"old", "new"} {
+		if _, err := orch.repositoryUserCreate(ctx, "rudolph", "spindev-00001", roleGroups["pull"], &RepositoryUserCreateRequest{UserName: u, Role: "pull"}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if _, err := client.CreateAccessKeyWithContext(ctx, &awsiam.CreateAccessKeyInput{UserName: aws.String("rudolph-" + u)}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	// a user in the org path that isn't a repository user
+	if _, err := client.CreateUserWithContext(ctx, &awsiam.CreateUserInput{
+		Path:     aws.String("/spinup/testOrg/spindev-00001/rudolph/"),
+		UserName: aws.String("deploy-bot"),
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := client.CreateAccessKeyWithContext(ctx, &awsiam.CreateAccessKeyInput{UserName: aws.String("deploy-bot")}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	client.ageAccessKeys("rudolph-old", now.AddDate(0, 0, -91))
+	client.ageAccessKeys("rudolph-new", now.AddDate(0, 0, -10))
+	client.ageAccessKeys("deploy-bot", now.AddDate(0, 0, -91))
+}
+
+func TestIamOrchestrator_rotateExpiredKeys(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		action     string
+		dryRun     bool
+		sinkErr    error
+		wantResult string
+		wantError  bool
+		wantKeys   []string
+		wantStatus string
+	}{
+		{
+			name:       "disable",
+			action:     keyRotationActionDisable,
+			wantResult: keyRotationResultDisabled,
+			wantKeys:   []string{"AKIA000000000001"},
+			wantStatus: awsiam.StatusTypeInactive,
+		},
+		{
+			name:       "rotate",
+			action:     keyRotationActionRotate,
+			wantResult: keyRotationResultRotated,
+			wantKeys:   []string{"AKIA000000000004"},
+			wantStatus: awsiam.StatusTypeActive,
+		},
+		{
+			name:       "rotate with a failing sink",
+			action:     keyRotationActionRotate,
+			sinkErr:    errors.New("boom"),
+			wantResult: keyRotationResultRotated,
+			wantError:  true,
+			wantKeys:   []string{"AKIA000000000001"},
+			wantStatus: awsiam.StatusTypeActive,
+		},
+		{
+			name:       "dry run",
+			action:     keyRotationActionRotate,
+			dryRun:     true,
+			wantResult: keyRotationResultRotated,
+			wantKeys:   []string{"AKIA000000000001"},
+			wantStatus: awsiam.StatusTypeActive,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			client := newFakeIAM()
+			orch := newIamOrchestrator(iam.IAM{Service: client}, "testOrg")
+			newKeyRotationTestUsers(t, client, orch, now)
+
+			sink := &recordingKeySink{err: tt.sinkErr}
+			policy := &keyRotation{maxKeyAge: 90, action: tt.action, sink: sink}
+
+			results, err := orch.rotateExpiredKeys(ctx, "12345", policy, tt.dryRun, now)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if len(results) != 1 {
+				t.Fatalf("expected 1 result, got %d", len(results))
+			}
+
+			r := results[0]
+			if r.UserName != "old" || r.Repository != "spindev-00001/rudolph" || r.AccessKeyId != "AKIA000000000001" || r.Action != tt.wantResult {
+				t.Errorf("unexpected result %+v", r)
+			}
+
+			if (r.Error != "") != tt.wantError {
+				t.Errorf("expected error %t, got '%s'", tt.wantError, r.Error)
+			}
+
+			keys := client.keys["rudolph-old"]
+			ids := []string{}
+			for _, k := range keys {
+				ids = append(ids, aws.StringValue(k.AccessKeyId))
+			}
+
+			if len(ids) != len(tt.wantKeys) || ids[0] != tt.wantKeys[0] || aws.StringValue(keys[0].Status) != tt.wantStatus {
+				t.Errorf("expected keys %v with status %s, got %v with status %s", tt.wantKeys, tt.wantStatus, ids, aws.StringValue(keys[0].Status))
+			}
+
+			if tt.action == keyRotationActionRotate && !tt.dryRun && tt.sinkErr == nil {
+				if len(sink.keys) != 1 || sink.keys[0].AccessKeyId != r.NewAccessKeyId || sink.keys[0].SecretAccessKey == "" {
+					t.Errorf("expected the new key to be delivered, got %+v", sink.keys)
+				}
+			}
+
+			if newKeys := client.keys["rudolph-new"]; len(newKeys) != 1 || aws.StringValue(newKeys[0].Status) != awsiam.StatusTypeActive {
+				t.Errorf("expected the new key to be untouched, got %+v", newKeys)
+			}
+
+			if botKeys := client.keys["deploy-bot"]; len(botKeys) != 1 || aws.StringValue(botKeys[0].Status) != awsiam.StatusTypeActive {
+				t.Errorf("expected the key of a user that isn't a repository user to be untouched, got %+v", botKeys)
+			}
+		})
+	}
+}
+
+func TestIamOrchestrator_rotateExpiredKeysMaximumKeys(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	client := newFakeIAM()
+	orch := newIamOrchestrator(iam.IAM{Service: client}, "testOrg")
+	newKeyRotationTestUsers(t, client, orch, now)
+
+	// both of the old user's keys are expired, the oldest (inactive) key makes room for the new key
+	if _, err := client.CreateAccessKeyWithContext(ctx, &awsiam.CreateAccessKeyInput{UserName: aws.String("rudolph-old")}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	client.keys["rudolph-old"][0].Status = aws.String(awsiam.StatusTypeInactive)
+	client.keys["rudolph-old"][1].CreateDate = aws.Time(now.AddDate(0, 0, -91))
+	client.keys["rudolph-old"][0].CreateDate = aws.Time(now.AddDate(0, 0, -200))
+
+	// the new user has a second key that isn't expired
+	if _, err := client.CreateAccessKeyWithContext(ctx, &awsiam.CreateAccessKeyInput{UserName: aws.String("rudolph-new")}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	client.keys["rudolph-new"][0].CreateDate = aws.Time(now.AddDate(0, 0, -91))
+
+	sink := &recordingKeySink{}
+	policy := &keyRotation{maxKeyAge: 90, action: keyRotationActionRotate, sink: sink}
+
+	results, err := orch.rotateExpiredKeys(ctx, "12345", policy, false, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+
+	for _, r := range results {
+		switch r.UserName {
+		case "old":
+			if r.Error != "" || r.NewAccessKeyId == "" {
+				t.Errorf("expected the old user's key to be rotated, got %+v", r)
+			}
+
+			if keys := client.keys["rudolph-old"]; len(keys) != 1 || aws.StringValue(keys[0].AccessKeyId) != r.NewAccessKeyId {
+				t.Errorf("expected only the new key for the old user, got %+v", keys)
+			}
+		case "new":
+			if r.Error == "" {
+				t.Errorf("expected a conflict rotating with a key that isn't expired, got %+v", r)
+			}
+
+			if keys := client.keys["rudolph-new"]; len(keys) != 2 {
+				t.Errorf("expected the new user's keys to be untouched, got %+v", keys)
+			}
+		default:
+			t.Errorf("unexpected result %+v", r)
+		}
+	}
+
+	if len(sink.keys) != 1 {
+		t.Errorf("expected 1 delivered key, got %d", len(sink.keys))
+	}
+}
+
+func TestServer_rotateKeysWithOrchestrators(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	client := newFakeIAM()
+	orch := newIamOrchestrator(iam.IAM{Service: client}, "testOrg")
+	newKeyRotationTestUsers(t, client, orch, now)
+
+	n := &recordingNotifier{}
+	s := &server{
+		store:       store.NewMemoryStore(),
+		notifier:    n,
+		keyRotation: &keyRotation{maxKeyAge: 90, action: keyRotationActionRotate, sink: &recordingKeySink{}},
+	}
+
+	orchestrators := func(ctx context.Context) (*ecrOrchestrator, *iamOrchestrator, error) {
+		return nil, orch, nil
+	}
+
+	if _, err := s.rotateKeysWithOrchestrators(ctx, orchestrators, "12345", true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := s.keyRotationReport(ctx, "12345"); err == nil {
+		t.Error("expected dry run report not to be recorded")
+	}
+
+	report, err := s.rotateKeysWithOrchestrators(ctx, orchestrators, "12345", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(report.Keys) != 1 || report.MaxKeyAge != 90 || report.Action != keyRotationActionRotate {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	stored, err := s.keyRotationReport(ctx, "12345")
+	if err != nil || len(stored.Keys) != 1 {
+		t.Errorf("expected the report to be recorded, got %+v (%v)", stored, err)
+	}
+
+	if len(n.notifications) != 1 || n.notifications[0].Type != notificationUserKeyRotated || n.notifications[0].Group != "spindev-00001" {
+		t.Errorf("expected a key rotated notification, got %+v", n.notifications)
+	}
+}
+
+func TestHTTPKeySink_deliver(t *testing.T) {
+	var body []byte
+	var signature string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(webhookSignatureHeader)
+	}))
+	defer ts.Close()
+
+	sink := newHTTPKeySink(ts.URL, "0123456789abcdef")
+	if err := sink.deliver(context.Background(), &RotatedAccessKey{UserName: "old", AccessKeyId: "AKIA1", SecretAccessKey: "shh"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if signature != signPayload("0123456789abcdef", body) {
+		t.Errorf("unexpected signature %s", signature)
+	}
+
+	key := RotatedAccessKey{}
+	if err := json.Unmarshal(body, &key); err != nil || key.SecretAccessKey != "shh" {
+		t.Errorf("unexpected body %s (%v)", string(body), err)
+	}
+}
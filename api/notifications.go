@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// notification types sent to the notifier
+const (
+	notificationRepositoryCreated     = "repository.created"
+	notificationRepositoryUpdated     = "repository.updated"
+	notificationRepositoryDeleted     = "repository.deleted"
+	notificationRepositoryPending     = "repository.pending_deletion"
+	notificationRepositoryRestored    = "repository.restored"
+	notificationUserCreated           = "user.created"
+	notificationUserDeleted           = "user.deleted"
+	notificationUserKeyRotated        = "user.key_rotated"
+	notificationScanCompleted         = "scan.completed"
+	notificationScanThresholdExceeded = "scan.threshold_exceeded"
+	notificationImagePushed           = "image.pushed"
+	notificationImageDeleted          = "image.deleted"
+)
+
+// notificationTypes are the valid notification types
+var notificationTypes = map[string]bool{
+	notificationRepositoryCreated:     true,
+	notificationRepositoryUpdated:     true,
+	notificationRepositoryDeleted:     true,
+	notificationRepositoryPending:     true,
+	notificationRepositoryRestored:    true,
+	notificationUserCreated:           true,
+	notificationUserDeleted:           true,
+	notificationUserKeyRotated:        true,
+	notificationScanCompleted:         true,
+	notificationScanThresholdExceeded: true,
+	notificationImagePushed:           true,
+	notificationImageDeleted:          true,
+}
+
+// Notification is an outbound notification about something that happened in an account
+type Notification struct {
+	Type    string
+	Account string
+	// Group is the space the notification is about, if any
+	Group string
+	Time  time.Time
+	Data  interface{}
+}
+
+// ScanCompletedNotification is the notification data when an image scan completes
+type ScanCompletedNotification struct {
+	Repository     string
+	ImageDigest    string
+	ImageTags      []string
+	SeverityCounts map[string]int64
+	Gate           *GateResult
+}
+
+// ImageActionNotification is the notification data when an image is pushed or deleted
+type ImageActionNotification struct {
+	Repository  string
+	ImageDigest string
+	ImageTag    string
+}
+
+// notifier sends outbound notifications
+type notifier interface {
+	notify(ctx context.Context, n *Notification)
+}
+
+// multiNotifier sends notifications to each of the notifiers
+type multiNotifier []notifier
+
+func (m multiNotifier) notify(ctx context.Context, n *Notification) {
+	for _, notifier := range m {
+		notifier.notify(ctx, n)
+	}
+}
+
+// notify sends a notification for the account and group
+func (s *server) notify(ctx context.Context, notificationType, account, group string, data interface{}) {
+	s.notifier.notify(ctx, &Notification{
+		Type:    notificationType,
+		Account: account,
+		Group:   group,
+		Time:    time.Now().UTC(),
+		Data:    data,
+	})
+}
+
+// logNotifier logs notifications, it's used when nothing else is configured
+type logNotifier struct{}
+
+func (logNotifier) notify(ctx context.Context, n *Notification) {
+	log.Infof("%s notification for account %s group %s: %+v", n.Type, n.Account, n.Group, n.Data)
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// imageManifest is the subset of a docker v2 or OCI image manifest (or index) needed to compare and copy layers.
+// The manifest layer fields (digest, mediaType and size) unmarshal into the ImageLayer case-insensitively, and
+// docker v1 manifests only have the fsLayers.
+type imageManifest struct {
+	MediaType string        `json:"mediaType"`
+	Config    *ImageLayer   `json:"config"`
+	Layers    []*ImageLayer `json:"layers"`
+	Manifests []struct {
+		Digest string `json:"digest"`
+	} `json:"manifests"`
+	FSLayers []struct {
+		BlobSum string `json:"blobSum"`
+	} `json:"fsLayers"`
+}
+
+// imageIdentifier returns the image identifier for a tag or digest reference
+func imageIdentifier(ref string) *ecr.ImageIdentifier {
+	if strings.HasPrefix(ref, "sha256:") {
+		return &ecr.ImageIdentifier{ImageDigest: aws.String(ref)}
+	}
+	return &ecr.ImageIdentifier{ImageTag: aws.String(ref)}
+}
+
+// imageDiff compares the vulnerabilities, size and layers of two images (by tag or digest) in a repository.  When
+// either image hasn't been scanned, the size and layers are still compared and the scan error is returned
+// with the image.
+func (o *ecrOrchestrator) imageDiff(ctx context.Context, repository, from, to string) (*ImageDiffResponse, error) {
+	if from == "" || to == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "from and to are required", nil)
+	}
+
+	log.Debugf("comparing images %s and %s in repository %s", from, to, repository)
+
+	fromImage, fromFindings, fromLayers, err := o.imageDiffDetails(ctx, repository, from)
+	if err != nil {
+		return nil, err
+	}
+
+	toImage, toFindings, toLayers, err := o.imageDiffDetails(ctx, repository, to)
+	if err != nil {
+		return nil, err
+	}
+
+	layersAdded, layersRemoved := layerDiff(fromLayers, toLayers)
+
+	resp := &ImageDiffResponse{
+		Repository:       repository,
+		From:             fromImage,
+		To:               toImage,
+		SizeDeltaInBytes: toImage.ImageSizeInBytes - fromImage.ImageSizeInBytes,
+		LayersAdded:      layersAdded,
+		LayersRemoved:    layersRemoved,
+	}
+
+	// the vulnerabilities can only be compared when both images have scan findings
+	if fromFindings == nil || toFindings == nil {
+		return resp, nil
+	}
+
+	resp.CVEsAdded, resp.CVEsRemoved = cveDiff(fromFindings.cves(), toFindings.cves())
+	resp.SeverityCountsDeltas = severityCountsDeltas(fromImage.SeverityCounts, toImage.SeverityCounts)
+
+	return resp, nil
+}
+
+// imageDiffDetails gets the image details, scan findings and manifest layers for an image reference.  The
+// findings are nil and the scan error is set on the image when the scan findings can't be retrieved.
+func (o *ecrOrchestrator) imageDiffDetails(ctx context.Context, repository, ref string) (*ImageDiffImage, *ImageScanFindings, []*ImageLayer, error) {
+	images, err := o.client.GetImages(ctx, repository, imageIdentifier(ref))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if len(images) == 0 {
+		msg := fmt.Sprintf("image %s not found in repository %s", ref, repository)
+		return nil, nil, nil, apierror.New(apierror.ErrNotFound, msg, nil)
+	}
+
+	detail := images[0]
+	digest := aws.StringValue(detail.ImageDigest)
+
+	manifest, err := o.client.GetImageManifest(ctx, repository, &ecr.ImageIdentifier{ImageDigest: aws.String(digest)})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	layers, err := manifestLayers(aws.StringValue(manifest.ImageManifest))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	image := &ImageDiffImage{
+		ImageDigest:      digest,
+		ImageTags:        aws.StringValueSlice(detail.ImageTags),
+		ImagePushedAt:    detail.ImagePushedAt,
+		ImageSizeInBytes: aws.Int64Value(detail.ImageSizeInBytes),
+	}
+
+	out, extras, err := o.client.GetImageScanFindingsByImageDigest(ctx, repository, digest)
+	if err != nil {
+		log.Warnf("failed to get scan findings for %s@%s, not comparing vulnerabilities: %s", repository, digest, err)
+		image.ScanError = fmt.Sprintf("Unable to retrieve scan findings: %v", err)
+		return image, nil, layers, nil
+	}
+
+	findings := imageScanFindingsFromECR(out.ImageScanFindings, extras)
+	image.SeverityCounts = findings.severityCounts()
+	if findings != nil {
+		image.ImageScanCompletedAt = findings.ImageScanCompletedAt
+	}
+
+	return image, findings, layers, nil
+}
+
+// manifestLayers parses the layers from an image manifest.  Manifest lists (multi-architecture images) don't
+// have layers of their own and can't be compared.
+func manifestLayers(manifest string) ([]*ImageLayer, error) {
+	m := imageManifest{}
+	if err := json.Unmarshal([]byte(manifest), &m); err != nil {
+		return nil, apierror.New(apierror.ErrInternalError, "failed to parse image manifest", err)
+	}
+
+	if len(m.Manifests) > 0 {
+		return nil, apierror.New(apierror.ErrBadRequest, "comparing multi-architecture images (manifest lists) is not supported, use the digest of a platform image", nil)
+	}
+
+	return m.Layers, nil
+}
+
+// layerDiff returns the layers in to that aren't in from (added) and the layers in from that aren't in to (removed)
+func layerDiff(from, to []*ImageLayer) ([]*ImageLayer, []*ImageLayer) {
+	fromSet := map[string]bool{}
+	for _, l := range from {
+		fromSet[l.Digest] = true
+	}
+
+	toSet := map[string]bool{}
+	for _, l := range to {
+		toSet[l.Digest] = true
+	}
+
+	added := []*ImageLayer{}
+	for _, l := range to {
+		if !fromSet[l.Digest] {
+			added = append(added, l)
+		}
+	}
+
+	removed := []*ImageLayer{}
+	for _, l := range from {
+		if !toSet[l.Digest] {
+			removed = append(removed, l)
+		}
+	}
+
+	return added, removed
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awsecr "github.com/aws/aws-sdk-go/service/ecr"
+)
+
+func Test_manifestLayers(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		want     []*ImageLayer
+		wantErr  bool
+	}{
+		{
+			name:     "docker v2 manifest",
+			manifest: `{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json","config":{"size":1510,"digest":"sha256:cccc"},"layers":[{"mediaType":"application/vnd.docker.image.rootfs.diff.tar.gzip","size":27145915,"digest":"sha256:aaaa"},{"mediaType":"application/vnd.docker.image.rootfs.diff.tar.gzip","size":1024,"digest":"sha256:bbbb"}]}`,
+			want: []*ImageLayer{
+				{Digest: "sha256:aaaa", MediaType: "application/vnd.docker.image.rootfs.diff.tar.gzip", Size: 27145915},
+				{Digest: "sha256:bbbb", MediaType: "application/vnd.docker.image.rootfs.diff.tar.gzip", Size: 1024},
+			},
+		},
+		{
+			name:     "manifest list",
+			manifest: `{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.list.v2+json","manifests":[{"digest":"sha256:dddd"}]}`,
+			wantErr:  true,
+		},
+		{
+			name:     "invalid manifest",
+			manifest: `not json`,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := manifestLayers(tt.manifest)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("manifestLayers() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("manifestLayers() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_layerDiff(t *testing.T) {
+	base := &ImageLayer{Digest: "sha256:aaaa", Size: 100}
+	old := &ImageLayer{Digest: "sha256:bbbb", Size: 10}
+	app := &ImageLayer{Digest: "sha256:cccc", Size: 20}
+
+	added, removed := layerDiff([]*ImageLayer{base, old}, []*ImageLayer{base, app})
+	if !reflect.DeepEqual(added, []*ImageLayer{app}) {
+		t.Errorf("expected added layers [%+v], got %+v", app, added)
+	}
+
+	if !reflect.DeepEqual(removed, []*ImageLayer{old}) {
+		t.Errorf("expected removed layers [%+v], got %+v", old, removed)
+	}
+}
+
+func Test_imageIdentifier(t *testing.T) {
+	if id := imageIdentifier("sha256:aaaa"); id.ImageDigest == nil || id.ImageTag != nil {
+		t.Errorf("expected digest image identifier, got %+v", id)
+	}
+
+	if id := imageIdentifier("v1.2.3"); id.ImageTag == nil || id.ImageDigest != nil {
+		t.Errorf("expected tag image identifier, got %+v", id)
+	}
+}
+
+func TestEcrOrchestrator_imageDiff(t *testing.T) {
+	ctx := context.Background()
+	st := newSoftDeleteTest(t)
+
+	st.ecrClient.addImage("spindev-00001/rudolph", "v1", "sha256:0000", 100, time.Now())
+	st.ecrClient.addImage("spindev-00001/rudolph", "v2", "sha256:1111", 150, time.Now())
+	st.ecrClient.manifests["spindev-00001/rudolph@sha256:0000"] = `{"schemaVersion":2,"layers":[{"digest":"sha256:aaaa","size":100}]}`
+	st.ecrClient.manifests["spindev-00001/rudolph@sha256:1111"] = `{"schemaVersion":2,"layers":[{"digest":"sha256:aaaa","size":100},{"digest":"sha256:bbbb","size":50}]}`
+	st.ecrClient.scanFindings["spindev-00001/rudolph@sha256:0000"] = &awsecr.ImageScanFindings{
+		FindingSeverityCounts: aws.Int64Map(map[string]int64{"HIGH": 1}),
+		Findings:              []*awsecr.ImageScanFinding{{Name: aws.String("CVE-0000-0001"), Severity: aws.String("HIGH")}},
+	}
+
+	// the second image hasn't been scanned, so only the size and layers are compared
+	resp, err := st.ecrOrch.imageDiff(ctx, "spindev-00001/rudolph", "v1", "v2")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if resp.SizeDeltaInBytes != 50 || len(resp.LayersAdded) != 1 || resp.LayersAdded[0].Digest != "sha256:bbbb" {
+		t.Errorf("expected the size and layers to be compared, got %+v", resp)
+	}
+
+	if resp.From.ScanError != "" || resp.To.ScanError == "" {
+		t.Errorf("expected a scan error for only the second image, got %+v and %+v", resp.From, resp.To)
+	}
+
+	if resp.CVEsAdded != nil || resp.CVEsRemoved != nil || resp.SeverityCountsDeltas != nil {
+		t.Errorf("expected the vulnerabilities not to be compared, got %+v", resp)
+	}
+
+	st.ecrClient.scanFindings["spindev-00001/rudolph@sha256:1111"] = &awsecr.ImageScanFindings{}
+
+	resp, err = st.ecrOrch.imageDiff(ctx, "spindev-00001/rudolph", "v1", "sha256:1111")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if resp.To.ScanError != "" || !reflect.DeepEqual(resp.CVEsRemoved, []string{"CVE-0000-0001"}) || resp.SeverityCountsDeltas["HIGH"] != -1 {
+		t.Errorf("expected the vulnerabilities to be compared, got %+v", resp)
+	}
+
+	if _, err := st.ecrOrch.imageDiff(ctx, "spindev-00001/rudolph", "v1", "v3"); err == nil {
+		t.Error("expected error comparing a missing image, got nil")
+	}
+}
@@ -0,0 +1,391 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// registryScanningConfiguration returns the scanning configuration for the registry
+func (o *ecrOrchestrator) registryScanningConfiguration(ctx context.Context) (*RegistryScanningConfiguration, error) {
+	log.Debug("getting registry scanning configuration")
+
+	config, err := o.client.GetRegistryScanningConfiguration(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return registryScanningConfigurationFromECR(config), nil
+}
+
+// registryScanningConfigurationUpdate validates and sets the scanning configuration for the registry
+func (o *ecrOrchestrator) registryScanningConfigurationUpdate(ctx context.Context, req *RegistryScanningConfiguration) (*RegistryScanningConfiguration, error) {
+	log.Debugf("updating registry scanning configuration with request %+v", req)
+
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+
+	config, err := o.client.PutRegistryScanningConfiguration(ctx, putRegistryScanningConfigurationInputFromRequest(req))
+	if err != nil {
+		return nil, err
+	}
+
+	return registryScanningConfigurationFromECR(config), nil
+}
+
+// validate checks the scan type and rules of the registry scanning configuration request
+func (req *RegistryScanningConfiguration) validate() error {
+	scanType := strings.ToUpper(req.ScanType)
+	if scanType != ecr.ScanTypeBasic && scanType != ecr.ScanTypeEnhanced {
+		msg := fmt.Sprintf("invalid scan type %q, must be one of %s", req.ScanType, strings.Join(ecr.ScanType_Values(), ", "))
+		return apierror.New(apierror.ErrBadRequest, msg, nil)
+	}
+
+	for _, r := range req.Rules {
+		frequency := strings.ToUpper(r.ScanFrequency)
+		switch frequency {
+		case ecr.ScanFrequencyScanOnPush, ecr.ScanFrequencyManual:
+		case ecr.ScanFrequencyContinuousScan:
+			if scanType != ecr.ScanTypeEnhanced {
+				return apierror.New(apierror.ErrBadRequest, "continuous scanning requires the ENHANCED scan type", nil)
+			}
+		default:
+			msg := fmt.Sprintf("invalid scan frequency %q, must be one of %s", r.ScanFrequency, strings.Join(ecr.ScanFrequency_Values(), ", "))
+			return apierror.New(apierror.ErrBadRequest, msg, nil)
+		}
+
+		if len(r.RepositoryFilters) == 0 {
+			return apierror.New(apierror.ErrBadRequest, "at least one repository filter is required for each rule", nil)
+		}
+
+		for _, f := range r.RepositoryFilters {
+			if f == "" {
+				return apierror.New(apierror.ErrBadRequest, "repository filters cannot be empty", nil)
+			}
+		}
+	}
+
+	return nil
+}
+
+const (
+	// repositoryReplicationNotReplicated is the status of a destination the latest image isn't replicated to,
+	// images are only replicated when they're pushed
+	repositoryReplicationNotReplicated = "NOT_REPLICATED"
+	// repositoryReplicationNoImages is the status of the destinations of a repository without images
+	repositoryReplicationNoImages = "NO_IMAGES"
+)
+
+// replicationRegionPattern matches an AWS region, ie. us-west-2
+var replicationRegionPattern = regexp.MustCompile(`^[a-z]{2}(-gov|-iso[a-z]*)?-[a-z]+-\d+$`)
+
+// replicationGroupPrefixPattern matches the prefix of the repository names in a group, ie. spindev-00001/
+var replicationGroupPrefixPattern = regexp.MustCompile(`^[a-z0-9]+(?:[._-][a-z0-9]+)*/$`)
+
+// registryReplicationConfiguration returns the replication configuration for the registry
+func (o *ecrOrchestrator) registryReplicationConfiguration(ctx context.Context) (*RegistryReplicationConfiguration, error) {
+	log.Debug("getting registry replication configuration")
+
+	config, err := o.client.GetReplicationConfiguration(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return registryReplicationConfigurationFromECR(config), nil
+}
+
+// registryReplicationConfigurationUpdate validates the replication rules of the groups in the request and merges
+// them with the existing rules of the registry, which is shared by every org in the account.  The replication of
+// the groups in the request is replaced and the rules of the other groups are kept, a rule without destinations
+// turns off replication for its groups.
+func (o *ecrOrchestrator) registryReplicationConfigurationUpdate(ctx context.Context, account string, req *RegistryReplicationConfiguration) (*RegistryReplicationConfiguration, error) {
+	log.Debugf("updating registry replication configuration with request %+v", req)
+
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+
+	existing, err := o.client.GetReplicationConfiguration(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := mergeReplicationConfiguration(existing, replicationConfigurationFromRequest(account, req))
+	if err := validateReplicationLimits(merged); err != nil {
+		return nil, err
+	}
+
+	config, err := o.client.PutReplicationConfiguration(ctx, merged)
+	if err != nil {
+		return nil, err
+	}
+
+	return registryReplicationConfigurationFromECR(config), nil
+}
+
+// validate checks the destinations and group prefixes of the registry replication configuration request, each
+// prefix must be the prefix of a single group so the rules can't replicate the repositories of other orgs
+func (req *RegistryReplicationConfiguration) validate() error {
+	for _, r := range req.Rules {
+		for _, d := range r.Destinations {
+			if !replicationRegionPattern.MatchString(d.Region) {
+				msg := fmt.Sprintf("invalid destination region %q", d.Region)
+				return apierror.New(apierror.ErrBadRequest, msg, nil)
+			}
+
+			if d.Account != "" && !accountIdPattern.MatchString(d.Account) {
+				msg := fmt.Sprintf("invalid destination account %q, must be an account id", d.Account)
+				return apierror.New(apierror.ErrBadRequest, msg, nil)
+			}
+
+		}
+
+		// without a prefix every repository in the account would be replicated, including other orgs
+		if len(r.GroupPrefixes) == 0 {
+			return apierror.New(apierror.ErrBadRequest, "at least one group prefix is required for each rule", nil)
+		}
+
+		for _, p := range r.GroupPrefixes {
+			if len(p) > 256 || !replicationGroupPrefixPattern.MatchString(p) {
+				msg := fmt.Sprintf("invalid group prefix %q, must be a group followed by a slash, ie. spindev-00001/", p)
+				return apierror.New(apierror.ErrBadRequest, msg, nil)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateReplicationLimits checks the merged replication configuration against the ECR limits of 10 rules,
+// 25 destinations and 100 filters per rule
+func validateReplicationLimits(config *ecr.ReplicationConfiguration) error {
+	if len(config.Rules) > 10 {
+		return apierror.New(apierror.ErrBadRequest, "at most 10 replication rules are allowed", nil)
+	}
+
+	destinations := map[string]bool{}
+	for _, r := range config.Rules {
+		for _, d := range r.Destinations {
+			destinations[aws.StringValue(d.Region)+"/"+aws.StringValue(d.RegistryId)] = true
+		}
+
+		if len(r.RepositoryFilters) > 100 {
+			return apierror.New(apierror.ErrBadRequest, "at most 100 group prefixes are allowed for each rule", nil)
+		}
+	}
+
+	if len(destinations) > 25 {
+		return apierror.New(apierror.ErrBadRequest, "at most 25 replication destinations are allowed", nil)
+	}
+
+	return nil
+}
+
+// mergeReplicationConfiguration merges the rules of the update into the existing replication configuration.  The
+// filters of the groups in the update are removed from the existing rules, and rules left without filters are
+// dropped.  The filters of each update rule with destinations are then added to the rule with the same destinations,
+// or as a new rule.
+func mergeReplicationConfiguration(existing, update *ecr.ReplicationConfiguration) *ecr.ReplicationConfiguration {
+	updated := map[string]bool{}
+	for _, r := range update.Rules {
+		for _, f := range r.RepositoryFilters {
+			updated[aws.StringValue(f.Filter)] = true
+		}
+	}
+
+	merged := &ecr.ReplicationConfiguration{Rules: []*ecr.ReplicationRule{}}
+	if existing != nil {
+		for _, r := range existing.Rules {
+			filters := []*ecr.RepositoryFilter{}
+			for _, f := range r.RepositoryFilters {
+				if !updated[aws.StringValue(f.Filter)] {
+					filters = append(filters, f)
+				}
+			}
+
+			if len(filters) == 0 {
+				continue
+			}
+
+			merged.Rules = append(merged.Rules, &ecr.ReplicationRule{
+				Destinations:      r.Destinations,
+				RepositoryFilters: filters,
+			})
+		}
+	}
+
+	for _, r := range update.Rules {
+		if len(r.Destinations) == 0 {
+			continue
+		}
+
+		var rule *ecr.ReplicationRule
+		for _, m := range merged.Rules {
+			if sameReplicationDestinations(m.Destinations, r.Destinations) {
+				rule = m
+				break
+			}
+		}
+
+		if rule == nil {
+			merged.Rules = append(merged.Rules, &ecr.ReplicationRule{
+				Destinations:      r.Destinations,
+				RepositoryFilters: r.RepositoryFilters,
+			})
+			continue
+		}
+
+		for _, f := range r.RepositoryFilters {
+			if !hasReplicationFilter(rule.RepositoryFilters, aws.StringValue(f.Filter)) {
+				rule.RepositoryFilters = append(rule.RepositoryFilters, f)
+			}
+		}
+	}
+
+	return merged
+}
+
+// sameReplicationDestinations returns true if both lists have the same regions and registries, in any order
+func sameReplicationDestinations(a, b []*ecr.ReplicationDestination) bool {
+	set := func(destinations []*ecr.ReplicationDestination) map[string]bool {
+		s := make(map[string]bool, len(destinations))
+		for _, d := range destinations {
+			s[aws.StringValue(d.Region)+"/"+aws.StringValue(d.RegistryId)] = true
+		}
+		return s
+	}
+
+	sa, sb := set(a), set(b)
+	if len(sa) != len(sb) {
+		return false
+	}
+
+	for k := range sa {
+		if !sb[k] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasReplicationFilter returns true if one of the filters is the prefix
+func hasReplicationFilter(filters []*ecr.RepositoryFilter, prefix string) bool {
+	for _, f := range filters {
+		if aws.StringValue(f.Filter) == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+// repositoryReplicationStatus returns the replication status of the latest image in the repository to each of
+// the destinations of the replication rules matching the repository.  It returns nil if the repository isn't
+// replicated.
+func (o *ecrOrchestrator) repositoryReplicationStatus(ctx context.Context, account, repository string) ([]*RepositoryReplicationStatus, error) {
+	config, err := o.client.GetReplicationConfiguration(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []*RepositoryReplicationStatus{}
+	for _, r := range registryReplicationConfigurationFromECR(config).Rules {
+		if !replicationRuleMatches(r, repository) {
+			continue
+		}
+
+		for _, d := range r.Destinations {
+			if d.Account == "" {
+				d.Account = account
+			}
+
+			if replicationStatusFor(statuses, d.Region, d.Account) == nil {
+				statuses = append(statuses, &RepositoryReplicationStatus{Region: d.Region, Account: d.Account})
+			}
+		}
+	}
+
+	if len(statuses) == 0 {
+		return nil, nil
+	}
+
+	images, err := o.client.GetImages(ctx, repository)
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *ecr.ImageDetail
+	for _, i := range images {
+		if latest == nil || aws.TimeValue(i.ImagePushedAt).After(aws.TimeValue(latest.ImagePushedAt)) {
+			latest = i
+		}
+	}
+
+	if latest == nil {
+		for _, s := range statuses {
+			s.Status = repositoryReplicationNoImages
+		}
+		return statuses, nil
+	}
+
+	digest := aws.StringValue(latest.ImageDigest)
+	out, err := o.client.GetImageReplicationStatus(ctx, repository, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range statuses {
+		s.Status = repositoryReplicationNotReplicated
+		s.ImageDigest = digest
+	}
+
+	for _, rs := range out {
+		region, registryId := aws.StringValue(rs.Region), aws.StringValue(rs.RegistryId)
+
+		// images may still be replicated to a destination that was removed from the rules
+		s := replicationStatusFor(statuses, region, registryId)
+		if s == nil {
+			s = &RepositoryReplicationStatus{Region: region, Account: registryId, ImageDigest: digest}
+			statuses = append(statuses, s)
+		}
+
+		s.Status = aws.StringValue(rs.Status)
+		s.FailureCode = aws.StringValue(rs.FailureCode)
+	}
+
+	return statuses, nil
+}
+
+// replicationRuleMatches returns true if the repository name starts with one of the rule prefixes, a rule without
+// prefixes matches all of the repositories
+func replicationRuleMatches(rule *RegistryReplicationRule, repository string) bool {
+	if len(rule.GroupPrefixes) == 0 {
+		return true
+	}
+
+	for _, p := range rule.GroupPrefixes {
+		if strings.HasPrefix(repository, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// replicationStatusFor returns the status for the destination region and account, nil if it isn't in the list
+func replicationStatusFor(statuses []*RepositoryReplicationStatus, region, account string) *RepositoryReplicationStatus {
+	for _, s := range statuses {
+		if s.Region == region && s.Account == account {
+			return s
+		}
+	}
+	return nil
+}
@@ -0,0 +1,390 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	ecrSvc "github.com/YaleSpinup/ecr-api/ecr"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+func TestRegistryScanningConfiguration_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     RegistryScanningConfiguration
+		wantErr bool
+	}{
+		{
+			name: "basic scan on push",
+			req: RegistryScanningConfiguration{
+				ScanType: "basic",
+				Rules:    []*RegistryScanningRule{{ScanFrequency: "scan_on_push", RepositoryFilters: []string{"*"}}},
+			},
+		},
+		{
+			name: "enhanced continuous",
+			req: RegistryScanningConfiguration{
+				ScanType: "ENHANCED",
+				Rules: []*RegistryScanningRule{
+					{ScanFrequency: "CONTINUOUS_SCAN", RepositoryFilters: []string{"spindev-00001/*"}},
+					{ScanFrequency: "SCAN_ON_PUSH", RepositoryFilters: []string{"*"}},
+				},
+			},
+		},
+		{
+			name:    "invalid scan type",
+			req:     RegistryScanningConfiguration{ScanType: "SUPER"},
+			wantErr: true,
+		},
+		{
+			name: "basic continuous",
+			req: RegistryScanningConfiguration{
+				ScanType: "BASIC",
+				Rules:    []*RegistryScanningRule{{ScanFrequency: "CONTINUOUS_SCAN", RepositoryFilters: []string{"*"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid frequency",
+			req: RegistryScanningConfiguration{
+				ScanType: "ENHANCED",
+				Rules:    []*RegistryScanningRule{{ScanFrequency: "HOURLY", RepositoryFilters: []string{"*"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing filters",
+			req: RegistryScanningConfiguration{
+				ScanType: "ENHANCED",
+				Rules:    []*RegistryScanningRule{{ScanFrequency: "SCAN_ON_PUSH"}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.req.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("RegistryScanningConfiguration.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_putRegistryScanningConfigurationInputFromRequest(t *testing.T) {
+	req := &RegistryScanningConfiguration{
+		ScanType: "enhanced",
+		Rules:    []*RegistryScanningRule{{ScanFrequency: "continuous_scan", RepositoryFilters: []string{"spindev-00001/*"}}},
+	}
+
+	want := &ecr.PutRegistryScanningConfigurationInput{
+		ScanType: aws.String("ENHANCED"),
+		Rules: []*ecr.RegistryScanningRule{
+			{
+				ScanFrequency: aws.String("CONTINUOUS_SCAN"),
+				RepositoryFilters: []*ecr.ScanningRepositoryFilter{
+					{Filter: aws.String("spindev-00001/*"), FilterType: aws.String("WILDCARD")},
+				},
+			},
+		},
+	}
+
+	input := putRegistryScanningConfigurationInputFromRequest(req)
+	if !reflect.DeepEqual(input, want) {
+		t.Errorf("putRegistryScanningConfigurationInputFromRequest() = %v, want %v", input, want)
+	}
+
+	want2 := &RegistryScanningConfiguration{
+		ScanType: "ENHANCED",
+		Rules:    []*RegistryScanningRule{{ScanFrequency: "CONTINUOUS_SCAN", RepositoryFilters: []string{"spindev-00001/*"}}},
+	}
+	if got := registryScanningConfigurationFromECR(&ecr.RegistryScanningConfiguration{Rules: input.Rules, ScanType: input.ScanType}); !reflect.DeepEqual(got, want2) {
+		t.Errorf("registryScanningConfigurationFromECR() = %+v, want %+v", got, want2)
+	}
+}
+
+func TestRegistryReplicationConfiguration_validate(t *testing.T) {
+	drDestination := []*RegistryReplicationDestination{{Region: "us-west-2"}}
+
+	tests := []struct {
+		name    string
+		req     RegistryReplicationConfiguration
+		wantErr bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "groups to another region",
+			req: RegistryReplicationConfiguration{
+				Rules: []*RegistryReplicationRule{{Destinations: drDestination, GroupPrefixes: []string{"spindev-00001/", "spindev-00002/"}}},
+			},
+		},
+		{
+			name: "group to another account",
+			req: RegistryReplicationConfiguration{
+				Rules: []*RegistryReplicationRule{
+					{
+						Destinations:  []*RegistryReplicationDestination{{Region: "us-east-1", Account: "012345678901"}, {Region: "us-gov-west-1"}},
+						GroupPrefixes: []string{"spindev-00001/"},
+					},
+				},
+			},
+		},
+		{
+			name: "turn off replication of a group",
+			req: RegistryReplicationConfiguration{
+				Rules: []*RegistryReplicationRule{{GroupPrefixes: []string{"spindev-00001/"}}},
+			},
+		},
+		{
+			name: "invalid region",
+			req: RegistryReplicationConfiguration{
+				Rules: []*RegistryReplicationRule{{Destinations: []*RegistryReplicationDestination{{Region: "west"}}, GroupPrefixes: []string{"spindev-00001/"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid account",
+			req: RegistryReplicationConfiguration{
+				Rules: []*RegistryReplicationRule{{Destinations: []*RegistryReplicationDestination{{Region: "us-west-2", Account: "dr"}}, GroupPrefixes: []string{"spindev-00001/"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing prefixes",
+			req: RegistryReplicationConfiguration{
+				Rules: []*RegistryReplicationRule{{Destinations: drDestination}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid prefix",
+			req: RegistryReplicationConfiguration{
+				Rules: []*RegistryReplicationRule{{Destinations: drDestination, GroupPrefixes: []string{"SpinDev/*"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "partial group prefix",
+			req: RegistryReplicationConfiguration{
+				Rules: []*RegistryReplicationRule{{Destinations: drDestination, GroupPrefixes: []string{"spindev-"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "group without a slash",
+			req: RegistryReplicationConfiguration{
+				Rules: []*RegistryReplicationRule{{Destinations: drDestination, GroupPrefixes: []string{"spindev-00001"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "repository prefix",
+			req: RegistryReplicationConfiguration{
+				Rules: []*RegistryReplicationRule{{Destinations: drDestination, GroupPrefixes: []string{"spindev-00001/rudolph"}}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.req.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("RegistryReplicationConfiguration.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegistryReplicationConfigurationUpdate(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeECR("12345")
+	orch := newEcrOrchestrator(ecrSvc.ECR{Service: client}, "testOrg")
+
+	req := &RegistryReplicationConfiguration{
+		Rules: []*RegistryReplicationRule{
+			{
+				Destinations:  []*RegistryReplicationDestination{{Region: "us-west-2"}, {Region: "us-west-2", Account: "012345678901"}},
+				GroupPrefixes: []string{"spindev-00001/"},
+			},
+		},
+	}
+
+	want := &RegistryReplicationConfiguration{
+		Rules: []*RegistryReplicationRule{
+			{
+				Destinations:  []*RegistryReplicationDestination{{Region: "us-west-2", Account: "12345"}, {Region: "us-west-2", Account: "012345678901"}},
+				GroupPrefixes: []string{"spindev-00001/"},
+			},
+		},
+	}
+
+	got, err := orch.registryReplicationConfigurationUpdate(ctx, "12345", req)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("registryReplicationConfigurationUpdate() = %+v, want %+v", got, want)
+	}
+
+	if f := client.replication.Rules[0].RepositoryFilters[0]; aws.StringValue(f.FilterType) != ecr.RepositoryFilterTypePrefixMatch {
+		t.Errorf("expected a prefix match filter, got %s", aws.StringValue(f.FilterType))
+	}
+
+	got, err = orch.registryReplicationConfiguration(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("registryReplicationConfiguration() = %+v, want %+v", got, want)
+	}
+
+	_, err = orch.registryReplicationConfigurationUpdate(ctx, "12345", &RegistryReplicationConfiguration{
+		Rules: []*RegistryReplicationRule{{Destinations: req.Rules[0].Destinations}},
+	})
+	if aerr, ok := err.(apierror.Error); !ok || aerr.Code != apierror.ErrBadRequest {
+		t.Errorf("expected a bad request error for a rule without prefixes, got %v", err)
+	}
+}
+
+func TestRegistryReplicationConfigurationMerge(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeECR("12345")
+	orch := newEcrOrchestrator(ecrSvc.ECR{Service: client}, "testOrg")
+
+	west := []*RegistryReplicationDestination{{Region: "us-west-2"}}
+	east := []*RegistryReplicationDestination{{Region: "us-east-2"}}
+
+	// another org's rule and two of our groups replicated to us-west-2
+	client.replication = replicationConfigurationFromRequest("12345", &RegistryReplicationConfiguration{
+		Rules: []*RegistryReplicationRule{
+			{Destinations: west, GroupPrefixes: []string{"otherorg-00001/"}},
+			{Destinations: east, GroupPrefixes: []string{"spindev-00001/", "spindev-00002/"}},
+		},
+	})
+
+	// move spindev-00001 to us-west-2, turn off spindev-00002 and add spindev-00003 to us-east-2
+	got, err := orch.registryReplicationConfigurationUpdate(ctx, "12345", &RegistryReplicationConfiguration{
+		Rules: []*RegistryReplicationRule{
+			{Destinations: west, GroupPrefixes: []string{"spindev-00001/"}},
+			{GroupPrefixes: []string{"spindev-00002/"}},
+			{Destinations: east, GroupPrefixes: []string{"spindev-00003/"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := &RegistryReplicationConfiguration{
+		Rules: []*RegistryReplicationRule{
+			{
+				Destinations:  []*RegistryReplicationDestination{{Region: "us-west-2", Account: "12345"}},
+				GroupPrefixes: []string{"otherorg-00001/", "spindev-00001/"},
+			},
+			{
+				Destinations:  []*RegistryReplicationDestination{{Region: "us-east-2", Account: "12345"}},
+				GroupPrefixes: []string{"spindev-00003/"},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("registryReplicationConfigurationUpdate() = %s, want %s", awsutil.Prettify(got), awsutil.Prettify(want))
+	}
+
+	// the limits apply to the merged rules
+	rules := []*RegistryReplicationRule{}
+	for i := 0; i < 9; i++ {
+		rules = append(rules, &RegistryReplicationRule{
+			Destinations:  []*RegistryReplicationDestination{{Region: fmt.Sprintf("us-west-%d", i+3)}},
+			GroupPrefixes: []string{fmt.Sprintf("spindev-0001%d/", i)},
+		})
+	}
+
+	_, err = orch.registryReplicationConfigurationUpdate(ctx, "12345", &RegistryReplicationConfiguration{Rules: rules})
+	if aerr, ok := err.(apierror.Error); !ok || aerr.Code != apierror.ErrBadRequest {
+		t.Errorf("expected a bad request error for more than 10 merged rules, got %v", err)
+	}
+
+	if len(client.replication.Rules) != 2 {
+		t.Errorf("expected the replication configuration to be unchanged, got %d rules", len(client.replication.Rules))
+	}
+}
+
+func TestRepositoryReplicationStatus(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeECR("12345")
+	orch := newEcrOrchestrator(ecrSvc.ECR{Service: client}, "testOrg")
+
+	client.addRepository("spindev-00001/rudolph", "")
+	client.addRepository("otherorg-00001/rudolph", "")
+
+	// not replicated without a configuration
+	resp, err := orch.repositoryDetails(ctx, "12345", "spindev-00001", "rudolph")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if resp.Replication != nil {
+		t.Errorf("expected no replication status, got %+v", resp.Replication)
+	}
+
+	if _, err := orch.registryReplicationConfigurationUpdate(ctx, "12345", &RegistryReplicationConfiguration{
+		Rules: []*RegistryReplicationRule{
+			{
+				Destinations:  []*RegistryReplicationDestination{{Region: "us-west-2"}, {Region: "us-east-2", Account: "012345678901"}},
+				GroupPrefixes: []string{"spindev-00001/"},
+			},
+		},
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	statuses, err := orch.repositoryReplicationStatus(ctx, "12345", "otherorg-00001/rudolph")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if statuses != nil {
+		t.Errorf("expected the repository not matching the prefix not to be replicated, got %+v", statuses)
+	}
+
+	statuses, err = orch.repositoryReplicationStatus(ctx, "12345", "spindev-00001/rudolph")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(statuses) != 2 || statuses[0].Status != repositoryReplicationNoImages || statuses[1].Status != repositoryReplicationNoImages {
+		t.Errorf("expected 2 destinations without images, got %+v", statuses)
+	}
+
+	client.addImage("spindev-00001/rudolph", "v1", "sha256:1111", 1000, time.Now().Add(-time.Hour))
+	client.addImage("spindev-00001/rudolph", "v2", "sha256:2222", 1000, time.Now())
+	client.replicationStatuses["spindev-00001/rudolph@sha256:2222"] = []*ecr.ImageReplicationStatus{
+		{Region: aws.String("us-west-2"), RegistryId: aws.String("12345"), Status: aws.String(ecr.ReplicationStatusComplete)},
+	}
+
+	resp, err = orch.repositoryDetails(ctx, "12345", "spindev-00001", "rudolph")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []*RepositoryReplicationStatus{
+		{Region: "us-west-2", Account: "12345", Status: ecr.ReplicationStatusComplete, ImageDigest: "sha256:2222"},
+		{Region: "us-east-2", Account: "012345678901", Status: repositoryReplicationNotReplicated, ImageDigest: "sha256:2222"},
+	}
+
+	if !reflect.DeepEqual(resp.Replication, want) {
+		for _, s := range resp.Replication {
+			t.Logf("got %+v", s)
+		}
+		t.Errorf("unexpected replication status")
+	}
+}
@@ -2,9 +2,13 @@ package api
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/YaleSpinup/apierror"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awsutil"
 	"github.com/aws/aws-sdk-go/service/ecr"
@@ -28,7 +32,7 @@ func (o *ecrOrchestrator) repositoryDetails(ctx context.Context, account, group,
 		return nil, err
 	}
 
-	groups, err := repositoryGroupsFromPolicy(policy)
+	access, err := repositoryAccessFromPolicy(policy)
 	if err != nil {
 		return nil, err
 	}
@@ -38,11 +42,36 @@ func (o *ecrOrchestrator) repositoryDetails(ctx context.Context, account, group,
 		return nil, err
 	}
 
-	return repositoryResponseFromECR(repo, groups, tags), nil
+	resp := repositoryResponseFromECR(repo, access, tags)
+
+	// the replication status is informational, the details are still returned without it
+	replication, err := o.repositoryReplicationStatus(ctx, account, repository)
+	if err != nil {
+		log.Warnf("failed to get replication status of repository %s: %s", repository, err)
+	}
+	resp.Replication = replication
+
+	return resp, nil
 }
 
 // repositoryCreate orchestrates the creation of a repository from the RepositoryCreateRequest
 func (o *ecrOrchestrator) repositoryCreate(ctx context.Context, account, group string, req *RepositoryCreateRequest) (*RepositoryResponse, error) {
+	// the group-wide users are managed under {group}/users
+	if req.RepositoryName == "users" {
+		return nil, apierror.New(apierror.ErrBadRequest, "users is a reserved repository name", nil)
+	}
+
+	access := &repositoryAccess{
+		groups:     req.Groups,
+		principals: req.AllowedPrincipals,
+		services:   req.AllowedServices,
+		statements: req.statements,
+	}
+
+	if err := access.validate(); err != nil {
+		return nil, err
+	}
+
 	repository := fmt.Sprintf("%s/%s", group, req.RepositoryName)
 
 	log.Debugf("creating %s repository with request %+v", repository, req)
@@ -83,7 +112,7 @@ func (o *ecrOrchestrator) repositoryCreate(ctx context.Context, account, group s
 		return nil, err
 	}
 
-	policy, err := repositoryPolicy(req.Groups)
+	policy, err := repositoryPolicy(access)
 	if err != nil {
 		return nil, err
 	}
@@ -97,7 +126,13 @@ func (o *ecrOrchestrator) repositoryCreate(ctx context.Context, account, group s
 		return nil, err
 	}
 
-	return repositoryResponseFromECR(out, req.Groups, tags), nil
+	// respond with the access from the policy, so it's the same as getting the repository
+	access, err = repositoryAccessFromPolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	return repositoryResponseFromECR(out, access, tags), nil
 }
 
 // repositoryDelete orchestrates the deletion of a repository
@@ -116,7 +151,7 @@ func (o *ecrOrchestrator) repositoryDelete(ctx context.Context, account, group,
 		return nil, err
 	}
 
-	groups, err := repositoryGroupsFromPolicy(policy)
+	access, err := repositoryAccessFromPolicy(policy)
 	if err != nil {
 		return nil, err
 	}
@@ -133,7 +168,7 @@ func (o *ecrOrchestrator) repositoryDelete(ctx context.Context, account, group,
 
 	log.Debugf("got output %+v", out)
 
-	return repositoryResponseFromECR(out, groups, tags), nil
+	return repositoryResponseFromECR(out, access, tags), nil
 }
 
 // repositoryUpdate orchestrates updating a repository
@@ -142,6 +177,15 @@ func (o *ecrOrchestrator) repositoryUpdate(ctx context.Context, account, group,
 
 	log.Debugf("updating %s repository with request %+v", repository, req)
 
+	update := &repositoryAccess{
+		principals: req.AllowedPrincipals,
+		services:   req.AllowedServices,
+	}
+
+	if err := update.validate(); err != nil {
+		return nil, err
+	}
+
 	req.Tags = normalizeTags(o.org, group, repository, req.Tags)
 
 	repo, err := o.client.GetRepositories(ctx, repository)
@@ -149,6 +193,16 @@ func (o *ecrOrchestrator) repositoryUpdate(ctx context.Context, account, group,
 		return nil, err
 	}
 
+	tags, err := o.client.GetRepositoryTags(ctx, aws.StringValue(repo.RepositoryArn))
+	if err != nil {
+		return nil, err
+	}
+
+	if deleteAt := repositoryDeleteAt(tags); deleteAt != nil {
+		msg := fmt.Sprintf("repository %s is pending deletion at %s, restore it before updating", repository, deleteAt.Format(time.RFC3339))
+		return nil, apierror.New(apierror.ErrConflict, msg, nil)
+	}
+
 	if req.ScanOnPush != "" {
 		scanOnPush, err := strconv.ParseBool(req.ScanOnPush)
 		if err != nil {
@@ -160,8 +214,31 @@ func (o *ecrOrchestrator) repositoryUpdate(ctx context.Context, account, group,
 		}
 	}
 
-	if req.Groups != nil {
-		policy, err := repositoryPolicy(req.Groups)
+	if req.Groups != nil || req.AllowedPrincipals != nil || req.AllowedServices != nil {
+		current, err := o.client.GetRepositoryPolicy(ctx, repository)
+		if err != nil {
+			return nil, err
+		}
+
+		access, err := repositoryAccessFromPolicy(current)
+		if err != nil {
+			return nil, err
+		}
+
+		// keep the groups, principals or services that aren't being updated
+		if req.Groups != nil {
+			access.groups = req.Groups
+		}
+
+		if req.AllowedPrincipals != nil {
+			access.principals = req.AllowedPrincipals
+		}
+
+		if req.AllowedServices != nil {
+			access.services = req.AllowedServices
+		}
+
+		policy, err := repositoryPolicy(access)
 		if err != nil {
 			return nil, err
 		}
@@ -187,15 +264,66 @@ func (o *ecrOrchestrator) repositoryUpdate(ctx context.Context, account, group,
 		return nil, err
 	}
 
-	groups, err := repositoryGroupsFromPolicy(policy)
+	access, err := repositoryAccessFromPolicy(policy)
 	if err != nil {
 		return nil, err
 	}
 
-	tags, err := o.client.GetRepositoryTags(ctx, aws.StringValue(repo.RepositoryArn))
+	tags, err = o.client.GetRepositoryTags(ctx, aws.StringValue(repo.RepositoryArn))
 	if err != nil {
 		return nil, err
 	}
 
-	return repositoryResponseFromECR(repo, groups, tags), nil
+	return repositoryResponseFromECR(repo, access, tags), nil
+}
+
+// repositoryToken gets a docker login for the repository.  The session is expected to be limited to the repository
+// with the repositoryTokenPolicy, the token has the same permissions as the session and stops working when the
+// session credentials expire at sessionExpiresAt.
+func (o *ecrOrchestrator) repositoryToken(ctx context.Context, group, name, access string, sessionExpiresAt time.Time) (*RepositoryTokenResponse, error) {
+	repository := fmt.Sprintf("%s/%s", group, name)
+
+	log.Infof("getting %s token for repository %s", access, repository)
+
+	if _, err := o.client.GetRepositories(ctx, repository); err != nil {
+		return nil, err
+	}
+
+	auth, err := o.client.GetAuthorizationToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	username, password, err := decodeAuthorizationToken(aws.StringValue(auth.AuthorizationToken))
+	if err != nil {
+		return nil, apierror.New(apierror.ErrInternalError, "failed to decode authorization token", err)
+	}
+
+	expiresAt := aws.TimeValue(auth.ExpiresAt)
+	if !sessionExpiresAt.IsZero() && sessionExpiresAt.Before(expiresAt) {
+		expiresAt = sessionExpiresAt
+	}
+
+	return &RepositoryTokenResponse{
+		Access:    access,
+		Username:  username,
+		Password:  password,
+		Endpoint:  aws.StringValue(auth.ProxyEndpoint),
+		ExpiresAt: expiresAt.UTC(),
+	}, nil
+}
+
+// decodeAuthorizationToken splits a base64 encoded 'user:password' authorization token
+func decodeAuthorizationToken(token string) (string, string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return "", "", err
+	}
+
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("expected 'user:password' token")
+	}
+
+	return parts[0], parts[1], nil
 }
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/ecr-api/ecr"
+)
+
+func Test_decodeAuthorizationToken(t *testing.T) {
+	tests := []struct {
+		name         string
+		token        string
+		wantUsername string
+		wantPassword string
+		wantErr      bool
+	}{
+		{
+			name:         "token",
+			token:        "QVdTOnNlY3JldDpwYXNzd29yZA==",
+			wantUsername: "AWS",
+			wantPassword: "secret:password",
+		},
+		{
+			name:    "not base64",
+			token:   "not a token!",
+			wantErr: true,
+		},
+		{
+			name:    "no password",
+			token:   "QVdT",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			username, password, err := decodeAuthorizationToken(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeAuthorizationToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if username != tt.wantUsername || password != tt.wantPassword {
+				t.Errorf("decodeAuthorizationToken() = %s, %s, want %s, %s", username, password, tt.wantUsername, tt.wantPassword)
+			}
+		})
+	}
+}
+
+func TestRepositoryAllowedPrincipals(t *testing.T) {
+	ctx := context.Background()
+	orch := newEcrOrchestrator(ecr.ECR{Service: newFakeECR("12345")}, "testOrg")
+
+	principals := []string{"012345678901", "arn:aws:iam::109876543210:role/deploy"}
+
+	resp, err := orch.repositoryCreate(ctx, "12345", "spindev-00001", &RepositoryCreateRequest{
+		RepositoryName:    "rudolph",
+		Groups:            []string{"spindev-00002"},
+		AllowedPrincipals: principals,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(resp.AllowedPrincipals, principals) {
+		t.Errorf("expected principals %v, got %v", principals, resp.AllowedPrincipals)
+	}
+
+	// updating the groups keeps the principals
+	resp, err = orch.repositoryUpdate(ctx, "12345", "spindev-00001", "rudolph", &RepositoryUpdateRequest{Groups: []string{"spindev-00003"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(resp.Groups, []string{"spindev-00003"}) || !reflect.DeepEqual(resp.AllowedPrincipals, principals) {
+		t.Errorf("expected groups [spindev-00003] and principals %v, got %v and %v", principals, resp.Groups, resp.AllowedPrincipals)
+	}
+
+	// updating the principals keeps the groups
+	resp, err = orch.repositoryUpdate(ctx, "12345", "spindev-00001", "rudolph", &RepositoryUpdateRequest{AllowedPrincipals: []string{}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(resp.Groups, []string{"spindev-00003"}) || len(resp.AllowedPrincipals) != 0 {
+		t.Errorf("expected groups [spindev-00003] and no principals, got %v and %v", resp.Groups, resp.AllowedPrincipals)
+	}
+
+	_, err = orch.repositoryUpdate(ctx, "12345", "spindev-00001", "rudolph", &RepositoryUpdateRequest{AllowedPrincipals: []string{"*"}})
+	if aerr, ok := err.(apierror.Error); !ok || aerr.Code != apierror.ErrBadRequest {
+		t.Errorf("expected a bad request error for an invalid principal, got %v", err)
+	}
+}
+
+func TestRepositoryAllowedServices(t *testing.T) {
+	ctx := context.Background()
+	orch := newEcrOrchestrator(ecr.ECR{Service: newFakeECR("12345")}, "testOrg")
+
+	services := []*RepositoryServiceAccess{
+		{Service: "lambda", SourceAccounts: []string{"012345678901"}, SourceArns: []string{"arn:aws:lambda:us-east-1:012345678901:function:*"}},
+		{Service: "codebuild", SourceAccounts: []string{"012345678901"}, SourceArns: []string{}},
+	}
+
+	resp, err := orch.repositoryCreate(ctx, "12345", "spindev-00001", &RepositoryCreateRequest{
+		RepositoryName:  "rudolph",
+		AllowedServices: services,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(resp.AllowedServices, services) {
+		t.Errorf("expected services %+v, got %+v", services, resp.AllowedServices)
+	}
+
+	// updating the groups keeps the services
+	resp, err = orch.repositoryUpdate(ctx, "12345", "spindev-00001", "rudolph", &RepositoryUpdateRequest{Groups: []string{"spindev-00003"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(resp.Groups, []string{"spindev-00003"}) || !reflect.DeepEqual(resp.AllowedServices, services) {
+		t.Errorf("expected groups [spindev-00003] and services %+v, got %v and %+v", services, resp.Groups, resp.AllowedServices)
+	}
+
+	resp, err = orch.repositoryUpdate(ctx, "12345", "spindev-00001", "rudolph", &RepositoryUpdateRequest{AllowedServices: []*RepositoryServiceAccess{}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(resp.Groups, []string{"spindev-00003"}) || len(resp.AllowedServices) != 0 {
+		t.Errorf("expected groups [spindev-00003] and no services, got %v and %+v", resp.Groups, resp.AllowedServices)
+	}
+
+	_, err = orch.repositoryUpdate(ctx, "12345", "spindev-00001", "rudolph", &RepositoryUpdateRequest{
+		AllowedServices: []*RepositoryServiceAccess{{Service: "lambda"}},
+	})
+	if aerr, ok := err.(apierror.Error); !ok || aerr.Code != apierror.ErrBadRequest {
+		t.Errorf("expected a bad request error for an unrestricted service, got %v", err)
+	}
+}
+
+func TestRepositoryUpdateKeepsPolicyStatements(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeECR("12345")
+	orch := newEcrOrchestrator(ecr.ECR{Service: client}, "testOrg")
+
+	policy, err := repositoryPolicy(&repositoryAccess{groups: []string{"spindev-00002"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// the security team denies pulls outside of the organization
+	security := `{"Sid":"DenyPullOutsideOrganization","Effect":"Deny","Principal":{"AWS":"*"},"Action":["ecr:BatchGetImage"],"Condition":{"StringNotEquals":{"aws:PrincipalOrgID":"o-abc123"}}}`
+	client.addRepository("spindev-00001/rudolph", policy[:len(policy)-2]+","+security+"]}")
+
+	resp, err := orch.repositoryUpdate(ctx, "12345", "spindev-00001", "rudolph", &RepositoryUpdateRequest{Groups: []string{"spindev-00003"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(resp.Groups, []string{"spindev-00003"}) {
+		t.Errorf("expected groups [spindev-00003], got %v", resp.Groups)
+	}
+
+	if resp.Policy == nil || len(resp.Policy.Statement) != 2 {
+		t.Fatalf("expected the policy with 2 statements, got %+v", resp.Policy)
+	}
+
+	if s := resp.Policy.Statement[1]; s.Sid != "DenyPullOutsideOrganization" || s.Effect != "Deny" || s.Condition["StringNotEquals"]["aws:PrincipalOrgID"][0] != "o-abc123" {
+		t.Errorf("expected the security statement to be kept, got %+v", s)
+	}
+}
+
+func TestRepositoryTokenExpiresWithSession(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeECR("12345")
+	orch := newEcrOrchestrator(ecr.ECR{Service: client}, "testOrg")
+
+	client.addRepository("spindev-00001/rudolph", "")
+
+	// the session expires before the 12 hour token
+	sessionExpiresAt := time.Now().Add(time.Hour).UTC()
+	resp, err := orch.repositoryToken(ctx, "spindev-00001", "rudolph", userRolePull, sessionExpiresAt)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if resp.Username != "AWS" || resp.Password != "secret" {
+		t.Errorf("expected AWS:secret login, got %s:%s", resp.Username, resp.Password)
+	}
+
+	if !resp.ExpiresAt.Equal(sessionExpiresAt) {
+		t.Errorf("expected token to expire with the session at %s, got %s", sessionExpiresAt, resp.ExpiresAt)
+	}
+
+	// the token expires before the session
+	sessionExpiresAt = time.Now().Add(24 * time.Hour)
+	resp, err = orch.repositoryToken(ctx, "spindev-00001", "rudolph", userRolePull, sessionExpiresAt)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !resp.ExpiresAt.Before(sessionExpiresAt) {
+		t.Errorf("expected token to expire before the session at %s, got %s", sessionExpiresAt, resp.ExpiresAt)
+	}
+
+	if _, err := orch.repositoryToken(ctx, "spindev-00001", "missing", userRolePull, sessionExpiresAt); err == nil {
+		t.Error("expected error for missing repository, got nil")
+	}
+}
+
+func TestRepositoryCreateReservedName(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeECR("12345")
+	orch := newEcrOrchestrator(ecr.ECR{Service: client}, "testOrg")
+
+	// the group-wide users are managed under {group}/users
+	_, err := orch.repositoryCreate(ctx, "12345", "spindev-00001", &RepositoryCreateRequest{RepositoryName: "users"})
+	if aerr, ok := err.(apierror.Error); !ok || aerr.Code != apierror.ErrBadRequest {
+		t.Errorf("expected a bad request error for the reserved name, got %v", err)
+	}
+
+	if _, ok := client.repos["spindev-00001/users"]; ok {
+		t.Error("expected the reserved repository not to be created")
+	}
+}
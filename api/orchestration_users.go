@@ -5,16 +5,113 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/YaleSpinup/apierror"
 	"github.com/aws/aws-sdk-go/aws"
+	awsiam "github.com/aws/aws-sdk-go/service/iam"
 
 	"github.com/YaleSpinup/ecr-api/iam"
 	log "github.com/sirupsen/logrus"
 )
 
-var ecrAdminPolicyDoc string
+// repository user roles, each has its own managed policy and group
+const (
+	userRolePull  = "pull"
+	userRolePush  = "push"
+	userRoleAdmin = "admin"
+)
+
+// userRoles are the repository user roles in the order their groups are prepared
+var userRoles = []string{userRoleAdmin, userRolePull, userRolePush}
+
+// user policy and group reconcile change types and actions
+const (
+	userPolicyChangeTypePolicy = "policy"
+	userPolicyChangeTypeGroup  = "group"
+
+	userPolicyActionCreated  = "created"
+	userPolicyActionUpdated  = "updated"
+	userPolicyActionAttached = "attached"
+)
+
+// maxPolicyVersions is the maximum number of versions IAM keeps for a managed policy
+const maxPolicyVersions = 5
+
+// userRoleNames are the base names of the managed policy and group for each role, the org is appended
+var userRoleNames = map[string]string{
+	userRolePull:  "SpinupECRPull",
+	userRolePush:  "SpinupECRPush",
+	userRoleAdmin: "SpinupECRAdmin",
+}
+
+// ecrRepositoryUserCondition limits the user to the repository in their space and org
+var ecrRepositoryUserCondition = iam.Condition{
+	"StringEqualsIgnoreCase": iam.ConditionStatement{
+		"aws:ResourceTag/Name":           []string{"${aws:PrincipalTag/ResourceName}"},
+		"aws:ResourceTag/spinup:org":     []string{"${aws:PrincipalTag/spinup:org}"},
+		"aws:ResourceTag/spinup:spaceid": []string{"${aws:PrincipalTag/spinup:spaceid}"},
+	},
+}
+
+var ecrDockerLoginStatement = iam.StatementEntry{
+	Sid:      "AllowDockerLogin",
+	Effect:   "Allow",
+	Action:   []string{"ecr:GetAuthorizationToken"},
+	Resource: []string{"*"},
+}
+
+// EcrPullPolicy only allows pulling images from the repository
+var EcrPullPolicy = iam.PolicyDocument{
+	Version: "2012-10-17",
+	Statement: []iam.StatementEntry{
+		{
+			Sid:    "AllowPullFromRepositoriesInSpaceAndOrg",
+			Effect: "Allow",
+			Action: []string{
+				"ecr:DescribeImageScanFindings",
+				"ecr:GetDownloadUrlForLayer",
+				"ecr:ListImages",
+				"ecr:BatchGetImage",
+				"ecr:DescribeImages",
+				"ecr:BatchCheckLayerAvailability",
+			},
+			Resource:  []string{"*"},
+			Condition: ecrRepositoryUserCondition,
+		},
+		ecrDockerLoginStatement,
+	},
+}
+
+// EcrPushPolicy allows pulling and pushing images to the repository
+var EcrPushPolicy = iam.PolicyDocument{
+	Version: "2012-10-17",
+	Statement: []iam.StatementEntry{
+		{
+			Sid:    "AllowPushToRepositoriesInSpaceAndOrg",
+			Effect: "Allow",
+			Action: []string{
+				"ecr:DescribeImageScanFindings",
+				"ecr:GetDownloadUrlForLayer",
+				"ecr:UploadLayerPart",
+				"ecr:ListImages",
+				"ecr:PutImage",
+				"ecr:BatchGetImage",
+				"ecr:CompleteLayerUpload",
+				"ecr:DescribeImages",
+				"ecr:InitiateLayerUpload",
+				"ecr:BatchCheckLayerAvailability",
+			},
+			Resource:  []string{"*"},
+			Condition: ecrRepositoryUserCondition,
+		},
+		ecrDockerLoginStatement,
+	},
+}
+
+// EcrAdminPolicy allows pushing, deleting images and changing the lifecycle of the repository
 var EcrAdminPolicy = iam.PolicyDocument{
 	Version: "2012-10-17",
 	Statement: []iam.StatementEntry{
@@ -39,50 +136,156 @@ var EcrAdminPolicy = iam.PolicyDocument{
 				"ecr:InitiateLayerUpload",
 				"ecr:BatchCheckLayerAvailability",
 			},
-			Resource: []string{"*"},
-			Condition: iam.Condition{
-				"StringEqualsIgnoreCase": iam.ConditionStatement{
-					"aws:ResourceTag/Name":           []string{"${aws:PrincipalTag/ResourceName}"},
-					"aws:ResourceTag/spinup:org":     []string{"${aws:PrincipalTag/spinup:org}"},
-					"aws:ResourceTag/spinup:spaceid": []string{"${aws:PrincipalTag/spinup:spaceid}"},
-				},
-			},
-		},
-		{
-			Sid:      "AllowDockerLogin",
-			Effect:   "Allow",
-			Action:   []string{"ecr:GetAuthorizationToken"},
-			Resource: []string{"*"},
+			Resource:  []string{"*"},
+			Condition: ecrRepositoryUserCondition,
 		},
+		ecrDockerLoginStatement,
+	},
+}
+
+// userRolePolicies are the managed policy documents for each role
+var userRolePolicies = map[string]iam.PolicyDocument{
+	userRolePull:  EcrPullPolicy,
+	userRolePush:  EcrPushPolicy,
+	userRoleAdmin: EcrAdminPolicy,
+}
+
+// groupUserRoleNames are the base names of the managed policy and group for each role of the group-wide users
+var groupUserRoleNames = map[string]string{
+	userRolePull:  "SpinupECRSpacePull",
+	userRolePush:  "SpinupECRSpacePush",
+	userRoleAdmin: "SpinupECRSpaceAdmin",
+}
+
+// ecrGroupUserCondition limits the user to the repositories in their space and org
+var ecrGroupUserCondition = iam.Condition{
+	"StringEqualsIgnoreCase": iam.ConditionStatement{
+		"aws:ResourceTag/spinup:org":     []string{"${aws:PrincipalTag/spinup:org}"},
+		"aws:ResourceTag/spinup:spaceid": []string{"${aws:PrincipalTag/spinup:spaceid}"},
 	},
 }
 
-// listRepositoryUsers lists users in a repository
+// groupUserRolePolicies are the managed policy documents for each role of the group-wide users
+var groupUserRolePolicies = map[string]iam.PolicyDocument{
+	userRolePull:  groupUserPolicy(EcrPullPolicy),
+	userRolePush:  groupUserPolicy(EcrPushPolicy),
+	userRoleAdmin: groupUserPolicy(EcrAdminPolicy),
+}
+
+// groupUserPolicy returns a copy of the repository user policy document that allows access to every
+// repository in the space
+func groupUserPolicy(doc iam.PolicyDocument) iam.PolicyDocument {
+	statements := make([]iam.StatementEntry, 0, len(doc.Statement))
+	for _, s := range doc.Statement {
+		if s.Condition != nil {
+			s.Condition = ecrGroupUserCondition
+		}
+		statements = append(statements, s)
+	}
+
+	return iam.PolicyDocument{
+		Version:   doc.Version,
+		Statement: statements,
+	}
+}
+
+// userRoleGroupName returns the name of the iam group for the role in the org
+func userRoleGroupName(org, role string) string {
+	return fmt.Sprintf("%sGroup-%s", userRoleNames[role], org)
+}
+
+// userRolePolicyName returns the name of the managed policy for the role in the org
+func userRolePolicyName(org, role string) string {
+	return fmt.Sprintf("%sPolicy-%s", userRoleNames[role], org)
+}
+
+// groupUserRoleGroupName returns the name of the iam group for the group-wide user role in the org
+func groupUserRoleGroupName(org, role string) string {
+	return fmt.Sprintf("%sGroup-%s", groupUserRoleNames[role], org)
+}
+
+// groupUserRolePolicyName returns the name of the managed policy for the group-wide user role in the org
+func groupUserRolePolicyName(org, role string) string {
+	return fmt.Sprintf("%sPolicy-%s", groupUserRoleNames[role], org)
+}
+
+// userRoleFromGroups returns the role of a user from the iam groups they're in, preferring the most privileged role
+func userRoleFromGroups(org string, groups []string) string {
+	for _, role := range userRoles {
+		for _, g := range groups {
+			if g == userRoleGroupName(org, role) || g == groupUserRoleGroupName(org, role) {
+				return role
+			}
+		}
+	}
+	return ""
+}
+
+// repositoryUserPath returns the iam path of the users of a repository, or of the group-wide users
+// when the name is empty
+func repositoryUserPath(org, group, name string) string {
+	if name == "" {
+		return fmt.Sprintf("/spinup/%s/%s/", org, group)
+	}
+	return fmt.Sprintf("/spinup/%s/%s/%s/", org, group, name)
+}
+
+// repositoryUserIAMName returns the iam user name of a repository user, prefixed with the repository name,
+// or with the group for group-wide users
+func repositoryUserIAMName(group, name, user string) string {
+	if name == "" {
+		return fmt.Sprintf("%s-%s", group, user)
+	}
+	return fmt.Sprintf("%s-%s", name, user)
+}
+
+// repositoryUserResource returns the repository (group/name) of a repository user, or the group for
+// group-wide users
+func repositoryUserResource(group, name string) string {
+	if name == "" {
+		return group
+	}
+	return fmt.Sprintf("%s/%s", group, name)
+}
+
+// repositoryUserScope splits the repository of a repository user into the group and name, the name is
+// empty for group-wide users
+func repositoryUserScope(repository string) (string, string) {
+	if !strings.Contains(repository, "/") {
+		return repository, ""
+	}
+	return splitRepositoryName(repository)
+}
+
+// listRepositoryUsers lists users in a repository, or the group-wide users when the name is empty.  Users
+// in the paths below are skipped, so the users of the repositories aren't listed as group-wide users.
 func (o *iamOrchestrator) listRepositoryUsers(ctx context.Context, group, name string) ([]string, error) {
-	path := fmt.Sprintf("/spinup/%s/%s/%s", o.org, group, name)
+	path := repositoryUserPath(o.org, group, name)
 
-	users, err := o.client.ListUsers(ctx, path)
+	users, err := o.client.ListUsersWithPath(ctx, path)
 	if err != nil {
 		return nil, err
 	}
 
-	prefix := name + "-"
+	prefix := repositoryUserIAMName(group, name, "")
 
 	trimmed := make([]string, 0, len(users))
 	for _, u := range users {
-		log.Debugf("trimming prefix '%s' from username %s", prefix, u)
-		u = strings.TrimPrefix(u, prefix)
-		trimmed = append(trimmed, u)
+		if aws.StringValue(u.Path) != path {
+			continue
+		}
+
+		log.Debugf("trimming prefix '%s' from username %s", prefix, aws.StringValue(u.UserName))
+		trimmed = append(trimmed, strings.TrimPrefix(aws.StringValue(u.UserName), prefix))
 	}
-	users = trimmed
 
-	return users, nil
+	return trimmed, nil
 }
 
 // getRepositoryUser gets the details about a user
 func (o *iamOrchestrator) getRepositoryUser(ctx context.Context, group, name, user string) (*RepositoryUserResponse, error) {
-	path := fmt.Sprintf("/spinup/%s/%s/%s/", o.org, group, name)
-	userName := fmt.Sprintf("%s-%s", name, user)
+	path := repositoryUserPath(o.org, group, name)
+	userName := repositoryUserIAMName(group, name, user)
 
 	iamUser, err := o.client.GetUserWithPath(ctx, path, userName)
 	if err != nil {
@@ -99,13 +302,86 @@ func (o *iamOrchestrator) getRepositoryUser(ctx context.Context, group, name, us
 		return nil, err
 	}
 
-	return repositoryUserResponseFromIAM(o.org, iamUser, keys, groups), nil
+	response := repositoryUserResponseFromIAM(o.org, iamUser, keys, groups)
+	if err := o.accessKeysLastUsed(ctx, response.AccessKeys); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// listRepositoryUsersWithDetails lists the details about the users in a repository
+func (o *iamOrchestrator) listRepositoryUsersWithDetails(ctx context.Context, group, name string) ([]*RepositoryUserResponse, error) {
+	users, err := o.listRepositoryUsers(ctx, group, name)
+	if err != nil {
+		return nil, err
+	}
+
+	details := make([]*RepositoryUserResponse, 0, len(users))
+	for _, u := range users {
+		user, err := o.getRepositoryUser(ctx, group, name, u)
+		if err != nil {
+			return nil, err
+		}
+		details = append(details, user)
+	}
+
+	return details, nil
+}
+
+// repositoryUserStatus is Inactive if all of the user's access keys are inactive, otherwise it's Active
+func repositoryUserStatus(keys []*awsiam.AccessKeyMetadata) string {
+	if len(keys) == 0 {
+		return awsiam.StatusTypeActive
+	}
+
+	for _, k := range keys {
+		if aws.StringValue(k.Status) == awsiam.StatusTypeActive {
+			return awsiam.StatusTypeActive
+		}
+	}
+
+	return awsiam.StatusTypeInactive
+}
+
+// accessKeysLastUsed sets when, where and with which service each of the access keys was last used
+func (o *iamOrchestrator) accessKeysLastUsed(ctx context.Context, keys []*RepositoryUserAccessKey) error {
+	for _, k := range keys {
+		lastUsed, err := o.client.GetAccessKeyLastUsed(ctx, aws.StringValue(k.AccessKeyId))
+		if err != nil {
+			return err
+		}
+
+		k.LastUsedDate, k.LastUsedService, k.LastUsedRegion = accessKeyLastUsed(lastUsed)
+	}
+
+	return nil
+}
+
+// accessKeyLastUsed returns the last used date, service and region of an access key.  IAM returns N/A for
+// the service and region and no date if the key has never been used.
+func accessKeyLastUsed(lastUsed *awsiam.AccessKeyLastUsed) (*time.Time, string, string) {
+	if lastUsed == nil || lastUsed.LastUsedDate == nil {
+		return nil, "", ""
+	}
+
+	service := aws.StringValue(lastUsed.ServiceName)
+	if service == "N/A" {
+		service = ""
+	}
+
+	region := aws.StringValue(lastUsed.Region)
+	if region == "N/A" {
+		region = ""
+	}
+
+	return lastUsed.LastUsedDate, service, region
 }
 
 // repositoryUserDelete orchestrates removing a user from all groups and deleting the user
 func (o *iamOrchestrator) repositoryUserDelete(ctx context.Context, name, group, user string) error {
-	path := fmt.Sprintf("/spinup/%s/%s/%s/", o.org, group, name)
-	userName := fmt.Sprintf("%s-%s", name, user)
+	path := repositoryUserPath(o.org, group, name)
+	userName := repositoryUserIAMName(group, name, user)
 
 	if _, err := o.client.GetUserWithPath(ctx, path, userName); err != nil {
 		return err
@@ -158,64 +434,119 @@ func (o *iamOrchestrator) repositoryUserDeleteAll(ctx context.Context, name, gro
 	return users, nil
 }
 
-// prepareAccount sets up the account for user management by creating the ECR admin policy and group
-func (o *iamOrchestrator) prepareAccount(ctx context.Context) (string, error) {
+// prepareAccount sets up the account for user management by creating the managed policy and group
+// for each user role.  It returns the group names by role.
+func (o *iamOrchestrator) prepareAccount(ctx context.Context) (map[string]string, error) {
 	log.Info("preparing account for user management")
+	return o.prepareRoleGroups(ctx, userRolePolicyName, userRoleGroupName, userRolePolicies)
+}
 
-	path := fmt.Sprintf("/spinup/%s/", o.org)
+// prepareAccountForGroupUsers sets up the account for group-wide user management by creating the managed
+// policy and group for each group-wide user role.  It returns the group names by role.
+func (o *iamOrchestrator) prepareAccountForGroupUsers(ctx context.Context) (map[string]string, error) {
+	log.Info("preparing account for group-wide user management")
+	return o.prepareRoleGroups(ctx, groupUserRolePolicyName, groupUserRoleGroupName, groupUserRolePolicies)
+}
 
-	policyName := fmt.Sprintf("SpinupECRAdminPolicy-%s", o.org)
-	policyArn, err := o.userCreatePolicyIfMissing(ctx, policyName, path)
-	if err != nil {
-		return "", err
+// prepareRoleGroups creates the managed policy and group for each user role if they're missing and repairs
+// any drift from the desired policy documents
+func (o *iamOrchestrator) prepareRoleGroups(ctx context.Context, policyNameFor, groupNameFor func(string, string) string, policies map[string]iam.PolicyDocument) (map[string]string, error) {
+	groups, changes, err := o.reconcileRoleGroups(ctx, policyNameFor, groupNameFor, policies, false)
+	for _, c := range changes {
+		log.Warnf("repaired user %s %s %s: %s", c.Role, c.Type, c.Name, c.Action)
 	}
 
-	groupName := fmt.Sprintf("SpinupECRAdminGroup-%s", o.org)
-	if err := o.userCreateGroupIfMissing(ctx, groupName, path, policyArn); err != nil {
-		return "", err
+	return groups, err
+}
+
+// reconcileRoleGroups reconciles the managed policy and group for each user role with the desired policy
+// documents.  It returns the group names by role and the changes, with dryRun the changes are only reported.
+func (o *iamOrchestrator) reconcileRoleGroups(ctx context.Context, policyNameFor, groupNameFor func(string, string) string, policies map[string]iam.PolicyDocument, dryRun bool) (map[string]string, []*UserPolicyChange, error) {
+	path := fmt.Sprintf("/spinup/%s/", o.org)
+
+	groups := make(map[string]string, len(userRoles))
+	changes := []*UserPolicyChange{}
+	for _, role := range userRoles {
+		policyArn, change, err := o.userCreatePolicyIfMissing(ctx, policyNameFor(o.org, role), path, policies[role], dryRun)
+		if err != nil {
+			return nil, changes, err
+		}
+
+		if change != nil {
+			change.Role = role
+			changes = append(changes, change)
+		}
+
+		groupName := groupNameFor(o.org, role)
+		change, err = o.userCreateGroupIfMissing(ctx, groupName, path, policyArn, dryRun)
+		if err != nil {
+			return nil, changes, err
+		}
+
+		if change != nil {
+			change.Role = role
+			changes = append(changes, change)
+		}
+
+		groups[role] = groupName
 	}
 
-	return groupName, err
+	return groups, changes, nil
 }
 
 // userCreatePolicyIfMissing gets the given policy by name.  if the policy isn't found it simply creates the policy and
 // returns.  if the policy is found, it gets the policy document and compares to the expected policy document, updating
-// if they differ.
-func (o *iamOrchestrator) userCreatePolicyIfMissing(ctx context.Context, name, path string) (string, error) {
+// if they differ.  The change is returned, it's nil if the policy is unchanged.
+func (o *iamOrchestrator) userCreatePolicyIfMissing(ctx context.Context, name, path string, policyDoc iam.PolicyDocument, dryRun bool) (string, *UserPolicyChange, error) {
 	log.Infof("creating policy %s in %s if missing", name, path)
 
+	policyDocBytes, err := json.Marshal(policyDoc)
+	if err != nil {
+		return "", nil, err
+	}
+
 	policy, err := o.client.GetPolicyByName(ctx, name, path)
 	if err != nil {
 		if aerr, ok := err.(apierror.Error); ok && aerr.Code == apierror.ErrNotFound {
 			log.Infof("policy %s not found, creating", name)
 		} else {
-			return "", err
+			return "", nil, err
 		}
 	}
 
+	change := &UserPolicyChange{
+		Type: userPolicyChangeTypePolicy,
+		Name: name,
+	}
+
 	// if the policy isn't found, create it and return
 	if policy == nil {
-		out, err := o.client.CreatePolicy(ctx, name, path, ecrAdminPolicyDoc)
+		change.Action = userPolicyActionCreated
+		if dryRun {
+			return "", change, nil
+		}
+
+		out, err := o.client.CreatePolicy(ctx, name, path, string(policyDocBytes))
 		if err != nil {
-			return "", err
+			return "", nil, err
 		}
 
 		if err := o.client.WaitForPolicy(ctx, aws.StringValue(out.Arn)); err != nil {
-			return "", err
+			return "", nil, err
 		}
 
-		return aws.StringValue(out.Arn), nil
+		return aws.StringValue(out.Arn), change, nil
 	}
 
 	out, err := o.client.GetDefaultPolicyVersion(ctx, aws.StringValue(policy.Arn), aws.StringValue(policy.DefaultVersionId))
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	// Document is returned url encoded, we must decode it to unmarshal and compare
 	d, err := url.QueryUnescape(aws.StringValue(out.Document))
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	// If we cannot unmarshal the document we received into an iam.PolicyDocument or if
@@ -226,40 +557,96 @@ func (o *iamOrchestrator) userCreatePolicyIfMissing(ctx context.Context, name, p
 	if err := json.Unmarshal([]byte(d), &doc); err != nil {
 		log.Warnf("error getting policy document: %s, updating", err)
 		updatePolicy = true
-	} else if !iam.PolicyDeepEqual(doc, EcrAdminPolicy) {
+	} else if !iam.PolicyDeepEqual(doc, policyDoc) {
 		log.Warn("policy document is not the same, updating")
 		updatePolicy = true
+		change.PreviousDocument = &doc
+	}
+
+	if !updatePolicy {
+		return aws.StringValue(policy.Arn), nil, nil
+	}
+
+	change.Action = userPolicyActionUpdated
+	change.PreviousVersionId = aws.StringValue(policy.DefaultVersionId)
+	if dryRun {
+		return aws.StringValue(policy.Arn), change, nil
+	}
+
+	pruned, err := o.pruneUserPolicyVersions(ctx, aws.StringValue(policy.Arn))
+	if err != nil {
+		return "", nil, err
+	}
+	change.PrunedVersionIds = pruned
+
+	if err := o.client.UpdatePolicy(ctx, aws.StringValue(policy.Arn), string(policyDocBytes)); err != nil {
+		return "", nil, err
+	}
+
+	return aws.StringValue(policy.Arn), change, nil
+}
+
+// pruneUserPolicyVersions deletes the oldest non-default versions of a managed policy to make room for a new
+// version, IAM only allows 5 versions of a policy.  It returns the deleted version ids.
+func (o *iamOrchestrator) pruneUserPolicyVersions(ctx context.Context, policyArn string) ([]string, error) {
+	versions, err := o.client.ListPolicyVersions(ctx, policyArn)
+	if err != nil {
+		return nil, err
 	}
 
-	if updatePolicy {
-		if err := o.client.UpdatePolicy(ctx, aws.StringValue(policy.Arn), ecrAdminPolicyDoc); err != nil {
-			return "", err
+	old := make([]*awsiam.PolicyVersion, 0, len(versions))
+	for _, v := range versions {
+		if !aws.BoolValue(v.IsDefaultVersion) {
+			old = append(old, v)
 		}
+	}
 
-		// TODO: delete old version, only 5 versions allowed
+	sort.Slice(old, func(i, j int) bool {
+		return aws.TimeValue(old[i].CreateDate).Before(aws.TimeValue(old[j].CreateDate))
+	})
+
+	pruned := []string{}
+	for i := 0; len(versions)-len(pruned) >= maxPolicyVersions && i < len(old); i++ {
+		id := aws.StringValue(old[i].VersionId)
+		if err := o.client.DeletePolicyVersion(ctx, policyArn, id); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, id)
 	}
 
-	return aws.StringValue(policy.Arn), nil
+	return pruned, nil
 }
 
-func (o *iamOrchestrator) userCreateGroupIfMissing(ctx context.Context, name, path, policyArn string) error {
+// userCreateGroupIfMissing creates the group if it's missing and attaches the policy if it's not attached.
+// The change is returned, it's nil if the group is unchanged.
+func (o *iamOrchestrator) userCreateGroupIfMissing(ctx context.Context, name, path, policyArn string, dryRun bool) (*UserPolicyChange, error) {
 	log.Infof("creating group %s in %s and assigning policy %s if missing", name, path, policyArn)
 
+	change := &UserPolicyChange{
+		Type: userPolicyChangeTypeGroup,
+		Name: name,
+	}
+
 	if _, err := o.client.GetGroupWithPath(ctx, name, path); err != nil {
 		if aerr, ok := err.(apierror.Error); ok && aerr.Code == apierror.ErrNotFound {
 			log.Infof("group %s not found, creating", name)
 
+			change.Action = userPolicyActionCreated
+			if dryRun {
+				return change, nil
+			}
+
 			if _, err := o.client.CreateGroup(ctx, name, path); err != nil {
-				return err
+				return nil, err
 			}
 		} else {
-			return err
+			return nil, err
 		}
 	}
 
 	attachedPolicies, err := o.client.ListAttachedGroupPolicies(ctx, name, path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// return if the policy is already attached to the group
@@ -268,24 +655,107 @@ func (o *iamOrchestrator) userCreateGroupIfMissing(ctx context.Context, name, pa
 			continue
 		}
 
-		return nil
+		if change.Action == "" {
+			return nil, nil
+		}
+		return change, nil
+	}
+
+	if change.Action == "" {
+		change.Action = userPolicyActionAttached
+	}
+
+	if dryRun {
+		return change, nil
 	}
 
 	if err := o.client.AttachGroupPolicy(ctx, name, policyArn); err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return change, nil
+}
+
+// reconcileUserPolicies reconciles the managed policies and groups of the repository and group-wide user roles
+func (o *iamOrchestrator) reconcileUserPolicies(ctx context.Context, dryRun bool) ([]*UserPolicyChange, error) {
+	log.Infof("reconciling user management policies and groups (dry run: %t)", dryRun)
+
+	_, changes, err := o.reconcileRoleGroups(ctx, userRolePolicyName, userRoleGroupName, userRolePolicies, dryRun)
+	if err != nil {
+		return changes, err
+	}
+
+	_, groupChanges, err := o.reconcileRoleGroups(ctx, groupUserRolePolicyName, groupUserRoleGroupName, groupUserRolePolicies, dryRun)
+	changes = append(changes, groupChanges...)
+	if err != nil {
+		return changes, err
+	}
+
+	return changes, nil
+}
+
+// repositoryUserGroups returns the role group and the requested groups with the org appended.  A requested
+// group can't grant a role other than the requested role, or a role for the other kind of user (repository
+// or group-wide).
+func (o *iamOrchestrator) repositoryUserGroups(name, roleGroup string, req *RepositoryUserCreateRequest) ([]string, error) {
+	groupName := userRoleGroupName
+	if name == "" {
+		groupName = groupUserRoleGroupName
+	}
+
+	groups := []string{}
+	if roleGroup != "" {
+		groups = append(groups, roleGroup)
+	}
+
+	for _, g := range req.Groups {
+		grp := fmt.Sprintf("%s-%s", g, o.org)
+		if grp == roleGroup {
+			continue
+		}
+
+		for _, role := range userRoles {
+			if grp != userRoleGroupName(o.org, role) && grp != groupUserRoleGroupName(o.org, role) {
+				continue
+			}
+
+			if req.Role != "" {
+				msg := fmt.Sprintf("group %s grants the %s role, it can't be combined with the %s role", g, role, req.Role)
+				return nil, apierror.New(apierror.ErrBadRequest, msg, nil)
+			}
+
+			if grp != groupName(o.org, role) {
+				msg := fmt.Sprintf("group %s is not a role group for this kind of user", g)
+				return nil, apierror.New(apierror.ErrBadRequest, msg, nil)
+			}
+		}
+
+		groups = append(groups, grp)
+	}
+
+	return groups, nil
 }
 
-func (o *iamOrchestrator) repositoryUserCreate(ctx context.Context, name, group, groupName string, req *RepositoryUserCreateRequest) (*RepositoryUserResponse, error) {
-	log.Infof("creating repository %s user %s in group %s in iam group %s", name, req.UserName, group, groupName)
+// repositoryUserCreate creates a repository user and adds them to the role group and any requested groups
+func (o *iamOrchestrator) repositoryUserCreate(ctx context.Context, name, group, roleGroup string, req *RepositoryUserCreateRequest) (*RepositoryUserResponse, error) {
+	log.Infof("creating repository %s user %s in group %s with role %s", name, req.UserName, group, req.Role)
+
+	groups, err := o.repositoryUserGroups(name, roleGroup, req)
+	if err != nil {
+		return nil, err
+	}
 
-	path := fmt.Sprintf("/spinup/%s/%s/%s/", o.org, group, name)
-	userName := fmt.Sprintf("%s-%s", name, req.UserName)
-	repository := fmt.Sprintf("%s/%s", group, name)
+	path := repositoryUserPath(o.org, group, name)
+	userName := repositoryUserIAMName(group, name, req.UserName)
+	repository := repositoryUserResource(group, name)
 
 	req.Tags = normalizeUserTags(o.org, group, repository, userName, req.Tags)
+	if req.ExpiresAt != nil {
+		req.Tags = append(req.Tags, &Tag{
+			Key:   userExpiresAtTag,
+			Value: req.ExpiresAt.UTC().Format(time.RFC3339),
+		})
+	}
 
 	user, err := o.client.CreateUser(ctx, userName, path, toIAMTags(req.Tags))
 	if err != nil {
@@ -296,24 +766,44 @@ func (o *iamOrchestrator) repositoryUserCreate(ctx context.Context, name, group,
 		return nil, err
 	}
 
-	// append the org to the passed group(s) and add user to the group
 	// TODO rollback on failure
-	for _, g := range req.Groups {
-		grp := fmt.Sprintf("%s-%s", g, o.org)
-
+	for _, grp := range groups {
 		if err := o.client.AddUserToGroup(ctx, userName, grp); err != nil {
 			return nil, err
 		}
 	}
 
-	return repositoryUserResponseFromIAM(o.org, user, nil, []string{groupName}), nil
+	return repositoryUserResponseFromIAM(o.org, user, nil, groups), nil
 }
 
 func (o *iamOrchestrator) repositoryUserUpdate(ctx context.Context, name, group, uname string, req *RepositoryUserUpdateRequest) (*RepositoryUserResponse, error) {
 	log.Infof("updating repository %s user %s in group %s", name, uname, group)
 
-	userName := fmt.Sprintf("%s-%s", name, uname)
-	repository := fmt.Sprintf("%s/%s", group, name)
+	if req.Status != "" {
+		switch strings.ToLower(req.Status) {
+		case "active":
+			req.Status = awsiam.StatusTypeActive
+		case "inactive":
+			req.Status = awsiam.StatusTypeInactive
+		default:
+			msg := fmt.Sprintf("invalid status '%s', must be one of Active or Inactive", req.Status)
+			return nil, apierror.New(apierror.ErrBadRequest, msg, nil)
+		}
+
+		if req.ResetKey {
+			return nil, apierror.New(apierror.ErrBadRequest, "the key can't be reset when setting the status", nil)
+		}
+	}
+
+	path := repositoryUserPath(o.org, group, name)
+	userName := repositoryUserIAMName(group, name, uname)
+	repository := repositoryUserResource(group, name)
+
+	// group-wide user names ({group}-{user}) can be the same as repository user names ({name}-{user}),
+	// so make sure the user is in the expected path before changing it
+	if _, err := o.client.GetUserWithPath(ctx, path, userName); err != nil {
+		return nil, err
+	}
 
 	response := &RepositoryUserResponse{
 		UserName: uname,
@@ -327,6 +817,25 @@ func (o *iamOrchestrator) repositoryUserUpdate(ctx context.Context, name, group,
 		response.Tags = req.Tags
 	}
 
+	if req.Status != "" {
+		keys, err := o.client.ListAccessKeys(ctx, userName)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, k := range keys {
+			if aws.StringValue(k.Status) == req.Status {
+				continue
+			}
+
+			if err := o.client.UpdateAccessKey(ctx, userName, aws.StringValue(k.AccessKeyId), req.Status); err != nil {
+				return response, err
+			}
+		}
+
+		response.Status = req.Status
+	}
+
 	if req.ResetKey {
 		// get a list of users access keys
 		keys, err := o.client.ListAccessKeys(ctx, userName)
@@ -0,0 +1,326 @@
+package api
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/ecr-api/iam"
+	"github.com/aws/aws-sdk-go/aws"
+	awsiam "github.com/aws/aws-sdk-go/service/iam"
+)
+
+func TestIamOrchestrator_prepareAccount(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeIAM()
+	orch := newIamOrchestrator(iam.IAM{Service: client}, "testOrg")
+
+	groups, err := orch.prepareAccount(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := map[string]string{
+		"admin": "SpinupECRAdminGroup-testOrg",
+		"pull":  "SpinupECRPullGroup-testOrg",
+		"push":  "SpinupECRPushGroup-testOrg",
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("expected groups %v, got %v", want, groups)
+	}
+
+	for role, group := range want {
+		policyArn := "arn:aws:iam::12345:policy/spinup/testOrg/" + userRolePolicyName("testOrg", role)
+		if attached := client.attached[group]; len(attached) != 1 || attached[0] != policyArn {
+			t.Errorf("expected %s policy attached to %s, got %v", policyArn, group, attached)
+		}
+	}
+
+	// preparing again is a no-op
+	if _, err := orch.prepareAccount(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for arn, versions := range client.versions {
+		if len(versions) != 1 {
+			t.Errorf("expected policy %s not to be updated, got %d versions", arn, len(versions))
+		}
+	}
+}
+
+func TestIamOrchestrator_repositoryUserCreate(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        *RepositoryUserCreateRequest
+		wantGroups []string
+		wantRole   string
+	}{
+		{
+			name:       "pull role",
+			req:        &RepositoryUserCreateRequest{UserName: "ci", Role: "pull"},
+			wantGroups: []string{"SpinupECRPullGroup"},
+			wantRole:   "pull",
+		},
+		{
+			name:       "push role with the same group requested",
+			req:        &RepositoryUserCreateRequest{UserName: "builder", Role: "push", Groups: []string{"SpinupECRPushGroup"}},
+			wantGroups: []string{"SpinupECRPushGroup"},
+			wantRole:   "push",
+		},
+		{
+			name:       "groups without a role",
+			req:        &RepositoryUserCreateRequest{UserName: "legacy", Groups: []string{"SpinupECRAdminGroup"}},
+			wantGroups: []string{"SpinupECRAdminGroup"},
+			wantRole:   "admin",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			client := newFakeIAM()
+			orch := newIamOrchestrator(iam.IAM{Service: client}, "testOrg")
+
+			roleGroups, err := orch.prepareAccount(ctx)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			out, err := orch.repositoryUserCreate(ctx, "rudolph", "spindev-00001", roleGroups[tt.req.Role], tt.req)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if !reflect.DeepEqual(out.Groups, tt.wantGroups) || out.Role != tt.wantRole {
+				t.Errorf("expected groups %v and role %s, got %v and %s", tt.wantGroups, tt.wantRole, out.Groups, out.Role)
+			}
+
+			user, err := orch.getRepositoryUser(ctx, "spindev-00001", "rudolph", tt.req.UserName)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if !reflect.DeepEqual(user.Groups, tt.wantGroups) || user.Role != tt.wantRole {
+				t.Errorf("expected user groups %v and role %s, got %v and %s", tt.wantGroups, tt.wantRole, user.Groups, user.Role)
+			}
+		})
+	}
+}
+
+func TestIamOrchestrator_repositoryUserCreateRoleGroups(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeIAM()
+	orch := newIamOrchestrator(iam.IAM{Service: client}, "testOrg")
+
+	roleGroups, err := orch.prepareAccount(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, req := range []*RepositoryUserCreateRequest{
+		// another role's group would escalate the role
+		{UserName: "ci", Role: "pull", Groups: []string{"SpinupECRAdminGroup"}},
+		{UserName: "ci", Role: "pull", Groups: []string{"SpinupECRSpacePushGroup"}},
+		// a group-wide role group would grant a repository user access to every repository in the group
+		{UserName: "ci", Groups: []string{"SpinupECRSpaceAdminGroup"}},
+	} {
+		if _, err := orch.repositoryUserCreate(ctx, "rudolph", "spindev-00001", roleGroups[req.Role], req); err == nil {
+			t.Errorf("expected error creating user with role '%s' and groups %v, got nil", req.Role, req.Groups)
+		}
+	}
+
+	if _, err := orch.getRepositoryUser(ctx, "spindev-00001", "rudolph", "ci"); err == nil {
+		t.Error("expected the user not to be created")
+	}
+
+	if _, err := client.CreateGroupWithContext(ctx, &awsiam.CreateGroupInput{GroupName: aws.String("SpinupDevelopers-testOrg")}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	out, err := orch.repositoryUserCreate(ctx, "rudolph", "spindev-00001", roleGroups["pull"], &RepositoryUserCreateRequest{UserName: "ci", Role: "pull", Groups: []string{"SpinupDevelopers"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(out.Groups, []string{"SpinupECRPullGroup", "SpinupDevelopers"}) || out.Role != "pull" {
+		t.Errorf("expected the pull role and other groups, got %v and %s", out.Groups, out.Role)
+	}
+}
+
+func TestIamOrchestrator_repositoryUserUpdateStatus(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeIAM()
+	orch := newIamOrchestrator(iam.IAM{Service: client}, "testOrg")
+
+	roleGroups, err := orch.prepareAccount(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := orch.repositoryUserCreate(ctx, "rudolph", "spindev-00001", roleGroups["push"], &RepositoryUserCreateRequest{UserName: "ci", Role: "push"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := orch.repositoryUserUpdate(ctx, "rudolph", "spindev-00001", "ci", &RepositoryUserUpdateRequest{ResetKey: true}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	user, err := orch.getRepositoryUser(ctx, "spindev-00001", "rudolph", "ci")
+	if err != nil || user.Status != "Active" {
+		t.Fatalf("expected active user, got %+v (%v)", user, err)
+	}
+
+	if _, err := orch.repositoryUserUpdate(ctx, "rudolph", "spindev-00001", "ci", &RepositoryUserUpdateRequest{Status: "disabled"}); err == nil {
+		t.Error("expected error for invalid status")
+	}
+
+	if _, err := orch.repositoryUserUpdate(ctx, "rudolph", "spindev-00001", "ci", &RepositoryUserUpdateRequest{Status: "Inactive", ResetKey: true}); err == nil {
+		t.Error("expected error resetting the key while setting the status")
+	}
+
+	for _, status := range []string{"inactive", "active"} {
+		out, err := orch.repositoryUserUpdate(ctx, "rudolph", "spindev-00001", "ci", &RepositoryUserUpdateRequest{Status: status})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		user, err := orch.getRepositoryUser(ctx, "spindev-00001", "rudolph", "ci")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if user.Status != out.Status || len(user.AccessKeys) != 1 || *user.AccessKeys[0].Status != out.Status {
+			t.Errorf("expected user and keys to be %s, got %+v", out.Status, user)
+		}
+
+		if !reflect.DeepEqual(user.Groups, []string{"SpinupECRPushGroup"}) {
+			t.Errorf("expected group membership to be preserved, got %v", user.Groups)
+		}
+	}
+}
+
+func TestIamOrchestrator_groupUsers(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeIAM()
+	orch := newIamOrchestrator(iam.IAM{Service: client}, "testOrg")
+
+	repoGroups, err := orch.prepareAccount(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	groups, err := orch.prepareAccountForGroupUsers(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := map[string]string{
+		"admin": "SpinupECRSpaceAdminGroup-testOrg",
+		"pull":  "SpinupECRSpacePullGroup-testOrg",
+		"push":  "SpinupECRSpacePushGroup-testOrg",
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("expected groups %v, got %v", want, groups)
+	}
+
+	if _, err := orch.repositoryUserCreate(ctx, "rudolph", "spindev-00001", repoGroups["pull"], &RepositoryUserCreateRequest{UserName: "deploy", Role: "pull"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	out, err := orch.repositoryUserCreate(ctx, "", "spindev-00001", groups["push"], &RepositoryUserCreateRequest{UserName: "ci", Role: "push"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if out.UserName != "ci" || out.Role != "push" {
+		t.Errorf("unexpected group-wide user %+v", out)
+	}
+
+	u, ok := client.users["spindev-00001-ci"]
+	if !ok || aws.StringValue(u.Path) != "/spinup/testOrg/spindev-00001/" {
+		t.Fatalf("expected group-wide user in the group path, got %+v", u)
+	}
+
+	users, err := orch.listRepositoryUsers(ctx, "spindev-00001", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(users, []string{"ci"}) {
+		t.Errorf("expected only the group-wide users, got %v", users)
+	}
+
+	users, err = orch.listRepositoryUsers(ctx, "spindev-00001", "rudolph")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(users, []string{"deploy"}) {
+		t.Errorf("expected only the repository users, got %v", users)
+	}
+
+	if repository, userName := repositoryUserFromIAM("testOrg", u); repository != "spindev-00001" || userName != "ci" {
+		t.Errorf("expected group-wide user spindev-00001 ci, got %s %s", repository, userName)
+	}
+
+	if err := orch.repositoryUserDelete(ctx, "", "spindev-00001", "ci"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, ok := client.users["spindev-00001-ci"]; ok {
+		t.Error("expected group-wide user to be deleted")
+	}
+
+	// the user of the spindev-00009/spindev-00001 repository has the name of the spindev-00001 group-wide user
+	if _, err := orch.repositoryUserCreate(ctx, "spindev-00001", "spindev-00009", repoGroups["pull"], &RepositoryUserCreateRequest{UserName: "ci", Role: "pull"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_, err = orch.repositoryUserUpdate(ctx, "", "spindev-00001", "ci", &RepositoryUserUpdateRequest{Status: "inactive"})
+	if aerr, ok := err.(apierror.Error); !ok || aerr.Code != apierror.ErrNotFound {
+		t.Errorf("expected not found updating the group-wide user, got %v", err)
+	}
+
+	user, err := orch.getRepositoryUser(ctx, "spindev-00009", "spindev-00001", "ci")
+	if err != nil || user.Status != "Active" {
+		t.Errorf("expected the repository user to be left active, got %+v (%v)", user, err)
+	}
+}
+
+func Test_groupUserPolicy(t *testing.T) {
+	for role, doc := range groupUserRolePolicies {
+		if len(doc.Statement) != len(userRolePolicies[role].Statement) {
+			t.Fatalf("expected %s policy to have the same statements as the repository user policy", role)
+		}
+
+		if !reflect.DeepEqual(doc.Statement[0].Condition, ecrGroupUserCondition) {
+			t.Errorf("expected %s policy to be limited to the space, got %+v", role, doc.Statement[0].Condition)
+		}
+
+		if _, ok := doc.Statement[0].Condition["StringEqualsIgnoreCase"]["aws:ResourceTag/Name"]; ok {
+			t.Errorf("expected %s policy not to be limited to a repository", role)
+		}
+
+		if !reflect.DeepEqual(userRolePolicies[role].Statement[0].Condition, ecrRepositoryUserCondition) {
+			t.Errorf("expected %s repository user policy to be unchanged", role)
+		}
+	}
+}
+
+func Test_repositoryUserScope(t *testing.T) {
+	tests := []struct {
+		repository string
+		wantGroup  string
+		wantName   string
+	}{
+		{repository: "spindev-00001/rudolph", wantGroup: "spindev-00001", wantName: "rudolph"},
+		{repository: "spindev-00001", wantGroup: "spindev-00001"},
+	}
+	for _, tt := range tests {
+		group, name := repositoryUserScope(tt.repository)
+		if group != tt.wantGroup || name != tt.wantName {
+			t.Errorf("repositoryUserScope(%s) = %s, %s, want %s, %s", tt.repository, group, name, tt.wantGroup, tt.wantName)
+		}
+	}
+}
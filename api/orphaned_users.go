@@ -0,0 +1,271 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/ecr-api/common"
+	"github.com/aws/aws-sdk-go/aws"
+	awsiam "github.com/aws/aws-sdk-go/service/iam"
+	log "github.com/sirupsen/logrus"
+)
+
+// orphanedUserSweep is the background job configuration for finding orphaned users
+type orphanedUserSweep struct {
+	interval time.Duration
+	accounts []string
+	delete   bool
+}
+
+// newOrphanedUserSweep validates the orphaned user configuration, it returns nil if the job is disabled
+func newOrphanedUserSweep(config common.OrphanedUsers) (*orphanedUserSweep, error) {
+	if len(config.Accounts) == 0 {
+		return nil, nil
+	}
+
+	o := &orphanedUserSweep{
+		interval: 24 * time.Hour,
+		accounts: config.Accounts,
+		delete:   config.Delete,
+	}
+
+	if config.Interval != "" {
+		interval, err := time.ParseDuration(config.Interval)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid orphaned users interval '%s'", config.Interval)
+		}
+		o.interval = interval
+	}
+
+	return o, nil
+}
+
+// orphanedUsers finds the repository users in the org whose repository isn't in the list of repositories.
+// Group-wide users aren't tied to a repository, so they're never orphaned.  Other users can be created under
+// the org path, so a user is only a repository user if it's tagged with the repository or is in one of the
+// repository role groups.
+func (o *iamOrchestrator) orphanedUsers(ctx context.Context, repositories []string) ([]*OrphanedUser, error) {
+	path := fmt.Sprintf("/spinup/%s/", o.org)
+
+	users, err := o.client.ListUsersWithPath(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	exists := make(map[string]bool, len(repositories))
+	for _, r := range repositories {
+		exists[r] = true
+	}
+
+	orphaned := []*OrphanedUser{}
+	for _, u := range users {
+		repository, userName := repositoryUserFromIAM(o.org, u)
+
+		group, name := repositoryUserScope(repository)
+		if group == "" || name == "" || exists[repository] {
+			continue
+		}
+
+		ok, err := o.isRepositoryUser(ctx, u, repository)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			log.Debugf("user %s in path %s isn't a repository user", aws.StringValue(u.UserName), aws.StringValue(u.Path))
+			continue
+		}
+
+		orphaned = append(orphaned, &OrphanedUser{
+			UserName:    userName,
+			Repository:  repository,
+			IAMUserName: aws.StringValue(u.UserName),
+			CreatedAt:   aws.TimeValue(u.CreateDate),
+		})
+	}
+
+	return orphaned, nil
+}
+
+// isRepositoryUser checks if the iam user is a user of the repository, either by the ResourceName tag or by
+// being in one of the repository role groups, or the group-wide role groups when the repository is a group.  Listing users doesn't return their tags, so the user is fetched.
+func (o *iamOrchestrator) isRepositoryUser(ctx context.Context, u *awsiam.User, repository string) (bool, error) {
+	userName := aws.StringValue(u.UserName)
+
+	user, err := o.client.GetUserWithPath(ctx, aws.StringValue(u.Path), userName)
+	if err != nil {
+		// the user was deleted since it was listed
+		if aerr, ok := err.(apierror.Error); ok && aerr.Code == apierror.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+
+	for _, t := range user.Tags {
+		if aws.StringValue(t.Key) == "ResourceName" {
+			return aws.StringValue(t.Value) == repository, nil
+		}
+	}
+
+	groups, err := o.client.ListGroupsForUser(ctx, userName)
+	if err != nil {
+		return false, err
+	}
+
+	roleGroupName := userRoleGroupName
+	if _, name := repositoryUserScope(repository); name == "" {
+		roleGroupName = groupUserRoleGroupName
+	}
+
+	for _, role := range userRoles {
+		for _, g := range groups {
+			if g == roleGroupName(o.org, role) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// deleteOrphanedUsers deletes the orphaned users, the errors are reported with each user
+func (o *iamOrchestrator) deleteOrphanedUsers(ctx context.Context, users []*OrphanedUser) {
+	for _, u := range users {
+		group, name := repositoryUserScope(u.Repository)
+
+		log.Infof("deleting user %s of missing repository %s", u.UserName, u.Repository)
+
+		if err := o.repositoryUserDelete(ctx, name, group, u.UserName); err != nil {
+			u.Error = err.Error()
+			continue
+		}
+
+		u.Deleted = true
+	}
+}
+
+// orphanedUsersJobSession returns the job session to find orphaned users in the account, and delete them unless
+// it's a dry run
+func (s *server) orphanedUsersJobSession(account string, dryRun bool) (*jobSession, error) {
+	// dry runs only need to read, IAM doesn't support resource tags, so we can't pass the s.orgPolicy here
+	if dryRun {
+		return s.newJobSession(
+			account,
+			"",
+			"arn:aws:iam::aws:policy/IAMReadOnlyAccess",
+			"arn:aws:iam::aws:policy/AmazonEC2ContainerRegistryReadOnly",
+		), nil
+	}
+
+	policy, err := s.orphanedUserDeletePolicy()
+	if err != nil {
+		return nil, apierror.New(apierror.ErrInternalError, "failed to generate policy", err)
+	}
+
+	return s.newJobSession(account, policy), nil
+}
+
+// startOrphanedUsersSweep starts finding the orphaned users in the account in the background, and deleting them
+// unless it's a dry run
+func (s *server) startOrphanedUsersSweep(ctx context.Context, account string, dryRun bool) (*Report, error) {
+	job, err := s.orphanedUsersJobSession(account, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.startReport(ctx, job, reportOrphanedUsers, func(ctx context.Context) (interface{}, error) {
+		return s.sweepOrphanedUsers(ctx, job.orchestrators, account, dryRun)
+	})
+}
+
+// sweepOrphanedUsers finds the repository users whose repository no longer exists in the account and deletes them
+// unless it's a dry run
+func (s *server) sweepOrphanedUsers(ctx context.Context, orchestrators orchestratorsFunc, account string, dryRun bool) (*OrphanedUsersReport, error) {
+	report := &OrphanedUsersReport{
+		Account:   account,
+		DryRun:    dryRun,
+		StartedAt: time.Now().UTC(),
+	}
+
+	ecrOrch, iamOrch, err := orchestrators(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	repositories, err := ecrOrch.client.ListRepositories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := iamOrch.orphanedUsers(ctx, repositories)
+	if err != nil {
+		return nil, err
+	}
+
+	if !dryRun {
+		// finding the orphaned users can take a while, so the session may have been assumed again
+		if _, iamOrch, err = orchestrators(ctx); err != nil {
+			return nil, err
+		}
+
+		iamOrch.deleteOrphanedUsers(ctx, users)
+		s.notifyOrphanedUsersDeleted(ctx, account, users)
+	}
+
+	report.Users = users
+	report.CompletedAt = time.Now().UTC()
+
+	return report, nil
+}
+
+// notifyOrphanedUsersDeleted sends a user deleted notification for each deleted orphaned user
+func (s *server) notifyOrphanedUsersDeleted(ctx context.Context, account string, users []*OrphanedUser) {
+	for _, u := range users {
+		if !u.Deleted {
+			continue
+		}
+
+		group, _ := repositoryUserScope(u.Repository)
+		s.notify(ctx, notificationUserDeleted, account, group, &UserNotification{
+			Repository: u.Repository,
+			UserName:   u.UserName,
+		})
+	}
+}
+
+// orphanedUserJob periodically finds, and optionally deletes, the orphaned users in the configured accounts
+// until the context is cancelled
+func (s *server) orphanedUserJob(ctx context.Context) {
+	log.Infof("checking for orphaned users every %s in %d accounts (delete: %t)", s.orphanedUsers.interval, len(s.orphanedUsers.accounts), s.orphanedUsers.delete)
+
+	ticker := time.NewTicker(s.orphanedUsers.interval)
+	defer ticker.Stop()
+
+	for {
+		for _, account := range s.orphanedUsers.accounts {
+			job, err := s.orphanedUsersJobSession(account, !s.orphanedUsers.delete)
+			if err != nil {
+				log.Errorf("failed to check for orphaned users in account %s: %s", account, err)
+				continue
+			}
+
+			report, err := s.sweepOrphanedUsers(ctx, job.orchestrators, account, !s.orphanedUsers.delete)
+			if err != nil {
+				log.Errorf("failed to check for orphaned users in account %s: %s", account, err)
+				continue
+			}
+
+			for _, u := range report.Users {
+				log.Warnf("user %s of missing repository %s in account %s is orphaned (deleted: %t)", u.UserName, u.Repository, account, u.Deleted)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
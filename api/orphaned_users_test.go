@@ -0,0 +1,194 @@
+package api
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ecr-api/common"
+	"github.com/YaleSpinup/ecr-api/iam"
+	"github.com/aws/aws-sdk-go/aws"
+	awsiam "github.com/aws/aws-sdk-go/service/iam"
+)
+
+func TestNewOrphanedUserSweep(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       common.OrphanedUsers
+		wantNil      bool
+		wantErr      bool
+		wantInterval time.Duration
+	}{
+		{
+			name:    "disabled",
+			config:  common.OrphanedUsers{Delete: true},
+			wantNil: true,
+		},
+		{
+			name:         "default interval",
+			config:       common.OrphanedUsers{Accounts: []string{"12345"}},
+			wantInterval: 24 * time.Hour,
+		},
+		{
+			name:    "invalid interval",
+			config:  common.OrphanedUsers{Interval: "-1h", Accounts: []string{"12345"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newOrphanedUserSweep(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newOrphanedUserSweep() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if (got == nil) != tt.wantNil {
+				t.Fatalf("newOrphanedUserSweep() = %+v, wantNil %t", got, tt.wantNil)
+			}
+
+			if got != nil && got.interval != tt.wantInterval {
+				t.Errorf("expected interval %s, got %s", tt.wantInterval, got.interval)
+			}
+		})
+	}
+}
+
+func TestIamOrchestrator_orphanedUsers(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeIAM()
+	orch := newIamOrchestrator(iam.IAM{Service: client}, "testOrg")
+
+	repoGroups, err := orch.prepareAccount(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	groupGroups, err := orch.prepareAccountForGroupUsers(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, repo := range []string{"rudolph", "dasher"} {
+		if _, err := orch.repositoryUserCreate(ctx, repo, "spindev-00001", repoGroups["pull"], &RepositoryUserCreateRequest{UserName: "ci", Role: "pull"}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	if _, err := orch.repositoryUserCreate(ctx, "", "spindev-00001", groupGroups["pull"], &RepositoryUserCreateRequest{UserName: "team", Role: "pull"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// users in the org path that aren't repository users, one untagged and one tagged with another resource
+	for name, tags := range map[string][]*awsiam.Tag{
+		"deploy-bot": nil,
+		"vixen-bot":  {{Key: aws.String("ResourceName"), Value: aws.String("spindev-00001/comet")}},
+	} {
+		if _, err := client.CreateUserWithContext(ctx, &awsiam.CreateUserInput{
+			Path:     aws.String("/spinup/testOrg/spindev-00001/" + strings.TrimSuffix(name, "-bot") + "/"),
+			UserName: aws.String(name),
+			Tags:     tags,
+		}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	// an untagged user in a repository role group is a repository user
+	if _, err := client.CreateUserWithContext(ctx, &awsiam.CreateUserInput{
+		Path:     aws.String("/spinup/testOrg/spindev-00003/cupid/"),
+		UserName: aws.String("cupid-legacy"),
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := client.AddUserToGroupWithContext(ctx, &awsiam.AddUserToGroupInput{
+		GroupName: aws.String(repoGroups["pull"]),
+		UserName:  aws.String("cupid-legacy"),
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	users, err := orch.orphanedUsers(ctx, []string{"spindev-00001/rudolph", "spindev-00002/comet"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(users) != 2 {
+		t.Fatalf("expected 2 orphaned users, got %d", len(users))
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].Repository < users[j].Repository })
+
+	if u := users[1]; u.UserName != "legacy" || u.Repository != "spindev-00003/cupid" {
+		t.Errorf("unexpected orphaned user %+v", u)
+	}
+	users = users[:1]
+
+	u := users[0]
+	if u.UserName != "ci" || u.Repository != "spindev-00001/dasher" || u.IAMUserName != "dasher-ci" {
+		t.Errorf("unexpected orphaned user %+v", u)
+	}
+
+	orch.deleteOrphanedUsers(ctx, users)
+	if !u.Deleted || u.Error != "" {
+		t.Errorf("expected orphaned user to be deleted, got %+v", u)
+	}
+
+	for name, want := range map[string]bool{"dasher-ci": false, "rudolph-ci": true, "spindev-00001-team": true} {
+		if _, ok := client.users[name]; ok != want {
+			t.Errorf("expected user %s to exist %t, got %t", name, want, ok)
+		}
+	}
+
+	// deleting a user that's already gone is reported
+	u.Deleted = false
+	orch.deleteOrphanedUsers(ctx, users)
+	if u.Deleted || u.Error == "" {
+		t.Errorf("expected an error deleting a missing user, got %+v", u)
+	}
+}
+
+func TestIamOrchestrator_isRepositoryUser(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeIAM()
+	orch := newIamOrchestrator(iam.IAM{Service: client}, "testOrg")
+
+	groupGroups, err := orch.prepareAccountForGroupUsers(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, name := range []string{"spindev-00001-legacy", "spindev-00001-bot"} {
+		if _, err := client.CreateUserWithContext(ctx, &awsiam.CreateUserInput{
+			Path:     aws.String("/spinup/testOrg/spindev-00001/"),
+			UserName: aws.String(name),
+		}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	// an untagged user in a group-wide role group is a user of the group
+	if _, err := client.AddUserToGroupWithContext(ctx, &awsiam.AddUserToGroupInput{
+		GroupName: aws.String(groupGroups["pull"]),
+		UserName:  aws.String("spindev-00001-legacy"),
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for name, want := range map[string]bool{"spindev-00001-legacy": true, "spindev-00001-bot": false} {
+		got, err := orch.isRepositoryUser(ctx, client.users[name], "spindev-00001")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if got != want {
+			t.Errorf("expected isRepositoryUser() for %s to be %t, got %t", name, want, got)
+		}
+	}
+}
@@ -3,7 +3,10 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"regexp"
+	"strings"
 
+	"github.com/YaleSpinup/apierror"
 	"github.com/YaleSpinup/ecr-api/iam"
 	log "github.com/sirupsen/logrus"
 )
@@ -58,6 +61,8 @@ func (s *server) repositoryUserCreatePolicy() (string, error) {
 					"iam:GetGroup",
 					"iam:CreateGroup",
 					"iam:TagUser",
+					"iam:ListPolicyVersions",
+					"iam:DeletePolicyVersion",
 				},
 				Resource: []string{
 					"arn:aws:iam::*:group/*",
@@ -73,6 +78,7 @@ func (s *server) repositoryUserCreatePolicy() (string, error) {
 				},
 				Resource: []string{"*"},
 			},
+			repositoryPendingDeletionStatement(),
 		},
 	}
 
@@ -100,11 +106,54 @@ func (s *server) repositoryDeletePolicy(org string) (string, error) {
 					"iam:GetUser",
 					"iam:ListUsers",
 				},
-				Resource: []string{
+				Resource: append([]string{
 					fmt.Sprintf("arn:aws:iam::*:user/spinup/%s/*", s.org),
-					fmt.Sprintf("arn:aws:iam::*:group/spinup/%s/SpinupECRAdminGroup-%s", s.org, s.org),
+				}, userRoleGroupArns(s.org)...),
+			},
+			{
+				Effect:   "Allow",
+				Action:   []string{"*"},
+				Resource: []string{"*"},
+				Condition: iam.Condition{
+					"StringEquals": iam.ConditionStatement{
+						"aws:ResourceTag/spinup:org": []string{org},
+					},
 				},
 			},
+		},
+	}
+
+	j, err := json.Marshal(policy)
+	if err != nil {
+		return "", err
+	}
+
+	return string(j), nil
+}
+
+// repositorySoftDeletePolicy is the inline policy to soft delete, restore and purge repositories.  It
+// allows disabling and enabling the access keys of the repository users as well as deleting them.
+func (s *server) repositorySoftDeletePolicy(org string) (string, error) {
+	policy := &iam.PolicyDocument{
+		Version: "2012-10-17",
+		Statement: []iam.StatementEntry{
+			{
+				Sid:    "ManageRepositoryUser",
+				Effect: "Allow",
+				Action: []string{
+					"iam:UpdateAccessKey",
+					"iam:DeleteAccessKey",
+					"iam:RemoveUserFromGroup",
+					"iam:ListAccessKeys",
+					"iam:ListGroupsForUser",
+					"iam:DeleteUser",
+					"iam:GetUser",
+					"iam:ListUsers",
+				},
+				Resource: append([]string{
+					fmt.Sprintf("arn:aws:iam::*:user/spinup/%s/*", s.org),
+				}, userRoleGroupArns(s.org)...),
+			},
 			{
 				Effect:   "Allow",
 				Action:   []string{"*"},
@@ -126,6 +175,36 @@ func (s *server) repositoryDeletePolicy(org string) (string, error) {
 	return string(j), nil
 }
 
+// repositoryMovePolicy is the inline policy to move repositories between groups.  It allows renaming and
+// tagging the repository users, the repositories are managed with the ECR managed policy.
+func (s *server) repositoryMovePolicy() (string, error) {
+	policy := &iam.PolicyDocument{
+		Version: "2012-10-17",
+		Statement: []iam.StatementEntry{
+			{
+				Sid:    "MoveRepositoryUser",
+				Effect: "Allow",
+				Action: []string{
+					"iam:UpdateUser",
+					"iam:TagUser",
+					"iam:GetUser",
+					"iam:ListUsers",
+				},
+				Resource: []string{
+					fmt.Sprintf("arn:aws:iam::*:user/spinup/%s/*", s.org),
+				},
+			},
+		},
+	}
+
+	j, err := json.Marshal(policy)
+	if err != nil {
+		return "", err
+	}
+
+	return string(j), nil
+}
+
 func (s *server) repositoryUserDeletePolicy() (string, error) {
 	policy := &iam.PolicyDocument{
 		Version: "2012-10-17",
@@ -141,10 +220,9 @@ func (s *server) repositoryUserDeletePolicy() (string, error) {
 					"iam:DeleteUser",
 					"iam:GetUser",
 				},
-				Resource: []string{
+				Resource: append([]string{
 					fmt.Sprintf("arn:aws:iam::*:user/spinup/%s/*", s.org),
-					fmt.Sprintf("arn:aws:iam::*:group/spinup/%s/SpinupECRAdminGroup-%s", s.org, s.org),
-				},
+				}, userRoleGroupArns(s.org)...),
 			},
 		},
 	}
@@ -157,6 +235,19 @@ func (s *server) repositoryUserDeletePolicy() (string, error) {
 	return string(j), nil
 }
 
+// repositoryPendingDeletionStatement allows checking if a repository is soft deleted before managing its users
+func repositoryPendingDeletionStatement() iam.StatementEntry {
+	return iam.StatementEntry{
+		Sid:    "CheckRepositoryPendingDeletion",
+		Effect: "Allow",
+		Action: []string{
+			"ecr:DescribeRepositories",
+			"ecr:ListTagsForResource",
+		},
+		Resource: []string{"*"},
+	}
+}
+
 func (s *server) repositoryUserUpdatePolicy() (string, error) {
 	policy := &iam.PolicyDocument{
 		Version: "2012-10-17",
@@ -165,16 +256,101 @@ func (s *server) repositoryUserUpdatePolicy() (string, error) {
 				Sid:    "UpdateRepositoryUser",
 				Effect: "Allow",
 				Action: []string{
+					"iam:GetUser",
 					"iam:UntagUser",
 					"iam:DeleteAccessKey",
 					"iam:RemoveUserFromGroup",
 					"iam:TagUser",
 					"iam:CreateAccessKey",
 					"iam:ListAccessKeys",
+					"iam:UpdateAccessKey",
 				},
-				Resource: []string{
+				Resource: append([]string{
 					fmt.Sprintf("arn:aws:iam::*:user/spinup/%s/*", s.org),
-					fmt.Sprintf("arn:aws:iam::*:group/spinup/%s/SpinupECRAdminGroup-%s", s.org, s.org),
+				}, userRoleGroupArns(s.org)...),
+			},
+			repositoryPendingDeletionStatement(),
+		},
+	}
+
+	j, err := json.Marshal(policy)
+	if err != nil {
+		return "", err
+	}
+
+	return string(j), nil
+}
+
+// registryScanningPolicy returns the policy for managing the registry scanning configuration.  Enhanced
+// scanning is provided by Amazon Inspector which is enabled (along with its service linked role) when
+// the scan type is set to ENHANCED.
+func registryScanningPolicy() (string, error) {
+	policy := &iam.PolicyDocument{
+		Version: "2012-10-17",
+		Statement: []iam.StatementEntry{
+			{
+				Sid:    "ManageRegistryScanningConfiguration",
+				Effect: "Allow",
+				Action: []string{
+					"ecr:GetRegistryScanningConfiguration",
+					"ecr:PutRegistryScanningConfiguration",
+					"inspector2:Enable",
+					"inspector2:Disable",
+					"inspector2:BatchGetAccountStatus",
+					"inspector2:ListAccountPermissions",
+				},
+				Resource: []string{"*"},
+			},
+			{
+				Sid:    "CreateInspectorServiceLinkedRole",
+				Effect: "Allow",
+				Action: []string{
+					"iam:CreateServiceLinkedRole",
+				},
+				Resource: []string{"*"},
+				Condition: iam.Condition{
+					"StringEquals": iam.ConditionStatement{
+						"iam:AWSServiceName": []string{"inspector2.amazonaws.com"},
+					},
+				},
+			},
+		},
+	}
+
+	j, err := json.Marshal(policy)
+	if err != nil {
+		return "", err
+	}
+
+	return string(j), nil
+}
+
+// registryReplicationPolicy returns the policy for managing the registry replication configuration.  ECR creates
+// its replication service linked role the first time replication is configured.
+func registryReplicationPolicy() (string, error) {
+	policy := &iam.PolicyDocument{
+		Version: "2012-10-17",
+		Statement: []iam.StatementEntry{
+			{
+				Sid:    "ManageRegistryReplicationConfiguration",
+				Effect: "Allow",
+				Action: []string{
+					"ecr:DescribeRegistry",
+					"ecr:PutReplicationConfiguration",
+				},
+				Resource: []string{"*"},
+			},
+			{
+				Sid:    "CreateReplicationServiceLinkedRole",
+				Effect: "Allow",
+				Action: []string{
+					"iam:CreateServiceLinkedRole",
+				},
+				Resource: []string{"*"},
+				Condition: iam.Condition{
+					"StringEquals": iam.ConditionStatement{
+						"iam:AWSServiceName": []string{"replication.ecr.amazonaws.com"},
+					},
 				},
 			},
 		},
@@ -188,18 +364,201 @@ func (s *server) repositoryUserUpdatePolicy() (string, error) {
 	return string(j), nil
 }
 
-// repositoryPolicy accepts a list of groups and returns the policy to allow ecr access
-// for resources in the same org/group as well as any passed groups
-func repositoryPolicy(groups []string) (string, error) {
-	groupConditions := append([]string{"${aws:ResourceTag/spinup:spaceid}"}, groups...)
+// registryDescribePolicy returns the policy for reading the registry replication configuration
+func registryDescribePolicy() (string, error) {
+	policy := &iam.PolicyDocument{
+		Version: "2012-10-17",
+		Statement: []iam.StatementEntry{
+			{
+				Sid:    "DescribeRegistry",
+				Effect: "Allow",
+				Action: []string{
+					"ecr:DescribeRegistry",
+				},
+				Resource: []string{"*"},
+			},
+		},
+	}
+
+	j, err := json.Marshal(policy)
+	if err != nil {
+		return "", err
+	}
+
+	return string(j), nil
+}
+
+// registryScanningReadPolicy returns the policy for reading the registry scanning configuration
+func registryScanningReadPolicy() (string, error) {
+	policy := &iam.PolicyDocument{
+		Version: "2012-10-17",
+		Statement: []iam.StatementEntry{
+			{
+				Sid:    "ReadRegistryScanningConfiguration",
+				Effect: "Allow",
+				Action: []string{
+					"ecr:GetRegistryScanningConfiguration",
+				},
+				Resource: []string{"*"},
+			},
+		},
+	}
+
+	j, err := json.Marshal(policy)
+	if err != nil {
+		return "", err
+	}
 
-	log.Debugf("generating policy text from groups %+v", groups)
+	return string(j), nil
+}
 
+// repositoryDetailsPolicy is the org tag conditional policy, which also allows reading the registry replication
+// configuration for the replication status of the repository
+func repositoryDetailsPolicy(org string) (string, error) {
 	policy := iam.PolicyDocument{
 		Version: "2012-10-17",
 		Statement: []iam.StatementEntry{
 			{
-				Sid:    "AllowPullImagesFromSpaceAndOrg",
+				Effect:   "Allow",
+				Action:   []string{"*"},
+				Resource: []string{"*"},
+				Condition: iam.Condition{
+					"StringEquals": iam.ConditionStatement{
+						"aws:ResourceTag/spinup:org": []string{org},
+					},
+				},
+			},
+			{
+				Sid:    "DescribeRegistry",
+				Effect: "Allow",
+				Action: []string{
+					"ecr:DescribeRegistry",
+				},
+				Resource: []string{"*"},
+			},
+		},
+	}
+
+	j, err := json.Marshal(policy)
+	if err != nil {
+		return "", err
+	}
+
+	return string(j), nil
+}
+
+// repositoryPolicySid is the Sid of the repository policy statement allowing pulls from the space and groups
+const repositoryPolicySid = "AllowPullImagesFromSpaceAndOrg"
+
+// repositoryPrincipalsPolicySid is the Sid of the repository policy statement allowing pulls from other accounts
+const repositoryPrincipalsPolicySid = "AllowPullImagesFromPrincipals"
+
+// repositoryServicePolicySidPrefix is the prefix of the Sid of the repository policy statements allowing pulls
+// from a service, followed by the service name
+const repositoryServicePolicySidPrefix = "AllowPullImagesFromService"
+
+// repositoryServicePrincipals are the service principals by the services that can be allowed to pull images
+var repositoryServicePrincipals = map[string]string{
+	"codebuild": "codebuild.amazonaws.com",
+	"lambda":    "lambda.amazonaws.com",
+}
+
+// repositoryAccess is the pull access to a repository granted by the repository policy, besides its own space
+type repositoryAccess struct {
+	// groups are the other spaces in the org
+	groups []string
+	// principals are the account ids or principal ARNs in other accounts
+	principals []string
+	// services are the services pulling images on behalf of resources, like lambda functions
+	services []*RepositoryServiceAccess
+	// statements are the statements of the policy not managed by the api, for example added by the
+	// security team, they are kept as is when the policy is generated
+	statements []iam.StatementEntry
+	// policy is the full policy document the access was read from, nil if the repository has no policy
+	policy *iam.PolicyDocument
+}
+
+// validate validates the principals and services of the repository access
+func (a *repositoryAccess) validate() error {
+	for _, p := range a.principals {
+		if !accountIdPattern.MatchString(p) && !principalArnPattern.MatchString(p) {
+			msg := fmt.Sprintf("invalid principal '%s', must be an account id or a principal ARN", p)
+			return apierror.New(apierror.ErrBadRequest, msg, nil)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, svc := range a.services {
+		if _, ok := repositoryServicePrincipals[svc.Service]; !ok {
+			msg := fmt.Sprintf("invalid service '%s', must be one of codebuild or lambda", svc.Service)
+			return apierror.New(apierror.ErrBadRequest, msg, nil)
+		}
+
+		if seen[svc.Service] {
+			msg := fmt.Sprintf("service '%s' is allowed more than once", svc.Service)
+			return apierror.New(apierror.ErrBadRequest, msg, nil)
+		}
+		seen[svc.Service] = true
+
+		// without a source, any account's resources could pull through the service
+		if len(svc.SourceAccounts) == 0 && len(svc.SourceArns) == 0 {
+			msg := fmt.Sprintf("service '%s' must be limited to source accounts or ARNs", svc.Service)
+			return apierror.New(apierror.ErrBadRequest, msg, nil)
+		}
+
+		for _, account := range svc.SourceAccounts {
+			if !accountIdPattern.MatchString(account) {
+				msg := fmt.Sprintf("invalid source account '%s' for service '%s'", account, svc.Service)
+				return apierror.New(apierror.ErrBadRequest, msg, nil)
+			}
+		}
+
+		for _, arn := range svc.SourceArns {
+			if !strings.HasPrefix(arn, "arn:") {
+				msg := fmt.Sprintf("invalid source ARN '%s' for service '%s'", arn, svc.Service)
+				return apierror.New(apierror.ErrBadRequest, msg, nil)
+			}
+		}
+	}
+
+	return nil
+}
+
+// repositoryServicePolicySid returns the Sid of the repository policy statement allowing pulls from the service
+func repositoryServicePolicySid(service string) string {
+	return repositoryServicePolicySidPrefix + strings.ToUpper(service[:1]) + service[1:]
+}
+
+// isRepositoryPolicyStatement returns true if the statement Sid is one of the statements managed by the api.
+// Other statements can have Sids starting with the same prefixes, so only the exact Sids are matched.
+func isRepositoryPolicyStatement(sid string) bool {
+	if sid == repositoryPolicySid || sid == repositoryPrincipalsPolicySid {
+		return true
+	}
+
+	for service := range repositoryServicePrincipals {
+		if sid == repositoryServicePolicySid(service) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// repositoryPolicy returns the policy to allow ecr access for resources in the same org/group as well as
+// any of the groups.  The principals, accounts or principal ARNs in other accounts, are allowed to pull in
+// a separate statement, as is each service limited to its source accounts and ARNs.  Any statements not
+// managed by the api are appended unchanged.
+func repositoryPolicy(access *repositoryAccess) (string, error) {
+	groupConditions := append([]string{"${aws:ResourceTag/spinup:spaceid}"}, access.groups...)
+
+	log.Debugf("generating policy text from groups %+v, principals %+v and %d services", access.groups, access.principals, len(access.services))
+
+	policy := iam.PolicyDocument{
+		Version: "2012-10-17",
+		Statement: []iam.StatementEntry{
+			{
+				Sid:    repositoryPolicySid,
 				Effect: "Allow",
 				Action: []string{
 					"ecr:GetAuthorizationToken",
@@ -218,66 +577,217 @@ func repositoryPolicy(groups []string) (string, error) {
 		},
 	}
 
+	if len(access.principals) > 0 {
+		arns := make(iam.Value, 0, len(access.principals))
+		for _, p := range access.principals {
+			arns = append(arns, principalArn(p))
+		}
+
+		policy.Statement = append(policy.Statement, iam.StatementEntry{
+			Sid:    repositoryPrincipalsPolicySid,
+			Effect: "Allow",
+			Action: []string{
+				"ecr:BatchCheckLayerAvailability",
+				"ecr:GetDownloadUrlForLayer",
+				"ecr:BatchGetImage",
+			},
+			Principal: iam.Principal{"AWS": arns},
+		})
+	}
+
+	for _, svc := range access.services {
+		condition := iam.Condition{}
+		if len(svc.SourceAccounts) > 0 {
+			condition["StringEquals"] = iam.ConditionStatement{"aws:sourceAccount": svc.SourceAccounts}
+		}
+
+		if len(svc.SourceArns) > 0 {
+			condition["ArnLike"] = iam.ConditionStatement{"aws:sourceArn": svc.SourceArns}
+		}
+
+		policy.Statement = append(policy.Statement, iam.StatementEntry{
+			Sid:    repositoryServicePolicySid(svc.Service),
+			Effect: "Allow",
+			Action: []string{
+				"ecr:BatchGetImage",
+				"ecr:GetDownloadUrlForLayer",
+			},
+			Principal: iam.Principal{"Service": iam.Value{repositoryServicePrincipals[svc.Service]}},
+			Condition: condition,
+		})
+	}
+
+	policy.Statement = append(policy.Statement, access.statements...)
+
 	policyDoc, err := json.Marshal(policy)
 	if err != nil {
 		log.Errorf("failed to generate repository policy documentfor %s", err)
 		return "", err
 	}
 
-	log.Debugf("returning policy document from groups: %s", string(policyDoc))
+	log.Debugf("returning policy document from repository access: %s", string(policyDoc))
+
+	return string(policyDoc), nil
+}
+
+// accountIdPattern matches an AWS account id
+var accountIdPattern = regexp.MustCompile(`^\d{12}$`)
+
+// principalArnPattern matches the ARN of an account root, role or user
+var principalArnPattern = regexp.MustCompile(`^arn:aws[a-z-]*:iam::\d{12}:(root|role/.+|user/.+)$`)
+
+// principalArn returns the root ARN for an account id, or the principal ARN as is
+func principalArn(principal string) string {
+	if accountIdPattern.MatchString(principal) {
+		return fmt.Sprintf("arn:aws:iam::%s:root", principal)
+	}
+	return principal
+}
+
+// principalFromArn returns the account id of an account root ARN, or the principal ARN as is.  ECR
+// returns account ids in the policy as root ARNs.
+func principalFromArn(arn string) string {
+	if a := strings.TrimSuffix(strings.TrimPrefix(arn, "arn:aws:iam::"), ":root"); accountIdPattern.MatchString(a) {
+		return a
+	}
+	return arn
+}
+
+// repositoryServiceFromPrincipal returns the service name of a service principal, empty if it isn't
+// one of the services that can be allowed to pull
+func repositoryServiceFromPrincipal(principal string) string {
+	for name, p := range repositoryServicePrincipals {
+		if p == principal {
+			return name
+		}
+	}
+	return ""
+}
+
+// repositoryPendingDeletionPolicy returns the policy for a repository pending deletion, it denies pulling
+// images to everyone, including the space and the groups the repository was shared with
+func repositoryPendingDeletionPolicy() (string, error) {
+	policy := iam.PolicyDocument{
+		Version: "2012-10-17",
+		Statement: []iam.StatementEntry{
+			{
+				Sid:    "DenyPullImagesPendingDeletion",
+				Effect: "Deny",
+				Action: []string{
+					"ecr:BatchCheckLayerAvailability",
+					"ecr:GetDownloadUrlForLayer",
+					"ecr:BatchGetImage",
+				},
+				Principal: iam.Principal{"AWS": iam.Value{"*"}},
+			},
+		},
+	}
+
+	policyDoc, err := json.Marshal(policy)
+	if err != nil {
+		return "", err
+	}
 
 	return string(policyDoc), nil
 }
 
-// repositoryGroupsFromPolicy returns the list of groups from the repository policy string
-func repositoryGroupsFromPolicy(policy string) ([]string, error) {
+// repositoryAccessFromPolicy returns the groups, principals and services allowed to pull by the repository
+// policy string
+func repositoryAccessFromPolicy(policy string) (*repositoryAccess, error) {
+	access := &repositoryAccess{
+		groups:     []string{},
+		principals: []string{},
+		services:   []*RepositoryServiceAccess{},
+	}
+
 	if policy == "" {
-		return []string{}, nil
+		return access, nil
 	}
 
-	log.Debugf("getting groups from policy text: %s", policy)
+	log.Debugf("getting repository access from policy text: %s", policy)
 
 	policyDoc := iam.PolicyDocument{}
 	if err := json.Unmarshal([]byte(policy), &policyDoc); err != nil {
 		return nil, err
 	}
-
-	groups := []string{}
+	access.policy = &policyDoc
 
 	// for all of the statements in our policy
 	for _, statement := range policyDoc.Statement {
-		// if we aren't dealing with the policy we set, continue to the next statement
-		if statement.Sid != "AllowPullImagesFromSpaceAndOrg" {
+		// keep the statements we don't manage
+		if !isRepositoryPolicyStatement(statement.Sid) {
+			log.Debugf("keeping resource policy statement '%s' not managed by the api", statement.Sid)
+			access.statements = append(access.statements, statement)
 			continue
 		}
 
-		conditionStatement, ok := statement.Condition["StringEqualsIgnoreCase"]
-		if !ok {
+		// collect the principals allowed to pull from other accounts
+		if statement.Sid == repositoryPrincipalsPolicySid {
+			for _, p := range statement.Principal["AWS"] {
+				access.principals = append(access.principals, principalFromArn(p))
+			}
 			continue
 		}
 
-		for k, v := range conditionStatement {
-			// look for the condition on the spaceid tag
-			if k != "aws:PrincipalTag/spinup:spaceid" {
-				log.Debugf("resource policy condition tag key '%s' is not 'aws:PrincipalTag/spinup:spaceid', continuing", k)
+		// collect the services allowed to pull and their sources
+		if strings.HasPrefix(statement.Sid, repositoryServicePolicySidPrefix) {
+			for _, p := range statement.Principal["Service"] {
+				service := repositoryServiceFromPrincipal(p)
+				if service == "" {
+					log.Debugf("resource policy service principal '%s' is unknown, continuing", p)
+					continue
+				}
+
+				svc := &RepositoryServiceAccess{
+					Service:        service,
+					SourceAccounts: []string{},
+					SourceArns:     []string{},
+				}
+
+				if c, ok := statement.Condition["StringEquals"]; ok {
+					svc.SourceAccounts = append(svc.SourceAccounts, c["aws:sourceAccount"]...)
+				}
+
+				if c, ok := statement.Condition["ArnLike"]; ok {
+					svc.SourceArns = append(svc.SourceArns, c["aws:sourceArn"]...)
+				}
+
+				access.services = append(access.services, svc)
+			}
+			continue
+		}
+
+		// the groups are also read from a case sensitive condition so they aren't lost when older or hand
+		// edited documents are regenerated
+		for _, operator := range []string{"StringEqualsIgnoreCase", "StringEquals"} {
+			conditionStatement, ok := statement.Condition[operator]
+			if !ok {
 				continue
 			}
 
-			// collect the spaceid tags and add to the list of groups
-			for _, g := range v {
-				// ignore the "same space" group
-				if g == "${aws:ResourceTag/spinup:spaceid}" {
+			for k, v := range conditionStatement {
+				// look for the condition on the spaceid tag
+				if k != "aws:PrincipalTag/spinup:spaceid" {
+					log.Debugf("resource policy condition tag key '%s' is not 'aws:PrincipalTag/spinup:spaceid', continuing", k)
 					continue
 				}
 
-				groups = append(groups, g)
+				// collect the spaceid tags and add to the list of groups
+				for _, g := range v {
+					// ignore the "same space" group
+					if g == "${aws:ResourceTag/spinup:spaceid}" {
+						continue
+					}
+
+					access.groups = append(access.groups, g)
+				}
 			}
 		}
 	}
 
-	log.Debugf("returning groups list: %v", groups)
+	log.Debugf("returning groups list: %v, principals list: %v and %d services", access.groups, access.principals, len(access.services))
 
-	return groups, nil
+	return access, nil
 }
 
 func (s *server) repositoryImageDeletePolicy(account, repoName string) (string, error) {
@@ -304,3 +814,168 @@ func (s *server) repositoryImageDeletePolicy(account, repoName string) (string,
 
 	return string(j), nil
 }
+
+// repositoryTokenPolicy generates the session policy for a registry token limited to pulling, or pulling
+// and pushing, images in the repository
+func (s *server) repositoryTokenPolicy(account, repoName, access string) (string, error) {
+	rolePolicy, ok := userRolePolicies[access]
+	if !ok || access == userRoleAdmin {
+		return "", fmt.Errorf("invalid token access '%s'", access)
+	}
+
+	actions := append([]string{"ecr:DescribeRepositories"}, rolePolicy.Statement[0].Action...)
+
+	policy := &iam.PolicyDocument{
+		Version: "2012-10-17",
+		Statement: []iam.StatementEntry{
+			{
+				Sid:    "AllowRepositoryToken",
+				Effect: "Allow",
+				Action: actions,
+				Resource: []string{
+					fmt.Sprintf("arn:aws:ecr:*:%s:repository/%s", account, repoName),
+				},
+				Condition: iam.Condition{
+					"StringEquals": iam.ConditionStatement{
+						"aws:ResourceTag/spinup:org": []string{s.org},
+					},
+				},
+			},
+			ecrDockerLoginStatement,
+		},
+	}
+
+	j, err := json.Marshal(policy)
+	if err != nil {
+		return "", err
+	}
+
+	return string(j), nil
+}
+
+// userRoleGroupArns returns the arns of the iam groups for each repository and group-wide user role in the org
+func userRoleGroupArns(org string) []string {
+	arns := make([]string, 0, 2*len(userRoles))
+	for _, role := range userRoles {
+		arns = append(arns,
+			fmt.Sprintf("arn:aws:iam::*:group/spinup/%s/%s", org, userRoleGroupName(org, role)),
+			fmt.Sprintf("arn:aws:iam::*:group/spinup/%s/%s", org, groupUserRoleGroupName(org, role)),
+		)
+	}
+	return arns
+}
+
+// repositoryUserKeyRotationPolicy generates the policy to find, rotate and disable repository user access keys in the org
+func (s *server) repositoryUserKeyRotationPolicy() (string, error) {
+	policy := &iam.PolicyDocument{
+		Version: "2012-10-17",
+		Statement: []iam.StatementEntry{
+			{
+				Sid:    "RotateRepositoryUserKeys",
+				Effect: "Allow",
+				Action: []string{
+					"iam:CreateAccessKey",
+					"iam:DeleteAccessKey",
+					"iam:GetUser",
+					"iam:ListAccessKeys",
+					"iam:ListGroupsForUser",
+					"iam:UpdateAccessKey",
+				},
+				Resource: []string{
+					fmt.Sprintf("arn:aws:iam::*:user/spinup/%s/*", s.org),
+				},
+			},
+			{
+				Sid:      "ListRepositoryUsers",
+				Effect:   "Allow",
+				Action:   []string{"iam:ListUsers"},
+				Resource: []string{"*"},
+			},
+		},
+	}
+
+	j, err := json.Marshal(policy)
+	if err != nil {
+		return "", err
+	}
+
+	return string(j), nil
+}
+
+// expiredUserDeletePolicy generates the policy to find and delete expired users in the org
+func (s *server) expiredUserDeletePolicy() (string, error) {
+	policy := &iam.PolicyDocument{
+		Version: "2012-10-17",
+		Statement: []iam.StatementEntry{
+			{
+				Sid:    "DeleteExpiredRepositoryUser",
+				Effect: "Allow",
+				Action: []string{
+					"iam:DeleteAccessKey",
+					"iam:RemoveUserFromGroup",
+					"iam:ListAccessKeys",
+					"iam:ListGroupsForUser",
+					"iam:DeleteUser",
+					"iam:GetUser",
+				},
+				Resource: append([]string{
+					fmt.Sprintf("arn:aws:iam::*:user/spinup/%s/*", s.org),
+				}, userRoleGroupArns(s.org)...),
+			},
+			{
+				Sid:      "ListRepositoryUsers",
+				Effect:   "Allow",
+				Action:   []string{"iam:ListUsers"},
+				Resource: []string{"*"},
+			},
+		},
+	}
+
+	j, err := json.Marshal(policy)
+	if err != nil {
+		return "", err
+	}
+
+	return string(j), nil
+}
+
+// orphanedUserDeletePolicy generates the policy to find the repository users in the org whose repository no
+// longer exists and delete them
+func (s *server) orphanedUserDeletePolicy() (string, error) {
+	policy := &iam.PolicyDocument{
+		Version: "2012-10-17",
+		Statement: []iam.StatementEntry{
+			{
+				Sid:    "DeleteOrphanedRepositoryUser",
+				Effect: "Allow",
+				Action: []string{
+					"iam:DeleteAccessKey",
+					"iam:RemoveUserFromGroup",
+					"iam:ListAccessKeys",
+					"iam:ListGroupsForUser",
+					"iam:DeleteUser",
+					"iam:GetUser",
+				},
+				Resource: append([]string{
+					fmt.Sprintf("arn:aws:iam::*:user/spinup/%s/*", s.org),
+				}, userRoleGroupArns(s.org)...),
+			},
+			{
+				Sid:    "ListRepositoriesAndUsers",
+				Effect: "Allow",
+				Action: []string{
+					"iam:ListUsers",
+					"ecr:DescribeRepositories",
+				},
+				Resource: []string{"*"},
+			},
+		},
+	}
+
+	j, err := json.Marshal(policy)
+	if err != nil {
+		return "", err
+	}
+
+	return string(j), nil
+}
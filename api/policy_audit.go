@@ -0,0 +1,286 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/ecr-api/iam"
+	"github.com/YaleSpinup/ecr-api/resourcegroupstaggingapi"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	log "github.com/sirupsen/logrus"
+)
+
+// orgRepositories returns the names of all of the repositories tagged with the org
+func (s *server) orgRepositories(ctx context.Context, service resourcegroupstaggingapi.ResourceGroupsTaggingAPI) ([]string, error) {
+	tagFilters := []*resourcegroupstaggingapi.TagFilter{
+		{
+			Key:   "spinup:org",
+			Value: []string{s.org},
+		},
+	}
+
+	out, err := service.GetResourcesWithTags(ctx, []string{"ecr"}, tagFilters)
+	if err != nil {
+		return nil, err
+	}
+
+	repos := make([]string, 0, len(out))
+	for _, repo := range out {
+		a, err := arn.Parse(aws.StringValue(repo.ResourceARN))
+		if err != nil {
+			msg := fmt.Sprintf("failed to parse ARN %s: %s", aws.StringValue(repo.ResourceARN), err)
+			return nil, apierror.New(apierror.ErrInternalError, msg, err)
+		}
+
+		repos = append(repos, strings.TrimPrefix(a.Resource, "repository/"))
+	}
+
+	return repos, nil
+}
+
+// repositoryPolicyDrift compares the repository policy with the policy repositoryPolicy generates for the
+// groups, principals and services it grants.  It returns the differences and the repaired policy, which
+// keeps the statements not managed by the api.
+func repositoryPolicyDrift(repository, policy string) (*RepositoryPolicyAuditResult, string, error) {
+	result := &RepositoryPolicyAuditResult{
+		Repository:        repository,
+		MissingStatements: []string{},
+		ChangedStatements: []string{},
+		ChangedConditions: []string{},
+		ExtraStatements:   []string{},
+	}
+
+	access, err := repositoryAccessFromPolicy(policy)
+	if err != nil {
+		return nil, "", err
+	}
+
+	repaired, err := repositoryPolicy(access)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if policy == "" {
+		result.Drifted = true
+		result.MissingPolicy = true
+		return result, repaired, nil
+	}
+
+	generatedPolicy, err := repositoryPolicy(&repositoryAccess{
+		groups:     access.groups,
+		principals: access.principals,
+		services:   access.services,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	generated := iam.PolicyDocument{}
+	if err := json.Unmarshal([]byte(generatedPolicy), &generated); err != nil {
+		return nil, "", err
+	}
+
+	live := *access.policy
+	if iam.PolicyDeepEqual(live, generated) {
+		return result, repaired, nil
+	}
+
+	result.ChangedVersion = live.Version != generated.Version
+
+	generatedSids := make(map[string]bool, len(generated.Statement))
+	for _, g := range generated.Statement {
+		generatedSids[g.Sid] = true
+
+		var found bool
+		for _, l := range live.Statement {
+			if l.Sid != g.Sid {
+				continue
+			}
+			found = true
+
+			if !l.Condition.Equal(g.Condition) {
+				result.ChangedConditions = append(result.ChangedConditions, g.Sid)
+			}
+
+			if l.Effect != g.Effect || !l.Principal.Equal(g.Principal) || !l.Action.Equal(g.Action) || !l.Resource.Equal(g.Resource) {
+				result.ChangedStatements = append(result.ChangedStatements, g.Sid)
+			}
+
+			break
+		}
+
+		if !found {
+			result.MissingStatements = append(result.MissingStatements, g.Sid)
+		}
+	}
+
+	// a managed statement that isn't generated, like an empty list of principals, is removed by a repair
+	var extraManaged bool
+	for i, l := range live.Statement {
+		if generatedSids[l.Sid] {
+			continue
+		}
+
+		sid := l.Sid
+		if sid == "" {
+			sid = fmt.Sprintf("#%d", i)
+		}
+		result.ExtraStatements = append(result.ExtraStatements, sid)
+
+		if isRepositoryPolicyStatement(l.Sid) {
+			extraManaged = true
+		}
+	}
+
+	result.Drifted = result.ChangedVersion ||
+		extraManaged ||
+		len(result.MissingStatements) > 0 ||
+		len(result.ChangedStatements) > 0 ||
+		len(result.ChangedConditions) > 0
+
+	return result, repaired, nil
+}
+
+// repositoryPolicyAudit audits the repository policy and rewrites it when it's drifted and repair is true.  It
+// returns nil if the policy matches or the repository is pending deletion, its policy denies all pulls.
+func (o *ecrOrchestrator) repositoryPolicyAudit(ctx context.Context, repository string, repair bool) (*RepositoryPolicyAuditResult, error) {
+	repo, err := o.client.GetRepositories(ctx, repository)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := o.client.GetRepositoryTags(ctx, aws.StringValue(repo.RepositoryArn))
+	if err != nil {
+		return nil, err
+	}
+
+	if repositoryDeleteAt(tags) != nil {
+		log.Debugf("skipping policy audit of repository %s pending deletion", repository)
+		return nil, nil
+	}
+
+	policy, err := o.client.GetRepositoryPolicy(ctx, repository)
+	if err != nil {
+		return nil, err
+	}
+
+	result, repaired, err := repositoryPolicyDrift(repository, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	if !result.Drifted && len(result.ExtraStatements) == 0 {
+		return nil, nil
+	}
+
+	if repair && result.Drifted {
+		log.Infof("repairing drifted policy of repository %s", repository)
+
+		if err := o.client.UpdateRepositoryPolicy(ctx, repository, repaired); err != nil {
+			return result, err
+		}
+		result.Repaired = true
+	}
+
+	return result, nil
+}
+
+// startRepositoryPoliciesAudit starts auditing the policies of all of the repositories in the org in the
+// background, and optionally repairing them
+func (s *server) startRepositoryPoliciesAudit(ctx context.Context, account string, repair bool) (*Report, error) {
+	job, listJob := s.repositoryPoliciesAuditJobs(account, repair)
+	if _, err := listJob.get(ctx); err != nil {
+		return nil, err
+	}
+
+	return s.startReport(ctx, job, reportRepositoryPolicies, func(ctx context.Context) (interface{}, error) {
+		return s.auditRepositoryPolicies(ctx, job, listJob, account, repair)
+	})
+}
+
+// repositoryPoliciesAuditJobs returns the job session to audit the repository policies in the account, and
+// the job session to list the repositories in the org.  The org policy of a repair would deny listing the
+// repositories, so they're listed with a session without it.
+func (s *server) repositoryPoliciesAuditJobs(account string, repair bool) (*jobSession, *jobSession) {
+	policy := ""
+	policyArn := "arn:aws:iam::aws:policy/AmazonEC2ContainerRegistryReadOnly"
+
+	if repair {
+		policy = s.orgPolicy
+		policyArn = "arn:aws:iam::aws:policy/AmazonEC2ContainerRegistryFullAccess"
+	}
+
+	return s.newJobSession(account, policy, policyArn), s.newTaggedResourcesJobSession(account)
+}
+
+// auditRepositoryPolicies lists the repositories in the org with the list job session, and audits and optionally
+// repairs their policies with the job session
+func (s *server) auditRepositoryPolicies(ctx context.Context, job, listJob *jobSession, account string, repair bool) (*RepositoryPolicyAuditReport, error) {
+	session, err := listJob.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	repos, err := s.orgRepositories(ctx, resourcegroupstaggingapi.New(resourcegroupstaggingapi.WithSession(session.Session)))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.auditRepositoryPoliciesWithOrchestrators(ctx, job.orchestrators, account, repos, repair), nil
+}
+
+// auditRepositoryPoliciesWithOrchestrators audits the policies of the repositories, failures are reported with
+// each repository and the rest are still audited
+func (s *server) auditRepositoryPoliciesWithOrchestrators(ctx context.Context, orchestrators orchestratorsFunc, account string, repos []string, repair bool) *RepositoryPolicyAuditReport {
+	report := &RepositoryPolicyAuditReport{
+		Account:      account,
+		Repair:       repair,
+		StartedAt:    time.Now().UTC(),
+		Repositories: []*RepositoryPolicyAuditResult{},
+	}
+
+	log.Infof("auditing the policies of %d repositories in account %s (repair: %t)", len(repos), account, repair)
+
+	for _, repository := range repos {
+		report.Audited++
+
+		result, err := s.auditRepositoryPolicy(ctx, orchestrators, repository, repair)
+		if err != nil {
+			log.Errorf("failed to audit repository %s policy: %s", repository, err)
+
+			if result == nil {
+				result = &RepositoryPolicyAuditResult{Repository: repository}
+			}
+			result.Error = err.Error()
+		}
+
+		if result == nil {
+			continue
+		}
+		report.Repositories = append(report.Repositories, result)
+
+		if result.Repaired {
+			group, _ := splitRepositoryName(repository)
+			s.notify(ctx, notificationRepositoryUpdated, account, group, &RepositoryNotification{Repository: repository})
+		}
+	}
+
+	report.CompletedAt = time.Now().UTC()
+
+	return report
+}
+
+// auditRepositoryPolicy audits the policy of one of the repositories with the current job session
+func (s *server) auditRepositoryPolicy(ctx context.Context, orchestrators orchestratorsFunc, repository string, repair bool) (*RepositoryPolicyAuditResult, error) {
+	orch, _, err := orchestrators(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return orch.repositoryPolicyAudit(ctx, repository, repair)
+}
@@ -0,0 +1,252 @@
+package api
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/YaleSpinup/ecr-api/resourcegroupstaggingapi"
+	"github.com/aws/aws-sdk-go/aws"
+	awsecr "github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// legacyRepositoryPolicy is a policy in the older format, with the 2008 version, the anonymous principal and
+// without the authorization token action
+const legacyRepositoryPolicy = `{"Version":"2008-10-17","Statement":[{"Sid":"AllowPullImagesFromSpaceAndOrg","Effect":"Allow","Principal":"*","Action":["ecr:BatchCheckLayerAvailability","ecr:GetDownloadUrlForLayer","ecr:BatchGetImage"],"Condition":{"StringEqualsIgnoreCase":{"aws:PrincipalTag/spinup:org":"${aws:ResourceTag/spinup:org}","aws:PrincipalTag/spinup:spaceid":["${aws:ResourceTag/spinup:spaceid}","spindev-00002"]}}}]}`
+
+// securityStatement is a statement not managed by the api
+const securityStatement = `{"Sid":"DenyPullOutsideOrganization","Effect":"Deny","Principal":{"AWS":"*"},"Action":["ecr:BatchGetImage"],"Condition":{"StringNotEquals":{"aws:PrincipalOrgID":"o-abc123"}}}`
+
+// withStatement appends the statement to the policy
+func withStatement(policy, statement string) string {
+	return strings.TrimSuffix(policy, "]}") + "," + statement + "]}"
+}
+
+func Test_repositoryPolicyDrift(t *testing.T) {
+	current, err := repositoryPolicy(&repositoryAccess{groups: []string{"spindev-00002"}, principals: []string{"012345678901"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tests := []struct {
+		name              string
+		policy            string
+		wantDrifted       bool
+		wantMissingPolicy bool
+		wantVersion       bool
+		wantMissing       []string
+		wantChanged       []string
+		wantConditions    []string
+		wantExtra         []string
+	}{
+		{
+			name:   "current",
+			policy: current,
+		},
+		{
+			name:              "missing policy",
+			wantDrifted:       true,
+			wantMissingPolicy: true,
+		},
+		{
+			name:        "legacy",
+			policy:      legacyRepositoryPolicy,
+			wantDrifted: true,
+			wantVersion: true,
+			wantChanged: []string{"AllowPullImagesFromSpaceAndOrg"},
+		},
+		{
+			name:           "changed conditions",
+			policy:         strings.Replace(current, `"aws:PrincipalTag/spinup:org":["${aws:ResourceTag/spinup:org}"],`, "", 1),
+			wantDrifted:    true,
+			wantConditions: []string{"AllowPullImagesFromSpaceAndOrg"},
+		},
+		{
+			name:        "missing statement",
+			policy:      `{"Version":"2012-10-17","Statement":[` + securityStatement + `]}`,
+			wantDrifted: true,
+			wantMissing: []string{"AllowPullImagesFromSpaceAndOrg"},
+			wantExtra:   []string{"DenyPullOutsideOrganization"},
+		},
+		{
+			name:      "custom statement",
+			policy:    withStatement(current, securityStatement),
+			wantExtra: []string{"DenyPullOutsideOrganization"},
+		},
+		{
+			name:        "empty principals statement",
+			policy:      withStatement(legacyRepositoryPolicy, `{"Sid":"AllowPullImagesFromPrincipals","Effect":"Allow","Principal":{"AWS":[]},"Action":["ecr:BatchGetImage"]}`),
+			wantDrifted: true,
+			wantVersion: true,
+			wantChanged: []string{"AllowPullImagesFromSpaceAndOrg"},
+			wantExtra:   []string{"AllowPullImagesFromPrincipals"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, repaired, err := repositoryPolicyDrift("spindev-00001/rudolph", tt.policy)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if got.Drifted != tt.wantDrifted || got.MissingPolicy != tt.wantMissingPolicy || got.ChangedVersion != tt.wantVersion {
+				t.Errorf("expected drifted %t, missing policy %t and changed version %t, got %+v", tt.wantDrifted, tt.wantMissingPolicy, tt.wantVersion, got)
+			}
+
+			for _, c := range []struct {
+				name      string
+				got, want []string
+			}{
+				{"missing statements", got.MissingStatements, tt.wantMissing},
+				{"changed statements", got.ChangedStatements, tt.wantChanged},
+				{"changed conditions", got.ChangedConditions, tt.wantConditions},
+				{"extra statements", got.ExtraStatements, tt.wantExtra},
+			} {
+				want := c.want
+				if want == nil {
+					want = []string{}
+				}
+
+				if !reflect.DeepEqual(c.got, want) {
+					t.Errorf("expected %s %v, got %v", c.name, want, c.got)
+				}
+			}
+
+			// the repaired policy doesn't drift and keeps the custom statements
+			after, _, err := repositoryPolicyDrift("spindev-00001/rudolph", repaired)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if after.Drifted {
+				t.Errorf("expected the repaired policy not to drift, got %+v", after)
+			}
+
+			if strings.Contains(tt.policy, "DenyPullOutsideOrganization") != strings.Contains(repaired, "DenyPullOutsideOrganization") {
+				t.Errorf("expected the custom statement to be kept in the repaired policy %s", repaired)
+			}
+		})
+	}
+}
+
+func TestServer_auditRepositoryPolicies(t *testing.T) {
+	ctx := context.Background()
+	st := newSoftDeleteTest(t)
+
+	st.ecrClient.addRepository("spindev-00001/blitzen", legacyRepositoryPolicy)
+	st.ecrClient.addRepository("spindev-00001/comet", "")
+	st.ecrClient.addRepository("spindev-00002/cupid", withStatement(st.policy, securityStatement))
+	st.ecrClient.addRepository("spindev-00002/vixen", "",
+		&awsecr.Tag{Key: aws.String(repositoryDeleteAtTag), Value: aws.String("2026-01-01T00:00:00Z")},
+	)
+
+	repos := []string{"spindev-00001/rudolph", "spindev-00001/blitzen", "spindev-00001/comet", "spindev-00002/cupid", "spindev-00002/vixen", "spindev-00002/missing"}
+
+	report := st.server.auditRepositoryPoliciesWithOrchestrators(ctx, st.orchestrators, "12345", repos, false)
+	if report.Repair || report.Audited != 6 || len(report.Repositories) != 4 {
+		t.Fatalf("unexpected audit report %+v", report)
+	}
+
+	results := map[string]*RepositoryPolicyAuditResult{}
+	for _, r := range report.Repositories {
+		results[r.Repository] = r
+	}
+
+	if r := results["spindev-00001/blitzen"]; r == nil || !r.Drifted || r.Repaired {
+		t.Errorf("expected the legacy policy to be drifted, got %+v", r)
+	}
+
+	if r := results["spindev-00001/comet"]; r == nil || !r.MissingPolicy {
+		t.Errorf("expected the missing policy to be reported, got %+v", r)
+	}
+
+	if r := results["spindev-00002/cupid"]; r == nil || r.Drifted || len(r.ExtraStatements) != 1 {
+		t.Errorf("expected the custom statement to be reported, got %+v", r)
+	}
+
+	if r := results["spindev-00002/missing"]; r == nil || r.Error == "" {
+		t.Errorf("expected an error for the missing repository, got %+v", r)
+	}
+
+	if st.ecrClient.policies["spindev-00001/blitzen"] != legacyRepositoryPolicy {
+		t.Error("expected the policy not to be rewritten without repair")
+	}
+
+	report = st.server.auditRepositoryPoliciesWithOrchestrators(ctx, st.orchestrators, "12345", repos, true)
+
+	repaired := 0
+	for _, r := range report.Repositories {
+		if r.Repaired {
+			repaired++
+		}
+	}
+
+	if repaired != 2 || len(st.notifier.notifications) != 2 {
+		t.Errorf("expected 2 repaired repositories and notifications, got %d and %d", repaired, len(st.notifier.notifications))
+	}
+
+	access, err := repositoryAccessFromPolicy(st.ecrClient.policies["spindev-00001/blitzen"])
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(access.groups, []string{"spindev-00002"}) || access.policy.Version != "2012-10-17" {
+		t.Errorf("expected the repaired policy to keep the groups in the current format, got %+v", access.policy)
+	}
+
+	if st.ecrClient.policies["spindev-00002/cupid"] != withStatement(st.policy, securityStatement) {
+		t.Error("expected the policy with a custom statement not to be rewritten")
+	}
+
+	if _, ok := st.ecrClient.policies["spindev-00002/vixen"]; ok {
+		t.Error("expected the repository pending deletion not to be repaired")
+	}
+
+	report = st.server.auditRepositoryPoliciesWithOrchestrators(ctx, st.orchestrators, "12345", repos[:3], false)
+	if len(report.Repositories) != 0 {
+		t.Errorf("expected no drift after the repair, got %+v", report.Repositories)
+	}
+}
+
+func TestServer_repositoryPoliciesAuditJobs(t *testing.T) {
+	s := &server{org: "testOrg", orgPolicy: `{"Version":"2012-10-17"}`}
+
+	job, listJob := s.repositoryPoliciesAuditJobs("12345", false)
+	if job.policy != "" || !reflect.DeepEqual(job.policyArns, []string{"arn:aws:iam::aws:policy/AmazonEC2ContainerRegistryReadOnly"}) {
+		t.Errorf("unexpected audit job session %s %v", job.policy, job.policyArns)
+	}
+
+	job, listJob = s.repositoryPoliciesAuditJobs("12345", true)
+	if job.policy != s.orgPolicy || !reflect.DeepEqual(job.policyArns, []string{"arn:aws:iam::aws:policy/AmazonEC2ContainerRegistryFullAccess"}) {
+		t.Errorf("unexpected repair job session %s %v", job.policy, job.policyArns)
+	}
+
+	// the org policy would deny tag:GetResources
+	if listJob.policy != "" || !reflect.DeepEqual(listJob.policyArns, []string{"arn:aws:iam::aws:policy/ResourceGroupsandTagEditorReadOnlyAccess"}) {
+		t.Errorf("unexpected list job session %s %v", listJob.policy, listJob.policyArns)
+	}
+}
+
+func TestServer_orgRepositories(t *testing.T) {
+	s := &server{org: "testOrg"}
+	service := resourcegroupstaggingapi.ResourceGroupsTaggingAPI{
+		Service: &fakeTagging{
+			org: "testOrg",
+			resources: []string{
+				"arn:aws:ecr:us-east-1:12345:repository/spindev-00001/rudolph",
+				"arn:aws:ecr:us-east-1:12345:repository/spindev-00002/blitzen",
+			},
+		},
+	}
+
+	repos, err := s.orgRepositories(context.Background(), service)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(repos, []string{"spindev-00001/rudolph", "spindev-00002/blitzen"}) {
+		t.Errorf("expected [spindev-00001/rudolph spindev-00002/blitzen], got %v", repos)
+	}
+}
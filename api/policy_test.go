@@ -3,6 +3,8 @@ package api
 import (
 	"reflect"
 	"testing"
+
+	"github.com/YaleSpinup/ecr-api/iam"
 )
 
 func Test_orgTagAccessPolicy(t *testing.T) {
@@ -52,7 +54,7 @@ func Test_server_repositoryUserCreatePolicy(t *testing.T) {
 			fields: fields{
 				org: "testOrg",
 			},
-			want: `{"Version":"2012-10-17","Statement":[{"Sid":"CreateRepositoryUser","Effect":"Allow","Action":["iam:CreatePolicy","iam:UntagUser","iam:GetPolicyVersion","iam:AddUserToGroup","iam:GetPolicy","iam:ListAttachedGroupPolicies","iam:ListGroupPolicies","iam:AttachGroupPolicy","iam:GetUser","iam:CreatePolicyVersion","iam:CreateUser","iam:GetGroup","iam:CreateGroup","iam:TagUser"],"Resource":["arn:aws:iam::*:group/*","arn:aws:iam::*:policy/spinup/testOrg/*","arn:aws:iam::*:user/spinup/testOrg/*"]},{"Sid":"ListRepositoryUserPolicies","Effect":"Allow","Action":["iam:ListPolicies"],"Resource":["*"]}]}`,
+			want: `{"Version":"2012-10-17","Statement":[{"Sid":"CreateRepositoryUser","Effect":"Allow","Action":["iam:CreatePolicy","iam:UntagUser","iam:GetPolicyVersion","iam:AddUserToGroup","iam:GetPolicy","iam:ListAttachedGroupPolicies","iam:ListGroupPolicies","iam:AttachGroupPolicy","iam:GetUser","iam:CreatePolicyVersion","iam:CreateUser","iam:GetGroup","iam:CreateGroup","iam:TagUser","iam:ListPolicyVersions","iam:DeletePolicyVersion"],"Resource":["arn:aws:iam::*:group/*","arn:aws:iam::*:policy/spinup/testOrg/*","arn:aws:iam::*:user/spinup/testOrg/*"]},{"Sid":"ListRepositoryUserPolicies","Effect":"Allow","Action":["iam:ListPolicies"],"Resource":["*"]},{"Sid":"CheckRepositoryPendingDeletion","Effect":"Allow","Action":["ecr:DescribeRepositories","ecr:ListTagsForResource"],"Resource":["*"]}]}`,
 		},
 	}
 	for _, tt := range tests {
@@ -87,7 +89,7 @@ func Test_server_repositoryUserDeletePolicy(t *testing.T) {
 			fields: fields{
 				org: "testOrg",
 			},
-			want: `{"Version":"2012-10-17","Statement":[{"Sid":"DeleteRepositoryUser","Effect":"Allow","Action":["iam:DeleteAccessKey","iam:RemoveUserFromGroup","iam:ListAccessKeys","iam:ListGroupsForUser","iam:DeleteUser","iam:GetUser"],"Resource":["arn:aws:iam::*:user/spinup/testOrg/*","arn:aws:iam::*:group/spinup/testOrg/SpinupECRAdminGroup-testOrg"]}]}`,
+			want: `{"Version":"2012-10-17","Statement":[{"Sid":"DeleteRepositoryUser","Effect":"Allow","Action":["iam:DeleteAccessKey","iam:RemoveUserFromGroup","iam:ListAccessKeys","iam:ListGroupsForUser","iam:DeleteUser","iam:GetUser"],"Resource":["arn:aws:iam::*:user/spinup/testOrg/*","arn:aws:iam::*:group/spinup/testOrg/SpinupECRAdminGroup-testOrg","arn:aws:iam::*:group/spinup/testOrg/SpinupECRSpaceAdminGroup-testOrg","arn:aws:iam::*:group/spinup/testOrg/SpinupECRPullGroup-testOrg","arn:aws:iam::*:group/spinup/testOrg/SpinupECRSpacePullGroup-testOrg","arn:aws:iam::*:group/spinup/testOrg/SpinupECRPushGroup-testOrg","arn:aws:iam::*:group/spinup/testOrg/SpinupECRSpacePushGroup-testOrg"]}]}`,
 		},
 	}
 	for _, tt := range tests {
@@ -122,7 +124,7 @@ func Test_server_repositoryUserUpdatePolicy(t *testing.T) {
 			fields: fields{
 				org: "testOrg",
 			},
-			want: `{"Version":"2012-10-17","Statement":[{"Sid":"UpdateRepositoryUser","Effect":"Allow","Action":["iam:UntagUser","iam:DeleteAccessKey","iam:RemoveUserFromGroup","iam:TagUser","iam:CreateAccessKey","iam:ListAccessKeys"],"Resource":["arn:aws:iam::*:user/spinup/testOrg/*","arn:aws:iam::*:group/spinup/testOrg/SpinupECRAdminGroup-testOrg"]}]}`,
+			want: `{"Version":"2012-10-17","Statement":[{"Sid":"UpdateRepositoryUser","Effect":"Allow","Action":["iam:GetUser","iam:UntagUser","iam:DeleteAccessKey","iam:RemoveUserFromGroup","iam:TagUser","iam:CreateAccessKey","iam:ListAccessKeys","iam:UpdateAccessKey"],"Resource":["arn:aws:iam::*:user/spinup/testOrg/*","arn:aws:iam::*:group/spinup/testOrg/SpinupECRAdminGroup-testOrg","arn:aws:iam::*:group/spinup/testOrg/SpinupECRSpaceAdminGroup-testOrg","arn:aws:iam::*:group/spinup/testOrg/SpinupECRPullGroup-testOrg","arn:aws:iam::*:group/spinup/testOrg/SpinupECRSpacePullGroup-testOrg","arn:aws:iam::*:group/spinup/testOrg/SpinupECRPushGroup-testOrg","arn:aws:iam::*:group/spinup/testOrg/SpinupECRSpacePushGroup-testOrg"]},{"Sid":"CheckRepositoryPendingDeletion","Effect":"Allow","Action":["ecr:DescribeRepositories","ecr:ListTagsForResource"],"Resource":["*"]}]}`,
 		},
 	}
 	for _, tt := range tests {
@@ -144,7 +146,10 @@ func Test_server_repositoryUserUpdatePolicy(t *testing.T) {
 
 func Test_repositoryPolicy(t *testing.T) {
 	type args struct {
-		groups []string
+		groups     []string
+		principals []string
+		services   []*RepositoryServiceAccess
+		statements []iam.StatementEntry
 	}
 	tests := []struct {
 		name    string
@@ -173,10 +178,37 @@ func Test_repositoryPolicy(t *testing.T) {
 			},
 			want: `{"Version":"2012-10-17","Statement":[{"Sid":"AllowPullImagesFromSpaceAndOrg","Effect":"Allow","Principal":{"AWS":["*"]},"Action":["ecr:GetAuthorizationToken","ecr:BatchCheckLayerAvailability","ecr:GetDownloadUrlForLayer","ecr:BatchGetImage"],"Condition":{"StringEqualsIgnoreCase":{"aws:PrincipalTag/spinup:org":["${aws:ResourceTag/spinup:org}"],"aws:PrincipalTag/spinup:spaceid":["${aws:ResourceTag/spinup:spaceid}","foo","bar","baz"]}}}]}`,
 		},
+		{
+			name: "principals",
+			args: args{
+				groups:     []string{"foo"},
+				principals: []string{"012345678901", "arn:aws:iam::109876543210:role/deploy"},
+			},
+			want: `{"Version":"2012-10-17","Statement":[{"Sid":"AllowPullImagesFromSpaceAndOrg","Effect":"Allow","Principal":{"AWS":["*"]},"Action":["ecr:GetAuthorizationToken","ecr:BatchCheckLayerAvailability","ecr:GetDownloadUrlForLayer","ecr:BatchGetImage"],"Condition":{"StringEqualsIgnoreCase":{"aws:PrincipalTag/spinup:org":["${aws:ResourceTag/spinup:org}"],"aws:PrincipalTag/spinup:spaceid":["${aws:ResourceTag/spinup:spaceid}","foo"]}}},{"Sid":"AllowPullImagesFromPrincipals","Effect":"Allow","Principal":{"AWS":["arn:aws:iam::012345678901:root","arn:aws:iam::109876543210:role/deploy"]},"Action":["ecr:BatchCheckLayerAvailability","ecr:GetDownloadUrlForLayer","ecr:BatchGetImage"]}]}`,
+		},
+		{
+			name: "statements",
+			args: args{
+				statements: []iam.StatementEntry{
+					{Sid: "SecurityDeny", Effect: "Deny", Principal: iam.Principal{"AWS": iam.Value{"*"}}, Action: iam.Value{"ecr:BatchGetImage"}},
+				},
+			},
+			want: `{"Version":"2012-10-17","Statement":[{"Sid":"AllowPullImagesFromSpaceAndOrg","Effect":"Allow","Principal":{"AWS":["*"]},"Action":["ecr:GetAuthorizationToken","ecr:BatchCheckLayerAvailability","ecr:GetDownloadUrlForLayer","ecr:BatchGetImage"],"Condition":{"StringEqualsIgnoreCase":{"aws:PrincipalTag/spinup:org":["${aws:ResourceTag/spinup:org}"],"aws:PrincipalTag/spinup:spaceid":["${aws:ResourceTag/spinup:spaceid}"]}}},{"Sid":"SecurityDeny","Effect":"Deny","Principal":{"AWS":["*"]},"Action":["ecr:BatchGetImage"]}]}`,
+		},
+		{
+			name: "services",
+			args: args{
+				services: []*RepositoryServiceAccess{
+					{Service: "lambda", SourceAccounts: []string{"012345678901"}, SourceArns: []string{"arn:aws:lambda:us-east-1:012345678901:function:*"}},
+					{Service: "codebuild", SourceAccounts: []string{"012345678901"}},
+				},
+			},
+			want: `{"Version":"2012-10-17","Statement":[{"Sid":"AllowPullImagesFromSpaceAndOrg","Effect":"Allow","Principal":{"AWS":["*"]},"Action":["ecr:GetAuthorizationToken","ecr:BatchCheckLayerAvailability","ecr:GetDownloadUrlForLayer","ecr:BatchGetImage"],"Condition":{"StringEqualsIgnoreCase":{"aws:PrincipalTag/spinup:org":["${aws:ResourceTag/spinup:org}"],"aws:PrincipalTag/spinup:spaceid":["${aws:ResourceTag/spinup:spaceid}"]}}},{"Sid":"AllowPullImagesFromServiceLambda","Effect":"Allow","Principal":{"Service":["lambda.amazonaws.com"]},"Action":["ecr:BatchGetImage","ecr:GetDownloadUrlForLayer"],"Condition":{"ArnLike":{"aws:sourceArn":["arn:aws:lambda:us-east-1:012345678901:function:*"]},"StringEquals":{"aws:sourceAccount":["012345678901"]}}},{"Sid":"AllowPullImagesFromServiceCodebuild","Effect":"Allow","Principal":{"Service":["codebuild.amazonaws.com"]},"Action":["ecr:BatchGetImage","ecr:GetDownloadUrlForLayer"],"Condition":{"StringEquals":{"aws:sourceAccount":["012345678901"]}}}]}`,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := repositoryPolicy(tt.args.groups)
+			got, err := repositoryPolicy(&repositoryAccess{groups: tt.args.groups, principals: tt.args.principals, services: tt.args.services, statements: tt.args.statements})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("repositoryPolicy() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -188,15 +220,18 @@ func Test_repositoryPolicy(t *testing.T) {
 	}
 }
 
-func Test_repositoryGroupsFromPolicy(t *testing.T) {
+func Test_repositoryAccessFromPolicy(t *testing.T) {
 	type args struct {
 		policy string
 	}
 	tests := []struct {
-		name    string
-		args    args
-		want    []string
-		wantErr bool
+		name           string
+		args           args
+		want           []string
+		wantPrincipals []string
+		wantServices   []*RepositoryServiceAccess
+		wantStatements []iam.StatementEntry
+		wantErr        bool
 	}{
 		{
 			name: "nil",
@@ -226,12 +261,63 @@ func Test_repositoryGroupsFromPolicy(t *testing.T) {
 			},
 			want: []string{"foo", "bar", "baz"},
 		},
+		{
+			name: "principals",
+			args: args{
+				policy: `{"Version":"2012-10-17","Statement":[{"Action":["ecr:GetAuthorizationToken","ecr:BatchCheckLayerAvailability","ecr:GetDownloadUrlForLayer","ecr:BatchGetImage"],"Condition":{"StringEqualsIgnoreCase":{"aws:PrincipalTag/spinup:org":"${aws:ResourceTag/spinup:org}","aws:PrincipalTag/spinup:spaceid":["${aws:ResourceTag/spinup:spaceid}","foo"]}},"Effect":"Allow","Principal":{"AWS":"*"},"Sid":"AllowPullImagesFromSpaceAndOrg"},{"Action":["ecr:BatchCheckLayerAvailability","ecr:GetDownloadUrlForLayer","ecr:BatchGetImage"],"Effect":"Allow","Principal":{"AWS":["arn:aws:iam::012345678901:root","arn:aws:iam::109876543210:role/deploy"]},"Sid":"AllowPullImagesFromPrincipals"}]}`,
+			},
+			want:           []string{"foo"},
+			wantPrincipals: []string{"012345678901", "arn:aws:iam::109876543210:role/deploy"},
+		},
+		{
+			name: "single principal",
+			args: args{
+				policy: `{"Version":"2012-10-17","Statement":[{"Action":["ecr:BatchCheckLayerAvailability","ecr:GetDownloadUrlForLayer","ecr:BatchGetImage"],"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::012345678901:root"},"Sid":"AllowPullImagesFromPrincipals"}]}`,
+			},
+			want:           []string{},
+			wantPrincipals: []string{"012345678901"},
+		},
+		{
+			name: "services",
+			args: args{
+				policy: `{"Version":"2012-10-17","Statement":[{"Action":["ecr:BatchGetImage","ecr:GetDownloadUrlForLayer"],"Condition":{"ArnLike":{"aws:sourceArn":"arn:aws:lambda:us-east-1:012345678901:function:*"}},"Effect":"Allow","Principal":{"Service":"lambda.amazonaws.com"},"Sid":"AllowPullImagesFromServiceLambda"},{"Action":["ecr:BatchGetImage","ecr:GetDownloadUrlForLayer"],"Condition":{"StringEquals":{"aws:sourceAccount":"012345678901"}},"Effect":"Allow","Principal":{"Service":"codebuild.amazonaws.com"},"Sid":"AllowPullImagesFromServiceCodebuild"}]}`,
+			},
+			want: []string{},
+			wantServices: []*RepositoryServiceAccess{
+				{Service: "lambda", SourceAccounts: []string{}, SourceArns: []string{"arn:aws:lambda:us-east-1:012345678901:function:*"}},
+				{Service: "codebuild", SourceAccounts: []string{"012345678901"}, SourceArns: []string{}},
+			},
+		},
+		{
+			name: "keeps statements",
+			args: args{
+				policy: `{"Version":"2012-10-17","Statement":[{"Action":["ecr:GetAuthorizationToken","ecr:BatchCheckLayerAvailability","ecr:GetDownloadUrlForLayer","ecr:BatchGetImage"],"Condition":{"StringEqualsIgnoreCase":{"aws:PrincipalTag/spinup:org":"${aws:ResourceTag/spinup:org}","aws:PrincipalTag/spinup:spaceid":["${aws:ResourceTag/spinup:spaceid}","foo"]}},"Effect":"Allow","Principal":{"AWS":"*"},"Sid":"AllowPullImagesFromSpaceAndOrg"},{"Action":"ecr:BatchGetImage","Effect":"Deny","Principal":{"AWS":"*"},"Sid":"SecurityDeny"}]}`,
+			},
+			want: []string{"foo"},
+			wantStatements: []iam.StatementEntry{
+				{Sid: "SecurityDeny", Effect: "Deny", Principal: iam.Principal{"AWS": iam.Value{"*"}}, Action: iam.Value{"ecr:BatchGetImage"}},
+			},
+		},
 		{
 			name: "unexpected policy SID",
 			args: args{
 				policy: `{"Version":"2012-10-17","Statement":[{"Action":["ecr:GetAuthorizationToken","ecr:BatchCheckLayerAvailability","ecr:GetDownloadUrlForLayer","ecr:BatchGetImage"],"Condition":{"StringEqualsIgnoreCase":{"aws:PrincipalTag/spinup:org":"${aws:ResourceTag/spinup:org}","aws:PrincipalTag/spinup:spaceid":["${aws:ResourceTag/spinup:spaceid}","foo","bar","baz"]}},"Effect":"Allow","Principal":{"AWS":"*"},"Sid":"SomeOtherSID"}]}`,
 			},
 			want: []string{},
+			wantStatements: []iam.StatementEntry{
+				{
+					Sid:       "SomeOtherSID",
+					Effect:    "Allow",
+					Principal: iam.Principal{"AWS": iam.Value{"*"}},
+					Action:    iam.Value{"ecr:GetAuthorizationToken", "ecr:BatchCheckLayerAvailability", "ecr:GetDownloadUrlForLayer", "ecr:BatchGetImage"},
+					Condition: iam.Condition{
+						"StringEqualsIgnoreCase": iam.ConditionStatement{
+							"aws:PrincipalTag/spinup:org":     iam.Value{"${aws:ResourceTag/spinup:org}"},
+							"aws:PrincipalTag/spinup:spaceid": iam.Value{"${aws:ResourceTag/spinup:spaceid}", "foo", "bar", "baz"},
+						},
+					},
+				},
+			},
 		},
 		{
 			name: "missing StringEqualsIgnoreCase",
@@ -243,13 +329,115 @@ func Test_repositoryGroupsFromPolicy(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := repositoryGroupsFromPolicy(tt.args.policy)
+			got, err := repositoryAccessFromPolicy(tt.args.policy)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("repositoryGroupsFromPolicy() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("repositoryAccessFromPolicy() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("repositoryGroupsFromPolicy() = %v, want %v", got, tt.want)
+			if !reflect.DeepEqual(got.groups, tt.want) {
+				t.Errorf("repositoryAccessFromPolicy() groups = %v, want %v", got.groups, tt.want)
+			}
+
+			wantPrincipals := tt.wantPrincipals
+			if wantPrincipals == nil {
+				wantPrincipals = []string{}
+			}
+			if !reflect.DeepEqual(got.principals, wantPrincipals) {
+				t.Errorf("repositoryAccessFromPolicy() principals = %v, want %v", got.principals, wantPrincipals)
+			}
+
+			wantServices := tt.wantServices
+			if wantServices == nil {
+				wantServices = []*RepositoryServiceAccess{}
+			}
+			if !reflect.DeepEqual(got.services, wantServices) {
+				t.Errorf("repositoryAccessFromPolicy() services = %+v, want %+v", got.services, wantServices)
+			}
+
+			if !reflect.DeepEqual(got.statements, tt.wantStatements) {
+				t.Errorf("repositoryAccessFromPolicy() statements = %+v, want %+v", got.statements, tt.wantStatements)
+			}
+		})
+	}
+}
+
+func Test_isRepositoryPolicyStatement(t *testing.T) {
+	tests := []struct {
+		sid  string
+		want bool
+	}{
+		{sid: "AllowPullImagesFromSpaceAndOrg", want: true},
+		{sid: "AllowPullImagesFromPrincipals", want: true},
+		{sid: "AllowPullImagesFromServiceCodebuild", want: true},
+		{sid: "AllowPullImagesFromServiceLambda", want: true},
+		{sid: "AllowPullImagesFromServiceMonitoring", want: false},
+		{sid: "AllowPullImagesFromService", want: false},
+		{sid: "AllowPullImagesFromSpaceAndOrgLegacy", want: false},
+		{sid: "DenyPullOutsideOrganization", want: false},
+		{sid: "", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isRepositoryPolicyStatement(tt.sid); got != tt.want {
+			t.Errorf("isRepositoryPolicyStatement(%q) = %t, want %t", tt.sid, got, tt.want)
+		}
+	}
+}
+
+func Test_repositoryAccess_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		access  repositoryAccess
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "account id", access: repositoryAccess{principals: []string{"012345678901"}}},
+		{name: "root", access: repositoryAccess{principals: []string{"arn:aws:iam::012345678901:root"}}},
+		{name: "role", access: repositoryAccess{principals: []string{"arn:aws:iam::012345678901:role/path/deploy"}}},
+		{name: "user", access: repositoryAccess{principals: []string{"arn:aws:iam::012345678901:user/ci"}}},
+		{name: "short account id", access: repositoryAccess{principals: []string{"12345"}}, wantErr: true},
+		{name: "wildcard", access: repositoryAccess{principals: []string{"*"}}, wantErr: true},
+		{name: "policy arn", access: repositoryAccess{principals: []string{"arn:aws:iam::012345678901:policy/foo"}}, wantErr: true},
+		{
+			name: "services",
+			access: repositoryAccess{services: []*RepositoryServiceAccess{
+				{Service: "lambda", SourceArns: []string{"arn:aws:lambda:us-east-1:012345678901:function:*"}},
+				{Service: "codebuild", SourceAccounts: []string{"012345678901"}},
+			}},
+		},
+		{
+			name:    "unknown service",
+			access:  repositoryAccess{services: []*RepositoryServiceAccess{{Service: "ec2", SourceAccounts: []string{"012345678901"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "unlimited service",
+			access:  repositoryAccess{services: []*RepositoryServiceAccess{{Service: "lambda"}}},
+			wantErr: true,
+		},
+		{
+			name: "duplicate service",
+			access: repositoryAccess{services: []*RepositoryServiceAccess{
+				{Service: "lambda", SourceAccounts: []string{"012345678901"}},
+				{Service: "lambda", SourceAccounts: []string{"109876543210"}},
+			}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid source account",
+			access:  repositoryAccess{services: []*RepositoryServiceAccess{{Service: "lambda", SourceAccounts: []string{"prod"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid source arn",
+			access:  repositoryAccess{services: []*RepositoryServiceAccess{{Service: "lambda", SourceArns: []string{"function:*"}}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.access.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
@@ -274,7 +462,7 @@ func Test_server_repositoryDeletePolicy(t *testing.T) {
 			fields: fields{
 				org: "testOrg",
 			},
-			want: `{"Version":"2012-10-17","Statement":[{"Sid":"DeleteRepositoryUser","Effect":"Allow","Action":["iam:DeleteAccessKey","iam:RemoveUserFromGroup","iam:ListAccessKeys","iam:ListGroupsForUser","iam:DeleteUser","iam:GetUser","iam:ListUsers"],"Resource":["arn:aws:iam::*:user/spinup/testOrg/*","arn:aws:iam::*:group/spinup/testOrg/SpinupECRAdminGroup-testOrg"]},{"Effect":"Allow","Action":["*"],"Resource":["*"],"Condition":{"StringEquals":{"aws:ResourceTag/spinup:org":[""]}}}]}`,
+			want: `{"Version":"2012-10-17","Statement":[{"Sid":"DeleteRepositoryUser","Effect":"Allow","Action":["iam:DeleteAccessKey","iam:RemoveUserFromGroup","iam:ListAccessKeys","iam:ListGroupsForUser","iam:DeleteUser","iam:GetUser","iam:ListUsers"],"Resource":["arn:aws:iam::*:user/spinup/testOrg/*","arn:aws:iam::*:group/spinup/testOrg/SpinupECRAdminGroup-testOrg","arn:aws:iam::*:group/spinup/testOrg/SpinupECRSpaceAdminGroup-testOrg","arn:aws:iam::*:group/spinup/testOrg/SpinupECRPullGroup-testOrg","arn:aws:iam::*:group/spinup/testOrg/SpinupECRSpacePullGroup-testOrg","arn:aws:iam::*:group/spinup/testOrg/SpinupECRPushGroup-testOrg","arn:aws:iam::*:group/spinup/testOrg/SpinupECRSpacePushGroup-testOrg"]},{"Effect":"Allow","Action":["*"],"Resource":["*"],"Condition":{"StringEquals":{"aws:ResourceTag/spinup:org":[""]}}}]}`,
 		},
 	}
 	for _, tt := range tests {
@@ -293,3 +481,72 @@ func Test_server_repositoryDeletePolicy(t *testing.T) {
 		})
 	}
 }
+
+func Test_registryScanningPolicy(t *testing.T) {
+	want := `{"Version":"2012-10-17","Statement":[{"Sid":"ManageRegistryScanningConfiguration","Effect":"Allow","Action":["ecr:GetRegistryScanningConfiguration","ecr:PutRegistryScanningConfiguration","inspector2:Enable","inspector2:Disable","inspector2:BatchGetAccountStatus","inspector2:ListAccountPermissions"],"Resource":["*"]},{"Sid":"CreateInspectorServiceLinkedRole","Effect":"Allow","Action":["iam:CreateServiceLinkedRole"],"Resource":["*"],"Condition":{"StringEquals":{"iam:AWSServiceName":["inspector2.amazonaws.com"]}}}]}`
+
+	got, err := registryScanningPolicy()
+	if err != nil {
+		t.Fatalf("registryScanningPolicy() unexpected error = %v", err)
+	}
+
+	if got != want {
+		t.Errorf("registryScanningPolicy() = %v, want %v", got, want)
+	}
+}
+
+func Test_registryScanningReadPolicy(t *testing.T) {
+	want := `{"Version":"2012-10-17","Statement":[{"Sid":"ReadRegistryScanningConfiguration","Effect":"Allow","Action":["ecr:GetRegistryScanningConfiguration"],"Resource":["*"]}]}`
+
+	got, err := registryScanningReadPolicy()
+	if err != nil {
+		t.Fatalf("registryScanningReadPolicy() unexpected error = %v", err)
+	}
+
+	if got != want {
+		t.Errorf("registryScanningReadPolicy() = %v, want %v", got, want)
+	}
+}
+
+func Test_server_repositoryTokenPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		access  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "pull",
+			access: "pull",
+			want:   `{"Version":"2012-10-17","Statement":[{"Sid":"AllowRepositoryToken","Effect":"Allow","Action":["ecr:DescribeRepositories","ecr:DescribeImageScanFindings","ecr:GetDownloadUrlForLayer","ecr:ListImages","ecr:BatchGetImage","ecr:DescribeImages","ecr:BatchCheckLayerAvailability"],"Resource":["arn:aws:ecr:*:12345:repository/spindev-00001/rudolph"],"Condition":{"StringEquals":{"aws:ResourceTag/spinup:org":["testOrg"]}}},{"Sid":"AllowDockerLogin","Effect":"Allow","Action":["ecr:GetAuthorizationToken"],"Resource":["*"]}]}`,
+		},
+		{
+			name:   "push",
+			access: "push",
+			want:   `{"Version":"2012-10-17","Statement":[{"Sid":"AllowRepositoryToken","Effect":"Allow","Action":["ecr:DescribeRepositories","ecr:DescribeImageScanFindings","ecr:GetDownloadUrlForLayer","ecr:UploadLayerPart","ecr:ListImages","ecr:PutImage","ecr:BatchGetImage","ecr:CompleteLayerUpload","ecr:DescribeImages","ecr:InitiateLayerUpload","ecr:BatchCheckLayerAvailability"],"Resource":["arn:aws:ecr:*:12345:repository/spindev-00001/rudolph"],"Condition":{"StringEquals":{"aws:ResourceTag/spinup:org":["testOrg"]}}},{"Sid":"AllowDockerLogin","Effect":"Allow","Action":["ecr:GetAuthorizationToken"],"Resource":["*"]}]}`,
+		},
+		{
+			name:    "admin",
+			access:  "admin",
+			wantErr: true,
+		},
+		{
+			name:    "unknown",
+			access:  "delete",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &server{org: "testOrg"}
+			got, err := s.repositoryTokenPolicy("12345", "spindev-00001/rudolph", tt.access)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("server.repositoryTokenPolicy() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("server.repositoryTokenPolicy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
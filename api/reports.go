@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/YaleSpinup/ecr-api/store"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// reportsBucket is the store bucket for the reports generated in the background
+const reportsBucket = "reports"
+
+// report statuses
+const (
+	reportRunning   = "running"
+	reportCompleted = "completed"
+	reportFailed    = "failed"
+)
+
+// report types
+const (
+	reportRepositoryPolicies = "repositoryPolicies"
+	reportOrphanedUsers      = "orphanedUsers"
+	reportDormantKeys        = "dormantKeys"
+	reportKeyRotation        = "keyRotation"
+)
+
+// reportFunc generates the result of a report
+type reportFunc func(ctx context.Context) (interface{}, error)
+
+// reportKey is the store key of a report
+func reportKey(account, id string) string {
+	return fmt.Sprintf("%s/%s", account, id)
+}
+
+// startReport starts generating a report in the account in the background.  The role is assumed before the
+// report is stored, so the request fails when the account can't be managed.  It returns the new report with
+// its id.
+func (s *server) startReport(ctx context.Context, job *jobSession, reportType string, generate reportFunc) (*Report, error) {
+	if _, err := job.get(ctx); err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Id:        uuid.New().String(),
+		Account:   job.account,
+		Type:      reportType,
+		Status:    reportRunning,
+		StartedAt: time.Now().UTC(),
+	}
+
+	log.Infof("generating %s report in account %s (%s)", reportType, job.account, report.Id)
+
+	if err := store.PutJSON(ctx, s.store, reportsBucket, reportKey(report.Account, report.Id), report); err != nil {
+		return nil, err
+	}
+
+	// the report outlives the request, it's only cancelled with the server
+	progress := *report
+	go s.runReport(s.context, &progress, generate)
+
+	return report, nil
+}
+
+// runReport generates the result of the report and stores it, or the error if it fails
+func (s *server) runReport(ctx context.Context, report *Report, generate reportFunc) {
+	result, err := generate(ctx)
+	if err == nil {
+		report.Result, err = json.Marshal(result)
+	}
+
+	now := time.Now().UTC()
+	report.CompletedAt = &now
+
+	if err != nil {
+		log.Errorf("failed to generate %s report in account %s (%s): %s", report.Type, report.Account, report.Id, err)
+
+		report.Status = reportFailed
+		report.Error = err.Error()
+		report.Result = nil
+	} else {
+		report.Status = reportCompleted
+	}
+
+	if err := store.PutJSON(ctx, s.store, reportsBucket, reportKey(report.Account, report.Id), report); err != nil {
+		log.Errorf("failed to save %s report %s: %s", report.Type, report.Id, err)
+	}
+}
+
+// getReport gets a report by id
+func (s *server) getReport(ctx context.Context, account, id string) (*Report, error) {
+	report := &Report{}
+	if err := store.GetJSON(ctx, s.store, reportsBucket, reportKey(account, id), report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+)
+
+func TestServer_runReport(t *testing.T) {
+	ctx := context.Background()
+	st := newSoftDeleteTest(t)
+
+	// the users of the deleted repository are orphaned
+	delete(st.ecrClient.repos, "spindev-00001/rudolph")
+
+	report := &Report{
+		Id:        "orphaned",
+		Account:   "12345",
+		Type:      reportOrphanedUsers,
+		Status:    reportRunning,
+		StartedAt: time.Now().UTC(),
+	}
+
+	st.server.runReport(ctx, report, func(ctx context.Context) (interface{}, error) {
+		return st.server.sweepOrphanedUsers(ctx, st.orchestrators, "12345", true)
+	})
+
+	got, err := st.server.getReport(ctx, "12345", "orphaned")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got.Status != reportCompleted || got.Type != reportOrphanedUsers || got.Error != "" || got.CompletedAt == nil {
+		t.Errorf("unexpected completed report %+v", got)
+	}
+
+	result := &OrphanedUsersReport{}
+	if err := json.Unmarshal(got.Result, result); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !result.DryRun || len(result.Users) != 2 {
+		t.Errorf("expected the 2 orphaned users in the result, got %+v", result)
+	}
+
+	if _, ok := st.iamClient.users["rudolph-dasher"]; !ok {
+		t.Error("expected the orphaned users to be kept in a dry run")
+	}
+
+	report = &Report{
+		Id:        "dormant",
+		Account:   "12345",
+		Type:      reportDormantKeys,
+		Status:    reportRunning,
+		StartedAt: time.Now().UTC(),
+	}
+
+	st.server.runReport(ctx, report, func(ctx context.Context) (interface{}, error) {
+		return st.server.dormantAccessKeysReport(ctx, func(ctx context.Context) (*ecrOrchestrator, *iamOrchestrator, error) {
+			return nil, nil, apierror.New(apierror.ErrForbidden, "failed to assume role in account: 12345", nil)
+		}, "12345", 90)
+	})
+
+	got, err = st.server.getReport(ctx, "12345", "dormant")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got.Status != reportFailed || got.Error == "" || got.Result != nil || got.CompletedAt == nil {
+		t.Errorf("unexpected failed report %+v", got)
+	}
+
+	if _, err := st.server.getReport(ctx, "12345", "missing"); err == nil {
+		t.Error("expected an error for a missing report")
+	}
+}
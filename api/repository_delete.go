@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/ecr-api/ecr"
+	"github.com/YaleSpinup/ecr-api/iam"
+	"github.com/aws/aws-sdk-go/aws"
+	log "github.com/sirupsen/logrus"
+)
+
+// repositoryDeleteOrchestrators assumes the role in the account with the inline policy and returns the ecr and
+// iam orchestrators for deleting repositories
+func (s *server) repositoryDeleteOrchestrators(ctx context.Context, account, policy string) (*ecrOrchestrator, *iamOrchestrator, error) {
+	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
+
+	session, err := s.assumeRole(
+		ctx,
+		s.session.ExternalID,
+		role,
+		policy,
+		"arn:aws:iam::aws:policy/AmazonEC2ContainerRegistryFullAccess",
+	)
+	if err != nil {
+		msg := fmt.Sprintf("failed to assume role in account: %s", account)
+		return nil, nil, apierror.New(apierror.ErrForbidden, msg, nil)
+	}
+
+	ecrOrch := newEcrOrchestrator(
+		ecr.New(ecr.WithSession(session.Session)),
+		s.org,
+	)
+
+	iamOrch := newIamOrchestrator(
+		iam.New(iam.WithSession(session.Session)),
+		s.org,
+	)
+
+	return ecrOrch, iamOrch, nil
+}
+
+// deleteRepository deletes a repository and its users in the account
+func (s *server) deleteRepository(ctx context.Context, account, group, name string) (*RepositoryResponse, []string, error) {
+	policy, err := s.repositoryDeletePolicy(s.org)
+	if err != nil {
+		return nil, nil, apierror.New(apierror.ErrInternalError, "failed to generate policy", err)
+	}
+
+	ecrOrch, iamOrch, err := s.repositoryDeleteOrchestrators(ctx, account, policy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return s.deleteRepositoryWithOrchestrators(ctx, ecrOrch, iamOrch, account, group, name)
+}
+
+// deleteRepositoryWithOrchestrators deletes a repository and its users and notifies the space
+func (s *server) deleteRepositoryWithOrchestrators(ctx context.Context, ecrOrch *ecrOrchestrator, iamOrch *iamOrchestrator, account, group, name string) (*RepositoryResponse, []string, error) {
+	resp, err := ecrOrch.repositoryDelete(ctx, account, group, name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	users, err := iamOrch.repositoryUserDeleteAll(ctx, name, group)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.store.Delete(ctx, repositoryDeletionsBucket, repositoryDeletionKey(account, group, name)); err != nil {
+		log.Errorf("failed to remove soft delete state for repository %s: %s", resp.RepositoryName, err)
+	}
+
+	s.notify(ctx, notificationRepositoryDeleted, account, group, &RepositoryNotification{
+		Repository: resp.RepositoryName,
+		Users:      users,
+	})
+
+	return resp, users, nil
+}
+
+// repositoryDeleteSummary summarizes the images of a repository that would be destroyed by deleting it
+func (o *ecrOrchestrator) repositoryDeleteSummary(ctx context.Context, group, name string) (*RepositoryDeleteSummary, error) {
+	repository := fmt.Sprintf("%s/%s", group, name)
+
+	images, err := o.client.GetImages(ctx, repository)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &RepositoryDeleteSummary{
+		Repository: repository,
+		ImageCount: len(images),
+		Users:      []string{},
+	}
+
+	for _, i := range images {
+		summary.TotalSizeInBytes += aws.Int64Value(i.ImageSizeInBytes)
+
+		if i.ImagePushedAt == nil {
+			continue
+		}
+
+		if summary.LastPushedAt == nil || i.ImagePushedAt.After(*summary.LastPushedAt) {
+			summary.LastPushedAt = i.ImagePushedAt
+		}
+	}
+
+	return summary, nil
+}
+
+// repositoryDeleteSummary summarizes the images and users that would be destroyed by deleting the repository
+func (s *server) repositoryDeleteSummary(ctx context.Context, account, group, name string) (*RepositoryDeleteSummary, error) {
+	policy, err := s.repositoryDeletePolicy(s.org)
+	if err != nil {
+		return nil, apierror.New(apierror.ErrInternalError, "failed to generate policy", err)
+	}
+
+	ecrOrch, iamOrch, err := s.repositoryDeleteOrchestrators(ctx, account, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	return repositoryDeleteSummaryWithOrchestrators(ctx, ecrOrch, iamOrch, group, name)
+}
+
+// repositoryDeleteSummaryWithOrchestrators summarizes the images and users of the repository
+func repositoryDeleteSummaryWithOrchestrators(ctx context.Context, ecrOrch *ecrOrchestrator, iamOrch *iamOrchestrator, group, name string) (*RepositoryDeleteSummary, error) {
+	summary, err := ecrOrch.repositoryDeleteSummary(ctx, group, name)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := iamOrch.listRepositoryUsers(ctx, group, name)
+	if err != nil {
+		return nil, err
+	}
+	summary.Users = users
+
+	return summary, nil
+}
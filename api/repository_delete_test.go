@@ -0,0 +1,54 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRepositoryDeleteSummaryWithOrchestrators(t *testing.T) {
+	ctx := context.Background()
+	st := newSoftDeleteTest(t)
+
+	summary, err := repositoryDeleteSummaryWithOrchestrators(ctx, st.ecrOrch, st.iamOrch, "spindev-00001", "rudolph")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if summary.empty() || summary.ImageCount != 0 || summary.LastPushedAt != nil || len(summary.Users) != 2 {
+		t.Errorf("expected a summary with only users, got %+v", summary)
+	}
+
+	older := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	newer := time.Now().Add(-time.Hour).Truncate(time.Second)
+	st.ecrClient.addImage("spindev-00001/rudolph", "v1", "sha256:1111", 1000, older)
+	st.ecrClient.addImage("spindev-00001/rudolph", "v2", "sha256:2222", 2500, newer)
+
+	summary, err = repositoryDeleteSummaryWithOrchestrators(ctx, st.ecrOrch, st.iamOrch, "spindev-00001", "rudolph")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if summary.Repository != "spindev-00001/rudolph" || summary.ImageCount != 2 || summary.TotalSizeInBytes != 3500 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+
+	if summary.LastPushedAt == nil || !summary.LastPushedAt.Equal(newer) {
+		t.Errorf("expected the last push at %s, got %v", newer, summary.LastPushedAt)
+	}
+
+	st.ecrClient.addRepository("spindev-00001/blitzen", "")
+
+	summary, err = repositoryDeleteSummaryWithOrchestrators(ctx, st.ecrOrch, st.iamOrch, "spindev-00001", "blitzen")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !summary.empty() {
+		t.Errorf("expected an empty summary, got %+v", summary)
+	}
+
+	if _, err := repositoryDeleteSummaryWithOrchestrators(ctx, st.ecrOrch, st.iamOrch, "spindev-00001", "missing"); err == nil {
+		t.Error("expected an error for a missing repository")
+	}
+}
@@ -0,0 +1,264 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/ecr-api/resourcegroupstaggingapi"
+	"github.com/YaleSpinup/ecr-api/store"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// repositoryGroupDeletesBucket is the store bucket for the deletes of all of the repositories in a group
+const repositoryGroupDeletesBucket = "repository_group_deletes"
+
+// repository group delete statuses
+const (
+	repositoryGroupDeleteRunning   = "running"
+	repositoryGroupDeleteCompleted = "completed"
+	repositoryGroupDeleteFailed    = "failed"
+)
+
+// repositoryGroupDeleteKey is the store key of a group delete
+func repositoryGroupDeleteKey(account, id string) string {
+	return fmt.Sprintf("%s/%s", account, id)
+}
+
+// groupRepositories returns the names of the repositories in the org tagged with the group
+func (s *server) groupRepositories(ctx context.Context, service resourcegroupstaggingapi.ResourceGroupsTaggingAPI, group string) ([]string, error) {
+	// build up tag filters starting with the org
+	tagFilters := []*resourcegroupstaggingapi.TagFilter{
+		{
+			Key:   "spinup:org",
+			Value: []string{s.org},
+		},
+		{
+			Key:   "spinup:spaceid",
+			Value: []string{group},
+		},
+	}
+
+	out, err := service.GetResourcesWithTags(ctx, []string{"ecr"}, tagFilters)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("got output from resourcegroups tagging api %s", awsutil.Prettify(out))
+
+	repos := make([]string, 0, len(out))
+	for _, repo := range out {
+		a, err := arn.Parse(aws.StringValue(repo.ResourceARN))
+		if err != nil {
+			msg := fmt.Sprintf("failed to parse ARN %s: %s", aws.StringValue(repo.ResourceARN), err)
+			return nil, apierror.New(apierror.ErrInternalError, msg, err)
+		}
+
+		prefix := fmt.Sprintf("repository/%s/", group)
+		rid := strings.TrimPrefix(a.Resource, prefix)
+		repos = append(repos, rid)
+	}
+
+	return repos, nil
+}
+
+// startGroupRepositoriesDelete starts deleting all of the repositories in a group and the group-wide users in
+// the background, or reporting what would be deleted for a dry run.  The role is assumed before the delete is
+// stored, so the request fails when the account can't be managed.  It returns the new delete with its id.
+func (s *server) startGroupRepositoriesDelete(ctx context.Context, account, group string, dryRun bool) (*RepositoryGroupDeleteReport, error) {
+	var policy string
+	var err error
+	if s.softDelete != nil {
+		policy, err = s.repositorySoftDeletePolicy(s.org)
+	} else {
+		policy, err = s.repositoryDeletePolicy(s.org)
+	}
+
+	if err != nil {
+		return nil, apierror.New(apierror.ErrInternalError, "failed to generate policy", err)
+	}
+
+	job := s.newJobSession(account, policy, "arn:aws:iam::aws:policy/AmazonEC2ContainerRegistryFullAccess")
+	if _, err := job.get(ctx); err != nil {
+		return nil, err
+	}
+
+	listJob := s.newTaggedResourcesJobSession(account)
+	if _, err := listJob.get(ctx); err != nil {
+		return nil, err
+	}
+
+	report := &RepositoryGroupDeleteReport{
+		Id:           uuid.New().String(),
+		Account:      account,
+		Group:        group,
+		DryRun:       dryRun,
+		Status:       repositoryGroupDeleteRunning,
+		StartedAt:    time.Now().UTC(),
+		Repositories: []*RepositoryGroupDeleteResult{},
+		Users:        []*RepositoryGroupDeleteUserResult{},
+	}
+
+	log.Infof("deleting repositories in group %s in account %s (%s, dry run: %t)", group, account, report.Id, dryRun)
+
+	if err := store.PutJSON(ctx, s.store, repositoryGroupDeletesBucket, repositoryGroupDeleteKey(account, report.Id), report); err != nil {
+		return nil, err
+	}
+
+	// the delete outlives the request, it's only cancelled with the server
+	progress := *report
+	go s.deleteGroupRepositories(s.context, job, listJob, &progress)
+
+	return report, nil
+}
+
+// deleteGroupRepositories finds the repositories tagged with the group with the list job session and deletes them
+// with the job session
+func (s *server) deleteGroupRepositories(ctx context.Context, job, listJob *jobSession, report *RepositoryGroupDeleteReport) {
+	session, err := listJob.get(ctx)
+	if err != nil {
+		s.failGroupRepositoriesDelete(ctx, report, err)
+		return
+	}
+
+	repos, err := s.groupRepositories(ctx, resourcegroupstaggingapi.New(resourcegroupstaggingapi.WithSession(session.Session)), report.Group)
+	if err != nil {
+		s.failGroupRepositoriesDelete(ctx, report, err)
+		return
+	}
+
+	s.deleteGroupRepositoriesWithOrchestrators(ctx, job.orchestrators, report, repos)
+}
+
+// deleteGroupRepositoriesWithOrchestrators deletes each of the repositories in the group with the same logic as
+// deleting a single repository, and then the group-wide users.  A failure to delete one repository or user doesn't
+// stop the others from being deleted.  The progress is stored after each repository.
+func (s *server) deleteGroupRepositoriesWithOrchestrators(ctx context.Context, orchestrators orchestratorsFunc, report *RepositoryGroupDeleteReport, repos []string) {
+	group := report.Group
+
+	log.Infof("deleting %d repositories in group %s (dry run: %t)", len(repos), group, report.DryRun)
+
+	for _, name := range repos {
+		result := &RepositoryGroupDeleteResult{
+			Repository: fmt.Sprintf("%s/%s", group, name),
+			Users:      []string{},
+		}
+		report.Repositories = append(report.Repositories, result)
+
+		if err := s.deleteGroupRepository(ctx, orchestrators, report.Account, group, name, report.DryRun, result); err != nil {
+			log.Errorf("failed to delete repository %s: %s", result.Repository, err)
+			result.Error = err.Error()
+		}
+
+		s.saveGroupRepositoriesDelete(ctx, report)
+	}
+
+	_, iamOrch, err := orchestrators(ctx)
+	if err != nil {
+		s.failGroupRepositoriesDelete(ctx, report, err)
+		return
+	}
+
+	users, err := iamOrch.listRepositoryUsers(ctx, group, "")
+	if err != nil {
+		s.failGroupRepositoriesDelete(ctx, report, err)
+		return
+	}
+
+	for _, u := range users {
+		result := &RepositoryGroupDeleteUserResult{UserName: u}
+		report.Users = append(report.Users, result)
+
+		if report.DryRun {
+			continue
+		}
+
+		if err := iamOrch.repositoryUserDelete(ctx, "", group, u); err != nil {
+			log.Errorf("failed to delete group %s user %s: %s", group, u, err)
+			result.Error = err.Error()
+			continue
+		}
+		result.Deleted = true
+
+		s.notify(ctx, notificationUserDeleted, report.Account, group, &UserNotification{
+			Repository: repositoryUserResource(group, ""),
+			UserName:   u,
+		})
+	}
+
+	now := time.Now().UTC()
+	report.Status = repositoryGroupDeleteCompleted
+	report.CompletedAt = &now
+
+	s.saveGroupRepositoriesDelete(ctx, report)
+}
+
+// deleteGroupRepository summarizes one of the repositories in the group into the result and deletes it,
+// unless it's a dry run
+func (s *server) deleteGroupRepository(ctx context.Context, orchestrators orchestratorsFunc, account, group, name string, dryRun bool, result *RepositoryGroupDeleteResult) error {
+	ecrOrch, iamOrch, err := orchestrators(ctx)
+	if err != nil {
+		return err
+	}
+
+	summary, err := repositoryDeleteSummaryWithOrchestrators(ctx, ecrOrch, iamOrch, group, name)
+	if err != nil {
+		return err
+	}
+	result.ImageCount = summary.ImageCount
+	result.Users = summary.Users
+
+	if dryRun {
+		return nil
+	}
+
+	var resp *RepositoryResponse
+	if s.softDelete != nil {
+		resp, _, err = s.softDeleteRepositoryWithOrchestrators(ctx, ecrOrch, iamOrch, account, group, name)
+	} else {
+		resp, _, err = s.deleteRepositoryWithOrchestrators(ctx, ecrOrch, iamOrch, account, group, name)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	result.Deleted = true
+	result.DeleteAt = resp.DeleteAt
+
+	return nil
+}
+
+// failGroupRepositoriesDelete stores the error of a group delete that couldn't run to the end
+func (s *server) failGroupRepositoriesDelete(ctx context.Context, report *RepositoryGroupDeleteReport, err error) {
+	log.Errorf("failed to delete repositories in group %s (%s): %s", report.Group, report.Id, err)
+
+	now := time.Now().UTC()
+	report.Status = repositoryGroupDeleteFailed
+	report.Error = err.Error()
+	report.CompletedAt = &now
+
+	s.saveGroupRepositoriesDelete(ctx, report)
+}
+
+// saveGroupRepositoriesDelete stores the progress of a group delete
+func (s *server) saveGroupRepositoriesDelete(ctx context.Context, report *RepositoryGroupDeleteReport) {
+	if err := store.PutJSON(ctx, s.store, repositoryGroupDeletesBucket, repositoryGroupDeleteKey(report.Account, report.Id), report); err != nil {
+		log.Errorf("failed to save repository group delete %s: %s", report.Id, err)
+	}
+}
+
+// getGroupRepositoriesDelete gets a group delete by id
+func (s *server) getGroupRepositoriesDelete(ctx context.Context, account, id string) (*RepositoryGroupDeleteReport, error) {
+	report := &RepositoryGroupDeleteReport{}
+	if err := store.GetJSON(ctx, s.store, repositoryGroupDeletesBucket, repositoryGroupDeleteKey(account, id), report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
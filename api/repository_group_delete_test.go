@@ -0,0 +1,252 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/ecr-api/resourcegroupstaggingapi"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	awstagging "github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi"
+	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi/resourcegroupstaggingapiiface"
+)
+
+// fakeTagging returns the resources when the tag filters are for the org and group, with their tags by ARN
+type fakeTagging struct {
+	resourcegroupstaggingapiiface.ResourceGroupsTaggingAPIAPI
+	org       string
+	group     string
+	resources []string
+	tags      map[string][]*awstagging.Tag
+}
+
+func (f *fakeTagging) GetResourcesWithContext(ctx aws.Context, input *awstagging.GetResourcesInput, opts ...request.Option) (*awstagging.GetResourcesOutput, error) {
+	out := &awstagging.GetResourcesOutput{ResourceTagMappingList: []*awstagging.ResourceTagMapping{}}
+
+	for _, filter := range input.TagFilters {
+		if len(filter.Values) == 0 {
+			continue
+		}
+
+		key, value := aws.StringValue(filter.Key), aws.StringValue(filter.Values[0])
+		if (key == "spinup:org" && value != f.org) || (key == "spinup:spaceid" && value != f.group) {
+			return out, nil
+		}
+	}
+
+	for _, r := range f.resources {
+		out.ResourceTagMappingList = append(out.ResourceTagMappingList, &awstagging.ResourceTagMapping{
+			ResourceARN: aws.String(r),
+			Tags:        f.tags[r],
+		})
+	}
+
+	return out, nil
+}
+
+func TestServer_groupRepositories(t *testing.T) {
+	s := &server{org: "testOrg"}
+	service := resourcegroupstaggingapi.ResourceGroupsTaggingAPI{
+		Service: &fakeTagging{
+			org:   "testOrg",
+			group: "spindev-00001",
+			resources: []string{
+				"arn:aws:ecr:us-east-1:12345:repository/spindev-00001/rudolph",
+				"arn:aws:ecr:us-east-1:12345:repository/spindev-00001/blitzen",
+			},
+		},
+	}
+
+	repos, err := s.groupRepositories(context.Background(), service, "spindev-00001")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(repos) != 2 || repos[0] != "rudolph" || repos[1] != "blitzen" {
+		t.Errorf("expected [rudolph blitzen], got %v", repos)
+	}
+
+	repos, err = s.groupRepositories(context.Background(), service, "spindev-00002")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(repos) != 0 {
+		t.Errorf("expected no repositories, got %v", repos)
+	}
+
+	service.Service = &fakeTagging{org: "testOrg", group: "spindev-00001", resources: []string{"not-an-arn"}}
+	if _, err := s.groupRepositories(context.Background(), service, "spindev-00001"); err == nil {
+		t.Error("expected an error for an invalid ARN")
+	}
+}
+
+// newGroupDeleteTest stores a new delete of the repositories in the spindev-00001 group
+func newGroupDeleteTest(st *softDeleteTest, dryRun bool) *RepositoryGroupDeleteReport {
+	report := &RepositoryGroupDeleteReport{
+		Id:           fmt.Sprintf("delete-%t", dryRun),
+		Account:      "12345",
+		Group:        "spindev-00001",
+		DryRun:       dryRun,
+		Status:       repositoryGroupDeleteRunning,
+		StartedAt:    time.Now().UTC(),
+		Repositories: []*RepositoryGroupDeleteResult{},
+		Users:        []*RepositoryGroupDeleteUserResult{},
+	}
+	st.server.saveGroupRepositoriesDelete(context.Background(), report)
+
+	return report
+}
+
+func TestServer_deleteGroupRepositories(t *testing.T) {
+	ctx := context.Background()
+	st := newSoftDeleteTest(t)
+	st.server.softDelete = nil
+
+	st.ecrClient.addImage("spindev-00001/rudolph", "v1", "sha256:1111", 1000, time.Now().Add(-time.Hour))
+	st.ecrClient.addRepository("spindev-00001/blitzen", "")
+
+	groups, err := st.iamOrch.prepareAccountForGroupUsers(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := st.iamOrch.repositoryUserCreate(ctx, "", "spindev-00001", groups["push"], &RepositoryUserCreateRequest{UserName: "ci", Role: "push"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	repos := []string{"rudolph", "blitzen", "missing"}
+
+	report := newGroupDeleteTest(st, true)
+	st.server.deleteGroupRepositoriesWithOrchestrators(ctx, st.orchestrators, report, repos)
+	if !report.DryRun || report.Status != repositoryGroupDeleteCompleted || len(report.Repositories) != 3 {
+		t.Fatalf("unexpected dry run report %+v", report)
+	}
+
+	if r := report.Repositories[0]; r.Deleted || r.ImageCount != 1 || len(r.Users) != 2 {
+		t.Errorf("unexpected dry run result %+v", r)
+	}
+
+	if len(report.Users) != 1 || report.Users[0].UserName != "ci" || report.Users[0].Deleted {
+		t.Errorf("expected the group-wide user to be reported, got %+v", report.Users)
+	}
+
+	if len(st.ecrClient.repos) != 2 || len(st.notifier.notifications) != 0 {
+		t.Error("expected nothing to be deleted in a dry run")
+	}
+
+	if _, ok := st.iamClient.users["spindev-00001-ci"]; !ok {
+		t.Error("expected the group-wide user to be kept in a dry run")
+	}
+
+	report = newGroupDeleteTest(st, false)
+	st.server.deleteGroupRepositoriesWithOrchestrators(ctx, st.orchestrators, report, repos)
+
+	for _, r := range report.Repositories[:2] {
+		if !r.Deleted || r.Error != "" || r.DeleteAt != nil {
+			t.Errorf("expected %s to be deleted, got %+v", r.Repository, r)
+		}
+	}
+
+	if r := report.Repositories[2]; r.Deleted || r.Error == "" {
+		t.Errorf("expected the missing repository to fail, got %+v", r)
+	}
+
+	if len(st.ecrClient.repos) != 0 {
+		t.Errorf("expected the repositories to be deleted, got %d", len(st.ecrClient.repos))
+	}
+
+	users, err := st.iamOrch.listRepositoryUsers(ctx, "spindev-00001", "rudolph")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(users) != 0 {
+		t.Errorf("expected the users to be deleted, got %v", users)
+	}
+
+	if len(report.Users) != 1 || !report.Users[0].Deleted {
+		t.Errorf("expected the group-wide user to be deleted, got %+v", report.Users)
+	}
+
+	if _, ok := st.iamClient.users["spindev-00001-ci"]; ok {
+		t.Error("expected the group-wide user to be deleted")
+	}
+
+	if len(st.notifier.notifications) != 3 {
+		t.Errorf("expected 2 repository and 1 user deleted notifications, got %d", len(st.notifier.notifications))
+	}
+
+	got, err := st.server.getGroupRepositoriesDelete(ctx, "12345", report.Id)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got.Status != repositoryGroupDeleteCompleted || got.CompletedAt == nil || len(got.Repositories) != 3 || len(got.Users) != 1 {
+		t.Errorf("unexpected stored group delete %+v", got)
+	}
+}
+
+func TestServer_deleteGroupRepositoriesFailed(t *testing.T) {
+	ctx := context.Background()
+	st := newSoftDeleteTest(t)
+
+	report := newGroupDeleteTest(st, false)
+	st.server.deleteGroupRepositoriesWithOrchestrators(ctx, func(ctx context.Context) (*ecrOrchestrator, *iamOrchestrator, error) {
+		return nil, nil, apierror.New(apierror.ErrForbidden, "failed to assume role in account: 12345", nil)
+	}, report, []string{"rudolph"})
+
+	if r := report.Repositories[0]; r.Deleted || r.Error == "" {
+		t.Errorf("expected the repository to fail, got %+v", r)
+	}
+
+	got, err := st.server.getGroupRepositoriesDelete(ctx, "12345", report.Id)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got.Status != repositoryGroupDeleteFailed || got.Error == "" || got.CompletedAt == nil {
+		t.Errorf("unexpected failed group delete %+v", got)
+	}
+}
+
+func TestServer_deleteGroupRepositoriesSoftDelete(t *testing.T) {
+	ctx := context.Background()
+	st := newSoftDeleteTest(t)
+
+	report := newGroupDeleteTest(st, false)
+	st.server.deleteGroupRepositoriesWithOrchestrators(ctx, st.orchestrators, report, []string{"rudolph"})
+
+	r := report.Repositories[0]
+	if !r.Deleted || r.DeleteAt == nil {
+		t.Fatalf("expected the repository to be pending deletion, got %+v", r)
+	}
+
+	if _, ok := st.ecrClient.repos["spindev-00001/rudolph"]; !ok {
+		t.Error("expected the soft deleted repository to be kept until the grace period ends")
+	}
+
+	if st.keyStatus("rudolph-dasher") != "Inactive" {
+		t.Error("expected the user keys to be disabled")
+	}
+}
+
+func TestServer_newTaggedResourcesJobSession(t *testing.T) {
+	st := newSoftDeleteTest(t)
+
+	job := st.server.newTaggedResourcesJobSession("12345")
+
+	// the org policy conditions on resource tags would deny tag:GetResources
+	if job.policy != "" {
+		t.Errorf("expected no inline policy for listing the repositories, got %s", job.policy)
+	}
+
+	want := []string{"arn:aws:iam::aws:policy/ResourceGroupsandTagEditorReadOnlyAccess"}
+	if job.account != "12345" || !reflect.DeepEqual(job.policyArns, want) {
+		t.Errorf("expected the tag editor read only policy in account 12345, got %s %v", job.account, job.policyArns)
+	}
+}
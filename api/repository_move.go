@@ -0,0 +1,539 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/ecr-api/store"
+	"github.com/aws/aws-sdk-go/aws"
+	awsecr "github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// repositoryMovesBucket is the store bucket for repository moves
+const repositoryMovesBucket = "repository_moves"
+
+// repository move statuses
+const (
+	repositoryMoveRunning   = "running"
+	repositoryMoveCompleted = "completed"
+	repositoryMoveFailed    = "failed"
+)
+
+// repository move steps
+const (
+	repositoryMoveStepCreate = "create"
+	repositoryMoveStepImages = "images"
+	repositoryMoveStepUsers  = "users"
+	repositoryMoveStepDelete = "delete"
+)
+
+// repositoryMoveKey is the store key of a repository move
+func repositoryMoveKey(account, id string) string {
+	return fmt.Sprintf("%s/%s", account, id)
+}
+
+// repositoryCopyRequest returns the request to create a copy of the repository with the same settings, access
+// and tags.  The policy statements not managed by the api are copied as they are.  Repositories pending deletion
+// can't be copied.
+func (o *ecrOrchestrator) repositoryCopyRequest(ctx context.Context, group, name string) (*RepositoryCreateRequest, error) {
+	repository := fmt.Sprintf("%s/%s", group, name)
+
+	repo, err := o.client.GetRepositories(ctx, repository)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := o.client.GetRepositoryTags(ctx, aws.StringValue(repo.RepositoryArn))
+	if err != nil {
+		return nil, err
+	}
+
+	if at := repositoryDeleteAt(tags); at != nil {
+		msg := fmt.Sprintf("repository %s is pending deletion at %s", repository, at.Format(time.RFC3339))
+		return nil, apierror.New(apierror.ErrConflict, msg, nil)
+	}
+
+	policy, err := o.client.GetRepositoryPolicy(ctx, repository)
+	if err != nil {
+		return nil, err
+	}
+
+	access, err := repositoryAccessFromPolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &RepositoryCreateRequest{
+		Groups:            access.groups,
+		AllowedPrincipals: access.principals,
+		AllowedServices:   access.services,
+		Tags:              fromECRTags(tags),
+		statements:        access.statements,
+	}
+
+	if repo.ImageScanningConfiguration != nil {
+		req.ScanOnPush = strconv.FormatBool(aws.BoolValue(repo.ImageScanningConfiguration.ScanOnPush))
+	}
+
+	if repo.EncryptionConfiguration != nil && aws.StringValue(repo.EncryptionConfiguration.EncryptionType) == awsecr.EncryptionTypeKms {
+		req.KmsKeyId = aws.StringValue(repo.EncryptionConfiguration.KmsKey)
+	}
+
+	return req, nil
+}
+
+// repositoryImagesToCopy returns an image identifier for each tag of the images in the repository, or the
+// digest for untagged images.  The oldest images are first so the newest are pushed last.
+func (o *ecrOrchestrator) repositoryImagesToCopy(ctx context.Context, repository string) ([]*awsecr.ImageIdentifier, error) {
+	images, err := o.client.GetImages(ctx, repository)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(images, func(i, j int) bool {
+		return aws.TimeValue(images[i].ImagePushedAt).Before(aws.TimeValue(images[j].ImagePushedAt))
+	})
+
+	ids := []*awsecr.ImageIdentifier{}
+	for _, i := range images {
+		if len(i.ImageTags) == 0 {
+			ids = append(ids, &awsecr.ImageIdentifier{ImageDigest: i.ImageDigest})
+			continue
+		}
+
+		for _, t := range i.ImageTags {
+			ids = append(ids, &awsecr.ImageIdentifier{ImageDigest: i.ImageDigest, ImageTag: t})
+		}
+	}
+
+	return ids, nil
+}
+
+// blobs returns the unique digests of the config and layers stored in the registry, foreign layers are
+// only referenced by the manifest
+func (m *imageManifest) blobs() []string {
+	layers := append([]*ImageLayer{}, m.Layers...)
+	if m.Config != nil {
+		layers = append([]*ImageLayer{m.Config}, layers...)
+	}
+
+	for _, l := range m.FSLayers {
+		layers = append(layers, &ImageLayer{Digest: l.BlobSum})
+	}
+
+	seen := map[string]bool{}
+	digests := []string{}
+	for _, l := range layers {
+		if l == nil || l.Digest == "" || strings.Contains(l.MediaType, "foreign") || seen[l.Digest] {
+			continue
+		}
+		seen[l.Digest] = true
+		digests = append(digests, l.Digest)
+	}
+
+	return digests
+}
+
+// repositoryCopyLayer downloads a layer (blob) from one repository and uploads it to another in the parts
+// the target expects
+func (o *ecrOrchestrator) repositoryCopyLayer(ctx context.Context, from, to, digest string) error {
+	log.Debugf("copying layer %s from %s to %s", digest, from, to)
+
+	url, err := o.client.GetLayerDownloadUrl(ctx, from, digest)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return apierror.New(apierror.ErrInternalError, "failed to create layer download request", err)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return apierror.New(apierror.ErrServiceUnavailable, fmt.Sprintf("failed to download layer %s", digest), err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		msg := fmt.Sprintf("failed to download layer %s: %s", digest, res.Status)
+		return apierror.New(apierror.ErrServiceUnavailable, msg, nil)
+	}
+
+	uploadId, partSize, err := o.client.InitiateLayerUpload(ctx, to)
+	if err != nil {
+		return err
+	}
+
+	part := make([]byte, partSize)
+	var first int64
+	for {
+		n, err := io.ReadFull(res.Body, part)
+		if n > 0 {
+			if uerr := o.client.UploadLayerPart(ctx, to, uploadId, first, part[:n]); uerr != nil {
+				return uerr
+			}
+			first += int64(n)
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+
+		if err != nil {
+			return apierror.New(apierror.ErrServiceUnavailable, fmt.Sprintf("failed to download layer %s", digest), err)
+		}
+	}
+
+	if err := o.client.CompleteLayerUpload(ctx, to, uploadId, digest); err != nil {
+		if aerr, ok := err.(apierror.Error); ok && aerr.Code == apierror.ErrConflict {
+			log.Warnf("layer %s already exists in repository %s", digest, to)
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+// repositoryCopyLayers copies the layers (blobs) that aren't already in the target repository
+func (o *ecrOrchestrator) repositoryCopyLayers(ctx context.Context, from, to string, digests []string) error {
+	available, err := o.client.GetAvailableLayers(ctx, to, digests...)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range digests {
+		if available[d] {
+			continue
+		}
+
+		if err := o.repositoryCopyLayer(ctx, from, to, d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// repositoryCopyImage copies an image from one repository to another.  The layers are copied before the
+// manifest, and the images of a manifest list (index) before the list.  Images that already exist in the
+// target repository are skipped.
+func (o *ecrOrchestrator) repositoryCopyImage(ctx context.Context, from, to string, id *awsecr.ImageIdentifier) error {
+	image, err := o.client.GetImageManifest(ctx, from, &awsecr.ImageIdentifier{ImageDigest: id.ImageDigest})
+	if err != nil {
+		return err
+	}
+	image.ImageId = id
+
+	manifest := imageManifest{}
+	if err := json.Unmarshal([]byte(aws.StringValue(image.ImageManifest)), &manifest); err != nil {
+		msg := fmt.Sprintf("failed to parse manifest of image %s", aws.StringValue(id.ImageDigest))
+		return apierror.New(apierror.ErrInternalError, msg, err)
+	}
+
+	for _, m := range manifest.Manifests {
+		if err := o.repositoryCopyImage(ctx, from, to, &awsecr.ImageIdentifier{ImageDigest: aws.String(m.Digest)}); err != nil {
+			return err
+		}
+	}
+
+	if err := o.repositoryCopyLayers(ctx, from, to, manifest.blobs()); err != nil {
+		return err
+	}
+
+	if _, err := o.client.PutImage(ctx, to, image); err != nil {
+		if aerr, ok := err.(apierror.Error); ok && aerr.Code == apierror.ErrConflict {
+			log.Warnf("image %s%s already exists in repository %s", aws.StringValue(id.ImageTag), aws.StringValue(id.ImageDigest), to)
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+// repositoryUserMove renames a repository user and moves it to the path of the target repository.  The
+// access keys and groups of the user are kept and the tags are updated for the target repository.
+func (o *iamOrchestrator) repositoryUserMove(ctx context.Context, fromGroup, fromName, toGroup, toName, user string) error {
+	log.Infof("moving repository %s/%s user %s to %s/%s", fromGroup, fromName, user, toGroup, toName)
+
+	path := repositoryUserPath(o.org, fromGroup, fromName)
+	userName := repositoryUserIAMName(fromGroup, fromName, user)
+
+	iamUser, err := o.client.GetUserWithPath(ctx, path, userName)
+	if err != nil {
+		return err
+	}
+
+	newPath := repositoryUserPath(o.org, toGroup, toName)
+	newUserName := repositoryUserIAMName(toGroup, toName, user)
+
+	if err := o.client.UpdateUser(ctx, userName, newUserName, newPath); err != nil {
+		return err
+	}
+
+	tags := fromIAMTags(iamUser.Tags)
+	normalized := normalizeUserTags(o.org, toGroup, repositoryUserResource(toGroup, toName), newUserName, tags)
+
+	// keep the expiration of the user
+	for _, t := range tags {
+		if t.Key == userExpiresAtTag {
+			normalized = append(normalized, t)
+		}
+	}
+
+	return o.client.TagUser(ctx, newUserName, toIAMTags(normalized))
+}
+
+// prepareRepositoryMove validates the move of a repository to the target group and name and stores the
+// new move.  It returns the move and the request to create the target repository.
+func (s *server) prepareRepositoryMove(ctx context.Context, ecrOrch *ecrOrchestrator, account, group, name string, req *RepositoryMoveRequest) (*RepositoryMove, *RepositoryCreateRequest, error) {
+	if req.Group == "" {
+		return nil, nil, apierror.New(apierror.ErrBadRequest, "the target group is required", nil)
+	}
+
+	if req.RepositoryName == "" {
+		req.RepositoryName = name
+	}
+
+	if req.Group == group && req.RepositoryName == name {
+		return nil, nil, apierror.New(apierror.ErrBadRequest, "the target repository is the same as the source", nil)
+	}
+
+	// the group-wide users are managed under {group}/users
+	if req.RepositoryName == "users" {
+		return nil, nil, apierror.New(apierror.ErrBadRequest, "users is a reserved repository name", nil)
+	}
+
+	source := fmt.Sprintf("%s/%s", group, name)
+	target := fmt.Sprintf("%s/%s", req.Group, req.RepositoryName)
+
+	createReq, err := ecrOrch.repositoryCopyRequest(ctx, group, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	createReq.RepositoryName = req.RepositoryName
+
+	if _, err := ecrOrch.client.GetRepositories(ctx, target); err == nil {
+		msg := fmt.Sprintf("repository %s already exists", target)
+		return nil, nil, apierror.New(apierror.ErrConflict, msg, nil)
+	} else if aerr, ok := err.(apierror.Error); !ok || aerr.Code != apierror.ErrNotFound {
+		return nil, nil, err
+	}
+
+	move := &RepositoryMove{
+		Id:        uuid.New().String(),
+		Account:   account,
+		Source:    source,
+		Target:    target,
+		Status:    repositoryMoveRunning,
+		Users:     []string{},
+		StartedAt: time.Now().UTC(),
+	}
+
+	log.Infof("moving repository %s to %s in account %s (%s)", source, target, account, move.Id)
+
+	if err := store.PutJSON(ctx, s.store, repositoryMovesBucket, repositoryMoveKey(account, move.Id), move); err != nil {
+		return nil, nil, err
+	}
+
+	return move, createReq, nil
+}
+
+// saveRepositoryMove stores the progress of a repository move
+func (s *server) saveRepositoryMove(ctx context.Context, move *RepositoryMove) {
+	if err := store.PutJSON(ctx, s.store, repositoryMovesBucket, repositoryMoveKey(move.Account, move.Id), move); err != nil {
+		log.Errorf("failed to save repository move %s: %s", move.Id, err)
+	}
+}
+
+// getRepositoryMove gets a repository move by id
+func (s *server) getRepositoryMove(ctx context.Context, account, id string) (*RepositoryMove, error) {
+	move := &RepositoryMove{}
+	if err := store.GetJSON(ctx, s.store, repositoryMovesBucket, repositoryMoveKey(account, id), move); err != nil {
+		return nil, err
+	}
+	return move, nil
+}
+
+// repositoryMoveOrchestrators returns the orchestrators for moving repositories in the account, from a job
+// session that's assumed again as the move runs
+func (s *server) repositoryMoveOrchestrators(account string) (orchestratorsFunc, error) {
+	policy, err := s.repositoryMovePolicy()
+	if err != nil {
+		return nil, apierror.New(apierror.ErrInternalError, "failed to generate policy", err)
+	}
+
+	return s.newJobSession(account, policy, "arn:aws:iam::aws:policy/AmazonEC2ContainerRegistryFullAccess").orchestrators, nil
+}
+
+// startRepositoryMove validates and stores a repository move and runs it in the background
+func (s *server) startRepositoryMove(ctx context.Context, account, group, name string, req *RepositoryMoveRequest) (*RepositoryMove, error) {
+	orchestrators, err := s.repositoryMoveOrchestrators(account)
+	if err != nil {
+		return nil, err
+	}
+
+	ecrOrch, _, err := orchestrators(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	move, createReq, err := s.prepareRepositoryMove(ctx, ecrOrch, account, group, name, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// the move outlives the request, it's only cancelled with the server
+	progress := *move
+	go s.moveRepository(s.context, orchestrators, &progress, createReq)
+
+	return move, nil
+}
+
+// moveRepository creates the target repository with the same settings as the source, copies the images,
+// moves the repository users and deletes the source.  The progress is stored as it runs, and everything
+// done before a failure is rolled back.  The orchestrators are fetched for each step, so the session doesn't
+// expire during long moves.
+func (s *server) moveRepository(ctx context.Context, orchestrators orchestratorsFunc, move *RepositoryMove, createReq *RepositoryCreateRequest) (err error) {
+	// setup rollback function list and defer execution
+	var rollBackTasks []rollbackFunc
+	defer func() {
+		now := time.Now().UTC()
+		move.CompletedAt = &now
+
+		if err != nil {
+			log.Errorf("failed to move repository %s to %s in step %s: %s", move.Source, move.Target, move.Step, err)
+			log.Errorf("recovering from error: %s, executing %d rollback tasks", err, len(rollBackTasks))
+			rollBack(&rollBackTasks)
+
+			move.Status = repositoryMoveFailed
+			move.Error = err.Error()
+			move.RolledBack = len(rollBackTasks) > 0
+		} else {
+			move.Status = repositoryMoveCompleted
+			move.Step = ""
+		}
+
+		s.saveRepositoryMove(ctx, move)
+	}()
+
+	fromGroup, fromName := splitRepositoryName(move.Source)
+	toGroup, toName := splitRepositoryName(move.Target)
+
+	move.Step = repositoryMoveStepCreate
+	s.saveRepositoryMove(ctx, move)
+
+	ecrOrch, _, err := orchestrators(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err = ecrOrch.repositoryCreate(ctx, move.Account, toGroup, createReq); err != nil {
+		return err
+	}
+
+	rollBackTasks = append(rollBackTasks, func(ctx context.Context) error {
+		ecrOrch, _, err := orchestrators(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = ecrOrch.client.DeleteRepository(ctx, move.Target)
+		return err
+	})
+
+	images, err := ecrOrch.repositoryImagesToCopy(ctx, move.Source)
+	if err != nil {
+		return err
+	}
+
+	move.Step = repositoryMoveStepImages
+	move.ImageCount = len(images)
+	s.saveRepositoryMove(ctx, move)
+
+	for _, id := range images {
+		if ecrOrch, _, err = orchestrators(ctx); err != nil {
+			return err
+		}
+
+		if err = ecrOrch.repositoryCopyImage(ctx, move.Source, move.Target, id); err != nil {
+			return err
+		}
+
+		move.ImagesCopied++
+		s.saveRepositoryMove(ctx, move)
+	}
+
+	_, iamOrch, err := orchestrators(ctx)
+	if err != nil {
+		return err
+	}
+
+	users, err := iamOrch.listRepositoryUsers(ctx, fromGroup, fromName)
+	if err != nil {
+		return err
+	}
+
+	move.Step = repositoryMoveStepUsers
+	s.saveRepositoryMove(ctx, move)
+
+	for _, u := range users {
+		user := u
+		if _, iamOrch, err = orchestrators(ctx); err != nil {
+			return err
+		}
+
+		if err = iamOrch.repositoryUserMove(ctx, fromGroup, fromName, toGroup, toName, user); err != nil {
+			return err
+		}
+
+		rollBackTasks = append(rollBackTasks, func(ctx context.Context) error {
+			_, iamOrch, err := orchestrators(ctx)
+			if err != nil {
+				return err
+			}
+
+			return iamOrch.repositoryUserMove(ctx, toGroup, toName, fromGroup, fromName, user)
+		})
+
+		move.Users = append(move.Users, user)
+		s.saveRepositoryMove(ctx, move)
+	}
+
+	move.Step = repositoryMoveStepDelete
+	s.saveRepositoryMove(ctx, move)
+
+	if ecrOrch, _, err = orchestrators(ctx); err != nil {
+		return err
+	}
+
+	if _, err = ecrOrch.repositoryDelete(ctx, move.Account, fromGroup, fromName); err != nil {
+		return err
+	}
+
+	log.Infof("moved repository %s to %s in account %s", move.Source, move.Target, move.Account)
+
+	s.notify(ctx, notificationRepositoryCreated, move.Account, toGroup, &RepositoryNotification{
+		Repository: move.Target,
+		Users:      move.Users,
+	})
+
+	s.notify(ctx, notificationRepositoryDeleted, move.Account, fromGroup, &RepositoryNotification{
+		Repository: move.Source,
+		Users:      move.Users,
+	})
+
+	return nil
+}
@@ -0,0 +1,350 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/ecr-api/iam"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	awsecr "github.com/aws/aws-sdk-go/service/ecr"
+)
+
+func TestMoveRepository(t *testing.T) {
+	ctx := context.Background()
+	st := newSoftDeleteTest(t)
+
+	st.ecrClient.addImage("spindev-00001/rudolph", "", "sha256:1111", 1000, time.Now().Add(-72*time.Hour))
+	st.ecrClient.addImage("spindev-00001/rudolph", "v1", "sha256:2222", 1000, time.Now().Add(-48*time.Hour))
+	st.ecrClient.addImage("spindev-00001/rudolph", "v2", "sha256:3333", 1000, time.Now().Add(-time.Hour))
+
+	move, createReq, err := st.server.prepareRepositoryMove(ctx, st.ecrOrch, "12345", "spindev-00001", "rudolph", &RepositoryMoveRequest{Group: "spindev-00003"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if move.Source != "spindev-00001/rudolph" || move.Target != "spindev-00003/rudolph" || move.Status != repositoryMoveRunning {
+		t.Errorf("unexpected move %+v", move)
+	}
+
+	if err := st.server.moveRepository(ctx, st.orchestrators, move, createReq); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got, err := st.server.getRepositoryMove(ctx, "12345", move.Id)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got.Status != repositoryMoveCompleted || got.ImageCount != 3 || got.ImagesCopied != 3 || len(got.Users) != 2 || got.CompletedAt == nil {
+		t.Errorf("unexpected completed move %+v", got)
+	}
+
+	if _, ok := st.ecrClient.repos["spindev-00001/rudolph"]; ok {
+		t.Error("expected the source repository to be deleted")
+	}
+
+	resp, err := st.ecrOrch.repositoryDetails(ctx, "12345", "spindev-00003", "rudolph")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(resp.Groups) != 1 || resp.Groups[0] != "spindev-00002" {
+		t.Errorf("expected the target to be shared with spindev-00002, got %v", resp.Groups)
+	}
+
+	for _, tag := range resp.Tags {
+		if tag.Key == "spinup:spaceid" && tag.Value != "spindev-00003" {
+			t.Errorf("expected the target to be tagged with spindev-00003, got %s", tag.Value)
+		}
+	}
+
+	images, err := st.ecrOrch.client.GetImages(ctx, "spindev-00003/rudolph")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(images) != 3 {
+		t.Errorf("expected 3 images in the target repository, got %d", len(images))
+	}
+
+	users, err := st.iamOrch.listRepositoryUsers(ctx, "spindev-00003", "rudolph")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(users) != 2 {
+		t.Errorf("expected 2 users in the target repository, got %v", users)
+	}
+
+	if keys := st.iamClient.keys["rudolph-dasher"]; len(keys) != 1 {
+		t.Errorf("expected the dasher user to keep its access key, got %d", len(keys))
+	}
+
+	user, err := st.iamOrch.getRepositoryUser(ctx, "spindev-00003", "rudolph", "dasher")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, tag := range user.Tags {
+		if tag.Key == "ResourceName" && tag.Value != "spindev-00003/rudolph" {
+			t.Errorf("expected the user resource to be spindev-00003/rudolph, got %s", tag.Value)
+		}
+	}
+
+	if len(st.notifier.notifications) != 2 {
+		t.Errorf("expected created and deleted notifications, got %d", len(st.notifier.notifications))
+	}
+}
+
+func TestMoveRepositoryStatements(t *testing.T) {
+	ctx := context.Background()
+	st := newSoftDeleteTest(t)
+
+	// the security team's statement isn't managed by the api
+	statement := iam.StatementEntry{
+		Sid:       "DenyDeleteImages",
+		Effect:    "Deny",
+		Action:    []string{"ecr:BatchDeleteImage"},
+		Principal: iam.Principal{"AWS": iam.Value{"*"}},
+	}
+
+	policy, err := repositoryPolicy(&repositoryAccess{
+		groups:     []string{"spindev-00002"},
+		principals: []string{"123456789012"},
+		statements: []iam.StatementEntry{statement},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	st.ecrClient.policies["spindev-00001/rudolph"] = policy
+
+	move, createReq, err := st.server.prepareRepositoryMove(ctx, st.ecrOrch, "12345", "spindev-00001", "rudolph", &RepositoryMoveRequest{Group: "spindev-00003"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := st.server.moveRepository(ctx, st.orchestrators, move, createReq); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	access, err := repositoryAccessFromPolicy(st.ecrClient.policies["spindev-00003/rudolph"])
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(access.statements, []iam.StatementEntry{statement}) {
+		t.Errorf("expected the target policy to keep the statement %+v, got %+v", statement, access.statements)
+	}
+
+	if !reflect.DeepEqual(access.groups, []string{"spindev-00002"}) || !reflect.DeepEqual(access.principals, []string{"123456789012"}) {
+		t.Errorf("expected the target policy to keep the access, got groups %v and principals %v", access.groups, access.principals)
+	}
+}
+
+func TestMoveRepositoryLayers(t *testing.T) {
+	ctx := context.Background()
+	st := newSoftDeleteTest(t)
+
+	layers := httptest.NewServer(st.ecrClient)
+	defer layers.Close()
+	st.ecrClient.layerURL = layers.URL
+
+	amd64 := st.ecrClient.addImageWithLayers("spindev-00001/rudolph", "v1-amd64", time.Now().Add(-2*time.Hour), "base layer", "amd64 application layer")
+	arm64 := st.ecrClient.addImageWithLayers("spindev-00001/rudolph", "v1-arm64", time.Now().Add(-2*time.Hour), "base layer", "arm64 application layer")
+
+	// the manifest list references both images, without tagging them
+	index := fmt.Sprintf(`{"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[{"digest":"%s"},{"digest":"%s"}]}`, amd64, arm64)
+	st.ecrClient.addImage("spindev-00001/rudolph", "v1", "sha256:index", int64(len(index)), time.Now().Add(-time.Hour))
+	st.ecrClient.manifests["spindev-00001/rudolph@sha256:index"] = index
+
+	move, createReq, err := st.server.prepareRepositoryMove(ctx, st.ecrOrch, "12345", "spindev-00001", "rudolph", &RepositoryMoveRequest{Group: "spindev-00003"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := st.server.moveRepository(ctx, st.orchestrators, move, createReq); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got, err := st.server.getRepositoryMove(ctx, "12345", move.Id)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got.Status != repositoryMoveCompleted || got.ImagesCopied != 3 {
+		t.Errorf("unexpected completed move %+v", got)
+	}
+
+	// two configs, the shared base layer and the two application layers
+	var copied []string
+	for k, v := range st.ecrClient.layers {
+		if strings.HasPrefix(k, "spindev-00003/rudolph@") {
+			copied = append(copied, string(v))
+		}
+	}
+
+	if len(copied) != 5 {
+		t.Errorf("expected 5 layers in the target repository, got %d: %v", len(copied), copied)
+	}
+
+	for _, d := range []string{amd64, arm64, "sha256:index"} {
+		if _, ok := st.ecrClient.manifests["spindev-00003/rudolph@"+d]; !ok {
+			t.Errorf("expected image %s in the target repository", d)
+		}
+	}
+
+	if len(st.ecrClient.uploads) != 0 {
+		t.Errorf("expected all layer uploads to be completed, got %d", len(st.ecrClient.uploads))
+	}
+}
+
+func TestMoveRepositoryRollback(t *testing.T) {
+	ctx := context.Background()
+	st := newSoftDeleteTest(t)
+
+	st.ecrClient.addImage("spindev-00001/rudolph", "v1", "sha256:1111", 1000, time.Now().Add(-time.Hour))
+	st.ecrClient.putErr = awserr.New(awsecr.ErrCodeLayersNotFoundException, "layers not found", nil)
+
+	move, createReq, err := st.server.prepareRepositoryMove(ctx, st.ecrOrch, "12345", "spindev-00001", "rudolph", &RepositoryMoveRequest{Group: "spindev-00003", RepositoryName: "prancer"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := st.server.moveRepository(ctx, st.orchestrators, move, createReq); err == nil {
+		t.Fatal("expected an error copying images")
+	}
+
+	got, err := st.server.getRepositoryMove(ctx, "12345", move.Id)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got.Status != repositoryMoveFailed || got.Step != repositoryMoveStepImages || !got.RolledBack || got.Error == "" {
+		t.Errorf("unexpected failed move %+v", got)
+	}
+
+	if _, ok := st.ecrClient.repos["spindev-00003/prancer"]; ok {
+		t.Error("expected the target repository to be rolled back")
+	}
+
+	if _, ok := st.ecrClient.repos["spindev-00001/rudolph"]; !ok {
+		t.Error("expected the source repository to be kept")
+	}
+
+	users, err := st.iamOrch.listRepositoryUsers(ctx, "spindev-00001", "rudolph")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(users) != 2 {
+		t.Errorf("expected the users to stay with the source repository, got %v", users)
+	}
+}
+
+func TestMoveRepositoryRollbackUsers(t *testing.T) {
+	ctx := context.Background()
+	st := newSoftDeleteTest(t)
+
+	move, createReq, err := st.server.prepareRepositoryMove(ctx, st.ecrOrch, "12345", "spindev-00001", "rudolph", &RepositoryMoveRequest{Group: "spindev-00003"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// deleting the source fails after the users are moved
+	st.ecrClient.deleteErrs["spindev-00001/rudolph"] = awserr.New(awsecr.ErrCodeServerException, "boom", nil)
+
+	if err := st.server.moveRepository(ctx, st.orchestrators, move, createReq); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	users, err := st.iamOrch.listRepositoryUsers(ctx, "spindev-00001", "rudolph")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(users) != 2 {
+		t.Errorf("expected the users to be moved back to the source repository, got %v", users)
+	}
+
+	moved, err := st.iamOrch.listRepositoryUsers(ctx, "spindev-00003", "rudolph")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(moved) != 0 {
+		t.Errorf("expected no users in the target repository, got %v", moved)
+	}
+}
+
+func TestPrepareRepositoryMove(t *testing.T) {
+	ctx := context.Background()
+	st := newSoftDeleteTest(t)
+	st.ecrClient.addRepository("spindev-00003/rudolph", "")
+
+	tests := []struct {
+		name     string
+		group    string
+		repoName string
+		req      *RepositoryMoveRequest
+		wantCode string
+	}{
+		{
+			name:     "missing group",
+			group:    "spindev-00001",
+			repoName: "rudolph",
+			req:      &RepositoryMoveRequest{},
+			wantCode: apierror.ErrBadRequest,
+		},
+		{
+			name:     "same repository",
+			group:    "spindev-00001",
+			repoName: "rudolph",
+			req:      &RepositoryMoveRequest{Group: "spindev-00001"},
+			wantCode: apierror.ErrBadRequest,
+		},
+		{
+			name:     "reserved name",
+			group:    "spindev-00001",
+			repoName: "rudolph",
+			req:      &RepositoryMoveRequest{Group: "spindev-00003", RepositoryName: "users"},
+			wantCode: apierror.ErrBadRequest,
+		},
+		{
+			name:     "missing source",
+			group:    "spindev-00001",
+			repoName: "vixen",
+			req:      &RepositoryMoveRequest{Group: "spindev-00003"},
+			wantCode: apierror.ErrNotFound,
+		},
+		{
+			name:     "existing target",
+			group:    "spindev-00001",
+			repoName: "rudolph",
+			req:      &RepositoryMoveRequest{Group: "spindev-00003"},
+			wantCode: apierror.ErrConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := st.server.prepareRepositoryMove(ctx, st.ecrOrch, "12345", tt.group, tt.repoName, tt.req)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if aerr, ok := err.(apierror.Error); !ok || aerr.Code != tt.wantCode {
+				t.Errorf("expected %s error, got %s", tt.wantCode, err)
+			}
+		})
+	}
+
+	if _, err := st.server.getRepositoryMove(ctx, "12345", "missing"); err == nil {
+		t.Error("expected an error for a missing move")
+	}
+}
@@ -4,8 +4,12 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/ecr-api/ecr"
+	"github.com/YaleSpinup/ecr-api/iam"
 	"github.com/YaleSpinup/ecr-api/session"
 	stsSvc "github.com/YaleSpinup/ecr-api/sts"
 	"github.com/aws/aws-sdk-go/aws"
@@ -29,13 +33,54 @@ func (s *server) assumeRole(ctx context.Context, externalId, roleArn, inlinePoli
 		contextLogger.WithField("duration", totalTime).Info("assumeRole()")
 	}()
 
-	stsService := stsSvc.New(stsSvc.WithSession(s.session.Session))
+	input, cacheKey := s.assumeRoleInput(externalId, roleArn, inlinePolicy, policyArns...)
+	contextLogger = contextLogger.WithField("session", aws.StringValue(input.RoleSessionName))
 
-	name := fmt.Sprintf("spinup-%s-ecr-api-%s", s.org, uuid.New())
+	contextLogger.Debugf("checking for item with cache key: '%s'", cacheKey)
+
+	item, expire, found := s.sessionCache.GetWithExpiration(cacheKey)
+	if found {
+		if sess, ok := item.(*session.Session); ok {
+			contextLogger.Infof("using cached session (expire: %s)", expire.String())
+			return sess, nil
+		}
+	}
+
+	contextLogger.Debugf("assuming role %s with input %+v", roleArn, input)
+
+	sess, _, err := s.assumeRoleSession(ctx, input)
+	if err != nil {
+		return nil, err
+	}
 
-	contextLogger = contextLogger.WithField("session", name)
+	contextLogger.Debugf("caching session with cache key: '%s'", cacheKey)
+
+	s.sessionCache.Set(cacheKey, sess, cache.DefaultExpiration)
+
+	return sess, nil
+}
+
+// assumeRoleWithDuration assumes the passed role like assumeRole, but for the given duration and without caching the
+// session, for credentials that are handed out and need to live as long as requested.  It returns the session and
+// the expiration of its credentials.  The duration can't be longer than the maximum session duration of the role,
+// and is limited to 1 hour when the api's own credentials are a role session (role chaining).
+func (s *server) assumeRoleWithDuration(ctx context.Context, externalId, roleArn, inlinePolicy string, duration time.Duration, policyArns ...string) (*session.Session, time.Time, error) {
+	input, _ := s.assumeRoleInput(externalId, roleArn, inlinePolicy, policyArns...)
+	input.SetDurationSeconds(int64(duration.Seconds()))
 
-	input := sts.AssumeRoleInput{
+	log.WithFields(log.Fields{
+		"role":    roleArn,
+		"session": aws.StringValue(input.RoleSessionName),
+	}).Infof("assuming role for %s", duration)
+
+	return s.assumeRoleSession(ctx, input)
+}
+
+// assumeRoleInput returns the assume role input for the role and session policies, and the session cache key
+func (s *server) assumeRoleInput(externalId, roleArn, inlinePolicy string, policyArns ...string) (*sts.AssumeRoleInput, string) {
+	name := fmt.Sprintf("spinup-%s-ecr-api-%s", s.org, uuid.New())
+
+	input := &sts.AssumeRoleInput{
 		DurationSeconds: aws.Int64(900),
 		RoleArn:         aws.String(roleArn),
 		RoleSessionName: aws.String(name),
@@ -70,27 +115,23 @@ func (s *server) assumeRole(ctx context.Context, externalId, roleArn, inlinePoli
 		cacheKey = cacheKey + "_" + strings.Join(policyArns, "_")
 	}
 
-	contextLogger.Debugf("checking for item with cache key: '%s'", cacheKey)
-
-	item, expire, found := s.sessionCache.GetWithExpiration(cacheKey)
-	if found {
-		if sess, ok := item.(*session.Session); ok {
-			contextLogger.Infof("using cached session (expire: %s)", expire.String())
-			return sess, nil
-		}
-	}
+	return input, cacheKey
+}
 
-	contextLogger.Debugf("assuming role %s with input %+v", roleArn, input)
+// assumeRoleSession assumes the role and returns a session with the temporary credentials and their expiration
+func (s *server) assumeRoleSession(ctx context.Context, input *sts.AssumeRoleInput) (*session.Session, time.Time, error) {
+	stsService := stsSvc.New(stsSvc.WithSession(s.session.Session))
 
-	out, err := stsService.AssumeRole(ctx, &input)
+	out, err := stsService.AssumeRole(ctx, input)
 	if err != nil {
 		log.Errorf("got: %s", err)
-		return nil, err
+		return nil, time.Time{}, err
 	}
 
 	akid := aws.StringValue(out.Credentials.AccessKeyId)
+	expiration := aws.TimeValue(out.Credentials.Expiration)
 
-	contextLogger.Infof("got temporary creds %s, expiration: %s", akid, aws.TimeValue(out.Credentials.Expiration).String())
+	log.WithField("session", aws.StringValue(input.RoleSessionName)).Infof("got temporary creds %s, expiration: %s", akid, expiration.String())
 
 	sess := session.New(
 		session.WithCredentials(
@@ -101,9 +142,86 @@ func (s *server) assumeRole(ctx context.Context, externalId, roleArn, inlinePoli
 		session.WithRegion("us-east-1"),
 	)
 
-	contextLogger.Debugf("caching session with cache key: '%s'", cacheKey)
+	return &sess, expiration, nil
+}
+
+// jobSessionDuration is how long the role sessions of background jobs last, the longest allowed for chained roles
+const jobSessionDuration = time.Hour
+
+// jobSession is the role session of a background job that outlives the request that started it.  The role is
+// assumed again when the session is about to expire, so the job can run longer than a session.
+type jobSession struct {
+	server     *server
+	account    string
+	policy     string
+	policyArns []string
+
+	mu        sync.Mutex
+	session   *session.Session
+	expiresAt time.Time
+}
+
+// orchestratorsFunc returns the ecr and iam orchestrators of a background job, it's called for each step of the
+// job so they always have a valid session
+type orchestratorsFunc func(ctx context.Context) (*ecrOrchestrator, *iamOrchestrator, error)
+
+// newJobSession returns the session of a background job in the account, limited to the inline policy and
+// the managed policy arns
+func (s *server) newJobSession(account, policy string, policyArns ...string) *jobSession {
+	return &jobSession{
+		server:     s,
+		account:    account,
+		policy:     policy,
+		policyArns: policyArns,
+	}
+}
+
+// newTaggedResourcesJobSession returns the session of a background job to list the tagged resources in the account.
+// It doesn't have an inline policy, the org policies only allow actions on resources tagged with the org and
+// tag:GetResources doesn't act on a resource.
+func (s *server) newTaggedResourcesJobSession(account string) *jobSession {
+	return s.newJobSession(account, "", "arn:aws:iam::aws:policy/ResourceGroupsandTagEditorReadOnlyAccess")
+}
 
-	s.sessionCache.Set(cacheKey, &sess, cache.DefaultExpiration)
+// get returns the session, the role is assumed again when the session expires in less than 10 minutes
+func (j *jobSession) get(ctx context.Context) (*session.Session, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.session != nil && time.Until(j.expiresAt) > 10*time.Minute {
+		return j.session, nil
+	}
+
+	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", j.account, j.server.session.RoleName)
+
+	sess, expiresAt, err := j.server.assumeRoleWithDuration(ctx, j.server.session.ExternalID, role, j.policy, jobSessionDuration, j.policyArns...)
+	if err != nil {
+		msg := fmt.Sprintf("failed to assume role in account: %s", j.account)
+		return nil, apierror.New(apierror.ErrForbidden, msg, nil)
+	}
+
+	j.session = sess
+	j.expiresAt = expiresAt
+
+	return sess, nil
+}
+
+// orchestrators returns the ecr and iam orchestrators with the current session
+func (j *jobSession) orchestrators(ctx context.Context) (*ecrOrchestrator, *iamOrchestrator, error) {
+	sess, err := j.get(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ecrOrch := newEcrOrchestrator(
+		ecr.New(ecr.WithSession(sess.Session)),
+		j.server.org,
+	)
+
+	iamOrch := newIamOrchestrator(
+		iam.New(iam.WithSession(sess.Session)),
+		j.server.org,
+	)
 
-	return &sess, nil
+	return ecrOrch, iamOrch, nil
 }
@@ -32,16 +32,56 @@ func (s *server) routes() {
 	api.HandleFunc("/{account}/repositories", s.RepositoriesListHandler).Methods(http.MethodGet)
 	api.HandleFunc("/{account}/repositories/{group}", s.RepositoriesCreateHandler).Methods(http.MethodPost)
 	api.HandleFunc("/{account}/repositories/{group}", s.RepositoriesListHandler).Methods(http.MethodGet)
+	api.HandleFunc("/{account}/repositories/{group}", s.RepositoriesGroupDeleteHandler).Methods(http.MethodDelete)
+	api.HandleFunc("/{account}/groupDeletes/{id}", s.RepositoriesGroupDeleteShowHandler).Methods(http.MethodGet)
+	// Group-wide users are routed before the repositories, 'users' is a reserved repository name
+	api.HandleFunc("/{account}/repositories/{group}/users", s.UsersListHandler).Methods(http.MethodGet)
+	api.HandleFunc("/{account}/repositories/{group}/users", s.UsersCreateHandler).Methods(http.MethodPost)
+	api.HandleFunc("/{account}/repositories/{group}/users/{user}", s.UsersShowHandler).Methods(http.MethodGet)
+	api.HandleFunc("/{account}/repositories/{group}/users/{user}", s.UsersUpdateHandler).Methods(http.MethodPut)
+	api.HandleFunc("/{account}/repositories/{group}/users/{user}", s.UsersDeleteHandler).Methods(http.MethodDelete)
+
 	api.HandleFunc("/{account}/repositories/{group}/{name}", s.RepositoriesShowHandler).Methods(http.MethodGet)
 	api.HandleFunc("/{account}/repositories/{group}/{name}", s.RepositoriesUpdateHandler).Methods(http.MethodPut)
 	api.HandleFunc("/{account}/repositories/{group}/{name}", s.RepositoriesDeleteHandler).Methods(http.MethodDelete)
+	api.HandleFunc("/{account}/repositoryPolicies", s.RepositoryPoliciesAuditHandler).Methods(http.MethodGet)
+	api.HandleFunc("/{account}/repositoryPolicies", s.RepositoryPoliciesRepairHandler).Methods(http.MethodPut)
+	// reports generated in the background by the repository policies, orphaned and dormant users endpoints
+	api.HandleFunc("/{account}/reports/{id}", s.ReportsShowHandler).Methods(http.MethodGet)
 	api.HandleFunc("/{account}/scanRepositories", s.ScanRepositoriesHandler).Methods(http.MethodGet)
 	api.HandleFunc("/{account}/scanFindings", s.ScanFindings).Methods(http.MethodGet)
+	api.HandleFunc("/{account}/scanningConfiguration", s.ScanningConfigurationShowHandler).Methods(http.MethodGet)
+	api.HandleFunc("/{account}/scanningConfiguration", s.ScanningConfigurationUpdateHandler).Methods(http.MethodPut)
+	api.HandleFunc("/{account}/replicationConfiguration", s.ReplicationConfigurationShowHandler).Methods(http.MethodGet)
+	api.HandleFunc("/{account}/replicationConfiguration", s.ReplicationConfigurationUpdateHandler).Methods(http.MethodPut)
+
+	// CVE exceptions (accepted risk) applied to scan findings
+	api.HandleFunc("/{account}/exceptions", s.ExceptionsListHandler).Methods(http.MethodGet)
+	api.HandleFunc("/{account}/exceptions", s.ExceptionsCreateHandler).Methods(http.MethodPost)
+	api.HandleFunc("/{account}/exceptions/{id}", s.ExceptionsShowHandler).Methods(http.MethodGet)
+	api.HandleFunc("/{account}/exceptions/{id}", s.ExceptionsDeleteHandler).Methods(http.MethodDelete)
+
+	// repository user access key rotation
+	api.HandleFunc("/{account}/keyrotation", s.KeyRotationShowHandler).Methods(http.MethodGet)
+	api.HandleFunc("/{account}/keyrotation", s.KeyRotationRunHandler).Methods(http.MethodPost)
+
+	// webhooks notified of repository, user, scan and image events in a space
+	api.HandleFunc("/{account}/webhooks/{group}", s.WebhooksListHandler).Methods(http.MethodGet)
+	api.HandleFunc("/{account}/webhooks/{group}", s.WebhooksCreateHandler).Methods(http.MethodPost)
+	api.HandleFunc("/{account}/webhooks/{group}/{id}", s.WebhooksShowHandler).Methods(http.MethodGet)
+	api.HandleFunc("/{account}/webhooks/{group}/{id}", s.WebhooksDeleteHandler).Methods(http.MethodDelete)
+	api.HandleFunc("/{account}/webhooks/{group}/{id}/deliveries", s.WebhooksDeliveriesHandler).Methods(http.MethodGet)
 
 	// Image specific endpoints
 	api.HandleFunc("/{account}/repositories/{group}/{name}/images", s.RepositoriesImageListHandler).Methods(http.MethodGet)
+	api.HandleFunc("/{account}/repositories/{group}/{name}/images/diff", s.RepositoriesImageDiffHandler).Methods(http.MethodGet)
 	api.HandleFunc("/{account}/repositories/{group}/{name}/images/{tag}", s.RepositoriesImageTagShowHandler).Methods(http.MethodGet)
 	api.HandleFunc("/{account}/repositories/{group}/{name}/images/{tag}", s.RepositoriesImageTagDeleteHandler).Methods(http.MethodDelete)
+	api.HandleFunc("/{account}/repositories/{group}/{name}/trend", s.RepositoriesTrendHandler).Methods(http.MethodGet)
+	api.HandleFunc("/{account}/repositories/{group}/{name}/token", s.RepositoriesTokenHandler).Methods(http.MethodPost)
+	api.HandleFunc("/{account}/repositories/{group}/{name}/undelete", s.RepositoriesUndeleteHandler).Methods(http.MethodPost)
+	api.HandleFunc("/{account}/repositories/{group}/{name}/move", s.RepositoriesMoveHandler).Methods(http.MethodPost)
+	api.HandleFunc("/{account}/moves/{id}", s.RepositoriesMoveShowHandler).Methods(http.MethodGet)
 
 	// User management for repositories
 	api.HandleFunc("/{account}/repositories/{group}/{name}/users", s.UsersListHandler).Methods(http.MethodGet)
@@ -49,4 +89,9 @@ func (s *server) routes() {
 	api.HandleFunc("/{account}/repositories/{group}/{name}/users/{user}", s.UsersShowHandler).Methods(http.MethodGet)
 	api.HandleFunc("/{account}/repositories/{group}/{name}/users/{user}", s.UsersUpdateHandler).Methods(http.MethodPut)
 	api.HandleFunc("/{account}/repositories/{group}/{name}/users/{user}", s.UsersDeleteHandler).Methods(http.MethodDelete)
+	api.HandleFunc("/{account}/users/dormant", s.UsersDormantHandler).Methods(http.MethodGet)
+	api.HandleFunc("/{account}/users/expired", s.UsersExpiredHandler).Methods(http.MethodPost)
+	api.HandleFunc("/{account}/users/reconcile", s.UsersReconcileHandler).Methods(http.MethodPost)
+	api.HandleFunc("/{account}/users/orphaned", s.UsersOrphanedListHandler).Methods(http.MethodGet)
+	api.HandleFunc("/{account}/users/orphaned", s.UsersOrphanedDeleteHandler).Methods(http.MethodDelete)
 }
@@ -18,15 +18,18 @@ package api
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"math/rand"
 	"net/http"
 	"os"
 	"time"
 
 	"github.com/YaleSpinup/ecr-api/common"
+	"github.com/YaleSpinup/ecr-api/events"
 	"github.com/YaleSpinup/ecr-api/session"
+	"github.com/YaleSpinup/ecr-api/sqs"
+	"github.com/YaleSpinup/ecr-api/store"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	cache "github.com/patrickmn/go-cache"
@@ -55,6 +58,22 @@ type server struct {
 	sessionCache *cache.Cache
 	orgPolicy    string
 	org          string
+	store        store.Store
+	// scanThresholds are the maximum unsuppressed findings per severity for an image to pass the scan gate
+	scanThresholds map[string]int64
+	notifier       notifier
+	// keyRotation is the access key rotation policy, nil if it's disabled
+	keyRotation *keyRotation
+	// userReaper is the expired user reaper job configuration, nil if it's disabled
+	userReaper *userReaper
+	// orphanedUsers is the orphaned user job configuration, nil if it's disabled
+	orphanedUsers *orphanedUserSweep
+	// softDelete is the repository soft delete configuration, nil if repositories are deleted immediately
+	softDelete *softDelete
+	// imageEvents is true when image push and delete notifications come from the ECR events queue
+	imageEvents bool
+	// webhookSecrets encrypts the webhook signing secrets, nil if webhooks can't be created
+	webhookSecrets *webhookSecrets
 }
 
 // NewServer creates a new server and starts it
@@ -68,10 +87,12 @@ func NewServer(config common.Config) error {
 	}
 
 	s := server{
-		router:       mux.NewRouter(),
-		context:      ctx,
-		org:          config.Org,
-		sessionCache: cache.New(600*time.Second, 900*time.Second),
+		router:         mux.NewRouter(),
+		context:        ctx,
+		org:            config.Org,
+		sessionCache:   cache.New(600*time.Second, 900*time.Second),
+		scanThresholds: config.ScanThresholds,
+		notifier:       logNotifier{},
 	}
 
 	s.version = &apiVersion{
@@ -95,12 +116,66 @@ func NewServer(config common.Config) error {
 		session.WithExternalRoleName(config.Account.Role),
 	)
 
-	// initialize ecr admin policy document
-	policyDoc, err := json.Marshal(EcrAdminPolicy)
+	st, err := newStore(config.Store)
 	if err != nil {
 		return err
 	}
-	ecrAdminPolicyDoc = string(policyDoc)
+	s.store = st
+
+	webhookSecrets, err := newWebhookSecrets(config.Webhooks)
+	if err != nil {
+		return err
+	}
+	s.webhookSecrets = webhookSecrets
+	s.notifier = multiNotifier{logNotifier{}, newWebhookNotifier(st, webhookSecrets)}
+
+	keyRotation, err := newKeyRotation(config.KeyRotation)
+	if err != nil {
+		return err
+	}
+	s.keyRotation = keyRotation
+
+	if keyRotation != nil && len(keyRotation.accounts) > 0 {
+		go s.keyRotationJob(ctx)
+	}
+
+	userReaper, err := newUserReaper(config.UserReaper)
+	if err != nil {
+		return err
+	}
+	s.userReaper = userReaper
+
+	if userReaper != nil {
+		go s.userReaperJob(ctx)
+	}
+
+	orphanedUsers, err := newOrphanedUserSweep(config.OrphanedUsers)
+	if err != nil {
+		return err
+	}
+	s.orphanedUsers = orphanedUsers
+
+	if orphanedUsers != nil {
+		go s.orphanedUserJob(ctx)
+	}
+
+	softDelete, err := newSoftDelete(config.SoftDelete, config.Store)
+	if err != nil {
+		return err
+	}
+	s.softDelete = softDelete
+
+	if softDelete != nil {
+		go s.softDeleteJob(ctx)
+	}
+
+	// consume ECR events from the queue, if one is configured
+	if config.Events.QueueUrl != "" {
+		log.Infof("consuming ECR events from %s", config.Events.QueueUrl)
+		queue := events.NewSQSQueue(sqs.New(sqs.WithSession(s.session.Session)), config.Events.QueueUrl)
+		go events.NewConsumer(queue, s.handleEvent).Run(ctx)
+		s.imageEvents = true
+	}
 
 	publicURLs := map[string]string{
 		"/v1/ecr/ping":    "public",
@@ -130,6 +205,22 @@ func NewServer(config common.Config) error {
 	return nil
 }
 
+// newStore returns the configured store.  CVE exceptions are only kept in the store, so there's no fallback to
+// an in-memory store, it has to be configured explicitly.
+func newStore(config common.Store) (store.Store, error) {
+	switch config.Type {
+	case "file":
+		return store.NewFileStore(config.Path)
+	case "memory":
+		log.Warn("using in-memory store, exceptions and other state will not be persisted across restarts")
+		return store.NewMemoryStore(), nil
+	case "":
+		return nil, errors.New("a store is required in the configuration, the exceptions are lost on restart with the memory store")
+	default:
+		return nil, fmt.Errorf("unknown store type '%s' in the configuration", config.Type)
+	}
+}
+
 // LogWriter is an http.ResponseWriter
 type LogWriter struct {
 	http.ResponseWriter
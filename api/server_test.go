@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"testing"
 	"time"
+
+	"github.com/YaleSpinup/ecr-api/common"
 )
 
 func TestRollback(t *testing.T) {
@@ -80,3 +82,43 @@ func TestRetry(t *testing.T) {
 		t.Errorf("unexpected error for successful retry, got %s", err)
 	}
 }
+
+func TestNewStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  common.Store
+		wantErr bool
+	}{
+		{
+			name:   "file",
+			config: common.Store{Type: "file", Path: t.TempDir()},
+		},
+		{
+			name:   "memory",
+			config: common.Store{Type: "memory"},
+		},
+		{
+			name:    "missing store",
+			config:  common.Store{},
+			wantErr: true,
+		},
+		{
+			name:    "unknown store",
+			config:  common.Store{Type: "dynamodb"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newStore(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newStore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && got == nil {
+				t.Error("expected a store")
+			}
+		})
+	}
+}
@@ -0,0 +1,596 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/ecr-api/common"
+	"github.com/YaleSpinup/ecr-api/resourcegroupstaggingapi"
+	"github.com/YaleSpinup/ecr-api/store"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	awsecr "github.com/aws/aws-sdk-go/service/ecr"
+	awsiam "github.com/aws/aws-sdk-go/service/iam"
+	log "github.com/sirupsen/logrus"
+)
+
+// repositoryDeleteAtTag is the repository tag with the RFC3339 time a soft deleted repository is purged
+const repositoryDeleteAtTag = "spinup:deleteAt"
+
+// repositoryDeletionsBucket is the store bucket for soft deleted repositories
+const repositoryDeletionsBucket = "repository_deletions"
+
+// softDelete is the soft delete configuration for repositories
+type softDelete struct {
+	gracePeriod time.Duration
+	interval    time.Duration
+	accounts    []string
+}
+
+// newSoftDelete validates the soft delete configuration, it returns nil if soft delete is disabled.  The state
+// needed to restore a repository is only kept in the store, so soft delete requires a persistent store.
+func newSoftDelete(config common.SoftDelete, storeConfig common.Store) (*softDelete, error) {
+	if config.GracePeriod == "" {
+		return nil, nil
+	}
+
+	if storeConfig.Type == "" || storeConfig.Type == "memory" {
+		return nil, fmt.Errorf("soft delete requires a persistent store, the memory store is lost on restart")
+	}
+
+	gracePeriod, err := time.ParseDuration(config.GracePeriod)
+	if err != nil || gracePeriod <= 0 {
+		return nil, fmt.Errorf("invalid soft delete grace period '%s'", config.GracePeriod)
+	}
+
+	d := &softDelete{
+		gracePeriod: gracePeriod,
+		interval:    time.Hour,
+		accounts:    config.Accounts,
+	}
+
+	if config.Interval != "" {
+		interval, err := time.ParseDuration(config.Interval)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid soft delete interval '%s'", config.Interval)
+		}
+		d.interval = interval
+	}
+
+	return d, nil
+}
+
+// repositoryDeletionKey is the store key of a soft deleted repository
+func repositoryDeletionKey(account, group, name string) string {
+	return fmt.Sprintf("%s/%s/%s", account, group, name)
+}
+
+// repositoryDeleteAt returns when the repository is purged from its tags, nil if it isn't pending deletion
+func repositoryDeleteAt(tags []*awsecr.Tag) *time.Time {
+	for _, t := range tags {
+		if aws.StringValue(t.Key) != repositoryDeleteAtTag {
+			continue
+		}
+
+		deleteAt, err := time.Parse(time.RFC3339, aws.StringValue(t.Value))
+		if err != nil {
+			log.Warnf("invalid %s tag value '%s': %s", repositoryDeleteAtTag, aws.StringValue(t.Value), err)
+			return nil
+		}
+
+		return &deleteAt
+	}
+
+	return nil
+}
+
+// repositoryPendingDeletion returns a conflict if the repository is soft deleted, its users can't be created or
+// enabled until it's restored
+func (o *ecrOrchestrator) repositoryPendingDeletion(ctx context.Context, group, name string) error {
+	repository := fmt.Sprintf("%s/%s", group, name)
+
+	repo, err := o.client.GetRepositories(ctx, repository)
+	if err != nil {
+		return err
+	}
+
+	tags, err := o.client.GetRepositoryTags(ctx, aws.StringValue(repo.RepositoryArn))
+	if err != nil {
+		return err
+	}
+
+	if at := repositoryDeleteAt(tags); at != nil {
+		msg := fmt.Sprintf("repository %s is pending deletion at %s", repository, at.Format(time.RFC3339))
+		return apierror.New(apierror.ErrConflict, msg, nil)
+	}
+
+	return nil
+}
+
+// repositorySoftDelete replaces the repository policy with one that denies pulls and tags the repository with
+// the time it will be purged.  It returns the repository policy before the delete.
+func (o *ecrOrchestrator) repositorySoftDelete(ctx context.Context, group, name string, deleteAt time.Time) (*RepositoryResponse, string, error) {
+	repository := fmt.Sprintf("%s/%s", group, name)
+
+	log.Debugf("soft deleting repository %s until %s", repository, deleteAt.Format(time.RFC3339))
+
+	repo, err := o.client.GetRepositories(ctx, repository)
+	if err != nil {
+		return nil, "", err
+	}
+
+	tags, err := o.client.GetRepositoryTags(ctx, aws.StringValue(repo.RepositoryArn))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if at := repositoryDeleteAt(tags); at != nil {
+		msg := fmt.Sprintf("repository %s is already pending deletion at %s", repository, at.Format(time.RFC3339))
+		return nil, "", apierror.New(apierror.ErrConflict, msg, nil)
+	}
+
+	policy, err := o.client.GetRepositoryPolicy(ctx, repository)
+	if err != nil {
+		return nil, "", err
+	}
+
+	access, err := repositoryAccessFromPolicy(policy)
+	if err != nil {
+		return nil, "", err
+	}
+
+	denyPolicy, err := repositoryPendingDeletionPolicy()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := o.client.UpdateRepositoryPolicy(ctx, repository, denyPolicy); err != nil {
+		return nil, "", err
+	}
+
+	deleteAtTag := &awsecr.Tag{
+		Key:   aws.String(repositoryDeleteAtTag),
+		Value: aws.String(deleteAt.UTC().Format(time.RFC3339)),
+	}
+
+	if err := o.client.UpdateRepositoryTags(ctx, aws.StringValue(repo.RepositoryArn), []*awsecr.Tag{deleteAtTag}); err != nil {
+		if rerr := o.restoreRepositoryPolicy(ctx, repository, policy); rerr != nil {
+			log.Errorf("failed to restore repository %s policy: %s", repository, rerr)
+		}
+		return nil, "", err
+	}
+
+	return repositoryResponseFromECR(repo, access, append(tags, deleteAtTag)), policy, nil
+}
+
+// repositoryRestore restores the policy of a soft deleted repository and removes the pending deletion tag
+func (o *ecrOrchestrator) repositoryRestore(ctx context.Context, group, name, policy string) (*RepositoryResponse, error) {
+	repository := fmt.Sprintf("%s/%s", group, name)
+
+	log.Debugf("restoring soft deleted repository %s", repository)
+
+	repo, err := o.client.GetRepositories(ctx, repository)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := o.restoreRepositoryPolicy(ctx, repository, policy); err != nil {
+		return nil, err
+	}
+
+	if err := o.client.DeleteRepositoryTags(ctx, aws.StringValue(repo.RepositoryArn), []string{repositoryDeleteAtTag}); err != nil {
+		return nil, err
+	}
+
+	access, err := repositoryAccessFromPolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := o.client.GetRepositoryTags(ctx, aws.StringValue(repo.RepositoryArn))
+	if err != nil {
+		return nil, err
+	}
+
+	return repositoryResponseFromECR(repo, access, tags), nil
+}
+
+// restoreRepositoryPolicy sets the repository policy, or deletes it if the policy is empty
+func (o *ecrOrchestrator) restoreRepositoryPolicy(ctx context.Context, repository, policy string) error {
+	if policy == "" {
+		return o.client.DeleteRepositoryPolicy(ctx, repository)
+	}
+	return o.client.UpdateRepositoryPolicy(ctx, repository, policy)
+}
+
+// disableRepositoryUserKeys disables the active access keys of the repository users.  It returns the users
+// and the ids of the keys it disabled by user, including the keys disabled before an error.
+func (o *iamOrchestrator) disableRepositoryUserKeys(ctx context.Context, group, name string) ([]string, map[string][]string, error) {
+	disabled := map[string][]string{}
+
+	users, err := o.listRepositoryUsers(ctx, group, name)
+	if err != nil {
+		return nil, disabled, err
+	}
+
+	for _, u := range users {
+		userName := repositoryUserIAMName(group, name, u)
+
+		keys, err := o.client.ListAccessKeys(ctx, userName)
+		if err != nil {
+			return users, disabled, err
+		}
+
+		for _, k := range keys {
+			if aws.StringValue(k.Status) != awsiam.StatusTypeActive {
+				continue
+			}
+
+			keyId := aws.StringValue(k.AccessKeyId)
+			if err := o.client.UpdateAccessKey(ctx, userName, keyId, awsiam.StatusTypeInactive); err != nil {
+				return users, disabled, err
+			}
+			disabled[u] = append(disabled[u], keyId)
+		}
+	}
+
+	return users, disabled, nil
+}
+
+// enableRepositoryUserKeys enables the access keys by repository user.  Users and keys that were deleted
+// since they were disabled are skipped.  It returns the users with enabled keys.
+func (o *iamOrchestrator) enableRepositoryUserKeys(ctx context.Context, group, name string, keys map[string][]string) ([]string, error) {
+	users := make([]string, 0, len(keys))
+	for u := range keys {
+		users = append(users, u)
+	}
+	sort.Strings(users)
+
+	enabled := []string{}
+	for _, u := range users {
+		userName := repositoryUserIAMName(group, name, u)
+
+		for _, keyId := range keys[u] {
+			if err := o.client.UpdateAccessKey(ctx, userName, keyId, awsiam.StatusTypeActive); err != nil {
+				if aerr, ok := err.(apierror.Error); ok && aerr.Code == apierror.ErrNotFound {
+					log.Warnf("access key %s of repository user %s no longer exists", keyId, userName)
+					continue
+				}
+				return enabled, err
+			}
+		}
+
+		enabled = append(enabled, u)
+	}
+
+	return enabled, nil
+}
+
+// softDeleteRepository soft deletes a repository in the account
+func (s *server) softDeleteRepository(ctx context.Context, account, group, name string) (*RepositoryResponse, []string, error) {
+	policy, err := s.repositorySoftDeletePolicy(s.org)
+	if err != nil {
+		return nil, nil, apierror.New(apierror.ErrInternalError, "failed to generate policy", err)
+	}
+
+	ecrOrch, iamOrch, err := s.repositoryDeleteOrchestrators(ctx, account, policy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return s.softDeleteRepositoryWithOrchestrators(ctx, ecrOrch, iamOrch, account, group, name)
+}
+
+// softDeleteRepositoryWithOrchestrators denies pulls from the repository, disables the access keys of its users
+// and stores what's needed to restore it until the grace period ends
+func (s *server) softDeleteRepositoryWithOrchestrators(ctx context.Context, ecrOrch *ecrOrchestrator, iamOrch *iamOrchestrator, account, group, name string) (resp *RepositoryResponse, users []string, err error) {
+	// setup rollback function list and defer execution
+	var rollBackTasks []rollbackFunc
+	defer func() {
+		if err != nil {
+			log.Errorf("recovering from error: %s, executing %d rollback tasks", err, len(rollBackTasks))
+			rollBack(&rollBackTasks)
+		}
+	}()
+
+	now := time.Now().UTC()
+	deletion := &RepositoryDeletion{
+		Account:    account,
+		Repository: fmt.Sprintf("%s/%s", group, name),
+		DeletedAt:  now,
+		DeleteAt:   now.Add(s.softDelete.gracePeriod),
+	}
+
+	resp, deletion.Policy, err = ecrOrch.repositorySoftDelete(ctx, group, name, deletion.DeleteAt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rollBackTasks = append(rollBackTasks, func(ctx context.Context) error {
+		_, err := ecrOrch.repositoryRestore(ctx, group, name, deletion.Policy)
+		return err
+	})
+
+	users, deletion.Keys, err = iamOrch.disableRepositoryUserKeys(ctx, group, name)
+
+	// the keys disabled before an error are enabled again
+	rollBackTasks = append(rollBackTasks, func(ctx context.Context) error {
+		_, err := iamOrch.enableRepositoryUserKeys(ctx, group, name, deletion.Keys)
+		return err
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = store.PutJSON(ctx, s.store, repositoryDeletionsBucket, repositoryDeletionKey(account, group, name), deletion); err != nil {
+		return nil, nil, err
+	}
+
+	s.notify(ctx, notificationRepositoryPending, account, group, &RepositoryNotification{
+		Repository: deletion.Repository,
+		Users:      users,
+	})
+
+	return resp, users, nil
+}
+
+// restoreRepository restores a soft deleted repository in the account
+func (s *server) restoreRepository(ctx context.Context, account, group, name string) (*RepositoryResponse, []string, error) {
+	policy, err := s.repositorySoftDeletePolicy(s.org)
+	if err != nil {
+		return nil, nil, apierror.New(apierror.ErrInternalError, "failed to generate policy", err)
+	}
+
+	ecrOrch, iamOrch, err := s.repositoryDeleteOrchestrators(ctx, account, policy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return s.restoreRepositoryWithOrchestrators(ctx, ecrOrch, iamOrch, account, group, name)
+}
+
+// restoreRepositoryWithOrchestrators restores the repository policy and enables the access keys of the users
+// of a soft deleted repository before its grace period ends
+func (s *server) restoreRepositoryWithOrchestrators(ctx context.Context, ecrOrch *ecrOrchestrator, iamOrch *iamOrchestrator, account, group, name string) (*RepositoryResponse, []string, error) {
+	key := repositoryDeletionKey(account, group, name)
+
+	deletion := RepositoryDeletion{}
+	if err := store.GetJSON(ctx, s.store, repositoryDeletionsBucket, key, &deletion); err != nil {
+		if aerr, ok := err.(apierror.Error); ok && aerr.Code == apierror.ErrNotFound {
+			msg := fmt.Sprintf("repository %s/%s is not pending deletion", group, name)
+			return nil, nil, apierror.New(apierror.ErrNotFound, msg, nil)
+		}
+		return nil, nil, err
+	}
+
+	if !deletion.DeleteAt.After(time.Now()) {
+		msg := fmt.Sprintf("repository %s grace period ended at %s", deletion.Repository, deletion.DeleteAt.Format(time.RFC3339))
+		return nil, nil, apierror.New(apierror.ErrConflict, msg, nil)
+	}
+
+	resp, err := ecrOrch.repositoryRestore(ctx, group, name, deletion.Policy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	users, err := iamOrch.enableRepositoryUserKeys(ctx, group, name, deletion.Keys)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.store.Delete(ctx, repositoryDeletionsBucket, key); err != nil {
+		return nil, nil, err
+	}
+
+	s.notify(ctx, notificationRepositoryRestored, account, group, &RepositoryNotification{
+		Repository: deletion.Repository,
+		Users:      users,
+	})
+
+	return resp, users, nil
+}
+
+// dueRepositoryDeletions returns the soft deleted repositories past their grace period, oldest first
+func (s *server) dueRepositoryDeletions(ctx context.Context, now time.Time) ([]*RepositoryDeletion, error) {
+	items, err := s.store.List(ctx, repositoryDeletionsBucket, "")
+	if err != nil {
+		return nil, err
+	}
+
+	due := []*RepositoryDeletion{}
+	for key, b := range items {
+		d := &RepositoryDeletion{}
+		if err := json.Unmarshal(b, d); err != nil {
+			log.Errorf("failed to decode soft deleted repository %s: %s", key, err)
+			continue
+		}
+
+		if d.DeleteAt.After(now) {
+			continue
+		}
+
+		due = append(due, d)
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].DeleteAt.Before(due[j].DeleteAt)
+	})
+
+	return due, nil
+}
+
+// taggedRepositoryDeletions returns the repositories in the org tagged for deletion in the account before now.
+// The tag is set on every soft deleted repository, so they're found even if they're missing from the store.
+func (s *server) taggedRepositoryDeletions(ctx context.Context, service resourcegroupstaggingapi.ResourceGroupsTaggingAPI, account string, now time.Time) ([]*RepositoryDeletion, error) {
+	tagFilters := []*resourcegroupstaggingapi.TagFilter{
+		{
+			Key:   "spinup:org",
+			Value: []string{s.org},
+		},
+		{
+			Key: repositoryDeleteAtTag,
+		},
+	}
+
+	out, err := service.GetResourcesWithTags(ctx, []string{"ecr"}, tagFilters)
+	if err != nil {
+		return nil, err
+	}
+
+	due := []*RepositoryDeletion{}
+	for _, r := range out {
+		a, err := arn.Parse(aws.StringValue(r.ResourceARN))
+		if err != nil {
+			msg := fmt.Sprintf("failed to parse ARN %s: %s", aws.StringValue(r.ResourceARN), err)
+			return nil, apierror.New(apierror.ErrInternalError, msg, err)
+		}
+
+		tags := make([]*awsecr.Tag, 0, len(r.Tags))
+		for _, t := range r.Tags {
+			tags = append(tags, &awsecr.Tag{Key: t.Key, Value: t.Value})
+		}
+
+		deleteAt := repositoryDeleteAt(tags)
+		if deleteAt == nil || deleteAt.After(now) {
+			continue
+		}
+
+		due = append(due, &RepositoryDeletion{
+			Account:    account,
+			Repository: strings.TrimPrefix(a.Resource, "repository/"),
+			DeleteAt:   *deleteAt,
+		})
+	}
+
+	return due, nil
+}
+
+// dueTaggedRepositoryDeletions returns the repositories tagged for deletion in the account before now
+func (s *server) dueTaggedRepositoryDeletions(ctx context.Context, account string, now time.Time) ([]*RepositoryDeletion, error) {
+	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
+
+	session, err := s.assumeRole(
+		ctx,
+		s.session.ExternalID,
+		role,
+		"",
+		"arn:aws:iam::aws:policy/ResourceGroupsandTagEditorReadOnlyAccess",
+	)
+	if err != nil {
+		msg := fmt.Sprintf("failed to assume role in account: %s", account)
+		return nil, apierror.New(apierror.ErrForbidden, msg, nil)
+	}
+
+	return s.taggedRepositoryDeletions(ctx, resourcegroupstaggingapi.New(resourcegroupstaggingapi.WithSession(session.Session)), account, now)
+}
+
+// pendingRepositoryDeletions returns the soft deleted repositories past their grace period from the store and
+// from the deleteAt tag in the configured accounts and the accounts in the store
+func (s *server) pendingRepositoryDeletions(ctx context.Context, now time.Time) []*RepositoryDeletion {
+	deletions, err := s.dueRepositoryDeletions(ctx, now)
+	if err != nil {
+		log.Errorf("failed to list soft deleted repositories: %s", err)
+	}
+
+	seen := map[string]bool{}
+	accounts := append([]string{}, s.softDelete.accounts...)
+	for _, d := range deletions {
+		group, name := splitRepositoryName(d.Repository)
+		seen[repositoryDeletionKey(d.Account, group, name)] = true
+		accounts = append(accounts, d.Account)
+	}
+
+	checked := map[string]bool{}
+	for _, account := range accounts {
+		if checked[account] {
+			continue
+		}
+		checked[account] = true
+
+		tagged, err := s.dueTaggedRepositoryDeletions(ctx, account, now)
+		if err != nil {
+			log.Errorf("failed to find repositories tagged for deletion in account %s: %s", account, err)
+			continue
+		}
+
+		for _, d := range tagged {
+			group, name := splitRepositoryName(d.Repository)
+			if key := repositoryDeletionKey(d.Account, group, name); !seen[key] {
+				log.Warnf("repository %s in account %s is tagged for deletion but isn't in the store", d.Repository, d.Account)
+				seen[key] = true
+				deletions = append(deletions, d)
+			}
+		}
+	}
+
+	return deletions
+}
+
+// purgeDeletedRepository deletes a soft deleted repository past its grace period
+func (s *server) purgeDeletedRepository(ctx context.Context, d *RepositoryDeletion) error {
+	policy, err := s.repositoryDeletePolicy(s.org)
+	if err != nil {
+		return apierror.New(apierror.ErrInternalError, "failed to generate policy", err)
+	}
+
+	ecrOrch, iamOrch, err := s.repositoryDeleteOrchestrators(ctx, d.Account, policy)
+	if err != nil {
+		return err
+	}
+
+	return s.purgeDeletedRepositoryWithOrchestrators(ctx, ecrOrch, iamOrch, d)
+}
+
+// purgeDeletedRepositoryWithOrchestrators deletes a soft deleted repository and its users.  If the repository
+// was already deleted outside of the API, its users and stored state are still removed.
+func (s *server) purgeDeletedRepositoryWithOrchestrators(ctx context.Context, ecrOrch *ecrOrchestrator, iamOrch *iamOrchestrator, d *RepositoryDeletion) error {
+	group, name := splitRepositoryName(d.Repository)
+
+	_, _, err := s.deleteRepositoryWithOrchestrators(ctx, ecrOrch, iamOrch, d.Account, group, name)
+	if err == nil {
+		return nil
+	}
+
+	if aerr, ok := err.(apierror.Error); !ok || aerr.Code != apierror.ErrNotFound {
+		return err
+	}
+
+	log.Warnf("soft deleted repository %s no longer exists in account %s", d.Repository, d.Account)
+
+	if _, err := iamOrch.repositoryUserDeleteAll(ctx, name, group); err != nil {
+		return err
+	}
+
+	return s.store.Delete(ctx, repositoryDeletionsBucket, repositoryDeletionKey(d.Account, group, name))
+}
+
+// softDeleteJob periodically purges the soft deleted repositories past their grace period until the context is cancelled
+func (s *server) softDeleteJob(ctx context.Context) {
+	log.Infof("purging soft deleted repositories every %s after a grace period of %s", s.softDelete.interval, s.softDelete.gracePeriod)
+
+	ticker := time.NewTicker(s.softDelete.interval)
+	defer ticker.Stop()
+
+	for {
+		for _, d := range s.pendingRepositoryDeletions(ctx, time.Now()) {
+			if err := s.purgeDeletedRepository(ctx, d); err != nil {
+				log.Errorf("failed to purge soft deleted repository %s in account %s: %s", d.Repository, d.Account, err)
+				continue
+			}
+
+			log.Infof("purged soft deleted repository %s in account %s", d.Repository, d.Account)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
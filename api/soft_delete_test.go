@@ -0,0 +1,406 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/ecr-api/common"
+	"github.com/YaleSpinup/ecr-api/ecr"
+	"github.com/YaleSpinup/ecr-api/iam"
+	"github.com/YaleSpinup/ecr-api/resourcegroupstaggingapi"
+	"github.com/YaleSpinup/ecr-api/store"
+	"github.com/aws/aws-sdk-go/aws"
+	awsecr "github.com/aws/aws-sdk-go/service/ecr"
+	awsiam "github.com/aws/aws-sdk-go/service/iam"
+	awstagging "github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi"
+)
+
+func TestNewSoftDelete(t *testing.T) {
+	tests := []struct {
+		name            string
+		config          common.SoftDelete
+		store           common.Store
+		wantNil         bool
+		wantErr         bool
+		wantGracePeriod time.Duration
+		wantInterval    time.Duration
+	}{
+		{
+			name:    "disabled",
+			config:  common.SoftDelete{Interval: "1h"},
+			wantNil: true,
+		},
+		{
+			name:            "default interval",
+			config:          common.SoftDelete{GracePeriod: "168h"},
+			store:           common.Store{Type: "file"},
+			wantGracePeriod: 168 * time.Hour,
+			wantInterval:    time.Hour,
+		},
+		{
+			name:            "interval",
+			config:          common.SoftDelete{GracePeriod: "72h", Interval: "15m"},
+			store:           common.Store{Type: "file"},
+			wantGracePeriod: 72 * time.Hour,
+			wantInterval:    15 * time.Minute,
+		},
+		{
+			name:    "invalid grace period",
+			config:  common.SoftDelete{GracePeriod: "a week"},
+			store:   common.Store{Type: "file"},
+			wantErr: true,
+		},
+		{
+			name:    "negative grace period",
+			config:  common.SoftDelete{GracePeriod: "-1h"},
+			store:   common.Store{Type: "file"},
+			wantErr: true,
+		},
+		{
+			name:    "memory store",
+			config:  common.SoftDelete{GracePeriod: "72h"},
+			store:   common.Store{Type: "memory"},
+			wantErr: true,
+		},
+		{
+			name:    "default store",
+			config:  common.SoftDelete{GracePeriod: "72h"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid interval",
+			config:  common.SoftDelete{GracePeriod: "72h", Interval: "hourly"},
+			store:   common.Store{Type: "file"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newSoftDelete(tt.config, tt.store)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newSoftDelete() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if (got == nil) != tt.wantNil {
+				t.Fatalf("newSoftDelete() = %+v, wantNil %t", got, tt.wantNil)
+			}
+
+			if got != nil && (got.gracePeriod != tt.wantGracePeriod || got.interval != tt.wantInterval) {
+				t.Errorf("expected grace period %s and interval %s, got %+v", tt.wantGracePeriod, tt.wantInterval, got)
+			}
+		})
+	}
+}
+
+type softDeleteTest struct {
+	server    *server
+	notifier  *recordingNotifier
+	ecrClient *fakeECR
+	iamClient *fakeIAM
+	ecrOrch   *ecrOrchestrator
+	iamOrch   *iamOrchestrator
+	policy    string
+}
+
+// orchestrators returns the test orchestrators for background jobs
+func (st *softDeleteTest) orchestrators(ctx context.Context) (*ecrOrchestrator, *iamOrchestrator, error) {
+	return st.ecrOrch, st.iamOrch, nil
+}
+
+// newSoftDeleteTest creates the spindev-00001/rudolph repository shared with spindev-00002 and two users,
+// the comet user's key is already disabled
+func newSoftDeleteTest(t *testing.T) *softDeleteTest {
+	ctx := context.Background()
+
+	policy, err := repositoryPolicy(&repositoryAccess{groups: []string{"spindev-00002"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	ecrClient := newFakeECR("12345")
+	ecrClient.addRepository("spindev-00001/rudolph", policy,
+		&awsecr.Tag{Key: aws.String("spinup:org"), Value: aws.String("testOrg")},
+		&awsecr.Tag{Key: aws.String("spinup:spaceid"), Value: aws.String("spindev-00001")},
+	)
+
+	iamClient := newFakeIAM()
+	iamOrch := newIamOrchestrator(iam.IAM{Service: iamClient}, "testOrg")
+
+	roleGroups, err := iamOrch.prepareAccount(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, u := range []string{"dasher", "comet"} {
+		if _, err := iamOrch.repositoryUserCreate(ctx, "rudolph", "spindev-00001", roleGroups["pull"], &RepositoryUserCreateRequest{UserName: u, Role: "pull"}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if _, err := iamOrch.client.CreateAccessKey(ctx, "rudolph-"+u); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	cometKey := aws.StringValue(iamClient.keys["rudolph-comet"][0].AccessKeyId)
+	if err := iamOrch.client.UpdateAccessKey(ctx, "rudolph-comet", cometKey, awsiam.StatusTypeInactive); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	n := &recordingNotifier{}
+	return &softDeleteTest{
+		server: &server{
+			store:      store.NewMemoryStore(),
+			notifier:   n,
+			softDelete: &softDelete{gracePeriod: 72 * time.Hour, interval: time.Hour},
+		},
+		notifier:  n,
+		ecrClient: ecrClient,
+		iamClient: iamClient,
+		ecrOrch:   newEcrOrchestrator(ecr.ECR{Service: ecrClient}, "testOrg"),
+		iamOrch:   iamOrch,
+		policy:    policy,
+	}
+}
+
+func (st *softDeleteTest) keyStatus(userName string) string {
+	return aws.StringValue(st.iamClient.keys[userName][0].Status)
+}
+
+func TestServer_softDeleteAndRestoreRepository(t *testing.T) {
+	ctx := context.Background()
+	st := newSoftDeleteTest(t)
+	s := st.server
+
+	resp, users, err := s.softDeleteRepositoryWithOrchestrators(ctx, st.ecrOrch, st.iamOrch, "12345", "spindev-00001", "rudolph")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if resp.DeleteAt == nil || resp.DeleteAt.Before(time.Now().Add(71*time.Hour)) {
+		t.Errorf("expected the repository to be deleted in 72h, got %v", resp.DeleteAt)
+	}
+
+	if len(users) != 2 {
+		t.Errorf("expected 2 users, got %v", users)
+	}
+
+	if tag := st.ecrClient.tagValue("spindev-00001/rudolph", repositoryDeleteAtTag); tag == "" {
+		t.Error("expected the repository to be tagged as pending deletion")
+	}
+
+	denyPolicy, _ := repositoryPendingDeletionPolicy()
+	if st.ecrClient.policies["spindev-00001/rudolph"] != denyPolicy {
+		t.Errorf("expected the pull deny policy, got %s", st.ecrClient.policies["spindev-00001/rudolph"])
+	}
+
+	for _, u := range []string{"rudolph-dasher", "rudolph-comet"} {
+		if status := st.keyStatus(u); status != awsiam.StatusTypeInactive {
+			t.Errorf("expected %s key to be inactive, got %s", u, status)
+		}
+	}
+
+	deletion := RepositoryDeletion{}
+	if err := store.GetJSON(ctx, s.store, repositoryDeletionsBucket, "12345/spindev-00001/rudolph", &deletion); err != nil {
+		t.Fatalf("expected the deletion to be stored, got %s", err)
+	}
+
+	if deletion.Policy != st.policy || len(deletion.Keys) != 1 || len(deletion.Keys["dasher"]) != 1 {
+		t.Errorf("unexpected stored deletion %+v", deletion)
+	}
+
+	if _, _, err := s.softDeleteRepositoryWithOrchestrators(ctx, st.ecrOrch, st.iamOrch, "12345", "spindev-00001", "rudolph"); err == nil {
+		t.Error("expected an error deleting a repository pending deletion")
+	} else if aerr, ok := err.(apierror.Error); !ok || aerr.Code != apierror.ErrConflict {
+		t.Errorf("expected a conflict, got %s", err)
+	}
+
+	if _, err := st.ecrOrch.repositoryUpdate(ctx, "12345", "spindev-00001", "rudolph", &RepositoryUpdateRequest{Groups: []string{}}); err == nil {
+		t.Error("expected an error updating a repository pending deletion")
+	}
+
+	if err := st.ecrOrch.repositoryPendingDeletion(ctx, "spindev-00001", "rudolph"); err == nil {
+		t.Error("expected the repository to be pending deletion")
+	} else if aerr, ok := err.(apierror.Error); !ok || aerr.Code != apierror.ErrConflict {
+		t.Errorf("expected a conflict, got %s", err)
+	}
+
+	resp, users, err = s.restoreRepositoryWithOrchestrators(ctx, st.ecrOrch, st.iamOrch, "12345", "spindev-00001", "rudolph")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if resp.DeleteAt != nil || len(resp.Groups) != 1 || resp.Groups[0] != "spindev-00002" {
+		t.Errorf("unexpected restored repository %+v", resp)
+	}
+
+	if len(users) != 1 || users[0] != "dasher" {
+		t.Errorf("expected dasher to be enabled, got %v", users)
+	}
+
+	if st.ecrClient.policies["spindev-00001/rudolph"] != st.policy {
+		t.Errorf("expected the policy to be restored, got %s", st.ecrClient.policies["spindev-00001/rudolph"])
+	}
+
+	if tag := st.ecrClient.tagValue("spindev-00001/rudolph", repositoryDeleteAtTag); tag != "" {
+		t.Errorf("expected the pending deletion tag to be removed, got %s", tag)
+	}
+
+	if status := st.keyStatus("rudolph-dasher"); status != awsiam.StatusTypeActive {
+		t.Errorf("expected dasher key to be active, got %s", status)
+	}
+
+	if status := st.keyStatus("rudolph-comet"); status != awsiam.StatusTypeInactive {
+		t.Errorf("expected comet key to stay inactive, got %s", status)
+	}
+
+	if err := st.ecrOrch.repositoryPendingDeletion(ctx, "spindev-00001", "rudolph"); err != nil {
+		t.Errorf("expected the restored repository not to be pending deletion, got %s", err)
+	}
+
+	if _, _, err := s.restoreRepositoryWithOrchestrators(ctx, st.ecrOrch, st.iamOrch, "12345", "spindev-00001", "rudolph"); err == nil {
+		t.Error("expected an error restoring a repository that isn't pending deletion")
+	} else if aerr, ok := err.(apierror.Error); !ok || aerr.Code != apierror.ErrNotFound {
+		t.Errorf("expected not found, got %s", err)
+	}
+
+	var types []string
+	for _, n := range st.notifier.notifications {
+		types = append(types, n.Type)
+	}
+
+	if len(types) != 2 || types[0] != notificationRepositoryPending || types[1] != notificationRepositoryRestored {
+		t.Errorf("expected pending deletion and restored notifications, got %v", types)
+	}
+}
+
+func TestServer_restoreRepositoryAfterGracePeriod(t *testing.T) {
+	ctx := context.Background()
+	st := newSoftDeleteTest(t)
+	s := st.server
+
+	if _, _, err := s.softDeleteRepositoryWithOrchestrators(ctx, st.ecrOrch, st.iamOrch, "12345", "spindev-00001", "rudolph"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	deletion := RepositoryDeletion{}
+	if err := store.GetJSON(ctx, s.store, repositoryDeletionsBucket, "12345/spindev-00001/rudolph", &deletion); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	deletion.DeleteAt = time.Now().Add(-time.Minute)
+	if err := store.PutJSON(ctx, s.store, repositoryDeletionsBucket, "12345/spindev-00001/rudolph", &deletion); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, _, err := s.restoreRepositoryWithOrchestrators(ctx, st.ecrOrch, st.iamOrch, "12345", "spindev-00001", "rudolph"); err == nil {
+		t.Error("expected an error restoring a repository after the grace period")
+	} else if aerr, ok := err.(apierror.Error); !ok || aerr.Code != apierror.ErrConflict {
+		t.Errorf("expected a conflict, got %s", err)
+	}
+}
+
+func TestServer_purgeDeletedRepository(t *testing.T) {
+	for _, alreadyDeleted := range []bool{false, true} {
+		ctx := context.Background()
+		st := newSoftDeleteTest(t)
+		s := st.server
+
+		if _, _, err := s.softDeleteRepositoryWithOrchestrators(ctx, st.ecrOrch, st.iamOrch, "12345", "spindev-00001", "rudolph"); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		due, err := s.dueRepositoryDeletions(ctx, time.Now())
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if len(due) != 0 {
+			t.Errorf("expected no repositories due for deletion, got %d", len(due))
+		}
+
+		due, err = s.dueRepositoryDeletions(ctx, time.Now().Add(73*time.Hour))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if len(due) != 1 || due[0].Repository != "spindev-00001/rudolph" || due[0].Account != "12345" {
+			t.Fatalf("expected the repository to be due for deletion, got %+v", due)
+		}
+
+		if alreadyDeleted {
+			delete(st.ecrClient.repos, "spindev-00001/rudolph")
+		}
+
+		if err := s.purgeDeletedRepositoryWithOrchestrators(ctx, st.ecrOrch, st.iamOrch, due[0]); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if _, ok := st.ecrClient.repos["spindev-00001/rudolph"]; ok {
+			t.Error("expected the repository to be deleted")
+		}
+
+		if len(st.iamClient.users) != 0 {
+			t.Errorf("expected the repository users to be deleted, got %d users", len(st.iamClient.users))
+		}
+
+		items, err := s.store.List(ctx, repositoryDeletionsBucket, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if len(items) != 0 {
+			t.Errorf("expected the stored deletion to be removed, got %d", len(items))
+		}
+
+		last := st.notifier.notifications[len(st.notifier.notifications)-1]
+		if alreadyDeleted == (last.Type == notificationRepositoryDeleted) {
+			t.Errorf("unexpected last notification %s when the repository was already deleted %t", last.Type, alreadyDeleted)
+		}
+	}
+}
+
+func TestServer_taggedRepositoryDeletions(t *testing.T) {
+	now := time.Now()
+	s := &server{org: "testOrg"}
+
+	deleteAt := func(t time.Time) []*awstagging.Tag {
+		return []*awstagging.Tag{{Key: aws.String(repositoryDeleteAtTag), Value: aws.String(t.UTC().Format(time.RFC3339))}}
+	}
+
+	service := resourcegroupstaggingapi.ResourceGroupsTaggingAPI{
+		Service: &fakeTagging{
+			org: "testOrg",
+			resources: []string{
+				"arn:aws:ecr:us-east-1:12345:repository/spindev-00001/rudolph",
+				"arn:aws:ecr:us-east-1:12345:repository/spindev-00001/blitzen",
+				"arn:aws:ecr:us-east-1:12345:repository/spindev-00002/comet",
+			},
+			tags: map[string][]*awstagging.Tag{
+				"arn:aws:ecr:us-east-1:12345:repository/spindev-00001/rudolph": deleteAt(now.Add(-time.Hour)),
+				"arn:aws:ecr:us-east-1:12345:repository/spindev-00001/blitzen": deleteAt(now.Add(time.Hour)),
+				"arn:aws:ecr:us-east-1:12345:repository/spindev-00002/comet":   {{Key: aws.String(repositoryDeleteAtTag), Value: aws.String("tomorrow")}},
+			},
+		},
+	}
+
+	due, err := s.taggedRepositoryDeletions(context.Background(), service, "12345", now)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(due) != 1 || due[0].Repository != "spindev-00001/rudolph" || due[0].Account != "12345" {
+		t.Errorf("expected spindev-00001/rudolph to be due for deletion, got %+v", due)
+	}
+
+	service.Service = &fakeTagging{org: "testOrg", resources: []string{"not-an-arn"}}
+	if _, err := s.taggedRepositoryDeletions(context.Background(), service, "12345", now); err == nil {
+		t.Error("expected an error for an invalid ARN")
+	}
+}
@@ -1,11 +1,14 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	ecrSvc "github.com/YaleSpinup/ecr-api/ecr"
+	iamSvc "github.com/YaleSpinup/ecr-api/iam"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awsutil"
 	"github.com/aws/aws-sdk-go/service/ecr"
@@ -42,15 +45,36 @@ type RepositoryCreateRequest struct {
 	// List of additioal group ids that should have access to the repository
 	Groups []string
 
+	// List of account ids or principal ARNs in other accounts that can pull from the repository
+	AllowedPrincipals []string
+
+	// List of services that can pull from the repository on behalf of resources, like lambda functions
+	AllowedServices []*RepositoryServiceAccess
+
 	// Tags to apply to the repository
 	Tags []*Tag
+
+	// statements are the repository policy statements not managed by the api, only set when a repository
+	// is copied so they're kept in the policy of the copy
+	statements []iamSvc.StatementEntry
 }
 
 // RepositoryUpdateRequest is the payload for updating an ECR repository
 type RepositoryUpdateRequest struct {
-	Groups     []string
-	ScanOnPush string
-	Tags       []*Tag
+	Groups            []string
+	AllowedPrincipals []string
+	AllowedServices   []*RepositoryServiceAccess
+	ScanOnPush        string
+	Tags              []*Tag
+}
+
+// RepositoryServiceAccess allows a service to pull from a repository on behalf of the resources in the source
+// accounts or matching the source ARNs, at least one of them is required
+type RepositoryServiceAccess struct {
+	// Service is codebuild or lambda
+	Service        string
+	SourceAccounts []string
+	SourceArns     []string
 }
 
 // RepositoryResponse is the response payload for repository operations
@@ -58,6 +82,8 @@ type RepositoryResponse struct {
 	CreatedAt          time.Time
 	EncryptionType     string
 	Groups             []string
+	AllowedPrincipals  []string
+	AllowedServices    []*RepositoryServiceAccess
 	KmsKeyId           string
 	ScanOnPush         string
 	ImageTagMutability string
@@ -66,29 +92,583 @@ type RepositoryResponse struct {
 	RepositoryName     string
 	RepositoryUri      string
 	Tags               []*Tag
+	// Policy is the full repository policy, including statements not managed by the api
+	Policy *iamSvc.PolicyDocument `json:",omitempty"`
+	// Replication is the replication status to each destination the repository is replicated to
+	Replication []*RepositoryReplicationStatus `json:",omitempty"`
+	// DeleteAt is when a soft deleted repository is purged, it can be restored until then
+	DeleteAt *time.Time `json:",omitempty"`
+}
+
+// RepositoryDeleteSummary is what would be destroyed by deleting a repository
+type RepositoryDeleteSummary struct {
+	Repository       string
+	ImageCount       int
+	TotalSizeInBytes int64
+	LastPushedAt     *time.Time `json:",omitempty"`
+	Users            []string
+}
+
+// empty returns true if the repository doesn't have any images or users
+func (r *RepositoryDeleteSummary) empty() bool {
+	return r.ImageCount == 0 && len(r.Users) == 0
+}
+
+// RepositoryDeletion is the stored state of a soft deleted repository, used to restore it
+type RepositoryDeletion struct {
+	Account    string
+	Repository string
+	DeletedAt  time.Time
+	DeleteAt   time.Time
+	// Policy is the repository policy before the repository was deleted, empty if it didn't have one
+	Policy string
+	// Keys are the ids of the access keys that were disabled, by repository user
+	Keys map[string][]string
+}
+
+// RepositoryGroupDeleteReport is the progress and outcome of deleting all of the repositories in a group
+type RepositoryGroupDeleteReport struct {
+	Id      string
+	Account string
+	Group   string
+	DryRun  bool
+	// Status is running, completed or failed
+	Status       string
+	Error        string `json:",omitempty"`
+	StartedAt    time.Time
+	CompletedAt  *time.Time `json:",omitempty"`
+	Repositories []*RepositoryGroupDeleteResult
+	// Users are the group-wide users of the group
+	Users []*RepositoryGroupDeleteUserResult
+}
+
+// RepositoryGroupDeleteResult is the outcome of deleting one of the repositories in a group
+type RepositoryGroupDeleteResult struct {
+	Repository string
+	ImageCount int
+	Users      []string
+	Deleted    bool
+	// DeleteAt is when a soft deleted repository is purged
+	DeleteAt *time.Time `json:",omitempty"`
+	Error    string     `json:",omitempty"`
+}
+
+// RepositoryGroupDeleteUserResult is the outcome of deleting one of the group-wide users of a group
+type RepositoryGroupDeleteUserResult struct {
+	UserName string
+	Deleted  bool
+	Error    string `json:",omitempty"`
+}
+
+// RepositoryMoveRequest is the request payload for moving a repository to another group
+type RepositoryMoveRequest struct {
+	// Group is the group the repository is moved to
+	Group string
+	// RepositoryName is the new name of the repository, it defaults to the current name
+	RepositoryName string
+}
+
+// RepositoryMove is the progress of a repository move
+type RepositoryMove struct {
+	Id      string
+	Account string
+	// Source is the repository being moved (group/name)
+	Source string
+	// Target is the repository it's moved to (group/name)
+	Target string
+	// Status is running, completed or failed
+	Status string
+	// Step is the step the move is running, or failed in
+	Step         string `json:",omitempty"`
+	ImageCount   int
+	ImagesCopied int
+	Users        []string
+	Error        string `json:",omitempty"`
+	// RolledBack is true when a failed move was rolled back
+	RolledBack  bool
+	StartedAt   time.Time
+	CompletedAt *time.Time `json:",omitempty"`
+}
+
+// RepositoryTokenRequest is the request payload for getting a registry token for a repository
+type RepositoryTokenRequest struct {
+	// Access is the access the token has to the repository, pull (the default) or push
+	Access string
+	// DurationSeconds is how long the token is valid, from 900 to 43200 seconds (default 3600)
+	DurationSeconds int64
+}
+
+// RepositoryTokenResponse is a docker login for a repository
+type RepositoryTokenResponse struct {
+	Access    string
+	Username  string
+	Password  string
+	Endpoint  string
+	ExpiresAt time.Time
 }
 
 // RepositoryUserCreateRequest is the request payload for creating a repository user
 type RepositoryUserCreateRequest struct {
 	UserName string
-	Groups   []string
-	Tags     []*Tag
+	// Role is the access the user has to the repository, one of pull, push or admin
+	Role   string
+	Groups []string
+	Tags   []*Tag
+	// ExpiresAt is when the user is deleted, users don't expire if it's empty
+	ExpiresAt *time.Time
 }
 
 // RepositoryUserResponse is the response payload for user operations
 type RepositoryUserResponse struct {
 	UserName          string
-	AccessKeys        []*iam.AccessKeyMetadata `json:",omitempty"`
-	AccessKey         *iam.AccessKey           `json:",omitempty"`
-	DeletedAccessKeys []string                 `json:",omitempty"`
-	Groups            []string                 `json:",omitempty"`
+	Role              string                     `json:",omitempty"`
+	Status            string                     `json:",omitempty"`
+	ExpiresAt         *time.Time                 `json:",omitempty"`
+	AccessKeys        []*RepositoryUserAccessKey `json:",omitempty"`
+	AccessKey         *iam.AccessKey             `json:",omitempty"`
+	DeletedAccessKeys []string                   `json:",omitempty"`
+	Groups            []string                   `json:",omitempty"`
 	Tags              []*Tag
 }
 
+// RepositoryUserAccessKey is a repository user's access key and when, where and with which service it was last used
+type RepositoryUserAccessKey struct {
+	*iam.AccessKeyMetadata
+	LastUsedDate    *time.Time `json:",omitempty"`
+	LastUsedService string     `json:",omitempty"`
+	LastUsedRegion  string     `json:",omitempty"`
+}
+
+// DormantAccessKeysReport is the report of repository user access keys that haven't been used recently
+type DormantAccessKeysReport struct {
+	Account string
+	// Days is the number of days without use after which a key is dormant
+	Days        int
+	GeneratedAt time.Time
+	Keys        []*DormantAccessKey
+}
+
+// DormantAccessKey is a repository user access key that has never been used or hasn't been used recently
+type DormantAccessKey struct {
+	UserName    string
+	Repository  string
+	IAMUserName string
+	AccessKeyId string
+	Status      string
+	CreatedAt   time.Time
+	NeverUsed   bool
+	// LastUsedDate, LastUsedService and LastUsedRegion are empty if the key has never been used
+	LastUsedDate    *time.Time `json:",omitempty"`
+	LastUsedService string     `json:",omitempty"`
+	LastUsedRegion  string     `json:",omitempty"`
+}
+
 // RepositoryUserUpdateRequest is the request payload for updating a user
 type RepositoryUserUpdateRequest struct {
 	ResetKey bool
-	Tags     []*Tag
+	// Status sets all of the user's access keys Active or Inactive
+	Status string
+	Tags   []*Tag
+}
+
+// ImageScanFindingsOutput is the response payload for the scan findings of an image in a repository
+type ImageScanFindingsOutput struct {
+	ImageId           *ecr.ImageIdentifier
+	ImageScanFindings *ImageScanFindings
+	ImageScanStatus   *ecr.ImageScanStatus
+	RegistryId        string
+	RepositoryName    string
+}
+
+// ImageScanFindings are the ECR image scan findings with any CVE exceptions applied
+type ImageScanFindings struct {
+	FindingSeverityCounts        map[string]*int64
+	Findings                     []*ImageScanFinding
+	EnhancedFindings             []*EnhancedImageScanFinding `json:",omitempty"`
+	ImageScanCompletedAt         *time.Time
+	VulnerabilitySourceUpdatedAt *time.Time
+
+	// SuppressedSeverityCounts are the number of findings per severity suppressed by an exception
+	SuppressedSeverityCounts map[string]int64 `json:",omitempty"`
+}
+
+// ImageScanFinding is an ECR image scan finding, marked as suppressed if an exception applies to it
+type ImageScanFinding struct {
+	*ecr.ImageScanFinding
+	Suppressed  bool   `json:",omitempty"`
+	ExceptionId string `json:",omitempty"`
+	// ExceptionJustification is why the risk of the suppressed finding is accepted
+	ExceptionJustification string `json:",omitempty"`
+}
+
+// EnhancedImageScanFinding is an enhanced (Inspector) image scan finding with the fix and
+// exploit availability, marked as suppressed if an exception applies to it
+type EnhancedImageScanFinding struct {
+	*ecr.EnhancedImageScanFinding
+	// YES, NO or PARTIAL
+	FixAvailable string `json:",omitempty"`
+	// YES or NO
+	ExploitAvailable string `json:",omitempty"`
+	// FixedInVersions maps the vulnerable package names to the version with the fix
+	FixedInVersions map[string]string `json:",omitempty"`
+	Suppressed      bool              `json:",omitempty"`
+	ExceptionId     string            `json:",omitempty"`
+	// ExceptionJustification is why the risk of the suppressed finding is accepted
+	ExceptionJustification string `json:",omitempty"`
+}
+
+// VulnerabilityId returns the CVE (or other vulnerability id) of the enhanced finding
+func (f *EnhancedImageScanFinding) VulnerabilityId() string {
+	if f.EnhancedImageScanFinding == nil || f.PackageVulnerabilityDetails == nil {
+		return ""
+	}
+	return aws.StringValue(f.PackageVulnerabilityDetails.VulnerabilityId)
+}
+
+// RegistryScanningConfiguration is the request and response payload for the registry scanning configuration
+type RegistryScanningConfiguration struct {
+	// BASIC or ENHANCED
+	ScanType string
+	Rules    []*RegistryScanningRule
+}
+
+// RegistryScanningRule is a scanning rule applied to the repositories matching the filters
+type RegistryScanningRule struct {
+	// SCAN_ON_PUSH, CONTINUOUS_SCAN or MANUAL.  BASIC scanning only supports SCAN_ON_PUSH and MANUAL.
+	ScanFrequency string
+	// RepositoryFilters are wildcard filters on the repository name, ie. spindev-00001/*
+	RepositoryFilters []string
+}
+
+// RegistryReplicationConfiguration is the request and response payload for the registry replication configuration
+type RegistryReplicationConfiguration struct {
+	Rules []*RegistryReplicationRule
+}
+
+// RegistryReplicationRule replicates the images pushed to the repositories matching the group prefixes to the
+// destinations
+type RegistryReplicationRule struct {
+	Destinations []*RegistryReplicationDestination
+	// GroupPrefixes are prefixes of the repository names, ie. spindev- for all of the spindev groups or
+	// spindev-00001/ for the repositories in a group
+	GroupPrefixes []string
+}
+
+// RegistryReplicationDestination is the region and account of a registry images are replicated to
+type RegistryReplicationDestination struct {
+	Region string
+	// Account defaults to the account of the registry
+	Account string
+}
+
+// RepositoryReplicationStatus is the replication status of the latest image in a repository to a destination
+type RepositoryReplicationStatus struct {
+	Region  string
+	Account string
+	// IN_PROGRESS, COMPLETE or FAILED.  NOT_REPLICATED if the image was pushed before the destination was added
+	// and NO_IMAGES if the repository is empty.
+	Status      string
+	FailureCode string `json:",omitempty"`
+	ImageDigest string `json:",omitempty"`
+}
+
+// FindingsSnapshot is the point-in-time severity counts and CVEs from an image scan, persisted to track
+// the vulnerability trend of a repository
+type FindingsSnapshot struct {
+	Repository           string
+	ImageDigest          string
+	ImageTags            []string `json:",omitempty"`
+	ImageScanCompletedAt time.Time
+	RecordedAt           time.Time
+	SeverityCounts       map[string]int64
+	// SuppressedSeverityCounts are the number of findings per severity suppressed by an exception
+	SuppressedSeverityCounts map[string]int64 `json:",omitempty"`
+	// CVEs are the sorted, unique vulnerability ids found in the image
+	CVEs []string
+}
+
+// FindingsTrendResponse is the response payload for the vulnerability trend of a repository
+type FindingsTrendResponse struct {
+	Repository string
+	Points     []*FindingsTrendPoint
+	// Comparison is set when comparing two images with the from and to query parameters
+	Comparison *FindingsComparison `json:",omitempty"`
+}
+
+// FindingsTrendPoint is a scan snapshot of an image and the CVEs introduced and fixed since the previous point
+type FindingsTrendPoint struct {
+	ImageDigest          string
+	ImageTags            []string `json:",omitempty"`
+	ImageScanCompletedAt time.Time
+	SeverityCounts       map[string]int64
+	Introduced           []string
+	Fixed                []string
+}
+
+// FindingsComparison is the CVEs introduced and fixed between the latest scans of two images
+type FindingsComparison struct {
+	From                 string
+	To                   string
+	Introduced           []string
+	Fixed                []string
+	SeverityCountsDeltas map[string]int64
+}
+
+// ImageDiffResponse is the response payload for comparing the vulnerabilities and layers of two images.  The
+// vulnerabilities are null when either image doesn't have scan findings.
+type ImageDiffResponse struct {
+	Repository           string
+	From                 *ImageDiffImage
+	To                   *ImageDiffImage
+	CVEsAdded            []string
+	CVEsRemoved          []string
+	SeverityCountsDeltas map[string]int64
+	SizeDeltaInBytes     int64
+	LayersAdded          []*ImageLayer
+	LayersRemoved        []*ImageLayer
+}
+
+// ImageDiffImage is one of the images being compared
+type ImageDiffImage struct {
+	ImageDigest          string
+	ImageTags            []string
+	ImagePushedAt        *time.Time
+	ImageSizeInBytes     int64
+	ImageScanCompletedAt *time.Time
+	SeverityCounts       map[string]int64
+	ScanError            string `json:",omitempty"`
+}
+
+// ImageLayer is a layer from an image manifest
+type ImageLayer struct {
+	Digest    string
+	MediaType string `json:",omitempty"`
+	Size      int64
+}
+
+// KeyRotationReport is the report of the access keys acted on by key rotation in an account
+type KeyRotationReport struct {
+	Account string
+	// Action taken on expired keys, rotate or disable
+	Action string
+	// MaxKeyAge is the maximum age of an access key in days
+	MaxKeyAge   int
+	DryRun      bool
+	StartedAt   time.Time
+	CompletedAt time.Time
+	Keys        []*KeyRotationResult
+}
+
+// KeyRotationResult is the outcome of key rotation for an expired access key
+type KeyRotationResult struct {
+	UserName   string
+	Repository string
+	// IAMUserName is the full iam user name
+	IAMUserName string
+	AccessKeyId string
+	CreatedAt   time.Time
+	// Action is rotated or disabled, or what would have been done for a dry run
+	Action         string
+	NewAccessKeyId string `json:",omitempty"`
+	Error          string `json:",omitempty"`
+}
+
+// UserPolicyReconcileReport is the report of reconciling the managed policies and groups of the user roles in an account
+type UserPolicyReconcileReport struct {
+	Account     string
+	DryRun      bool
+	GeneratedAt time.Time
+	Changes     []*UserPolicyChange
+}
+
+// UserPolicyChange is a change to the managed policy or group of a user role
+type UserPolicyChange struct {
+	Role   string
+	Type   string
+	Name   string
+	Action string
+	// PreviousDocument is the live default version of an updated policy
+	PreviousDocument  *iamSvc.PolicyDocument `json:",omitempty"`
+	PreviousVersionId string                 `json:",omitempty"`
+	PrunedVersionIds  []string               `json:",omitempty"`
+}
+
+// Report is a report generated in the background, like the repository policy audit
+type Report struct {
+	Id      string
+	Account string
+	// Type is repositoryPolicies, orphanedUsers or dormantKeys
+	Type string
+	// Status is running, completed or failed
+	Status      string
+	Error       string `json:",omitempty"`
+	StartedAt   time.Time
+	CompletedAt *time.Time `json:",omitempty"`
+	// Result is the report once it's completed
+	Result json.RawMessage `json:",omitempty"`
+}
+
+// RepositoryPolicyAuditReport is the report of the repositories in an account whose policy doesn't match the
+// policy generated for the access it grants
+type RepositoryPolicyAuditReport struct {
+	Account string
+	// Repair is true when the drifted policies are rewritten
+	Repair      bool
+	StartedAt   time.Time
+	CompletedAt time.Time
+	// Audited is the number of repositories in the org that were audited
+	Audited      int
+	Repositories []*RepositoryPolicyAuditResult
+}
+
+// RepositoryPolicyAuditResult is the difference between the live repository policy and the generated policy
+type RepositoryPolicyAuditResult struct {
+	Repository string
+	// Drifted is true when the statements managed by the api don't match the generated policy
+	Drifted       bool
+	MissingPolicy bool
+	// ChangedVersion is true when the policy language version isn't the current one
+	ChangedVersion bool
+	// MissingStatements, ChangedStatements and ChangedConditions are the Sids of the generated statements
+	// missing from the live policy, or with a different effect, principal, action or resource or condition
+	MissingStatements []string
+	ChangedStatements []string
+	ChangedConditions []string
+	// ExtraStatements are the Sids of the live statements that aren't generated, statements not managed by
+	// the api are kept when the policy is repaired
+	ExtraStatements []string
+	Repaired        bool
+	Error           string `json:",omitempty"`
+}
+
+// OrphanedUsersReport is the report of the repository users in an account whose repository no longer exists
+type OrphanedUsersReport struct {
+	Account     string
+	DryRun      bool
+	StartedAt   time.Time
+	CompletedAt time.Time
+	Users       []*OrphanedUser
+}
+
+// OrphanedUser is a repository user whose repository no longer exists
+type OrphanedUser struct {
+	UserName    string
+	Repository  string
+	IAMUserName string
+	CreatedAt   time.Time
+	Deleted     bool
+	Error       string `json:",omitempty"`
+}
+
+// ExpiredUsersReport is the report of the expired repository users deleted in an account
+type ExpiredUsersReport struct {
+	Account     string
+	DryRun      bool
+	StartedAt   time.Time
+	CompletedAt time.Time
+	Users       []*ExpiredUser
+}
+
+// ExpiredUser is a repository user past its expiry
+type ExpiredUser struct {
+	UserName    string
+	Repository  string
+	IAMUserName string
+	ExpiresAt   time.Time
+	Deleted     bool
+	Error       string `json:",omitempty"`
+}
+
+// WebhookCreateRequest is the request payload for registering a webhook for a space
+type WebhookCreateRequest struct {
+	// Url is the http(s) endpoint the events are posted to
+	Url string
+	// Events are the notification types delivered to the webhook, ie. repository.created
+	Events []string
+	// Secret is the HMAC signing secret, one is generated if it's empty
+	Secret      string
+	Description string
+}
+
+// Webhook is a registered webhook.  The secret is only returned when the webhook is created.
+type Webhook struct {
+	Id          string
+	Account     string
+	Group       string
+	Url         string
+	Events      []string
+	Description string `json:",omitempty"`
+	Secret      string `json:",omitempty"`
+	CreatedAt   time.Time
+}
+
+// WebhookDelivery is the delivery log of a notification to a webhook
+type WebhookDelivery struct {
+	Id          string
+	WebhookId   string
+	Type        string
+	Url         string
+	Attempts    int
+	StatusCode  int    `json:",omitempty"`
+	Error       string `json:",omitempty"`
+	Success     bool
+	StartedAt   time.Time
+	CompletedAt time.Time
+}
+
+// RepositoryNotification is the notification data when a repository is created, updated or deleted
+type RepositoryNotification struct {
+	Repository string
+	// Users are the repository users deleted with the repository
+	Users []string `json:",omitempty"`
+}
+
+// UserNotification is the notification data when a repository user is created, deleted or has their key rotated
+type UserNotification struct {
+	Repository string
+	UserName   string
+}
+
+// CVEExceptionCreateRequest is the request payload for creating a CVE exception
+type CVEExceptionCreateRequest struct {
+	// The CVE (finding name) being accepted, for example CVE-2019-25013
+	CVE string
+
+	// The scope of the exception, one of 'org', 'group', 'repository' or 'image'
+	Scope string
+
+	// The group (space id) the exception applies to, required for group, repository and image scope
+	Group string
+
+	// The repository name, without the group, required for repository and image scope
+	Repository string
+
+	// The image digest, required for image scope
+	ImageDigest string
+
+	// Why the risk is accepted
+	Justification string
+
+	// Who approved the exception
+	Approver string
+
+	// When the exception expires and the finding is no longer suppressed
+	ExpiresAt time.Time
+}
+
+// CVEException is an accepted-risk exception that suppresses matching scan findings
+type CVEException struct {
+	Id            string
+	Account       string
+	CVE           string
+	Scope         string
+	Group         string `json:",omitempty"`
+	Repository    string `json:",omitempty"`
+	ImageDigest   string `json:",omitempty"`
+	Justification string
+	Approver      string
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
 }
 
 // Tag is our AWS compatible tag struct that can be converted to specific tag types
@@ -98,18 +678,22 @@ type Tag struct {
 }
 
 // repositoryResponseFromECR maps ECR response to a common struct
-func repositoryResponseFromECR(r *ecr.Repository, groups []string, t []*ecr.Tag) *RepositoryResponse {
+func repositoryResponseFromECR(r *ecr.Repository, access *repositoryAccess, t []*ecr.Tag) *RepositoryResponse {
 	log.Debugf("mapping repository %s", awsutil.Prettify(r))
 
 	repository := RepositoryResponse{
 		CreatedAt:          aws.TimeValue(r.CreatedAt),
-		Groups:             groups,
+		Groups:             access.groups,
+		AllowedPrincipals:  access.principals,
+		AllowedServices:    access.services,
 		ImageTagMutability: aws.StringValue(r.ImageTagMutability),
 		RegistryId:         aws.StringValue(r.RegistryId),
 		RepositoryArn:      aws.StringValue(r.RepositoryArn),
 		RepositoryName:     aws.StringValue(r.RepositoryName),
 		RepositoryUri:      aws.StringValue(r.RepositoryUri),
 		Tags:               fromECRTags(t),
+		Policy:             access.policy,
+		DeleteAt:           repositoryDeleteAt(t),
 	}
 
 	if r.ImageScanningConfiguration != nil {
@@ -142,17 +726,27 @@ func repositoryUserResponseFromIAM(org string, u *iam.User, keys []*iam.AccessKe
 		userName = strings.TrimPrefix(userName, prefix)
 	}
 
-	if keys == nil {
-		keys = []*iam.AccessKeyMetadata{}
+	accessKeys := make([]*RepositoryUserAccessKey, 0, len(keys))
+	for _, k := range keys {
+		accessKeys = append(accessKeys, &RepositoryUserAccessKey{AccessKeyMetadata: k})
+	}
+
+	status := ""
+	if keys != nil {
+		status = repositoryUserStatus(keys)
 	}
 
+	role := userRoleFromGroups(org, groups)
 	for i, g := range groups {
 		groups[i] = strings.TrimSuffix(g, "-"+org)
 	}
 
 	user := RepositoryUserResponse{
-		AccessKeys: keys,
+		AccessKeys: accessKeys,
 		Groups:     groups,
+		Role:       role,
+		Status:     status,
+		ExpiresAt:  userExpiresAt(u.Tags),
 		Tags:       fromIAMTags(u.Tags),
 		UserName:   userName,
 	}
@@ -160,12 +754,170 @@ func repositoryUserResponseFromIAM(org string, u *iam.User, keys []*iam.AccessKe
 	return &user
 }
 
+// imageScanFindingsFromECR maps ECR image scan findings and the enhanced finding extras to a common struct
+func imageScanFindingsFromECR(f *ecr.ImageScanFindings, extras ecrSvc.EnhancedFindingExtras) *ImageScanFindings {
+	if f == nil {
+		return nil
+	}
+
+	findings := make([]*ImageScanFinding, 0, len(f.Findings))
+	for _, finding := range f.Findings {
+		findings = append(findings, &ImageScanFinding{ImageScanFinding: finding})
+	}
+
+	var enhancedFindings []*EnhancedImageScanFinding
+	for _, finding := range f.EnhancedFindings {
+		enhanced := &EnhancedImageScanFinding{EnhancedImageScanFinding: finding}
+		if extra, ok := extras[aws.StringValue(finding.FindingArn)]; ok {
+			enhanced.FixAvailable = extra.FixAvailable
+			enhanced.ExploitAvailable = extra.ExploitAvailable
+			if len(extra.FixedInVersions) > 0 {
+				enhanced.FixedInVersions = extra.FixedInVersions
+			}
+		}
+		enhancedFindings = append(enhancedFindings, enhanced)
+	}
+
+	return &ImageScanFindings{
+		FindingSeverityCounts:        f.FindingSeverityCounts,
+		Findings:                     findings,
+		EnhancedFindings:             enhancedFindings,
+		ImageScanCompletedAt:         f.ImageScanCompletedAt,
+		VulnerabilitySourceUpdatedAt: f.VulnerabilitySourceUpdatedAt,
+	}
+}
+
+// imageScanFindingsOutputFromECR maps the ECR describe image scan findings output to a common struct
+func imageScanFindingsOutputFromECR(out *ecr.DescribeImageScanFindingsOutput, extras ecrSvc.EnhancedFindingExtras) *ImageScanFindingsOutput {
+	return &ImageScanFindingsOutput{
+		ImageId:           out.ImageId,
+		ImageScanFindings: imageScanFindingsFromECR(out.ImageScanFindings, extras),
+		ImageScanStatus:   out.ImageScanStatus,
+		RegistryId:        aws.StringValue(out.RegistryId),
+		RepositoryName:    aws.StringValue(out.RepositoryName),
+	}
+}
+
+// registryScanningConfigurationFromECR maps the ECR registry scanning configuration to a common struct
+func registryScanningConfigurationFromECR(c *ecr.RegistryScanningConfiguration) *RegistryScanningConfiguration {
+	if c == nil {
+		return &RegistryScanningConfiguration{Rules: []*RegistryScanningRule{}}
+	}
+
+	rules := make([]*RegistryScanningRule, 0, len(c.Rules))
+	for _, r := range c.Rules {
+		filters := make([]string, 0, len(r.RepositoryFilters))
+		for _, f := range r.RepositoryFilters {
+			filters = append(filters, aws.StringValue(f.Filter))
+		}
+
+		rules = append(rules, &RegistryScanningRule{
+			ScanFrequency:     aws.StringValue(r.ScanFrequency),
+			RepositoryFilters: filters,
+		})
+	}
+
+	return &RegistryScanningConfiguration{
+		ScanType: aws.StringValue(c.ScanType),
+		Rules:    rules,
+	}
+}
+
+// putRegistryScanningConfigurationInputFromRequest maps the registry scanning configuration request to the ECR input
+func putRegistryScanningConfigurationInputFromRequest(req *RegistryScanningConfiguration) *ecr.PutRegistryScanningConfigurationInput {
+	rules := make([]*ecr.RegistryScanningRule, 0, len(req.Rules))
+	for _, r := range req.Rules {
+		filters := make([]*ecr.ScanningRepositoryFilter, 0, len(r.RepositoryFilters))
+		for _, f := range r.RepositoryFilters {
+			filters = append(filters, &ecr.ScanningRepositoryFilter{
+				Filter:     aws.String(f),
+				FilterType: aws.String(ecr.ScanningRepositoryFilterTypeWildcard),
+			})
+		}
+
+		rules = append(rules, &ecr.RegistryScanningRule{
+			RepositoryFilters: filters,
+			ScanFrequency:     aws.String(strings.ToUpper(r.ScanFrequency)),
+		})
+	}
+
+	return &ecr.PutRegistryScanningConfigurationInput{
+		Rules:    rules,
+		ScanType: aws.String(strings.ToUpper(req.ScanType)),
+	}
+}
+
+// registryReplicationConfigurationFromECR maps the ECR registry replication configuration to a common struct
+func registryReplicationConfigurationFromECR(c *ecr.ReplicationConfiguration) *RegistryReplicationConfiguration {
+	if c == nil {
+		return &RegistryReplicationConfiguration{Rules: []*RegistryReplicationRule{}}
+	}
+
+	rules := make([]*RegistryReplicationRule, 0, len(c.Rules))
+	for _, r := range c.Rules {
+		destinations := make([]*RegistryReplicationDestination, 0, len(r.Destinations))
+		for _, d := range r.Destinations {
+			destinations = append(destinations, &RegistryReplicationDestination{
+				Region:  aws.StringValue(d.Region),
+				Account: aws.StringValue(d.RegistryId),
+			})
+		}
+
+		prefixes := make([]string, 0, len(r.RepositoryFilters))
+		for _, f := range r.RepositoryFilters {
+			prefixes = append(prefixes, aws.StringValue(f.Filter))
+		}
+
+		rules = append(rules, &RegistryReplicationRule{
+			Destinations:  destinations,
+			GroupPrefixes: prefixes,
+		})
+	}
+
+	return &RegistryReplicationConfiguration{Rules: rules}
+}
+
+// replicationConfigurationFromRequest maps the registry replication configuration request to the ECR configuration,
+// destinations without an account are replicated within the account
+func replicationConfigurationFromRequest(account string, req *RegistryReplicationConfiguration) *ecr.ReplicationConfiguration {
+	rules := make([]*ecr.ReplicationRule, 0, len(req.Rules))
+	for _, r := range req.Rules {
+		destinations := make([]*ecr.ReplicationDestination, 0, len(r.Destinations))
+		for _, d := range r.Destinations {
+			registryId := d.Account
+			if registryId == "" {
+				registryId = account
+			}
+
+			destinations = append(destinations, &ecr.ReplicationDestination{
+				Region:     aws.String(d.Region),
+				RegistryId: aws.String(registryId),
+			})
+		}
+
+		filters := make([]*ecr.RepositoryFilter, 0, len(r.GroupPrefixes))
+		for _, p := range r.GroupPrefixes {
+			filters = append(filters, &ecr.RepositoryFilter{
+				Filter:     aws.String(p),
+				FilterType: aws.String(ecr.RepositoryFilterTypePrefixMatch),
+			})
+		}
+
+		rules = append(rules, &ecr.ReplicationRule{
+			Destinations:      destinations,
+			RepositoryFilters: filters,
+		})
+	}
+
+	return &ecr.ReplicationConfiguration{Rules: rules}
+}
+
 // normalizTags strips the org, spaceid and name from the given tags and ensures they
 // are set to the API org and the group string, name passed to the request
 func normalizeTags(org, group, name string, tags []*Tag) []*Tag {
 	normalizedTags := []*Tag{}
 	for _, t := range tags {
-		if t.Key == "spinup:spaceid" || t.Key == "spinup:org" || t.Key == "Name" {
+		if t.Key == "spinup:spaceid" || t.Key == "spinup:org" || t.Key == "Name" || t.Key == repositoryDeleteAtTag {
 			continue
 		}
 		normalizedTags = append(normalizedTags, t)
@@ -196,7 +948,7 @@ func normalizeTags(org, group, name string, tags []*Tag) []*Tag {
 func normalizeUserTags(org, group, resource, name string, tags []*Tag) []*Tag {
 	normalizedTags := []*Tag{}
 	for _, t := range tags {
-		if t.Key == "spinup:spaceid" || t.Key == "spinup:org" || t.Key == "ResourceName" || t.Key == "Name" {
+		if t.Key == "spinup:spaceid" || t.Key == "spinup:org" || t.Key == "ResourceName" || t.Key == "Name" || t.Key == userExpiresAtTag {
 			continue
 		}
 		normalizedTags = append(normalizedTags, t)
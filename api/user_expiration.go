@@ -0,0 +1,212 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/ecr-api/common"
+	"github.com/YaleSpinup/ecr-api/iam"
+	"github.com/aws/aws-sdk-go/aws"
+	awsiam "github.com/aws/aws-sdk-go/service/iam"
+	log "github.com/sirupsen/logrus"
+)
+
+// userExpiresAtTag is the user tag with the RFC3339 time the user expires
+const userExpiresAtTag = "spinup:expiresAt"
+
+// userReaper is the background job configuration for deleting expired users
+type userReaper struct {
+	interval time.Duration
+	accounts []string
+}
+
+// newUserReaper validates the user reaper configuration, it returns nil if the job is disabled
+func newUserReaper(config common.UserReaper) (*userReaper, error) {
+	if len(config.Accounts) == 0 {
+		return nil, nil
+	}
+
+	r := &userReaper{
+		interval: time.Hour,
+		accounts: config.Accounts,
+	}
+
+	if config.Interval != "" {
+		interval, err := time.ParseDuration(config.Interval)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid user reaper interval '%s'", config.Interval)
+		}
+		r.interval = interval
+	}
+
+	return r, nil
+}
+
+// userExpiresAt returns the expiry from the user tags, nil if the user doesn't expire
+func userExpiresAt(tags []*awsiam.Tag) *time.Time {
+	for _, t := range tags {
+		if aws.StringValue(t.Key) != userExpiresAtTag {
+			continue
+		}
+
+		expiresAt, err := time.Parse(time.RFC3339, aws.StringValue(t.Value))
+		if err != nil {
+			log.Warnf("invalid %s tag value '%s': %s", userExpiresAtTag, aws.StringValue(t.Value), err)
+			return nil
+		}
+
+		return &expiresAt
+	}
+
+	return nil
+}
+
+// expiredUsers finds the users in the org that are past their expiry.  Listing users doesn't return
+// their tags, so each user is fetched.
+func (o *iamOrchestrator) expiredUsers(ctx context.Context, now time.Time) ([]*ExpiredUser, error) {
+	path := fmt.Sprintf("/spinup/%s/", o.org)
+
+	users, err := o.client.ListUsersWithPath(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	expired := []*ExpiredUser{}
+	for _, u := range users {
+		user, err := o.client.GetUserWithPath(ctx, aws.StringValue(u.Path), aws.StringValue(u.UserName))
+		if err != nil {
+			if aerr, ok := err.(apierror.Error); ok && aerr.Code == apierror.ErrNotFound {
+				continue
+			}
+			return nil, err
+		}
+
+		expiresAt := userExpiresAt(user.Tags)
+		if expiresAt == nil || expiresAt.After(now) {
+			continue
+		}
+
+		repository, userName := repositoryUserFromIAM(o.org, user)
+		expired = append(expired, &ExpiredUser{
+			UserName:    userName,
+			Repository:  repository,
+			IAMUserName: aws.StringValue(user.UserName),
+			ExpiresAt:   *expiresAt,
+		})
+	}
+
+	return expired, nil
+}
+
+// reapExpiredUsers deletes the users in the org that are past their expiry
+func (o *iamOrchestrator) reapExpiredUsers(ctx context.Context, now time.Time, dryRun bool) ([]*ExpiredUser, error) {
+	expired, err := o.expiredUsers(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return expired, nil
+	}
+
+	for _, u := range expired {
+		group, name := repositoryUserScope(u.Repository)
+		if group == "" || strings.Contains(name, "/") {
+			u.Error = "user isn't in a repository path"
+			continue
+		}
+
+		log.Infof("deleting repository %s user %s expired at %s", u.Repository, u.UserName, u.ExpiresAt.Format(time.RFC3339))
+
+		if err := o.repositoryUserDelete(ctx, name, group, u.UserName); err != nil {
+			u.Error = err.Error()
+			continue
+		}
+
+		u.Deleted = true
+	}
+
+	return expired, nil
+}
+
+// reapExpiredUsers deletes the expired repository users in the account
+func (s *server) reapExpiredUsers(ctx context.Context, account string, dryRun bool) (*ExpiredUsersReport, error) {
+	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
+	policy, err := s.expiredUserDeletePolicy()
+	if err != nil {
+		return nil, apierror.New(apierror.ErrInternalError, "failed to generate policy", err)
+	}
+
+	// IAM doesn't support resource tags, so we can't pass the s.orgPolicy here
+	session, err := s.assumeRole(ctx, s.session.ExternalID, role, policy)
+	if err != nil {
+		msg := fmt.Sprintf("failed to assume role in account: %s", account)
+		return nil, apierror.New(apierror.ErrForbidden, msg, nil)
+	}
+
+	orch := newIamOrchestrator(
+		iam.New(iam.WithSession(session.Session)),
+		s.org,
+	)
+
+	return s.reapExpiredUsersWithOrchestrator(ctx, orch, account, dryRun)
+}
+
+// reapExpiredUsersWithOrchestrator deletes the expired users and notifies their spaces
+func (s *server) reapExpiredUsersWithOrchestrator(ctx context.Context, orch *iamOrchestrator, account string, dryRun bool) (*ExpiredUsersReport, error) {
+	report := &ExpiredUsersReport{
+		Account:   account,
+		DryRun:    dryRun,
+		StartedAt: time.Now().UTC(),
+	}
+
+	users, err := orch.reapExpiredUsers(ctx, report.StartedAt, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	report.Users = users
+	report.CompletedAt = time.Now().UTC()
+
+	for _, u := range users {
+		if !u.Deleted {
+			continue
+		}
+
+		group, _ := repositoryUserScope(u.Repository)
+		s.notify(ctx, notificationUserDeleted, account, group, &UserNotification{
+			Repository: u.Repository,
+			UserName:   u.UserName,
+		})
+	}
+
+	return report, nil
+}
+
+// userReaperJob periodically deletes the expired users in the configured accounts until the context is cancelled
+func (s *server) userReaperJob(ctx context.Context) {
+	log.Infof("deleting expired users every %s in %d accounts", s.userReaper.interval, len(s.userReaper.accounts))
+
+	ticker := time.NewTicker(s.userReaper.interval)
+	defer ticker.Stop()
+
+	for {
+		for _, account := range s.userReaper.accounts {
+			report, err := s.reapExpiredUsers(ctx, account, false)
+			if err != nil {
+				log.Errorf("failed to delete expired users in account %s: %s", account, err)
+				continue
+			}
+
+			log.Infof("found %d expired users in account %s", len(report.Users), account)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
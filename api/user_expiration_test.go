@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ecr-api/common"
+	"github.com/YaleSpinup/ecr-api/iam"
+	"github.com/YaleSpinup/ecr-api/store"
+)
+
+func TestNewUserReaper(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       common.UserReaper
+		wantNil      bool
+		wantErr      bool
+		wantInterval time.Duration
+	}{
+		{
+			name:    "disabled",
+			config:  common.UserReaper{Interval: "1h"},
+			wantNil: true,
+		},
+		{
+			name:         "default interval",
+			config:       common.UserReaper{Accounts: []string{"12345"}},
+			wantInterval: time.Hour,
+		},
+		{
+			name:         "interval",
+			config:       common.UserReaper{Interval: "30m", Accounts: []string{"12345"}},
+			wantInterval: 30 * time.Minute,
+		},
+		{
+			name:    "invalid interval",
+			config:  common.UserReaper{Interval: "hourly", Accounts: []string{"12345"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newUserReaper(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newUserReaper() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if (got == nil) != tt.wantNil {
+				t.Fatalf("newUserReaper() = %+v, wantNil %t", got, tt.wantNil)
+			}
+
+			if got != nil && got.interval != tt.wantInterval {
+				t.Errorf("expected interval %s, got %s", tt.wantInterval, got.interval)
+			}
+		})
+	}
+}
+
+// newExpiringTestUsers creates a repository user that has expired, one that expires tomorrow and one that doesn't expire
+func newExpiringTestUsers(t *testing.T, orch *iamOrchestrator, now time.Time) {
+	ctx := context.Background()
+
+	roleGroups, err := orch.prepareAccount(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expired := now.Add(-time.Hour)
+	tomorrow := now.AddDate(0, 0, 1)
+	for u, expiresAt := range map[string]*time.Time{"expired": &expired, "tomorrow": &tomorrow, "forever": nil} {
+		if _, err := orch.repositoryUserCreate(ctx, "rudolph", "spindev-00001", roleGroups["pull"], &RepositoryUserCreateRequest{UserName: u, Role: "pull", ExpiresAt: expiresAt}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+}
+
+func TestIamOrchestrator_reapExpiredUsers(t *testing.T) {
+	for _, dryRun := range []bool{false, true} {
+		ctx := context.Background()
+		now := time.Now().Truncate(time.Second)
+		client := newFakeIAM()
+		orch := newIamOrchestrator(iam.IAM{Service: client}, "testOrg")
+		newExpiringTestUsers(t, orch, now)
+
+		users, err := orch.reapExpiredUsers(ctx, now, dryRun)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if len(users) != 1 {
+			t.Fatalf("expected 1 expired user, got %d", len(users))
+		}
+
+		u := users[0]
+		if u.UserName != "expired" || u.Repository != "spindev-00001/rudolph" || u.IAMUserName != "rudolph-expired" || !u.ExpiresAt.Equal(now.Add(-time.Hour)) {
+			t.Errorf("unexpected expired user %+v", u)
+		}
+
+		if u.Deleted == dryRun || u.Error != "" {
+			t.Errorf("expected deleted %t without an error, got %+v", !dryRun, u)
+		}
+
+		if _, ok := client.users["rudolph-expired"]; ok != dryRun {
+			t.Errorf("expected expired user to exist %t, got %t", dryRun, ok)
+		}
+
+		for _, name := range []string{"rudolph-tomorrow", "rudolph-forever"} {
+			if _, ok := client.users[name]; !ok {
+				t.Errorf("expected unexpired user %s to be kept", name)
+			}
+		}
+	}
+}
+
+func TestServer_reapExpiredUsersWithOrchestrator(t *testing.T) {
+	ctx := context.Background()
+	n := &recordingNotifier{}
+	s := &server{store: store.NewMemoryStore(), notifier: n}
+
+	orch := newIamOrchestrator(iam.IAM{Service: newFakeIAM()}, "testOrg")
+	newExpiringTestUsers(t, orch, time.Now())
+
+	report, err := s.reapExpiredUsersWithOrchestrator(ctx, orch, "12345", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if report.Account != "12345" || len(report.Users) != 1 || !report.Users[0].Deleted {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	if len(n.notifications) != 1 || n.notifications[0].Type != notificationUserDeleted || n.notifications[0].Group != "spindev-00001" {
+		t.Errorf("expected a user deleted notification, got %+v", n.notifications)
+	}
+}
+
+func TestRepositoryUserResponseExpiresAt(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+	orch := newIamOrchestrator(iam.IAM{Service: newFakeIAM()}, "testOrg")
+	newExpiringTestUsers(t, orch, now)
+
+	got, err := orch.getRepositoryUser(ctx, "spindev-00001", "rudolph", "tomorrow")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got.ExpiresAt == nil || !got.ExpiresAt.Equal(now.AddDate(0, 0, 1)) {
+		t.Errorf("expected user to expire at %s, got %v", now.AddDate(0, 0, 1), got.ExpiresAt)
+	}
+}
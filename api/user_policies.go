@@ -0,0 +1,43 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/ecr-api/iam"
+)
+
+// reconcileUserPolicies repairs drift in the managed policies and groups of the user roles in the account
+func (s *server) reconcileUserPolicies(ctx context.Context, account string, dryRun bool) (*UserPolicyReconcileReport, error) {
+	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
+	policy, err := s.repositoryUserCreatePolicy()
+	if err != nil {
+		return nil, apierror.New(apierror.ErrInternalError, "failed to generate policy", err)
+	}
+
+	// IAM doesn't support resource tags, so we can't pass the s.orgPolicy here
+	session, err := s.assumeRole(ctx, s.session.ExternalID, role, policy)
+	if err != nil {
+		msg := fmt.Sprintf("failed to assume role in account: %s", account)
+		return nil, apierror.New(apierror.ErrForbidden, msg, nil)
+	}
+
+	orch := newIamOrchestrator(
+		iam.New(iam.WithSession(session.Session)),
+		s.org,
+	)
+
+	changes, err := orch.reconcileUserPolicies(ctx, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserPolicyReconcileReport{
+		Account:     account,
+		DryRun:      dryRun,
+		GeneratedAt: time.Now().UTC(),
+		Changes:     changes,
+	}, nil
+}
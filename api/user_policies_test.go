@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/YaleSpinup/ecr-api/iam"
+	"github.com/aws/aws-sdk-go/aws"
+	awsiam "github.com/aws/aws-sdk-go/service/iam"
+)
+
+func TestIamOrchestrator_reconcileUserPolicies(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeIAM()
+	orch := newIamOrchestrator(iam.IAM{Service: client}, "testOrg")
+
+	changes, err := orch.reconcileUserPolicies(ctx, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(changes) != 2*2*len(userRoles) {
+		t.Errorf("expected every policy and group to be created, got %d changes", len(changes))
+	}
+
+	for _, c := range changes {
+		if c.Action != userPolicyActionCreated {
+			t.Errorf("expected %s %s to be created, got %s", c.Type, c.Name, c.Action)
+		}
+	}
+
+	if len(client.policies) != 0 || len(client.groups) != 0 {
+		t.Fatalf("expected dry run not to create anything, got %d policies and %d groups", len(client.policies), len(client.groups))
+	}
+
+	if _, err := orch.reconcileUserPolicies(ctx, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// drift the pull policy until it has the maximum number of versions and detach the push group policy
+	pullArn := "arn:aws:iam::12345:policy/spinup/testOrg/" + userRolePolicyName("testOrg", userRolePull)
+	for i := 0; i < maxPolicyVersions-1; i++ {
+		if _, err := client.CreatePolicyVersionWithContext(ctx, &awsiam.CreatePolicyVersionInput{
+			PolicyArn:      aws.String(pullArn),
+			PolicyDocument: aws.String(`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["ecr:*"],"Resource":["*"]}]}`),
+			SetAsDefault:   aws.Bool(true),
+		}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	client.attached[userRoleGroupName("testOrg", userRolePush)] = nil
+
+	changes, err = orch.reconcileUserPolicies(ctx, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %d", len(changes))
+	}
+
+	policyChange, groupChange := changes[0], changes[1]
+	if policyChange.Role != userRolePull || policyChange.Type != userPolicyChangeTypePolicy || policyChange.Action != userPolicyActionUpdated {
+		t.Errorf("expected the pull policy to be updated, got %+v", policyChange)
+	}
+
+	if policyChange.PreviousVersionId != "v5" || policyChange.PreviousDocument == nil || len(policyChange.PrunedVersionIds) != 1 || policyChange.PrunedVersionIds[0] != "v1" {
+		t.Errorf("expected the oldest version to be pruned and the drifted version reported, got %+v", policyChange)
+	}
+
+	if groupChange.Role != userRolePush || groupChange.Type != userPolicyChangeTypeGroup || groupChange.Action != userPolicyActionAttached {
+		t.Errorf("expected the push group policy to be attached, got %+v", groupChange)
+	}
+
+	versions := client.versions[pullArn]
+	if len(versions) != maxPolicyVersions {
+		t.Errorf("expected %d policy versions, got %d", maxPolicyVersions, len(versions))
+	}
+
+	want, _ := json.Marshal(EcrPullPolicy)
+	latest := versions[len(versions)-1]
+	doc, _ := url.QueryUnescape(aws.StringValue(latest.Document))
+	if !aws.BoolValue(latest.IsDefaultVersion) || doc != string(want) {
+		t.Errorf("expected the desired document to be the default version, got %+v", latest)
+	}
+
+	// reconciling again is a no-op
+	changes, err = orch.reconcileUserPolicies(ctx, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(changes) != 0 {
+		t.Errorf("expected no changes, got %+v", changes)
+	}
+}
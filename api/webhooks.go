@@ -0,0 +1,597 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/ecr-api/common"
+	"github.com/YaleSpinup/ecr-api/store"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// webhooksBucket is the store bucket for webhooks, keyed by {account}/{group}/{id}
+	webhooksBucket = "webhooks"
+	// webhookDeliveriesBucket is the store bucket for the webhook delivery logs, keyed by
+	// {account}/{group}/{webhook id}/{started at}/{id}
+	webhookDeliveriesBucket = "webhook_deliveries"
+
+	// webhookDeliveriesRetained is the number of delivery logs kept per webhook
+	webhookDeliveriesRetained = 100
+
+	webhookSignatureHeader = "X-Spinup-Signature-256"
+	webhookEventHeader     = "X-Spinup-Event"
+	webhookDeliveryHeader  = "X-Spinup-Delivery"
+)
+
+// errWebhookAddress is returned when dialing a webhook address that isn't allowed
+var errWebhookAddress = errors.New("webhook address is not allowed")
+
+// validate checks the webhook create request.  Webhooks must use https and can't be sent to loopback, link-local
+// or private addresses, the addresses a host name resolves to are checked when the webhook is delivered.
+func (req *WebhookCreateRequest) validate() error {
+	u, err := url.Parse(req.Url)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return apierror.New(apierror.ErrBadRequest, "url must be an absolute https url", nil)
+	}
+
+	if !webhookHostAllowed(u.Hostname()) {
+		msg := fmt.Sprintf("url host '%s' is a loopback, link-local or private address", u.Hostname())
+		return apierror.New(apierror.ErrBadRequest, msg, nil)
+	}
+
+	if len(req.Events) == 0 {
+		return apierror.New(apierror.ErrBadRequest, "at least one event is required", nil)
+	}
+
+	for _, e := range req.Events {
+		if !notificationTypes[e] {
+			msg := fmt.Sprintf("invalid event '%s'", e)
+			return apierror.New(apierror.ErrBadRequest, msg, nil)
+		}
+	}
+
+	if req.Secret != "" && len(req.Secret) < 16 {
+		return apierror.New(apierror.ErrBadRequest, "secret must be at least 16 characters", nil)
+	}
+
+	return nil
+}
+
+// webhookHostAllowed returns false for localhost and for loopback, link-local or private ip addresses
+func webhookHostAllowed(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return publicAddress(ip)
+	}
+
+	return true
+}
+
+// publicAddress returns false for loopback, link-local, private, unspecified and multicast ip addresses
+func publicAddress(ip net.IP) bool {
+	return !ip.IsLoopback() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!ip.IsPrivate() &&
+		!ip.IsUnspecified()
+}
+
+// webhookDialControl checks the resolved address of each webhook connection before it's made
+func webhookDialControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip == nil || !publicAddress(ip) {
+		return fmt.Errorf("%w: %s", errWebhookAddress, address)
+	}
+
+	return nil
+}
+
+// newWebhookClient returns the http client for delivering webhooks.  It doesn't use a proxy or follow redirects
+// so the address of every connection is checked by webhookDialControl.
+func newWebhookClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   webhookDialControl,
+	}).DialContext
+
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// webhookSecrets encrypts the webhook signing secrets at rest with AES-256-GCM
+type webhookSecrets struct {
+	aead cipher.AEAD
+}
+
+// newWebhookSecrets validates the webhooks configuration, it returns nil if there's no secret key
+func newWebhookSecrets(config common.Webhooks) (*webhookSecrets, error) {
+	if config.SecretKey == "" {
+		log.Warn("no webhook secret key in the configuration, webhooks can't be created")
+		return nil, nil
+	}
+
+	if len(config.SecretKey) < 32 {
+		return nil, errors.New("webhook secret key must be at least 32 characters")
+	}
+
+	key := sha256.Sum256([]byte(config.SecretKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &webhookSecrets{aead: aead}, nil
+}
+
+// encrypt returns the base64 encoded nonce and sealed secret, the webhook id is authenticated with it
+func (ws *webhookSecrets) encrypt(id, secret string) (string, error) {
+	nonce := make([]byte, ws.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(ws.aead.Seal(nonce, nonce, []byte(secret), []byte(id))), nil
+}
+
+// decrypt opens a secret sealed by encrypt for the webhook id
+func (ws *webhookSecrets) decrypt(id, encrypted string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", err
+	}
+
+	if len(b) < ws.aead.NonceSize() {
+		return "", errors.New("encrypted secret is too short")
+	}
+
+	secret, err := ws.aead.Open(nil, b[:ws.aead.NonceSize()], b[ws.aead.NonceSize():], []byte(id))
+	if err != nil {
+		return "", err
+	}
+
+	return string(secret), nil
+}
+
+// storedWebhook is a webhook as it's stored, with the signing secret encrypted.  Webhooks stored before
+// the secrets were encrypted have the plain text Secret.
+type storedWebhook struct {
+	*Webhook
+	EncryptedSecret string `json:",omitempty"`
+}
+
+// subscribed returns true if the webhook should receive the notification type
+func (w *Webhook) subscribed(notificationType string) bool {
+	for _, e := range w.Events {
+		if e == notificationType {
+			return true
+		}
+	}
+	return false
+}
+
+// signPayload returns the hex encoded HMAC-SHA256 signature of the payload
+func signPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// generateSecret returns a random hex encoded webhook secret
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// createWebhook validates and stores a new webhook for the group, with its secret encrypted
+func (s *server) createWebhook(ctx context.Context, account, group string, req *WebhookCreateRequest) (*Webhook, error) {
+	if s.webhookSecrets == nil {
+		return nil, apierror.New(apierror.ErrBadRequest, "webhooks are not configured", nil)
+	}
+
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		var err error
+		if secret, err = generateSecret(); err != nil {
+			return nil, apierror.New(apierror.ErrInternalError, "failed to generate webhook secret", err)
+		}
+	}
+
+	w := &Webhook{
+		Id:          uuid.New().String(),
+		Account:     account,
+		Group:       group,
+		Url:         req.Url,
+		Events:      req.Events,
+		Description: req.Description,
+		Secret:      secret,
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	encrypted, err := s.webhookSecrets.encrypt(w.Id, secret)
+	if err != nil {
+		return nil, apierror.New(apierror.ErrInternalError, "failed to encrypt webhook secret", err)
+	}
+
+	stored := storedWebhook{Webhook: &Webhook{}, EncryptedSecret: encrypted}
+	*stored.Webhook = *w
+	stored.Secret = ""
+
+	log.Infof("creating webhook %s for %s/%s to %s", w.Id, account, group, w.Url)
+
+	if err := store.PutJSON(ctx, s.store, webhooksBucket, fmt.Sprintf("%s/%s/%s", account, group, w.Id), stored); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// getWebhook gets a webhook, without its secret
+func (s *server) getWebhook(ctx context.Context, account, group, id string) (*Webhook, error) {
+	w := &storedWebhook{Webhook: &Webhook{}}
+	if err := store.GetJSON(ctx, s.store, webhooksBucket, fmt.Sprintf("%s/%s/%s", account, group, id), w); err != nil {
+		return nil, err
+	}
+	w.Secret = ""
+	return w.Webhook, nil
+}
+
+// deleteWebhook deletes a webhook and its delivery logs
+func (s *server) deleteWebhook(ctx context.Context, account, group, id string) error {
+	key := fmt.Sprintf("%s/%s/%s", account, group, id)
+	if _, err := s.store.Get(ctx, webhooksBucket, key); err != nil {
+		return err
+	}
+
+	log.Infof("deleting webhook %s", key)
+
+	if err := s.store.Delete(ctx, webhooksBucket, key); err != nil {
+		return err
+	}
+
+	deliveries, err := s.store.List(ctx, webhookDeliveriesBucket, key+"/")
+	if err != nil {
+		return err
+	}
+
+	for k := range deliveries {
+		if err := s.store.Delete(ctx, webhookDeliveriesBucket, k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listWebhooks lists the webhooks for a group, without their secrets
+func (s *server) listWebhooks(ctx context.Context, account, group string) ([]*Webhook, error) {
+	stored, err := listWebhooks(ctx, s.store, account, group)
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks := make([]*Webhook, 0, len(stored))
+	for _, w := range stored {
+		w.Secret = ""
+		webhooks = append(webhooks, w.Webhook)
+	}
+
+	return webhooks, nil
+}
+
+// listWebhookDeliveries lists the delivery logs for a webhook, newest first.  If failed is true,
+// only failed deliveries are returned.
+func (s *server) listWebhookDeliveries(ctx context.Context, account, group, id string, failed bool) ([]*WebhookDelivery, error) {
+	if _, err := s.getWebhook(ctx, account, group, id); err != nil {
+		return nil, err
+	}
+
+	items, err := s.store.List(ctx, webhookDeliveriesBucket, fmt.Sprintf("%s/%s/%s/", account, group, id))
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]*WebhookDelivery, 0, len(items))
+	for key, item := range items {
+		d := &WebhookDelivery{}
+		if err := json.Unmarshal(item, d); err != nil {
+			log.Warnf("failed to unmarshal webhook delivery %s: %s", key, err)
+			continue
+		}
+
+		if failed && d.Success {
+			continue
+		}
+
+		deliveries = append(deliveries, d)
+	}
+
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].StartedAt.After(deliveries[j].StartedAt)
+	})
+
+	return deliveries, nil
+}
+
+// listWebhooks lists the stored webhooks for a group
+func listWebhooks(ctx context.Context, st store.Store, account, group string) ([]*storedWebhook, error) {
+	items, err := st.List(ctx, webhooksBucket, fmt.Sprintf("%s/%s/", account, group))
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks := make([]*storedWebhook, 0, len(items))
+	for key, item := range items {
+		w := &storedWebhook{Webhook: &Webhook{}}
+		if err := json.Unmarshal(item, w); err != nil {
+			log.Warnf("failed to unmarshal webhook %s: %s", key, err)
+			continue
+		}
+		webhooks = append(webhooks, w)
+	}
+
+	sort.SliceStable(webhooks, func(i, j int) bool {
+		return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+	})
+
+	return webhooks, nil
+}
+
+// webhookPayload is the body posted to webhooks
+type webhookPayload struct {
+	Id      string
+	Type    string
+	Account string
+	Group   string
+	Time    time.Time
+	Data    interface{}
+}
+
+// webhookNotifier delivers notifications to the webhooks registered for the notification's group
+type webhookNotifier struct {
+	store    store.Store
+	secrets  *webhookSecrets
+	client   *http.Client
+	attempts int
+	sleep    time.Duration
+	wg       sync.WaitGroup
+}
+
+func newWebhookNotifier(st store.Store, secrets *webhookSecrets) *webhookNotifier {
+	return &webhookNotifier{
+		store:    st,
+		secrets:  secrets,
+		client:   newWebhookClient(),
+		attempts: 5,
+		sleep:    2 * time.Second,
+	}
+}
+
+// secret returns the signing secret of the stored webhook
+func (n *webhookNotifier) secret(w *storedWebhook) (string, error) {
+	if w.EncryptedSecret == "" {
+		return w.Secret, nil
+	}
+
+	if n.secrets == nil {
+		return "", errors.New("no webhook secret key is configured")
+	}
+
+	return n.secrets.decrypt(w.Id, w.EncryptedSecret)
+}
+
+// notify delivers the notification to the subscribed webhooks in the background
+func (n *webhookNotifier) notify(ctx context.Context, notification *Notification) {
+	if notification.Group == "" {
+		return
+	}
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+
+		// the request context is likely gone by the time delivery completes
+		ctx := context.Background()
+
+		webhooks, err := listWebhooks(ctx, n.store, notification.Account, notification.Group)
+		if err != nil {
+			log.Errorf("failed to list webhooks for %s/%s: %s", notification.Account, notification.Group, err)
+			return
+		}
+
+		for _, w := range webhooks {
+			if !w.subscribed(notification.Type) {
+				continue
+			}
+
+			secret, err := n.secret(w)
+			if err != nil {
+				log.Errorf("failed to decrypt the secret of webhook %s: %s", w.Id, err)
+				continue
+			}
+
+			n.wg.Add(1)
+			go func(w *Webhook, secret string) {
+				defer n.wg.Done()
+				n.deliver(ctx, w, secret, notification)
+			}(w.Webhook, secret)
+		}
+	}()
+}
+
+// deliver posts the notification signed with the secret to the webhook, retrying with backoff, and records the
+// delivery log
+func (n *webhookNotifier) deliver(ctx context.Context, w *Webhook, secret string, notification *Notification) {
+	delivery := &WebhookDelivery{
+		Id:        uuid.New().String(),
+		WebhookId: w.Id,
+		Type:      notification.Type,
+		Url:       w.Url,
+		StartedAt: time.Now().UTC(),
+	}
+
+	body, err := json.Marshal(webhookPayload{
+		Id:      delivery.Id,
+		Type:    notification.Type,
+		Account: notification.Account,
+		Group:   notification.Group,
+		Time:    notification.Time,
+		Data:    notification.Data,
+	})
+	if err != nil {
+		log.Errorf("failed to marshal %s notification for webhook %s: %s", notification.Type, w.Id, err)
+		return
+	}
+
+	signature := signPayload(secret, body)
+
+	err = retry(n.attempts, n.sleep, func() error {
+		delivery.Attempts++
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.Url, bytes.NewReader(body))
+		if err != nil {
+			return stop{err}
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "ecr-api")
+		req.Header.Set(webhookEventHeader, notification.Type)
+		req.Header.Set(webhookDeliveryHeader, delivery.Id)
+		req.Header.Set(webhookSignatureHeader, signature)
+
+		res, err := n.client.Do(req)
+		if err != nil {
+			log.Warnf("attempt %d delivering %s to webhook %s failed: %s", delivery.Attempts, delivery.Id, w.Id, err)
+
+			if errors.Is(err, errWebhookAddress) {
+				return stop{err}
+			}
+			return err
+		}
+		io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+		res.Body.Close()
+
+		delivery.StatusCode = res.StatusCode
+		if res.StatusCode >= 200 && res.StatusCode < 300 {
+			return nil
+		}
+
+		err = fmt.Errorf("unexpected response status %d", res.StatusCode)
+		log.Warnf("attempt %d delivering %s to webhook %s failed: %s", delivery.Attempts, delivery.Id, w.Id, err)
+
+		// redirects aren't followed and other client errors won't succeed on retry
+		if res.StatusCode < 500 && res.StatusCode != http.StatusRequestTimeout && res.StatusCode != http.StatusTooManyRequests {
+			return stop{err}
+		}
+
+		return err
+	})
+
+	delivery.CompletedAt = time.Now().UTC()
+	delivery.Success = err == nil
+	if err != nil {
+		delivery.Error = err.Error()
+		log.Errorf("failed to deliver %s notification %s to webhook %s after %d attempts: %s", notification.Type, delivery.Id, w.Id, delivery.Attempts, err)
+	}
+
+	if err := n.recordDelivery(ctx, w, delivery); err != nil {
+		log.Errorf("failed to record webhook delivery %s: %s", delivery.Id, err)
+	}
+}
+
+// recordDelivery stores the delivery log and prunes the oldest logs over the retention limit
+func (n *webhookNotifier) recordDelivery(ctx context.Context, w *Webhook, delivery *WebhookDelivery) error {
+	prefix := fmt.Sprintf("%s/%s/%s/", w.Account, w.Group, w.Id)
+	key := fmt.Sprintf("%s%s/%s", prefix, delivery.StartedAt.Format("20060102T150405.000000000Z"), delivery.Id)
+
+	if err := store.PutJSON(ctx, n.store, webhookDeliveriesBucket, key, delivery); err != nil {
+		return err
+	}
+
+	items, err := n.store.List(ctx, webhookDeliveriesBucket, prefix)
+	if err != nil {
+		return err
+	}
+
+	if len(items) <= webhookDeliveriesRetained {
+		return nil
+	}
+
+	// keys sort by start time
+	keys := make([]string, 0, len(items))
+	for k := range items {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys[:len(keys)-webhookDeliveriesRetained] {
+		if err := n.store.Delete(ctx, webhookDeliveriesBucket, k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// webhookFailuresOnly parses the status query parameter for listing deliveries
+func webhookFailuresOnly(status string) (bool, error) {
+	switch strings.ToLower(status) {
+	case "", "all":
+		return false, nil
+	case "failed":
+		return true, nil
+	default:
+		return false, apierror.New(apierror.ErrBadRequest, "status must be one of all or failed", nil)
+	}
+}
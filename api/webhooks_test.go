@@ -0,0 +1,389 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ecr-api/common"
+	"github.com/YaleSpinup/ecr-api/store"
+)
+
+func testWebhookSecrets(t *testing.T) *webhookSecrets {
+	secrets, err := newWebhookSecrets(common.Webhooks{SecretKey: "0123456789abcdef0123456789abcdef"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return secrets
+}
+
+func TestWebhookCreateRequest_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     WebhookCreateRequest
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			req:  WebhookCreateRequest{Url: "https://hooks.example.com/ecr", Events: []string{notificationRepositoryCreated}},
+		},
+		{
+			name:    "relative url",
+			req:     WebhookCreateRequest{Url: "/ecr", Events: []string{notificationRepositoryCreated}},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported scheme",
+			req:     WebhookCreateRequest{Url: "ftp://hooks.example.com", Events: []string{notificationRepositoryCreated}},
+			wantErr: true,
+		},
+		{
+			name:    "http",
+			req:     WebhookCreateRequest{Url: "http://hooks.example.com/ecr", Events: []string{notificationRepositoryCreated}},
+			wantErr: true,
+		},
+		{
+			name:    "localhost",
+			req:     WebhookCreateRequest{Url: "https://localhost:8443/ecr", Events: []string{notificationRepositoryCreated}},
+			wantErr: true,
+		},
+		{
+			name:    "loopback",
+			req:     WebhookCreateRequest{Url: "https://[::1]/ecr", Events: []string{notificationRepositoryCreated}},
+			wantErr: true,
+		},
+		{
+			name:    "link-local",
+			req:     WebhookCreateRequest{Url: "https://169.254.169.254/latest/meta-data", Events: []string{notificationRepositoryCreated}},
+			wantErr: true,
+		},
+		{
+			name:    "private",
+			req:     WebhookCreateRequest{Url: "https://10.0.0.1/ecr", Events: []string{notificationRepositoryCreated}},
+			wantErr: true,
+		},
+		{
+			name:    "no events",
+			req:     WebhookCreateRequest{Url: "https://hooks.example.com/ecr"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown event",
+			req:     WebhookCreateRequest{Url: "https://hooks.example.com/ecr", Events: []string{"repository.exploded"}},
+			wantErr: true,
+		},
+		{
+			name:    "short secret",
+			req:     WebhookCreateRequest{Url: "https://hooks.example.com/ecr", Events: []string{notificationUserCreated}, Secret: "shh"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.req.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_webhookDialControl(t *testing.T) {
+	for address, wantErr := range map[string]bool{
+		"93.184.216.34:443":  false,
+		"127.0.0.1:443":      true,
+		"[::1]:443":          true,
+		"169.254.169.254:80": true,
+		"172.16.0.1:443":     true,
+		"[fd00::1]:443":      true,
+	} {
+		if err := webhookDialControl("tcp", address, nil); (err != nil) != wantErr {
+			t.Errorf("webhookDialControl(%s) error = %v, wantErr %v", address, err, wantErr)
+		}
+	}
+}
+
+func Test_webhookSecrets(t *testing.T) {
+	if _, err := newWebhookSecrets(common.Webhooks{SecretKey: "short"}); err == nil {
+		t.Error("expected error for a short secret key, got nil")
+	}
+
+	if secrets, err := newWebhookSecrets(common.Webhooks{}); err != nil || secrets != nil {
+		t.Errorf("expected nil webhook secrets without a key, got %+v (%v)", secrets, err)
+	}
+
+	secrets := testWebhookSecrets(t)
+
+	encrypted, err := secrets.encrypt("hook", "0123456789abcdef")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if strings.Contains(encrypted, "0123456789abcdef") {
+		t.Errorf("expected the secret to be encrypted, got %s", encrypted)
+	}
+
+	if secret, err := secrets.decrypt("hook", encrypted); err != nil || secret != "0123456789abcdef" {
+		t.Errorf("expected the decrypted secret, got '%s' (%v)", secret, err)
+	}
+
+	if _, err := secrets.decrypt("other", encrypted); err == nil {
+		t.Error("expected error decrypting the secret for another webhook, got nil")
+	}
+}
+
+func TestServer_webhooks(t *testing.T) {
+	ctx := context.Background()
+	s := &server{store: store.NewMemoryStore()}
+
+	if _, err := s.createWebhook(ctx, "12345", "spindev-00001", &WebhookCreateRequest{
+		Url:    "https://hooks.example.com/ecr",
+		Events: []string{notificationRepositoryCreated},
+	}); err == nil {
+		t.Error("expected error creating a webhook without a secret key, got nil")
+	}
+
+	s.webhookSecrets = testWebhookSecrets(t)
+
+	w, err := s.createWebhook(ctx, "12345", "spindev-00001", &WebhookCreateRequest{
+		Url:    "https://hooks.example.com/ecr",
+		Events: []string{notificationRepositoryCreated},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(w.Secret) != 64 {
+		t.Errorf("expected a generated secret to be returned on create, got '%s'", w.Secret)
+	}
+
+	item, err := s.store.Get(ctx, webhooksBucket, "12345/spindev-00001/"+w.Id)
+	if err != nil || strings.Contains(string(item), w.Secret) || !strings.Contains(string(item), "EncryptedSecret") {
+		t.Errorf("expected the secret to be encrypted in the store, got %s (%v)", item, err)
+	}
+
+	got, err := s.getWebhook(ctx, "12345", "spindev-00001", w.Id)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got.Secret != "" || got.Url != w.Url {
+		t.Errorf("expected webhook without its secret, got %+v", got)
+	}
+
+	list, err := s.listWebhooks(ctx, "12345", "spindev-00001")
+	if err != nil || len(list) != 1 || list[0].Secret != "" {
+		t.Errorf("expected 1 webhook without its secret, got %+v (%v)", list, err)
+	}
+
+	if list, _ := s.listWebhooks(ctx, "12345", "spindev-00002"); len(list) != 0 {
+		t.Errorf("expected no webhooks for another group, got %+v", list)
+	}
+
+	if err := s.deleteWebhook(ctx, "12345", "spindev-00001", w.Id); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := s.getWebhook(ctx, "12345", "spindev-00001", w.Id); err == nil {
+		t.Error("expected error getting deleted webhook")
+	}
+
+	if err := s.deleteWebhook(ctx, "12345", "spindev-00001", w.Id); err == nil {
+		t.Error("expected error deleting missing webhook")
+	}
+}
+
+// webhookReceiver is a test webhook endpoint that responds with the given statuses in order
+type webhookReceiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (wr *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	wr.requests = append(wr.requests, r)
+	wr.bodies = append(wr.bodies, body)
+
+	status := http.StatusOK
+	if len(wr.statuses) > 0 {
+		status = wr.statuses[0]
+		wr.statuses = wr.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func TestWebhookNotifier_notify(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantAttempts int
+		wantSuccess  bool
+	}{
+		{
+			name:         "delivered",
+			wantAttempts: 1,
+			wantSuccess:  true,
+		},
+		{
+			name:         "retried server errors",
+			statuses:     []int{http.StatusBadGateway, http.StatusServiceUnavailable},
+			wantAttempts: 3,
+			wantSuccess:  true,
+		},
+		{
+			name:         "stops on client error",
+			statuses:     []int{http.StatusNotFound},
+			wantAttempts: 1,
+		},
+		{
+			name:         "gives up after attempts",
+			statuses:     []int{500, 500, 500, 500, 500},
+			wantAttempts: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			receiver := &webhookReceiver{statuses: tt.statuses}
+			ts := httptest.NewTLSServer(receiver)
+			defer ts.Close()
+
+			s := &server{store: store.NewMemoryStore(), webhookSecrets: testWebhookSecrets(t)}
+			w, err := s.createWebhook(ctx, "12345", "spindev-00001", &WebhookCreateRequest{
+				Url:    "https://example.com/ecr",
+				Events: []string{notificationRepositoryCreated},
+				Secret: "0123456789abcdef",
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			n := newWebhookNotifier(s.store, s.webhookSecrets)
+			n.attempts = 3
+			n.sleep = time.Millisecond
+			s.notifier = n
+
+			// the test server's certificate is valid for example.com, connections are sent to the test server
+			n.client = ts.Client()
+			n.client.Transport.(*http.Transport).DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, ts.Listener.Addr().String())
+			}
+
+			s.notify(ctx, notificationRepositoryCreated, "12345", "spindev-00001", &RepositoryNotification{Repository: "spindev-00001/rudolph"})
+			// not subscribed
+			s.notify(ctx, notificationRepositoryDeleted, "12345", "spindev-00001", &RepositoryNotification{Repository: "spindev-00001/rudolph"})
+			// other group
+			s.notify(ctx, notificationRepositoryCreated, "12345", "spindev-00002", &RepositoryNotification{Repository: "spindev-00002/rudolph"})
+			n.wg.Wait()
+
+			if len(receiver.requests) != tt.wantAttempts {
+				t.Fatalf("expected %d requests, got %d", tt.wantAttempts, len(receiver.requests))
+			}
+
+			req := receiver.requests[0]
+			if req.Header.Get(webhookEventHeader) != notificationRepositoryCreated {
+				t.Errorf("expected event header %s, got %s", notificationRepositoryCreated, req.Header.Get(webhookEventHeader))
+			}
+
+			signature := req.Header.Get(webhookSignatureHeader)
+			if want := signPayload("0123456789abcdef", receiver.bodies[0]); !hmac.Equal([]byte(signature), []byte(want)) {
+				t.Errorf("expected signature %s, got %s", want, signature)
+			}
+
+			payload := webhookPayload{}
+			if err := json.Unmarshal(receiver.bodies[0], &payload); err != nil {
+				t.Fatalf("failed to unmarshal payload: %s", err)
+			}
+
+			if payload.Type != notificationRepositoryCreated || payload.Group != "spindev-00001" || payload.Id != req.Header.Get(webhookDeliveryHeader) {
+				t.Errorf("unexpected payload %+v", payload)
+			}
+
+			deliveries, err := s.listWebhookDeliveries(ctx, "12345", "spindev-00001", w.Id, false)
+			if err != nil || len(deliveries) != 1 {
+				t.Fatalf("expected 1 delivery, got %d (%v)", len(deliveries), err)
+			}
+
+			d := deliveries[0]
+			if d.Attempts != tt.wantAttempts || d.Success != tt.wantSuccess {
+				t.Errorf("expected %d attempts and success %t, got %+v", tt.wantAttempts, tt.wantSuccess, d)
+			}
+
+			failed, _ := s.listWebhookDeliveries(ctx, "12345", "spindev-00001", w.Id, true)
+			if tt.wantSuccess == (len(failed) != 0) {
+				t.Errorf("unexpected failed deliveries %+v", failed)
+			}
+		})
+	}
+}
+
+func TestWebhookNotifier_deliverPrivateAddress(t *testing.T) {
+	ctx := context.Background()
+	receiver := &webhookReceiver{}
+	ts := httptest.NewTLSServer(receiver)
+	defer ts.Close()
+
+	n := newWebhookNotifier(store.NewMemoryStore(), nil)
+	n.sleep = time.Millisecond
+
+	// the address is checked when it's dialed, like a host name resolving to a private address
+	w := &Webhook{Id: "hook", Account: "12345", Group: "spindev-00001", Url: ts.URL}
+	n.deliver(ctx, w, "0123456789abcdef", &Notification{Type: notificationRepositoryCreated, Account: "12345", Group: "spindev-00001"})
+
+	if len(receiver.requests) != 0 {
+		t.Errorf("expected no requests to the private address, got %d", len(receiver.requests))
+	}
+
+	items, err := n.store.List(ctx, webhookDeliveriesBucket, "12345/spindev-00001/hook/")
+	if err != nil || len(items) != 1 {
+		t.Fatalf("expected 1 delivery, got %d (%v)", len(items), err)
+	}
+
+	for _, item := range items {
+		d := &WebhookDelivery{}
+		if err := json.Unmarshal(item, d); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if d.Success || d.Attempts != 1 {
+			t.Errorf("expected a single failed attempt, got %+v", d)
+		}
+	}
+}
+
+func TestWebhookNotifier_recordDelivery(t *testing.T) {
+	ctx := context.Background()
+	n := newWebhookNotifier(store.NewMemoryStore(), nil)
+	w := &Webhook{Id: "hook", Account: "12345", Group: "spindev-00001"}
+
+	start := time.Now().UTC()
+	for i := 0; i < webhookDeliveriesRetained+5; i++ {
+		d := &WebhookDelivery{Id: "d", WebhookId: w.Id, StartedAt: start.Add(time.Duration(i) * time.Second)}
+		if err := n.recordDelivery(ctx, w, d); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	items, err := n.store.List(ctx, webhookDeliveriesBucket, "12345/spindev-00001/hook/")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(items) != webhookDeliveriesRetained {
+		t.Errorf("expected %d deliveries to be retained, got %d", webhookDeliveriesRetained, len(items))
+	}
+}
@@ -32,6 +32,16 @@ type Config struct {
 	LogLevel      string
 	Version       Version
 	Org           string
+	Store         Store
+	Events        Events
+	// ScanThresholds are the maximum number of unsuppressed findings per severity
+	// for an image scan to pass the scan gate, ie. {"CRITICAL": 0, "HIGH": 5}
+	ScanThresholds map[string]int64
+	KeyRotation    KeyRotation
+	UserReaper     UserReaper
+	OrphanedUsers  OrphanedUsers
+	SoftDelete     SoftDelete
+	Webhooks       Webhooks
 }
 
 // Account is the configuration for an individual account
@@ -44,6 +54,61 @@ type Account struct {
 	Secret     string
 }
 
+// Store is the configuration for the persistent data store
+type Store struct {
+	// Type is the store implementation, one of 'file' or 'memory' (default)
+	Type string
+	// Path is the data directory for the file store
+	Path string
+}
+
+// Events is the configuration for consuming ECR EventBridge events
+type Events struct {
+	// QueueUrl is the SQS queue receiving the "ECR Image Scan" and "ECR Image Action"
+	// events, the consumer is disabled if it's empty
+	QueueUrl string
+}
+
+// KeyRotation is the configuration for rotating repository user access keys in the org
+type KeyRotation struct {
+	// MaxKeyAge is the maximum age of an access key in days, rotation is disabled if it's 0
+	MaxKeyAge int
+	// Action is taken on active keys older than MaxKeyAge, one of 'rotate' or 'disable'
+	Action string
+	// Interval is how often the background job checks the keys, ie. "24h" (default)
+	Interval string
+	// Accounts are checked by the background job, the job is disabled if it's empty
+	Accounts []string
+	// Sink receives the new access keys when keys are rotated
+	Sink KeySink
+}
+
+// KeySink is the configuration for delivering rotated access keys
+type KeySink struct {
+	// Url is the endpoint the new access keys are posted to
+	Url string
+	// Secret is the HMAC secret used to sign the posted access keys
+	Secret string
+}
+
+// UserReaper is the configuration for deleting expired repository users
+type UserReaper struct {
+	// Interval is how often the background job checks for expired users, ie. "1h" (default)
+	Interval string
+	// Accounts are checked by the background job, the job is disabled if it's empty
+	Accounts []string
+}
+
+// OrphanedUsers is the configuration for finding repository users whose repository no longer exists
+type OrphanedUsers struct {
+	// Interval is how often the background job checks for orphaned users, ie. "24h" (default)
+	Interval string
+	// Accounts are checked by the background job, the job is disabled if it's empty
+	Accounts []string
+	// Delete the orphaned users found by the background job, otherwise they're only reported
+	Delete bool
+}
+
 // Version carries around the API version information
 type Version struct {
 	Version    string
@@ -60,3 +125,22 @@ func ReadConfig(r io.Reader) (Config, error) {
 	}
 	return c, nil
 }
+
+// SoftDelete is the configuration for deleting repositories after a grace period, during which they can be restored
+type SoftDelete struct {
+	// GracePeriod is how long a deleted repository can be restored before it's purged, ie. "168h",
+	// repositories are deleted immediately if it's empty
+	GracePeriod string
+	// Interval is how often the background job purges repositories past their grace period, ie. "1h" (default)
+	Interval string
+	// Accounts are checked for repositories tagged for deletion, along with the accounts of the soft deleted
+	// repositories in the store
+	Accounts []string
+}
+
+// Webhooks is the configuration for the space webhooks
+type Webhooks struct {
+	// SecretKey encrypts the webhook signing secrets in the store, it should be at least 32 random characters.
+	// Webhooks can't be created if it's empty.
+	SecretKey string
+}
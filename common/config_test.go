@@ -34,7 +34,45 @@ var testConfig = []byte(
 		},
 		"token": "SEKRET",
 		"logLevel": "info",
-		"org": "test"
+		"org": "test",
+		"store": {
+			"type": "file",
+			"path": "/tmp/data"
+		},
+		"events": {
+			"queueUrl": "https://sqs.us-east-1.amazonaws.com/012345678910/ecr-events"
+		},
+		"scanThresholds": {
+			"CRITICAL": 0,
+			"HIGH": 5
+		},
+		"keyRotation": {
+			"maxKeyAge": 90,
+			"action": "rotate",
+			"interval": "12h",
+			"accounts": ["012345678910"],
+			"sink": {
+				"url": "https://keys.example.com/ecr",
+				"secret": "sinksecret"
+			}
+		},
+		"userReaper": {
+			"interval": "30m",
+			"accounts": ["012345678910"]
+		},
+		"orphanedUsers": {
+			"interval": "12h",
+			"accounts": ["012345678910"],
+			"delete": true
+		},
+		"softDelete": {
+			"gracePeriod": "168h",
+			"interval": "2h",
+			"accounts": ["12345"]
+		},
+		"webhooks": {
+			"secretKey": "0123456789abcdef0123456789abcdef"
+		}
 	}`)
 
 var brokenConfig = []byte(`{ "foobar": { "baz": "biz" }`)
@@ -52,6 +90,44 @@ func TestReadConfig(t *testing.T) {
 		Token:    "SEKRET",
 		LogLevel: "info",
 		Org:      "test",
+		Store: Store{
+			Type: "file",
+			Path: "/tmp/data",
+		},
+		Events: Events{
+			QueueUrl: "https://sqs.us-east-1.amazonaws.com/012345678910/ecr-events",
+		},
+		ScanThresholds: map[string]int64{
+			"CRITICAL": 0,
+			"HIGH":     5,
+		},
+		KeyRotation: KeyRotation{
+			MaxKeyAge: 90,
+			Action:    "rotate",
+			Interval:  "12h",
+			Accounts:  []string{"012345678910"},
+			Sink: KeySink{
+				Url:    "https://keys.example.com/ecr",
+				Secret: "sinksecret",
+			},
+		},
+		UserReaper: UserReaper{
+			Interval: "30m",
+			Accounts: []string{"012345678910"},
+		},
+		OrphanedUsers: OrphanedUsers{
+			Interval: "12h",
+			Accounts: []string{"012345678910"},
+			Delete:   true,
+		},
+		SoftDelete: SoftDelete{
+			GracePeriod: "168h",
+			Interval:    "2h",
+			Accounts:    []string{"12345"},
+		},
+		Webhooks: Webhooks{
+			SecretKey: "0123456789abcdef0123456789abcdef",
+		},
 	}
 
 	actualConfig, err := ReadConfig(bytes.NewReader(testConfig))
@@ -0,0 +1,100 @@
+package ecr
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	log "github.com/sirupsen/logrus"
+)
+
+// EnhancedFindingExtras are the enhanced (Inspector) finding fields returned by the ECR API that
+// aren't modeled by the aws-sdk-go ecr types, keyed by the finding ARN
+type EnhancedFindingExtras map[string]*EnhancedFindingExtra
+
+// EnhancedFindingExtra is the fix and exploit availability of an enhanced finding
+type EnhancedFindingExtra struct {
+	// YES, NO or PARTIAL
+	FixAvailable string
+	// YES or NO
+	ExploitAvailable string
+	// FixedInVersions maps vulnerable package names to the version with the fix
+	FixedInVersions map[string]string
+}
+
+type rawScanFindings struct {
+	ImageScanFindings struct {
+		EnhancedFindings []struct {
+			FindingArn                  string `json:"findingArn"`
+			FixAvailable                string `json:"fixAvailable"`
+			ExploitAvailable            string `json:"exploitAvailable"`
+			PackageVulnerabilityDetails struct {
+				VulnerablePackages []struct {
+					Name           string `json:"name"`
+					FixedInVersion string `json:"fixedInVersion"`
+				} `json:"vulnerablePackages"`
+			} `json:"packageVulnerabilityDetails"`
+		} `json:"enhancedFindings"`
+	} `json:"imageScanFindings"`
+}
+
+// captureResponseBody is a request option that copies the raw response body into buf before it's unmarshaled
+func captureResponseBody(buf *bytes.Buffer) request.Option {
+	return func(r *request.Request) {
+		r.Handlers.Unmarshal.PushFront(func(r *request.Request) {
+			if r.HTTPResponse == nil || r.HTTPResponse.Body == nil {
+				return
+			}
+
+			b, err := io.ReadAll(r.HTTPResponse.Body)
+			r.HTTPResponse.Body.Close()
+			if err != nil {
+				r.Error = err
+				return
+			}
+
+			buf.Write(b)
+			r.HTTPResponse.Body = io.NopCloser(bytes.NewReader(b))
+		})
+	}
+}
+
+// parseEnhancedFindingExtras parses the fields missing from the aws-sdk-go ecr types from the raw
+// DescribeImageScanFindings response body
+func parseEnhancedFindingExtras(body []byte) EnhancedFindingExtras {
+	extras := EnhancedFindingExtras{}
+	if len(body) == 0 {
+		return extras
+	}
+
+	raw := rawScanFindings{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		log.Warnf("failed to parse enhanced finding details from response: %s", err)
+		return extras
+	}
+
+	for _, f := range raw.ImageScanFindings.EnhancedFindings {
+		if f.FindingArn == "" {
+			continue
+		}
+
+		extra := &EnhancedFindingExtra{
+			FixAvailable:     f.FixAvailable,
+			ExploitAvailable: f.ExploitAvailable,
+			FixedInVersions:  map[string]string{},
+		}
+
+		for _, p := range f.PackageVulnerabilityDetails.VulnerablePackages {
+			if p.FixedInVersion != "" {
+				extra.FixedInVersions[p.Name] = p.FixedInVersion
+			}
+		}
+
+		extras[f.FindingArn] = extra
+	}
+
+	log.Debugf("parsed %d enhanced finding extras from response", len(extras))
+
+	return extras
+}
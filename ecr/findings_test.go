@@ -0,0 +1,48 @@
+package ecr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parseEnhancedFindingExtras(t *testing.T) {
+	body := []byte(`{
+		"imageScanFindings": {
+			"enhancedFindings": [
+				{
+					"findingArn": "arn:aws:inspector2:us-east-1:012345678910:finding/0001",
+					"fixAvailable": "YES",
+					"exploitAvailable": "NO",
+					"packageVulnerabilityDetails": {
+						"vulnerabilityId": "CVE-2022-0778",
+						"vulnerablePackages": [
+							{"name": "openssl", "version": "1.1.1k", "fixedInVersion": "1.1.1n"},
+							{"name": "libssl1.1", "version": "1.1.1k", "fixedInVersion": ""}
+						]
+					}
+				},
+				{
+					"fixAvailable": "NO"
+				}
+			]
+		}
+	}`)
+
+	want := EnhancedFindingExtras{
+		"arn:aws:inspector2:us-east-1:012345678910:finding/0001": {
+			FixAvailable:     "YES",
+			ExploitAvailable: "NO",
+			FixedInVersions:  map[string]string{"openssl": "1.1.1n"},
+		},
+	}
+
+	if got := parseEnhancedFindingExtras(body); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseEnhancedFindingExtras() = %+v, want %+v", got, want)
+	}
+
+	for _, b := range [][]byte{nil, []byte("not json"), []byte(`{"imageScanFindings":{"findings":[]}}`)} {
+		if got := parseEnhancedFindingExtras(b); len(got) != 0 {
+			t.Errorf("expected no extras for %s, got %+v", string(b), got)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package ecr
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 
 	"github.com/YaleSpinup/apierror"
 	"github.com/aws/aws-sdk-go/aws"
@@ -53,29 +55,31 @@ func (e *ECR) GetImages(ctx context.Context, repoName string, imageIds ...*ecr.I
 }
 
 
-// GetImageScanFindings gets the scan findings for an image tag
-func (e *ECR) GetImageScanFindings(ctx context.Context, repoName, tag string) (*ecr.ImageScanFindings, error) {
+// GetImageScanFindings gets the scan findings for an image tag along with the enhanced finding
+// fields that aren't modeled by the aws-sdk-go ecr types
+func (e *ECR) GetImageScanFindings(ctx context.Context, repoName, tag string) (*ecr.ImageScanFindings, EnhancedFindingExtras, error) {
 	if repoName == "" || tag == "" {
-		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+		return nil, nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
 	}
 
 	log.Infof("getting image scan findings for %s:%s", repoName, tag)
 
+	body := &bytes.Buffer{}
 	out, err := e.Service.DescribeImageScanFindingsWithContext(ctx, &ecr.DescribeImageScanFindingsInput{
 		ImageId: &ecr.ImageIdentifier{
 			ImageTag: aws.String(tag),
 		},
 		MaxResults:     aws.Int64(1000),
 		RepositoryName: aws.String(repoName),
-	})
+	}, captureResponseBody(body))
 
 	if err != nil {
-		return nil, ErrCode("failed to get image scan findings", err)
+		return nil, nil, ErrCode("failed to get image scan findings", err)
 	}
 
 	log.Debugf("got output from image scan findings %+v", out)
 
-	return out.ImageScanFindings, nil
+	return out.ImageScanFindings, parseEnhancedFindingExtras(body.Bytes()), nil
 }
 
 // DeleteImageTag deletes the image tag, if no other tags reference the image, the image is deleted
@@ -104,27 +108,120 @@ func (e *ECR) DeleteImageTag(ctx context.Context, repoName, tag string) (*ecr.Ba
 	return out, nil
 }
 
-// GetImageScanFindingsByImageDigest gets the scan findings for an image digest
-func (e *ECR) GetImageScanFindingsByImageDigest(ctx context.Context, repoName, imageDigest string) (*ecr.DescribeImageScanFindingsOutput, error) {
+// GetImageScanFindingsByImageDigest gets the scan findings for an image digest along with the enhanced
+// finding fields that aren't modeled by the aws-sdk-go ecr types
+func (e *ECR) GetImageScanFindingsByImageDigest(ctx context.Context, repoName, imageDigest string) (*ecr.DescribeImageScanFindingsOutput, EnhancedFindingExtras, error) {
 	if imageDigest == "" || repoName == "" {
-		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+		return nil, nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
 	}
 
 	log.Infof("getting image scan findings for image ID %s in repository: %s", imageDigest, repoName)
 
+	body := &bytes.Buffer{}
 	out, err := e.Service.DescribeImageScanFindingsWithContext(ctx, &ecr.DescribeImageScanFindingsInput{
 		ImageId: &ecr.ImageIdentifier{
 			ImageDigest: aws.String(imageDigest),
 		},
 		MaxResults:     aws.Int64(1000),
 		RepositoryName: aws.String(repoName),
-	})
+	}, captureResponseBody(body))
 
 	if err != nil {
-		return nil, ErrCode("failed to get image scan findings", err)
+		return nil, nil, ErrCode("failed to get image scan findings", err)
 	}
 
 	log.Debugf("got output from image scan findings %+v", out)
 
-	return out, nil
+	return out, parseEnhancedFindingExtras(body.Bytes()), nil
+}
+
+// GetImageManifest gets the image manifest for an image in a repository
+func (e *ECR) GetImageManifest(ctx context.Context, repoName string, imageId *ecr.ImageIdentifier) (*ecr.Image, error) {
+	if repoName == "" || imageId == nil {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	log.Infof("getting image manifest for %s%s in repository %s", aws.StringValue(imageId.ImageTag), aws.StringValue(imageId.ImageDigest), repoName)
+
+	out, err := e.Service.BatchGetImageWithContext(ctx, &ecr.BatchGetImageInput{
+		AcceptedMediaTypes: aws.StringSlice([]string{
+			"application/vnd.docker.distribution.manifest.v2+json",
+			"application/vnd.oci.image.manifest.v1+json",
+			"application/vnd.docker.distribution.manifest.list.v2+json",
+			"application/vnd.oci.image.index.v1+json",
+		}),
+		ImageIds:       []*ecr.ImageIdentifier{imageId},
+		RepositoryName: aws.String(repoName),
+	})
+	if err != nil {
+		return nil, ErrCode("failed to get image manifest", err)
+	}
+
+	log.Debugf("got output from batch get image %+v", out)
+
+	if len(out.Failures) > 0 {
+		f := out.Failures[0]
+		msg := fmt.Sprintf("failed to get image manifest: %s", aws.StringValue(f.FailureReason))
+		if aws.StringValue(f.FailureCode) == ecr.ImageFailureCodeImageNotFound || aws.StringValue(f.FailureCode) == ecr.ImageFailureCodeImageTagDoesNotMatchDigest {
+			return nil, apierror.New(apierror.ErrNotFound, msg, nil)
+		}
+		return nil, apierror.New(apierror.ErrBadRequest, msg, nil)
+	}
+
+	if len(out.Images) == 0 {
+		return nil, apierror.New(apierror.ErrNotFound, "image not found", nil)
+	}
+
+	return out.Images[0], nil
+}
+
+// PutImage puts an image manifest into a repository, tagged with the image id tag if it has one.  The
+// layers referenced by the manifest must be available to the repository.
+func (e *ECR) PutImage(ctx context.Context, repoName string, image *ecr.Image) (*ecr.Image, error) {
+	if repoName == "" || image == nil || aws.StringValue(image.ImageManifest) == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	input := &ecr.PutImageInput{
+		ImageManifest:          image.ImageManifest,
+		ImageManifestMediaType: image.ImageManifestMediaType,
+		RepositoryName:         aws.String(repoName),
+	}
+
+	if image.ImageId != nil {
+		input.ImageDigest = image.ImageId.ImageDigest
+		input.ImageTag = image.ImageId.ImageTag
+	}
+
+	log.Infof("putting image %s%s in repository %s", aws.StringValue(input.ImageTag), aws.StringValue(input.ImageDigest), repoName)
+
+	out, err := e.Service.PutImageWithContext(ctx, input)
+	if err != nil {
+		return nil, ErrCode("failed to put image", err)
+	}
+
+	log.Debugf("got output from put image %+v", out)
+
+	return out.Image, nil
+}
+
+// GetImageReplicationStatus gets the replication status of an image to each of the destinations it's replicated to
+func (e *ECR) GetImageReplicationStatus(ctx context.Context, repoName, imageDigest string) ([]*ecr.ImageReplicationStatus, error) {
+	if repoName == "" || imageDigest == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	log.Infof("getting replication status of image %s in repository %s", imageDigest, repoName)
+
+	out, err := e.Service.DescribeImageReplicationStatusWithContext(ctx, &ecr.DescribeImageReplicationStatusInput{
+		ImageId:        &ecr.ImageIdentifier{ImageDigest: aws.String(imageDigest)},
+		RepositoryName: aws.String(repoName),
+	})
+	if err != nil {
+		return nil, ErrCode("failed to get image replication status", err)
+	}
+
+	log.Debugf("got output from image replication status %+v", out)
+
+	return out.ReplicationStatuses, nil
 }
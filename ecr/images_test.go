@@ -5,6 +5,9 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ecr"
 	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
@@ -114,7 +117,7 @@ func TestECR_GetImageScanFindings(t *testing.T) {
 				Service:         tt.fields.Service,
 				DefaultKMSKeyId: tt.fields.DefaultKMSKeyId,
 			}
-			got, err := e.GetImageScanFindings(tt.args.ctx, tt.args.repoName, tt.args.tag)
+			got, _, err := e.GetImageScanFindings(tt.args.ctx, tt.args.repoName, tt.args.tag)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ECR.GetImageScanFindings() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -164,3 +167,249 @@ func TestECR_DeleteImageTag(t *testing.T) {
 		})
 	}
 }
+
+var tManifest = `{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json","config":{"mediaType":"application/vnd.docker.container.image.v1+json","size":1510,"digest":"sha256:cccc"},"layers":[{"mediaType":"application/vnd.docker.image.rootfs.diff.tar.gzip","size":27145915,"digest":"sha256:aaaa"}]}`
+
+func (m *mockECRClient) BatchGetImageWithContext(ctx context.Context, input *ecr.BatchGetImageInput, opts ...request.Option) (*ecr.BatchGetImageOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	id := input.ImageIds[0]
+	if aws.StringValue(id.ImageTag) == "missing" {
+		return &ecr.BatchGetImageOutput{
+			Failures: []*ecr.ImageFailure{
+				{
+					FailureCode:   aws.String(ecr.ImageFailureCodeImageNotFound),
+					FailureReason: aws.String("Requested image not found"),
+					ImageId:       id,
+				},
+			},
+		}, nil
+	}
+
+	return &ecr.BatchGetImageOutput{
+		Images: []*ecr.Image{
+			{
+				ImageId:                id,
+				ImageManifest:          aws.String(tManifest),
+				ImageManifestMediaType: aws.String("application/vnd.docker.distribution.manifest.v2+json"),
+				RepositoryName:         input.RepositoryName,
+			},
+		},
+	}, nil
+}
+
+func TestECR_GetImageManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		repoName string
+		imageId  *ecr.ImageIdentifier
+		want     *ecr.Image
+		wantErr  bool
+	}{
+		{
+			name:     "success",
+			repoName: "carols/SilentNight",
+			imageId:  &ecr.ImageIdentifier{ImageTag: aws.String("latest")},
+			want: &ecr.Image{
+				ImageId:                &ecr.ImageIdentifier{ImageTag: aws.String("latest")},
+				ImageManifest:          aws.String(tManifest),
+				ImageManifestMediaType: aws.String("application/vnd.docker.distribution.manifest.v2+json"),
+				RepositoryName:         aws.String("carols/SilentNight"),
+			},
+		},
+		{
+			name:    "empty repository",
+			imageId: &ecr.ImageIdentifier{ImageTag: aws.String("latest")},
+			wantErr: true,
+		},
+		{
+			name:     "nil image id",
+			repoName: "carols/SilentNight",
+			wantErr:  true,
+		},
+		{
+			name:     "image not found",
+			repoName: "carols/SilentNight",
+			imageId:  &ecr.ImageIdentifier{ImageTag: aws.String("missing")},
+			wantErr:  true,
+		},
+		{
+			name:     "aws error",
+			err:      awserr.New(ecr.ErrCodeRepositoryNotFoundException, "not found", nil),
+			repoName: "carols/SilentNight",
+			imageId:  &ecr.ImageIdentifier{ImageTag: aws.String("latest")},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &ECR{Service: newmockECRClient(t, tt.err)}
+			got, err := e.GetImageManifest(context.TODO(), tt.repoName, tt.imageId)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ECR.GetImageManifest() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ECR.GetImageManifest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func (m *mockECRClient) PutImageWithContext(ctx context.Context, input *ecr.PutImageInput, opts ...request.Option) (*ecr.PutImageOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &ecr.PutImageOutput{
+		Image: &ecr.Image{
+			ImageId: &ecr.ImageIdentifier{
+				ImageDigest: input.ImageDigest,
+				ImageTag:    input.ImageTag,
+			},
+			ImageManifest:          input.ImageManifest,
+			ImageManifestMediaType: input.ImageManifestMediaType,
+			RepositoryName:         input.RepositoryName,
+		},
+	}, nil
+}
+
+func TestECR_PutImage(t *testing.T) {
+	image := &ecr.Image{
+		ImageId:                &ecr.ImageIdentifier{ImageDigest: aws.String("sha256:1234"), ImageTag: aws.String("latest")},
+		ImageManifest:          aws.String(tManifest),
+		ImageManifestMediaType: aws.String("application/vnd.docker.distribution.manifest.v2+json"),
+	}
+
+	tests := []struct {
+		name     string
+		err      error
+		repoName string
+		image    *ecr.Image
+		want     *ecr.Image
+		wantErr  bool
+	}{
+		{
+			name:    "empty repoName",
+			image:   image,
+			wantErr: true,
+		},
+		{
+			name:     "nil image",
+			repoName: "carols/SilentNight",
+			wantErr:  true,
+		},
+		{
+			name:     "empty manifest",
+			repoName: "carols/SilentNight",
+			image:    &ecr.Image{ImageId: image.ImageId},
+			wantErr:  true,
+		},
+		{
+			name:     "aws error",
+			err:      awserr.New(ecr.ErrCodeLayersNotFoundException, "layers not found", nil),
+			repoName: "carols/SilentNight",
+			image:    image,
+			wantErr:  true,
+		},
+		{
+			name:     "success",
+			repoName: "carols/SilentNight",
+			image:    image,
+			want: &ecr.Image{
+				ImageId:                image.ImageId,
+				ImageManifest:          image.ImageManifest,
+				ImageManifestMediaType: image.ImageManifestMediaType,
+				RepositoryName:         aws.String("carols/SilentNight"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &ECR{Service: newmockECRClient(t, tt.err)}
+			got, err := e.PutImage(context.TODO(), tt.repoName, tt.image)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ECR.PutImage() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ECR.PutImage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func (m *mockECRClient) DescribeImageReplicationStatusWithContext(ctx context.Context, input *ecr.DescribeImageReplicationStatusInput, opts ...request.Option) (*ecr.DescribeImageReplicationStatusOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &ecr.DescribeImageReplicationStatusOutput{
+		ImageId:        input.ImageId,
+		RepositoryName: input.RepositoryName,
+		ReplicationStatuses: []*ecr.ImageReplicationStatus{
+			{
+				Region:     aws.String("us-west-2"),
+				RegistryId: aws.String("012345678910"),
+				Status:     aws.String(ecr.ReplicationStatusComplete),
+			},
+		},
+	}, nil
+}
+
+func TestECR_GetImageReplicationStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		repoName    string
+		imageDigest string
+		want        []*ecr.ImageReplicationStatus
+		wantErr     bool
+	}{
+		{
+			name:        "empty repoName",
+			imageDigest: "sha256:1234",
+			wantErr:     true,
+		},
+		{
+			name:     "empty imageDigest",
+			repoName: "carols/SilentNight",
+			wantErr:  true,
+		},
+		{
+			name:        "aws error",
+			err:         awserr.New(ecr.ErrCodeImageNotFoundException, "image not found", nil),
+			repoName:    "carols/SilentNight",
+			imageDigest: "sha256:1234",
+			wantErr:     true,
+		},
+		{
+			name:        "success",
+			repoName:    "carols/SilentNight",
+			imageDigest: "sha256:1234",
+			want: []*ecr.ImageReplicationStatus{
+				{
+					Region:     aws.String("us-west-2"),
+					RegistryId: aws.String("012345678910"),
+					Status:     aws.String(ecr.ReplicationStatusComplete),
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &ECR{Service: newmockECRClient(t, tt.err)}
+			got, err := e.GetImageReplicationStatus(context.TODO(), tt.repoName, tt.imageDigest)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ECR.GetImageReplicationStatus() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ECR.GetImageReplicationStatus() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package ecr
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetLayerDownloadUrl gets the pre-signed url to download an image layer (blob) from a repository
+func (e *ECR) GetLayerDownloadUrl(ctx context.Context, repoName, digest string) (string, error) {
+	if repoName == "" || digest == "" {
+		return "", apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	log.Infof("getting download url for layer %s in repository %s", digest, repoName)
+
+	out, err := e.Service.GetDownloadUrlForLayerWithContext(ctx, &ecr.GetDownloadUrlForLayerInput{
+		LayerDigest:    aws.String(digest),
+		RepositoryName: aws.String(repoName),
+	})
+	if err != nil {
+		return "", ErrCode("failed to get layer download url", err)
+	}
+
+	return aws.StringValue(out.DownloadUrl), nil
+}
+
+// GetAvailableLayers returns the layers (blobs) in the list of digests that are already available in a repository
+func (e *ECR) GetAvailableLayers(ctx context.Context, repoName string, digests ...string) (map[string]bool, error) {
+	if repoName == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	available := map[string]bool{}
+	if len(digests) == 0 {
+		return available, nil
+	}
+
+	log.Infof("checking availability of %d layers in repository %s", len(digests), repoName)
+
+	out, err := e.Service.BatchCheckLayerAvailabilityWithContext(ctx, &ecr.BatchCheckLayerAvailabilityInput{
+		LayerDigests:   aws.StringSlice(digests),
+		RepositoryName: aws.String(repoName),
+	})
+	if err != nil {
+		return nil, ErrCode("failed to check layer availability", err)
+	}
+
+	log.Debugf("got output from batch check layer availability %+v", out)
+
+	for _, l := range out.Layers {
+		if aws.StringValue(l.LayerAvailability) == ecr.LayerAvailabilityAvailable {
+			available[aws.StringValue(l.LayerDigest)] = true
+		}
+	}
+
+	return available, nil
+}
+
+// InitiateLayerUpload starts uploading a layer (blob) to a repository.  It returns the upload id and the size
+// of the parts the layer is uploaded in.
+func (e *ECR) InitiateLayerUpload(ctx context.Context, repoName string) (string, int64, error) {
+	if repoName == "" {
+		return "", 0, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	log.Infof("initiating layer upload to repository %s", repoName)
+
+	out, err := e.Service.InitiateLayerUploadWithContext(ctx, &ecr.InitiateLayerUploadInput{
+		RepositoryName: aws.String(repoName),
+	})
+	if err != nil {
+		return "", 0, ErrCode("failed to initiate layer upload", err)
+	}
+
+	return aws.StringValue(out.UploadId), aws.Int64Value(out.PartSize), nil
+}
+
+// UploadLayerPart uploads a part of a layer starting at the first byte
+func (e *ECR) UploadLayerPart(ctx context.Context, repoName, uploadId string, first int64, part []byte) error {
+	if repoName == "" || uploadId == "" || len(part) == 0 {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	last := first + int64(len(part)) - 1
+
+	log.Debugf("uploading layer part %d-%d of upload %s to repository %s", first, last, uploadId, repoName)
+
+	if _, err := e.Service.UploadLayerPartWithContext(ctx, &ecr.UploadLayerPartInput{
+		LayerPartBlob:  part,
+		PartFirstByte:  aws.Int64(first),
+		PartLastByte:   aws.Int64(last),
+		RepositoryName: aws.String(repoName),
+		UploadId:       aws.String(uploadId),
+	}); err != nil {
+		return ErrCode(fmt.Sprintf("failed to upload layer part %d-%d", first, last), err)
+	}
+
+	return nil
+}
+
+// CompleteLayerUpload completes a layer upload, the digest is checked against the uploaded parts
+func (e *ECR) CompleteLayerUpload(ctx context.Context, repoName, uploadId, digest string) error {
+	if repoName == "" || uploadId == "" || digest == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	log.Infof("completing upload %s of layer %s to repository %s", uploadId, digest, repoName)
+
+	if _, err := e.Service.CompleteLayerUploadWithContext(ctx, &ecr.CompleteLayerUploadInput{
+		LayerDigests:   aws.StringSlice([]string{digest}),
+		RepositoryName: aws.String(repoName),
+		UploadId:       aws.String(uploadId),
+	}); err != nil {
+		return ErrCode("failed to complete layer upload", err)
+	}
+
+	return nil
+}
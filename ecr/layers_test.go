@@ -0,0 +1,221 @@
+package ecr
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+func (m *mockECRClient) GetDownloadUrlForLayerWithContext(ctx context.Context, input *ecr.GetDownloadUrlForLayerInput, opts ...request.Option) (*ecr.GetDownloadUrlForLayerOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &ecr.GetDownloadUrlForLayerOutput{
+		DownloadUrl: aws.String("https://prod-us-east-1-starport-layer-bucket.s3.amazonaws.com/" + aws.StringValue(input.LayerDigest)),
+		LayerDigest: input.LayerDigest,
+	}, nil
+}
+
+func TestECR_GetLayerDownloadUrl(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		repoName string
+		digest   string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:    "empty repoName",
+			digest:  "sha256:1234",
+			wantErr: true,
+		},
+		{
+			name:     "empty digest",
+			repoName: "carols/SilentNight",
+			wantErr:  true,
+		},
+		{
+			name:     "aws error",
+			err:      awserr.New(ecr.ErrCodeLayersNotFoundException, "layer not found", nil),
+			repoName: "carols/SilentNight",
+			digest:   "sha256:1234",
+			wantErr:  true,
+		},
+		{
+			name:     "success",
+			repoName: "carols/SilentNight",
+			digest:   "sha256:1234",
+			want:     "https://prod-us-east-1-starport-layer-bucket.s3.amazonaws.com/sha256:1234",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &ECR{Service: newmockECRClient(t, tt.err)}
+			got, err := e.GetLayerDownloadUrl(context.TODO(), tt.repoName, tt.digest)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ECR.GetLayerDownloadUrl() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ECR.GetLayerDownloadUrl() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func (m *mockECRClient) BatchCheckLayerAvailabilityWithContext(ctx context.Context, input *ecr.BatchCheckLayerAvailabilityInput, opts ...request.Option) (*ecr.BatchCheckLayerAvailabilityOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	out := &ecr.BatchCheckLayerAvailabilityOutput{}
+	for _, d := range input.LayerDigests {
+		availability := ecr.LayerAvailabilityAvailable
+		if aws.StringValue(d) == "sha256:missing" {
+			availability = ecr.LayerAvailabilityUnavailable
+		}
+
+		out.Layers = append(out.Layers, &ecr.Layer{
+			LayerAvailability: aws.String(availability),
+			LayerDigest:       d,
+		})
+	}
+
+	return out, nil
+}
+
+func TestECR_GetAvailableLayers(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		repoName string
+		digests  []string
+		want     map[string]bool
+		wantErr  bool
+	}{
+		{
+			name:    "empty repoName",
+			digests: []string{"sha256:1234"},
+			wantErr: true,
+		},
+		{
+			name:     "no digests",
+			repoName: "carols/SilentNight",
+			want:     map[string]bool{},
+		},
+		{
+			name:     "aws error",
+			err:      awserr.New(ecr.ErrCodeRepositoryNotFoundException, "repository not found", nil),
+			repoName: "carols/SilentNight",
+			digests:  []string{"sha256:1234"},
+			wantErr:  true,
+		},
+		{
+			name:     "success",
+			repoName: "carols/SilentNight",
+			digests:  []string{"sha256:1234", "sha256:missing"},
+			want:     map[string]bool{"sha256:1234": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &ECR{Service: newmockECRClient(t, tt.err)}
+			got, err := e.GetAvailableLayers(context.TODO(), tt.repoName, tt.digests...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ECR.GetAvailableLayers() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ECR.GetAvailableLayers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func (m *mockECRClient) InitiateLayerUploadWithContext(ctx context.Context, input *ecr.InitiateLayerUploadInput, opts ...request.Option) (*ecr.InitiateLayerUploadOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &ecr.InitiateLayerUploadOutput{
+		PartSize: aws.Int64(10485760),
+		UploadId: aws.String("upload-1"),
+	}, nil
+}
+
+func (m *mockECRClient) UploadLayerPartWithContext(ctx context.Context, input *ecr.UploadLayerPartInput, opts ...request.Option) (*ecr.UploadLayerPartOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	if size := aws.Int64Value(input.PartLastByte) - aws.Int64Value(input.PartFirstByte) + 1; size != int64(len(input.LayerPartBlob)) {
+		m.t.Errorf("expected part size %d, got %d bytes", size, len(input.LayerPartBlob))
+	}
+
+	return &ecr.UploadLayerPartOutput{
+		LastByteReceived: input.PartLastByte,
+		RepositoryName:   input.RepositoryName,
+		UploadId:         input.UploadId,
+	}, nil
+}
+
+func (m *mockECRClient) CompleteLayerUploadWithContext(ctx context.Context, input *ecr.CompleteLayerUploadInput, opts ...request.Option) (*ecr.CompleteLayerUploadOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &ecr.CompleteLayerUploadOutput{
+		LayerDigest:    input.LayerDigests[0],
+		RepositoryName: input.RepositoryName,
+		UploadId:       input.UploadId,
+	}, nil
+}
+
+func TestECR_LayerUpload(t *testing.T) {
+	e := &ECR{Service: newmockECRClient(t, nil)}
+
+	if _, _, err := e.InitiateLayerUpload(context.TODO(), ""); err == nil {
+		t.Error("expected error for empty repoName")
+	}
+
+	uploadId, partSize, err := e.InitiateLayerUpload(context.TODO(), "carols/SilentNight")
+	if err != nil || uploadId != "upload-1" || partSize != 10485760 {
+		t.Fatalf("expected upload-1 with 10485760 byte parts, got %s %d (%v)", uploadId, partSize, err)
+	}
+
+	if err := e.UploadLayerPart(context.TODO(), "carols/SilentNight", uploadId, 0, nil); err == nil {
+		t.Error("expected error for empty part")
+	}
+
+	if err := e.UploadLayerPart(context.TODO(), "carols/SilentNight", uploadId, 10, []byte("layer")); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if err := e.CompleteLayerUpload(context.TODO(), "carols/SilentNight", uploadId, ""); err == nil {
+		t.Error("expected error for empty digest")
+	}
+
+	if err := e.CompleteLayerUpload(context.TODO(), "carols/SilentNight", uploadId, "sha256:1234"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	e = &ECR{Service: newmockECRClient(t, awserr.New(ecr.ErrCodeLayerPartTooSmallException, "too small", nil))}
+	if err := e.UploadLayerPart(context.TODO(), "carols/SilentNight", uploadId, 0, []byte("layer")); err == nil {
+		t.Error("expected aws error uploading part")
+	}
+
+	if _, _, err := e.InitiateLayerUpload(context.TODO(), "carols/SilentNight"); err == nil {
+		t.Error("expected aws error initiating upload")
+	}
+
+	if err := e.CompleteLayerUpload(context.TODO(), "carols/SilentNight", uploadId, "sha256:1234"); err == nil {
+		t.Error("expected aws error completing upload")
+	}
+}
@@ -0,0 +1,91 @@
+package ecr
+
+import (
+	"context"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetRegistryScanningConfiguration gets the scanning configuration for the registry
+func (e *ECR) GetRegistryScanningConfiguration(ctx context.Context) (*ecr.RegistryScanningConfiguration, error) {
+	log.Info("getting registry scanning configuration")
+
+	out, err := e.Service.GetRegistryScanningConfigurationWithContext(ctx, &ecr.GetRegistryScanningConfigurationInput{})
+	if err != nil {
+		return nil, ErrCode("failed to get registry scanning configuration", err)
+	}
+
+	log.Debugf("got output from getting registry scanning configuration %+v", out)
+
+	return out.ScanningConfiguration, nil
+}
+
+// PutRegistryScanningConfiguration sets the scanning configuration for the registry
+func (e *ECR) PutRegistryScanningConfiguration(ctx context.Context, input *ecr.PutRegistryScanningConfigurationInput) (*ecr.RegistryScanningConfiguration, error) {
+	if input == nil {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	log.Infof("setting registry scanning configuration %+v", input)
+
+	out, err := e.Service.PutRegistryScanningConfigurationWithContext(ctx, input)
+	if err != nil {
+		return nil, ErrCode("failed to set registry scanning configuration", err)
+	}
+
+	log.Debugf("got output from setting registry scanning configuration %+v", out)
+
+	return out.RegistryScanningConfiguration, nil
+}
+
+// GetReplicationConfiguration gets the replication configuration for the registry
+func (e *ECR) GetReplicationConfiguration(ctx context.Context) (*ecr.ReplicationConfiguration, error) {
+	log.Info("getting registry replication configuration")
+
+	out, err := e.Service.DescribeRegistryWithContext(ctx, &ecr.DescribeRegistryInput{})
+	if err != nil {
+		return nil, ErrCode("failed to get registry replication configuration", err)
+	}
+
+	log.Debugf("got output from describing registry %+v", out)
+
+	return out.ReplicationConfiguration, nil
+}
+
+// PutReplicationConfiguration sets the replication configuration for the registry, replacing all of the rules
+func (e *ECR) PutReplicationConfiguration(ctx context.Context, config *ecr.ReplicationConfiguration) (*ecr.ReplicationConfiguration, error) {
+	if config == nil {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	log.Infof("setting registry replication configuration %+v", config)
+
+	out, err := e.Service.PutReplicationConfigurationWithContext(ctx, &ecr.PutReplicationConfigurationInput{
+		ReplicationConfiguration: config,
+	})
+	if err != nil {
+		return nil, ErrCode("failed to set registry replication configuration", err)
+	}
+
+	log.Debugf("got output from setting registry replication configuration %+v", out)
+
+	return out.ReplicationConfiguration, nil
+}
+
+// GetAuthorizationToken gets a docker login token for the registry with the permissions of the session
+func (e *ECR) GetAuthorizationToken(ctx context.Context) (*ecr.AuthorizationData, error) {
+	log.Info("getting registry authorization token")
+
+	out, err := e.Service.GetAuthorizationTokenWithContext(ctx, &ecr.GetAuthorizationTokenInput{})
+	if err != nil {
+		return nil, ErrCode("failed to get registry authorization token", err)
+	}
+
+	if len(out.AuthorizationData) == 0 {
+		return nil, apierror.New(apierror.ErrInternalError, "no authorization data returned", nil)
+	}
+
+	return out.AuthorizationData[0], nil
+}
@@ -0,0 +1,285 @@
+package ecr
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+var tScanningConfiguration = &ecr.RegistryScanningConfiguration{
+	Rules: []*ecr.RegistryScanningRule{
+		{
+			RepositoryFilters: []*ecr.ScanningRepositoryFilter{
+				{
+					Filter:     aws.String("carols/*"),
+					FilterType: aws.String("WILDCARD"),
+				},
+			},
+			ScanFrequency: aws.String("CONTINUOUS_SCAN"),
+		},
+	},
+	ScanType: aws.String("ENHANCED"),
+}
+
+func (m *mockECRClient) GetRegistryScanningConfigurationWithContext(ctx context.Context, input *ecr.GetRegistryScanningConfigurationInput, opts ...request.Option) (*ecr.GetRegistryScanningConfigurationOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &ecr.GetRegistryScanningConfigurationOutput{
+		RegistryId:            aws.String("012345678910"),
+		ScanningConfiguration: tScanningConfiguration,
+	}, nil
+}
+
+func (m *mockECRClient) PutRegistryScanningConfigurationWithContext(ctx context.Context, input *ecr.PutRegistryScanningConfigurationInput, opts ...request.Option) (*ecr.PutRegistryScanningConfigurationOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &ecr.PutRegistryScanningConfigurationOutput{
+		RegistryScanningConfiguration: &ecr.RegistryScanningConfiguration{
+			Rules:    input.Rules,
+			ScanType: input.ScanType,
+		},
+	}, nil
+}
+
+var tReplicationConfiguration = &ecr.ReplicationConfiguration{
+	Rules: []*ecr.ReplicationRule{
+		{
+			Destinations: []*ecr.ReplicationDestination{
+				{
+					Region:     aws.String("us-west-2"),
+					RegistryId: aws.String("012345678910"),
+				},
+			},
+			RepositoryFilters: []*ecr.RepositoryFilter{
+				{
+					Filter:     aws.String("carols-"),
+					FilterType: aws.String("PREFIX_MATCH"),
+				},
+			},
+		},
+	},
+}
+
+func (m *mockECRClient) DescribeRegistryWithContext(ctx context.Context, input *ecr.DescribeRegistryInput, opts ...request.Option) (*ecr.DescribeRegistryOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &ecr.DescribeRegistryOutput{
+		RegistryId:               aws.String("012345678910"),
+		ReplicationConfiguration: tReplicationConfiguration,
+	}, nil
+}
+
+func (m *mockECRClient) PutReplicationConfigurationWithContext(ctx context.Context, input *ecr.PutReplicationConfigurationInput, opts ...request.Option) (*ecr.PutReplicationConfigurationOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &ecr.PutReplicationConfigurationOutput{
+		ReplicationConfiguration: input.ReplicationConfiguration,
+	}, nil
+}
+
+var tAuthorizationData = &ecr.AuthorizationData{
+	AuthorizationToken: aws.String("QVdTOnNlY3JldA=="),
+	ExpiresAt:          aws.Time(time.Date(2021, 3, 12, 5, 27, 30, 0, time.UTC)),
+	ProxyEndpoint:      aws.String("https://012345678910.dkr.ecr.us-east-1.amazonaws.com"),
+}
+
+func (m *mockECRClient) GetAuthorizationTokenWithContext(ctx context.Context, input *ecr.GetAuthorizationTokenInput, opts ...request.Option) (*ecr.GetAuthorizationTokenOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{tAuthorizationData},
+	}, nil
+}
+
+func TestECR_GetRegistryScanningConfiguration(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		want    *ecr.RegistryScanningConfiguration
+		wantErr bool
+	}{
+		{
+			name: "success",
+			want: tScanningConfiguration,
+		},
+		{
+			name:    "aws error",
+			err:     awserr.New(ecr.ErrCodeValidationException, "boom", nil),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &ECR{Service: newmockECRClient(t, tt.err)}
+			got, err := e.GetRegistryScanningConfiguration(context.TODO())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ECR.GetRegistryScanningConfiguration() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ECR.GetRegistryScanningConfiguration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestECR_PutRegistryScanningConfiguration(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		input   *ecr.PutRegistryScanningConfigurationInput
+		want    *ecr.RegistryScanningConfiguration
+		wantErr bool
+	}{
+		{
+			name: "success",
+			input: &ecr.PutRegistryScanningConfigurationInput{
+				Rules:    tScanningConfiguration.Rules,
+				ScanType: tScanningConfiguration.ScanType,
+			},
+			want: tScanningConfiguration,
+		},
+		{
+			name:    "nil input",
+			wantErr: true,
+		},
+		{
+			name:    "aws error",
+			err:     awserr.New(ecr.ErrCodeValidationException, "boom", nil),
+			input:   &ecr.PutRegistryScanningConfigurationInput{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &ECR{Service: newmockECRClient(t, tt.err)}
+			got, err := e.PutRegistryScanningConfiguration(context.TODO(), tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ECR.PutRegistryScanningConfiguration() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ECR.PutRegistryScanningConfiguration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestECR_GetReplicationConfiguration(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		want    *ecr.ReplicationConfiguration
+		wantErr bool
+	}{
+		{
+			name: "success",
+			want: tReplicationConfiguration,
+		},
+		{
+			name:    "aws error",
+			err:     awserr.New(ecr.ErrCodeValidationException, "boom", nil),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &ECR{Service: newmockECRClient(t, tt.err)}
+			got, err := e.GetReplicationConfiguration(context.TODO())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ECR.GetReplicationConfiguration() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ECR.GetReplicationConfiguration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestECR_PutReplicationConfiguration(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		input   *ecr.ReplicationConfiguration
+		want    *ecr.ReplicationConfiguration
+		wantErr bool
+	}{
+		{
+			name:  "success",
+			input: tReplicationConfiguration,
+			want:  tReplicationConfiguration,
+		},
+		{
+			name:    "nil input",
+			wantErr: true,
+		},
+		{
+			name:    "aws error",
+			err:     awserr.New(ecr.ErrCodeValidationException, "boom", nil),
+			input:   &ecr.ReplicationConfiguration{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &ECR{Service: newmockECRClient(t, tt.err)}
+			got, err := e.PutReplicationConfiguration(context.TODO(), tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ECR.PutReplicationConfiguration() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ECR.PutReplicationConfiguration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestECR_GetAuthorizationToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		want    *ecr.AuthorizationData
+		wantErr bool
+	}{
+		{
+			name: "success",
+			want: tAuthorizationData,
+		},
+		{
+			name:    "aws error",
+			err:     awserr.New(ecr.ErrCodeServerException, "boom", nil),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &ECR{Service: newmockECRClient(t, tt.err)}
+			got, err := e.GetAuthorizationToken(context.TODO())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ECR.GetAuthorizationToken() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ECR.GetAuthorizationToken() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
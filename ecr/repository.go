@@ -147,6 +147,27 @@ func (e *ECR) UpdateRepositoryTags(ctx context.Context, repoArn string, tags []*
 	return nil
 }
 
+// DeleteRepositoryTags removes the tags with the given keys from a repository by ARN
+func (e *ECR) DeleteRepositoryTags(ctx context.Context, repoArn string, keys []string) error {
+	if repoArn == "" || len(keys) == 0 {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	log.Infof("removing tags %v from repository %s", keys, repoArn)
+
+	out, err := e.Service.UntagResourceWithContext(ctx, &ecr.UntagResourceInput{
+		ResourceArn: aws.String(repoArn),
+		TagKeys:     aws.StringSlice(keys),
+	})
+	if err != nil {
+		return ErrCode("failed to remove repository tags", err)
+	}
+
+	log.Debugf("got output from removing repository tags %+v", out)
+
+	return nil
+}
+
 // SetImageScanningConfiguration updates the image scanning configuration for a repository by name
 func (e *ECR) SetImageScanningConfiguration(ctx context.Context, repoName string, scanOnPush bool) error {
 	if repoName == "" {
@@ -219,6 +240,34 @@ func (e *ECR) GetRepositoryPolicy(ctx context.Context, repoName string) (string,
 	return aws.StringValue(out.PolicyText), nil
 }
 
+// DeleteRepositoryPolicy removes the policy from a repository by name, it's not an error if the
+// repository doesn't have a policy
+func (e *ECR) DeleteRepositoryPolicy(ctx context.Context, repoName string) error {
+	if repoName == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	log.Infof("deleting repository policy for %s", repoName)
+
+	out, err := e.Service.DeleteRepositoryPolicyWithContext(ctx, &ecr.DeleteRepositoryPolicyInput{
+		RepositoryName: aws.String(repoName),
+	})
+
+	if err != nil {
+		if aerr, ok := errors.Cause(err).(awserr.Error); ok {
+			if aerr.Code() == ecr.ErrCodeRepositoryPolicyNotFoundException {
+				return nil
+			}
+		}
+
+		return ErrCode("failed to delete repository policy", err)
+	}
+
+	log.Debugf("got output from deleting repository policy: %+v", out)
+
+	return nil
+}
+
 func (e *ECR) ScanImage(ctx context.Context, imageDetails *ecr.ImageDetail, repository string) error {
 	_, err := e.Service.StartImageScanWithContext(ctx, &ecr.StartImageScanInput{
 		ImageId: &ecr.ImageIdentifier{
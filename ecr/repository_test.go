@@ -213,6 +213,37 @@ func (m *mockECRClient) SetRepositoryPolicyWithContext(ctx context.Context, inpu
 	return nil, awserr.New(ecr.ErrCodeRepositoryNotFoundException, "repository not found", nil)
 }
 
+func (m *mockECRClient) DeleteRepositoryPolicyWithContext(ctx context.Context, input *ecr.DeleteRepositoryPolicyInput, opts ...request.Option) (*ecr.DeleteRepositoryPolicyOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	for _, r := range tRepos {
+		if aws.StringValue(input.RepositoryName) == aws.StringValue(r.RepositoryName) {
+			return &ecr.DeleteRepositoryPolicyOutput{
+				RegistryId:     r.RegistryId,
+				RepositoryName: r.RepositoryName,
+			}, nil
+		}
+	}
+
+	return nil, awserr.New(ecr.ErrCodeRepositoryNotFoundException, "repository not found", nil)
+}
+
+func (m *mockECRClient) UntagResourceWithContext(ctx context.Context, input *ecr.UntagResourceInput, opts ...request.Option) (*ecr.UntagResourceOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	for _, r := range tRepos {
+		if aws.StringValue(input.ResourceArn) == aws.StringValue(r.RepositoryArn) {
+			return &ecr.UntagResourceOutput{}, nil
+		}
+	}
+
+	return nil, awserr.New(ecr.ErrCodeRepositoryNotFoundException, "repository not found", nil)
+}
+
 func TestECR_CreateRepository(t *testing.T) {
 	type fields struct {
 		session         *session.Session
@@ -654,6 +685,58 @@ func TestECR_UpdateRepositoryTags(t *testing.T) {
 	}
 }
 
+func TestECR_DeleteRepositoryTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		service ecriface.ECRAPI
+		repoArn string
+		keys    []string
+		wantErr bool
+	}{
+		{
+			name:    "empty repoArn",
+			service: newmockECRClient(t, nil),
+			keys:    []string{"foo"},
+			wantErr: true,
+		},
+		{
+			name:    "empty keys",
+			service: newmockECRClient(t, nil),
+			repoArn: aws.StringValue(tRepos[0].RepositoryArn),
+			wantErr: true,
+		},
+		{
+			name:    "unknown repository",
+			service: newmockECRClient(t, nil),
+			repoArn: "arn:aws:ecr:us-east-1:012345678901:repository/somemissingrepo",
+			keys:    []string{"foo"},
+			wantErr: true,
+		},
+		{
+			name:    "aws error",
+			service: newmockECRClient(t, awserr.New(ecr.ErrCodeInvalidParameterException, "bad request", nil)),
+			repoArn: aws.StringValue(tRepos[0].RepositoryArn),
+			keys:    []string{"foo"},
+			wantErr: true,
+		},
+		{
+			name:    "success",
+			service: newmockECRClient(t, nil),
+			repoArn: aws.StringValue(tRepos[0].RepositoryArn),
+			keys:    []string{"foo", "bar"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &ECR{Service: tt.service}
+			if err := e.DeleteRepositoryTags(context.TODO(), tt.repoArn, tt.keys); (err != nil) != tt.wantErr {
+				t.Errorf("ECR.DeleteRepositoryTags() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestECR_SetImageScanningConfiguration(t *testing.T) {
 	type fields struct {
 		session         *session.Session
@@ -866,6 +949,53 @@ func TestECR_UpdateRepositoryPolicy(t *testing.T) {
 	}
 }
 
+func TestECR_DeleteRepositoryPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		service  ecriface.ECRAPI
+		repoName string
+		wantErr  bool
+	}{
+		{
+			name:     "empty repoName",
+			service:  newmockECRClient(t, nil),
+			repoName: "",
+			wantErr:  true,
+		},
+		{
+			name:     "unknown repository",
+			service:  newmockECRClient(t, nil),
+			repoName: "somemissingrepo",
+			wantErr:  true,
+		},
+		{
+			name:     "no policy",
+			service:  newmockECRClient(t, awserr.New(ecr.ErrCodeRepositoryPolicyNotFoundException, "not found", nil)),
+			repoName: "carols/JingleBells",
+		},
+		{
+			name:     "non-aws error",
+			service:  newmockECRClient(t, errors.New("things blowing up!")),
+			repoName: "carols/JingleBells",
+			wantErr:  true,
+		},
+		{
+			name:     "success",
+			service:  newmockECRClient(t, nil),
+			repoName: aws.StringValue(tRepos[0].RepositoryName),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &ECR{Service: tt.service}
+			if err := e.DeleteRepositoryPolicy(context.TODO(), tt.repoName); (err != nil) != tt.wantErr {
+				t.Errorf("ECR.DeleteRepositoryPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestECR_GetRepositoryPolicy(t *testing.T) {
 	type fields struct {
 		session         *session.Session
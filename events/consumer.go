@@ -0,0 +1,79 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Handler processes an event.  Returning an error leaves the message on the queue to be retried.
+type Handler func(ctx context.Context, e *Event) error
+
+// Consumer receives events from a queue and passes them to the handler
+type Consumer struct {
+	queue   Queue
+	handler Handler
+	// Backoff is the time to wait after failing to receive messages
+	Backoff time.Duration
+}
+
+// NewConsumer returns a consumer for the queue
+func NewConsumer(queue Queue, handler Handler) *Consumer {
+	return &Consumer{
+		queue:   queue,
+		handler: handler,
+		Backoff: 10 * time.Second,
+	}
+}
+
+// Run receives and handles events until the context is cancelled
+func (c *Consumer) Run(ctx context.Context) {
+	log.Info("starting event consumer")
+
+	for {
+		if ctx.Err() != nil {
+			log.Info("stopping event consumer")
+			return
+		}
+
+		messages, err := c.queue.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+
+			log.Errorf("failed to receive events, retrying in %s: %s", c.Backoff, err)
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(c.Backoff):
+			}
+			continue
+		}
+
+		for _, m := range messages {
+			c.process(ctx, m)
+		}
+	}
+}
+
+// process handles a single message, deleting it from the queue unless the handler fails
+func (c *Consumer) process(ctx context.Context, m *Message) {
+	e, err := Parse(m.Body)
+	if err != nil {
+		// a message that can't be parsed will never succeed, drop it
+		log.Errorf("dropping unparseable event message %s: %s", m.Id, err)
+	} else {
+		log.Debugf("handling %s event %s from account %s", e.DetailType, e.Id, e.Account)
+
+		if err := c.handler(ctx, e); err != nil {
+			log.Errorf("failed to handle %s event %s, it will be retried: %s", e.DetailType, e.Id, err)
+			return
+		}
+	}
+
+	if err := c.queue.Delete(ctx, m); err != nil {
+		log.Errorf("failed to delete event message %s: %s", m.Id, err)
+	}
+}
@@ -0,0 +1,101 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConsumer_Run(t *testing.T) {
+	q := NewMemoryQueue(10 * time.Millisecond)
+	q.Send(testScanEvent)
+	q.Send("not json")
+	q.Send(testActionEvent)
+
+	mu := sync.Mutex{}
+	handled := []string{}
+	handler := func(ctx context.Context, e *Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, e.DetailType)
+
+		if e.DetailType == DetailTypeImageAction {
+			return errors.New("boom")
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewConsumer(q, handler).Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		mu.Lock()
+		n := len(handled)
+		mu.Unlock()
+
+		if n >= 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+
+	if len(handled) != 2 || handled[0] != DetailTypeImageScan || handled[1] != DetailTypeImageAction {
+		t.Errorf("expected scan and action events to be handled, got %v", handled)
+	}
+
+	// the unparseable and successful messages are deleted, the failed event stays in flight
+	pending, inFlight := q.Len()
+	if pending != 0 || inFlight != 1 {
+		t.Errorf("expected 0 pending and 1 in flight message, got %d and %d", pending, inFlight)
+	}
+
+	q.Requeue()
+	if pending, inFlight := q.Len(); pending != 1 || inFlight != 0 {
+		t.Errorf("expected 1 pending and 0 in flight message after requeue, got %d and %d", pending, inFlight)
+	}
+}
+
+func TestMemoryQueue(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQueue(10 * time.Millisecond)
+
+	messages, err := q.Receive(ctx)
+	if err != nil || len(messages) != 0 {
+		t.Errorf("expected no messages from empty queue, got %v, %v", messages, err)
+	}
+
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		q.Send("hello")
+	}()
+
+	q.wait = time.Second
+	messages, err = q.Receive(ctx)
+	if err != nil || len(messages) != 1 || messages[0].Body != "hello" {
+		t.Fatalf("expected to receive the sent message, got %v, %v", messages, err)
+	}
+
+	if err := q.Delete(ctx, messages[0]); err != nil {
+		t.Errorf("unexpected error deleting message: %s", err)
+	}
+
+	if err := q.Delete(ctx, messages[0]); err == nil {
+		t.Error("expected error deleting message twice, got nil")
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := q.Receive(cctx); err == nil {
+		t.Error("expected error receiving with a cancelled context, got nil")
+	}
+}
@@ -0,0 +1,102 @@
+// Package events consumes ECR EventBridge events ("ECR Image Scan" and "ECR Image Action") and
+// the Amazon Inspector events for enhanced scans ("Inspector2 Scan") delivered to a queue.
+package events
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+)
+
+const (
+	// DetailTypeImageScan is the detail-type of the event sent when a basic image scan completes
+	DetailTypeImageScan = "ECR Image Scan"
+	// DetailTypeImageAction is the detail-type of the event sent when an image is pushed or deleted
+	DetailTypeImageAction = "ECR Image Action"
+	// DetailTypeInspectorScan is the detail-type of the event sent by Amazon Inspector when the initial
+	// enhanced scan of an image completes
+	DetailTypeInspectorScan = "Inspector2 Scan"
+
+	ScanStatusComplete            = "COMPLETE"
+	ScanStatusFailed              = "FAILED"
+	ScanStatusInitialScanComplete = "INITIAL_SCAN_COMPLETE"
+
+	ActionTypePush   = "PUSH"
+	ActionTypeDelete = "DELETE"
+
+	ResultSuccess = "SUCCESS"
+)
+
+// Event is an EventBridge event
+type Event struct {
+	Id         string          `json:"id"`
+	DetailType string          `json:"detail-type"`
+	Source     string          `json:"source"`
+	Account    string          `json:"account"`
+	Time       time.Time       `json:"time"`
+	Region     string          `json:"region"`
+	Resources  []string        `json:"resources"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+// ImageScanDetail is the detail of an "ECR Image Scan" or "Inspector2 Scan" event
+type ImageScanDetail struct {
+	ScanStatus            string           `json:"scan-status"`
+	RepositoryName        string           `json:"repository-name"`
+	ImageDigest           string           `json:"image-digest"`
+	ImageTags             []string         `json:"image-tags"`
+	FindingSeverityCounts map[string]int64 `json:"finding-severity-counts"`
+}
+
+// ImageActionDetail is the detail of an "ECR Image Action" event
+type ImageActionDetail struct {
+	ActionType     string `json:"action-type"`
+	Result         string `json:"result"`
+	RepositoryName string `json:"repository-name"`
+	ImageDigest    string `json:"image-digest"`
+	ImageTag       string `json:"image-tag"`
+}
+
+// Parse parses an EventBridge event from a message body
+func Parse(body string) (*Event, error) {
+	e := &Event{}
+	if err := json.Unmarshal([]byte(body), e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// ImageScan returns the image scan detail of the event.  Inspector events have the repository ARN
+// as the repository name, it's replaced with the name.
+func (e *Event) ImageScan() (*ImageScanDetail, error) {
+	d := &ImageScanDetail{}
+	if err := json.Unmarshal(e.Detail, d); err != nil {
+		return nil, err
+	}
+
+	if arn.IsARN(d.RepositoryName) {
+		a, err := arn.Parse(d.RepositoryName)
+		if err != nil {
+			return nil, err
+		}
+		d.RepositoryName = strings.TrimPrefix(a.Resource, "repository/")
+	}
+
+	return d, nil
+}
+
+// Complete returns true if the basic or enhanced scan completed
+func (d *ImageScanDetail) Complete() bool {
+	return d.ScanStatus == ScanStatusComplete || d.ScanStatus == ScanStatusInitialScanComplete
+}
+
+// ImageAction returns the image action detail of the event
+func (e *Event) ImageAction() (*ImageActionDetail, error) {
+	d := &ImageActionDetail{}
+	if err := json.Unmarshal(e.Detail, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
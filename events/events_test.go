@@ -0,0 +1,119 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+)
+
+var testScanEvent = `{
+	"version": "0",
+	"id": "85fc3613-e913-7fc4-a80c-a3753e4aa9ae",
+	"detail-type": "ECR Image Scan",
+	"source": "aws.ecr",
+	"account": "012345678910",
+	"time": "2021-03-11T17:27:30Z",
+	"region": "us-east-1",
+	"resources": ["arn:aws:ecr:us-east-1:012345678910:repository/spindev-00001/rudolph"],
+	"detail": {
+		"scan-status": "COMPLETE",
+		"repository-name": "spindev-00001/rudolph",
+		"finding-severity-counts": {"HIGH": 2, "MEDIUM": 1},
+		"image-digest": "sha256:0000",
+		"image-tags": ["latest"]
+	}
+}`
+
+var testActionEvent = `{
+	"version": "0",
+	"id": "13cde686-328b-6117-af20-0e5566167482",
+	"detail-type": "ECR Image Action",
+	"source": "aws.ecr",
+	"account": "012345678910",
+	"time": "2021-03-11T17:20:14Z",
+	"region": "us-east-1",
+	"resources": [],
+	"detail": {
+		"result": "SUCCESS",
+		"repository-name": "spindev-00001/rudolph",
+		"image-digest": "sha256:0000",
+		"action-type": "DELETE",
+		"image-tag": "latest"
+	}
+}`
+
+var testInspectorScanEvent = `{
+	"version": "0",
+	"id": "739c0d3c-4f02-85c7-5a88-94a9EXAMPLE",
+	"detail-type": "Inspector2 Scan",
+	"source": "aws.inspector2",
+	"account": "012345678910",
+	"time": "2021-12-03T18:03:16Z",
+	"region": "us-east-1",
+	"resources": ["arn:aws:ecr:us-east-1:012345678910:repository/spindev-00001/rudolph"],
+	"detail": {
+		"scan-status": "INITIAL_SCAN_COMPLETE",
+		"repository-name": "arn:aws:ecr:us-east-1:012345678910:repository/spindev-00001/rudolph",
+		"finding-severity-counts": {"CRITICAL": 1, "HIGH": 2, "MEDIUM": 0, "TOTAL": 3},
+		"image-digest": "sha256:0000",
+		"image-tags": ["latest"]
+	}
+}`
+
+func TestParse(t *testing.T) {
+	e, err := Parse(testScanEvent)
+	if err != nil {
+		t.Fatalf("unexpected error parsing event: %s", err)
+	}
+
+	if e.DetailType != DetailTypeImageScan || e.Account != "012345678910" || e.Id != "85fc3613-e913-7fc4-a80c-a3753e4aa9ae" {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	scan, err := e.ImageScan()
+	if err != nil {
+		t.Fatalf("unexpected error parsing image scan detail: %s", err)
+	}
+
+	want := &ImageScanDetail{
+		ScanStatus:            ScanStatusComplete,
+		RepositoryName:        "spindev-00001/rudolph",
+		ImageDigest:           "sha256:0000",
+		ImageTags:             []string{"latest"},
+		FindingSeverityCounts: map[string]int64{"HIGH": 2, "MEDIUM": 1},
+	}
+	if !reflect.DeepEqual(scan, want) {
+		t.Errorf("expected image scan detail %+v, got %+v", want, scan)
+	}
+
+	e, err = Parse(testActionEvent)
+	if err != nil {
+		t.Fatalf("unexpected error parsing event: %s", err)
+	}
+
+	action, err := e.ImageAction()
+	if err != nil {
+		t.Fatalf("unexpected error parsing image action detail: %s", err)
+	}
+
+	if action.ActionType != ActionTypeDelete || action.Result != ResultSuccess || action.ImageTag != "latest" {
+		t.Errorf("unexpected image action detail %+v", action)
+	}
+
+	e, err = Parse(testInspectorScanEvent)
+	if err != nil {
+		t.Fatalf("unexpected error parsing event: %s", err)
+	}
+
+	scan, err = e.ImageScan()
+	if err != nil {
+		t.Fatalf("unexpected error parsing inspector scan detail: %s", err)
+	}
+
+	if e.DetailType != DetailTypeInspectorScan || scan.RepositoryName != "spindev-00001/rudolph" || !scan.Complete() {
+		t.Errorf("unexpected inspector scan event %+v with detail %+v", e, scan)
+	}
+
+	if _, err := Parse("not json"); err == nil {
+		t.Error("expected error parsing invalid event, got nil")
+	}
+}
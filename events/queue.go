@@ -0,0 +1,166 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/YaleSpinup/ecr-api/sqs"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// Message is a message received from a queue
+type Message struct {
+	Id            string
+	Body          string
+	ReceiptHandle string
+}
+
+// Queue is the source of event messages.  Messages that aren't deleted after they're received
+// are expected to be redelivered.
+type Queue interface {
+	// Receive waits for and returns the next batch of messages, it may return no messages
+	Receive(ctx context.Context) ([]*Message, error)
+	// Delete removes a received message from the queue
+	Delete(ctx context.Context, m *Message) error
+}
+
+// SQSQueue is a Queue backed by an SQS queue
+type SQSQueue struct {
+	client   sqs.SQS
+	queueUrl string
+	// WaitTimeSeconds is the long polling wait time for receiving messages
+	WaitTimeSeconds int64
+}
+
+// NewSQSQueue returns a Queue for the SQS queue url
+func NewSQSQueue(client sqs.SQS, queueUrl string) *SQSQueue {
+	return &SQSQueue{
+		client:          client,
+		queueUrl:        queueUrl,
+		WaitTimeSeconds: 20,
+	}
+}
+
+// Receive long polls the SQS queue for up to 10 messages
+func (q *SQSQueue) Receive(ctx context.Context) ([]*Message, error) {
+	out, err := q.client.ReceiveMessages(ctx, q.queueUrl, 10, q.WaitTimeSeconds)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*Message, 0, len(out))
+	for _, m := range out {
+		messages = append(messages, &Message{
+			Id:            aws.StringValue(m.MessageId),
+			Body:          aws.StringValue(m.Body),
+			ReceiptHandle: aws.StringValue(m.ReceiptHandle),
+		})
+	}
+
+	return messages, nil
+}
+
+// Delete deletes the message from the SQS queue
+func (q *SQSQueue) Delete(ctx context.Context, m *Message) error {
+	return q.client.DeleteMessage(ctx, q.queueUrl, m.ReceiptHandle)
+}
+
+// MemoryQueue is an in-memory Queue, useful for testing and local development.  Received messages
+// stay in flight until they're deleted or requeued.
+type MemoryQueue struct {
+	mu       sync.Mutex
+	pending  []*Message
+	inFlight map[string]*Message
+	signal   chan struct{}
+	seq      int
+	wait     time.Duration
+}
+
+// NewMemoryQueue returns an empty in-memory queue that waits up to wait for messages when receiving
+func NewMemoryQueue(wait time.Duration) *MemoryQueue {
+	return &MemoryQueue{
+		inFlight: map[string]*Message{},
+		signal:   make(chan struct{}, 1),
+		wait:     wait,
+	}
+}
+
+// Send adds a message with the body to the queue
+func (q *MemoryQueue) Send(body string) {
+	q.mu.Lock()
+	q.seq++
+	id := fmt.Sprintf("%d", q.seq)
+	q.pending = append(q.pending, &Message{Id: id, Body: body, ReceiptHandle: id})
+	q.mu.Unlock()
+
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+// Receive returns the pending messages, waiting for a message if there are none
+func (q *MemoryQueue) Receive(ctx context.Context) ([]*Message, error) {
+	if messages := q.take(); len(messages) > 0 {
+		return messages, nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(q.wait):
+	case <-q.signal:
+	}
+
+	return q.take(), nil
+}
+
+func (q *MemoryQueue) take() []*Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	messages := q.pending
+	q.pending = nil
+	for _, m := range messages {
+		q.inFlight[m.ReceiptHandle] = m
+	}
+
+	return messages
+}
+
+// Delete removes an in flight message
+func (q *MemoryQueue) Delete(ctx context.Context, m *Message) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.inFlight[m.ReceiptHandle]; !ok {
+		return fmt.Errorf("message %s is not in flight", m.Id)
+	}
+
+	delete(q.inFlight, m.ReceiptHandle)
+	return nil
+}
+
+// Requeue returns the in flight messages to the queue, like an expired visibility timeout
+func (q *MemoryQueue) Requeue() {
+	q.mu.Lock()
+	for _, m := range q.inFlight {
+		q.pending = append(q.pending, m)
+	}
+	q.inFlight = map[string]*Message{}
+	q.mu.Unlock()
+
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+// Len returns the number of pending and in flight messages
+func (q *MemoryQueue) Len() (int, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending), len(q.inFlight)
+}
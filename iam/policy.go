@@ -153,6 +153,28 @@ func (v Value) Equal(v1 Value) bool {
 	return true
 }
 
+// UnmarshalJSON unmarshalls IAM principals, the anonymous principal "*" used by older policies is
+// converted to the equivalent {"AWS": ["*"]}
+func (p *Principal) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		if s != "*" {
+			return fmt.Errorf("invalid principal %s: allowed is only \"*\" or a map", s)
+		}
+
+		*p = Principal{"AWS": Value{"*"}}
+		return nil
+	}
+
+	var m map[string]Value
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+
+	*p = m
+	return nil
+}
+
 func (p Principal) Equal(p1 Principal) bool {
 	if len(p) != len(p1) {
 		return false
@@ -329,3 +351,42 @@ func (i *IAM) UpdatePolicy(ctx context.Context, arn, policyDoc string) error {
 
 	return nil
 }
+
+// ListPolicyVersions lists the versions of a managed policy
+func (i *IAM) ListPolicyVersions(ctx context.Context, arn string) ([]*iam.PolicyVersion, error) {
+	if arn == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	log.Infof("listing policy versions for %s", arn)
+
+	out, err := i.Service.ListPolicyVersionsWithContext(ctx, &iam.ListPolicyVersionsInput{
+		PolicyArn: aws.String(arn),
+	})
+
+	if err != nil {
+		return nil, ErrCode("failed to list policy versions", err)
+	}
+
+	log.Debugf("got output from list policy versions: %+v", out)
+
+	return out.Versions, nil
+}
+
+// DeletePolicyVersion deletes a version of a managed policy, the default version can't be deleted
+func (i *IAM) DeletePolicyVersion(ctx context.Context, arn, version string) error {
+	if arn == "" || version == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	log.Infof("deleting policy %s version %s", arn, version)
+
+	if _, err := i.Service.DeletePolicyVersionWithContext(ctx, &iam.DeletePolicyVersionInput{
+		PolicyArn: aws.String(arn),
+		VersionId: aws.String(version),
+	}); err != nil {
+		return ErrCode("failed to delete policy version", err)
+	}
+
+	return nil
+}
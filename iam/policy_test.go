@@ -2,12 +2,51 @@ package iam
 
 import (
 	"context"
+	"encoding/json"
 	"reflect"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/iam"
 )
 
+var testPolicyVersions = []*iam.PolicyVersion{
+	{
+		VersionId:        aws.String("v1"),
+		IsDefaultVersion: aws.Bool(false),
+	},
+	{
+		VersionId:        aws.String("v2"),
+		IsDefaultVersion: aws.Bool(true),
+	},
+}
+
+func (m *mockIAMClient) ListPolicyVersionsWithContext(ctx context.Context, input *iam.ListPolicyVersionsInput, opts ...request.Option) (*iam.ListPolicyVersionsOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	if aws.StringValue(input.PolicyArn) != "arn:aws:iam::12345:policy/testPolicy" {
+		return nil, awserr.New(iam.ErrCodeNoSuchEntityException, "not found", nil)
+	}
+
+	return &iam.ListPolicyVersionsOutput{Versions: testPolicyVersions}, nil
+}
+
+func (m *mockIAMClient) DeletePolicyVersionWithContext(ctx context.Context, input *iam.DeletePolicyVersionInput, opts ...request.Option) (*iam.DeletePolicyVersionOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	if aws.StringValue(input.VersionId) == "v2" {
+		return nil, awserr.New(iam.ErrCodeDeleteConflictException, "can't delete the default version", nil)
+	}
+
+	return &iam.DeletePolicyVersionOutput{}, nil
+}
+
 func TestIAM_GetPolicyByName(t *testing.T) {
 	type args struct {
 		ctx  context.Context
@@ -492,3 +531,137 @@ func TestPrincipal_Equal(t *testing.T) {
 		})
 	}
 }
+
+func TestPrincipal_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    Principal
+		wantErr bool
+	}{
+		{
+			name: "anonymous",
+			json: `"*"`,
+			want: Principal{"AWS": Value{"*"}},
+		},
+		{
+			name: "string value",
+			json: `{"AWS": "arn:aws:iam::012345678901:root"}`,
+			want: Principal{"AWS": Value{"arn:aws:iam::012345678901:root"}},
+		},
+		{
+			name: "list values",
+			json: `{"Service": ["lambda.amazonaws.com", "codebuild.amazonaws.com"]}`,
+			want: Principal{"Service": Value{"lambda.amazonaws.com", "codebuild.amazonaws.com"}},
+		},
+		{
+			name:    "invalid string",
+			json:    `"foo"`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid type",
+			json:    `123`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Principal
+			err := json.Unmarshal([]byte(tt.json), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Principal.UnmarshalJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Principal.UnmarshalJSON() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIAM_ListPolicyVersions(t *testing.T) {
+	tests := []struct {
+		name    string
+		arn     string
+		err     error
+		want    []*iam.PolicyVersion
+		wantErr bool
+	}{
+		{
+			name: "success",
+			arn:  "arn:aws:iam::12345:policy/testPolicy",
+			want: testPolicyVersions,
+		},
+		{
+			name:    "empty arn",
+			wantErr: true,
+		},
+		{
+			name:    "missing policy",
+			arn:     "arn:aws:iam::12345:policy/missing",
+			wantErr: true,
+		},
+		{
+			name:    "aws error",
+			arn:     "arn:aws:iam::12345:policy/testPolicy",
+			err:     awserr.New(iam.ErrCodeServiceFailureException, "boom", nil),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &IAM{Service: newMockIAMClient(t, tt.err)}
+			got, err := i.ListPolicyVersions(context.TODO(), tt.arn)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("IAM.ListPolicyVersions() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("IAM.ListPolicyVersions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIAM_DeletePolicyVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		arn     string
+		version string
+		err     error
+		wantErr bool
+	}{
+		{
+			name:    "success",
+			arn:     "arn:aws:iam::12345:policy/testPolicy",
+			version: "v1",
+		},
+		{
+			name:    "empty version",
+			arn:     "arn:aws:iam::12345:policy/testPolicy",
+			wantErr: true,
+		},
+		{
+			name:    "default version",
+			arn:     "arn:aws:iam::12345:policy/testPolicy",
+			version: "v2",
+			wantErr: true,
+		},
+		{
+			name:    "aws error",
+			arn:     "arn:aws:iam::12345:policy/testPolicy",
+			version: "v1",
+			err:     awserr.New(iam.ErrCodeServiceFailureException, "boom", nil),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &IAM{Service: newMockIAMClient(t, tt.err)}
+			if err := i.DeletePolicyVersion(context.TODO(), tt.arn, tt.version); (err != nil) != tt.wantErr {
+				t.Errorf("IAM.DeletePolicyVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -34,6 +34,31 @@ func (i *IAM) ListUsers(ctx context.Context, path string) ([]string, error) {
 	return users, nil
 }
 
+// ListUsersWithPath lists the details of all of the users in a path prefix, "/" by default
+func (i *IAM) ListUsersWithPath(ctx context.Context, path string) ([]*iam.User, error) {
+	if path == "" {
+		path = "/"
+	}
+
+	log.Infof("listing users with path prefix %s", path)
+
+	users := []*iam.User{}
+	err := i.Service.ListUsersPagesWithContext(ctx, &iam.ListUsersInput{
+		PathPrefix: aws.String(path),
+	}, func(page *iam.ListUsersOutput, lastPage bool) bool {
+		users = append(users, page.Users...)
+		return true
+	})
+
+	if err != nil {
+		return nil, ErrCode("failed to list users", err)
+	}
+
+	log.Debugf("got %d users listing users with path prefix %s", len(users), path)
+
+	return users, nil
+}
+
 // GetUserWithPath gets details about a user and returns an error if the path doesn't match
 func (i *IAM) GetUserWithPath(ctx context.Context, path, name string) (*iam.User, error) {
 	if name == "" {
@@ -103,6 +128,27 @@ func (i *IAM) DeleteAccessKey(ctx context.Context, name, keyId string) error {
 	return nil
 }
 
+// UpdateAccessKey sets the status of an access key to Active or Inactive
+func (i *IAM) UpdateAccessKey(ctx context.Context, name, keyId, status string) error {
+	if name == "" || keyId == "" || (status != iam.StatusTypeActive && status != iam.StatusTypeInactive) {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	log.Infof("updating access key %s for %s to %s", keyId, name, status)
+
+	_, err := i.Service.UpdateAccessKeyWithContext(ctx, &iam.UpdateAccessKeyInput{
+		AccessKeyId: aws.String(keyId),
+		Status:      aws.String(status),
+		UserName:    aws.String(name),
+	})
+
+	if err != nil {
+		return ErrCode("failed to update access key", err)
+	}
+
+	return nil
+}
+
 func (i *IAM) ListAccessKeys(ctx context.Context, name string) ([]*iam.AccessKeyMetadata, error) {
 	if name == "" {
 		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
@@ -123,6 +169,27 @@ func (i *IAM) ListAccessKeys(ctx context.Context, name string) ([]*iam.AccessKey
 	return out.AccessKeyMetadata, nil
 }
 
+// GetAccessKeyLastUsed gets when, where and with which service an access key was last used
+func (i *IAM) GetAccessKeyLastUsed(ctx context.Context, keyId string) (*iam.AccessKeyLastUsed, error) {
+	if keyId == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	log.Infof("getting access key last used for %s", keyId)
+
+	out, err := i.Service.GetAccessKeyLastUsedWithContext(ctx, &iam.GetAccessKeyLastUsedInput{
+		AccessKeyId: aws.String(keyId),
+	})
+
+	if err != nil {
+		return nil, ErrCode("failed to get access key last used", err)
+	}
+
+	log.Debugf("got output from get access key last used: %+v", out)
+
+	return out.AccessKeyLastUsed, nil
+}
+
 func (i *IAM) CreateUser(ctx context.Context, name, path string, tags []*iam.Tag) (*iam.User, error) {
 	if name == "" {
 		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
@@ -163,6 +230,25 @@ func (i *IAM) DeleteUser(ctx context.Context, name string) error {
 	return nil
 }
 
+// UpdateUser renames a user and moves it to the path, the user keeps its access keys, groups and tags
+func (i *IAM) UpdateUser(ctx context.Context, name, newName, newPath string) error {
+	if name == "" || newName == "" || newPath == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	log.Infof("updating user %s to %s in path %s", name, newName, newPath)
+
+	if _, err := i.Service.UpdateUserWithContext(ctx, &iam.UpdateUserInput{
+		UserName:    aws.String(name),
+		NewUserName: aws.String(newName),
+		NewPath:     aws.String(newPath),
+	}); err != nil {
+		return ErrCode("failed to update user", err)
+	}
+
+	return nil
+}
+
 func (i *IAM) WaitForUser(ctx context.Context, name string) error {
 	if name == "" {
 		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
@@ -3,6 +3,7 @@ package iam
 import (
 	"context"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -289,6 +290,230 @@ func (m *mockIAMClient) TagUserWithContext(ctx context.Context, input *iam.TagUs
 	return nil, awserr.New(iam.ErrCodeNoSuchEntityException, "Not Found", nil)
 }
 
+func (m *mockIAMClient) UpdateUserWithContext(ctx context.Context, input *iam.UpdateUserInput, opts ...request.Option) (*iam.UpdateUserOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	for _, u := range testUsers {
+		if aws.StringValue(input.UserName) == aws.StringValue(u.UserName) {
+			return &iam.UpdateUserOutput{}, nil
+		}
+	}
+
+	return nil, awserr.New(iam.ErrCodeNoSuchEntityException, "Not Found", nil)
+}
+
+func (m *mockIAMClient) ListUsersPagesWithContext(ctx context.Context, input *iam.ListUsersInput, fn func(*iam.ListUsersOutput, bool) bool, opts ...request.Option) error {
+	if m.err != nil {
+		return m.err
+	}
+
+	// return each user on its own page
+	var users []*iam.User
+	for _, u := range testUsers {
+		if strings.HasPrefix(aws.StringValue(u.Path), aws.StringValue(input.PathPrefix)) {
+			users = append(users, u)
+		}
+	}
+
+	for i, u := range users {
+		if !fn(&iam.ListUsersOutput{Users: []*iam.User{u}}, i == len(users)-1) {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (m *mockIAMClient) UpdateAccessKeyWithContext(ctx context.Context, input *iam.UpdateAccessKeyInput, opts ...request.Option) (*iam.UpdateAccessKeyOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	for _, k := range testAccessKeys[aws.StringValue(input.UserName)] {
+		if aws.StringValue(k.AccessKeyId) == aws.StringValue(input.AccessKeyId) {
+			return &iam.UpdateAccessKeyOutput{}, nil
+		}
+	}
+
+	return nil, awserr.New(iam.ErrCodeNoSuchEntityException, "Not Found", nil)
+}
+
+func (m *mockIAMClient) GetAccessKeyLastUsedWithContext(ctx context.Context, input *iam.GetAccessKeyLastUsedInput, opts ...request.Option) (*iam.GetAccessKeyLastUsedOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	for userName, keys := range testAccessKeys {
+		for _, k := range keys {
+			if aws.StringValue(k.AccessKeyId) == aws.StringValue(input.AccessKeyId) {
+				return &iam.GetAccessKeyLastUsedOutput{
+					AccessKeyLastUsed: &iam.AccessKeyLastUsed{
+						LastUsedDate: aws.Time(testTime),
+						Region:       aws.String("us-east-1"),
+						ServiceName:  aws.String("ecr"),
+					},
+					UserName: aws.String(userName),
+				}, nil
+			}
+		}
+	}
+
+	return nil, awserr.New(iam.ErrCodeNoSuchEntityException, "Not Found", nil)
+}
+
+func TestIAM_GetAccessKeyLastUsed(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyId   string
+		want    *iam.AccessKeyLastUsed
+		err     error
+		wantErr bool
+	}{
+		{
+			name:    "empty key id",
+			wantErr: true,
+		},
+		{
+			name:  "user1 key",
+			keyId: "USER1XXXXXXXXX01",
+			want: &iam.AccessKeyLastUsed{
+				LastUsedDate: aws.Time(testTime),
+				Region:       aws.String("us-east-1"),
+				ServiceName:  aws.String("ecr"),
+			},
+		},
+		{
+			name:    "unknown key",
+			keyId:   "xxxxxmissingxxxxx",
+			wantErr: true,
+		},
+		{
+			name:    "aws error",
+			keyId:   "USER1XXXXXXXXX01",
+			err:     awserr.New(iam.ErrCodeServiceFailureException, "boom", nil),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &IAM{Service: newMockIAMClient(t, tt.err)}
+			got, err := i.GetAccessKeyLastUsed(context.TODO(), tt.keyId)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("IAM.GetAccessKeyLastUsed() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("IAM.GetAccessKeyLastUsed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIAM_ListUsersWithPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		want    []*iam.User
+		err     error
+		wantErr bool
+	}{
+		{
+			name: "empty path",
+			path: "",
+			want: testUsers,
+		},
+		{
+			name: "path1",
+			path: "/path1/",
+			want: []*iam.User{user1, user2},
+		},
+		{
+			name: "no users",
+			path: "/path3/",
+			want: []*iam.User{},
+		},
+		{
+			name:    "aws error",
+			path:    "/",
+			err:     awserr.New(iam.ErrCodeServiceFailureException, "boom", nil),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &IAM{Service: newMockIAMClient(t, tt.err)}
+			got, err := i.ListUsersWithPath(context.TODO(), tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("IAM.ListUsersWithPath() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("IAM.ListUsersWithPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIAM_UpdateAccessKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    string
+		keyId   string
+		status  string
+		err     error
+		wantErr bool
+	}{
+		{
+			name:    "empty input",
+			wantErr: true,
+		},
+		{
+			name:    "invalid status",
+			user:    "user1",
+			keyId:   "USER1XXXXXXXXX01",
+			status:  "Disabled",
+			wantErr: true,
+		},
+		{
+			name:   "deactivate key",
+			user:   "user1",
+			keyId:  "USER1XXXXXXXXX01",
+			status: "Inactive",
+		},
+		{
+			name:   "activate key",
+			user:   "user1",
+			keyId:  "USER1XXXXXXXXX02",
+			status: "Active",
+		},
+		{
+			name:    "unknown key",
+			user:    "user1",
+			keyId:   "xxxxxmissingxxxxx",
+			status:  "Inactive",
+			wantErr: true,
+		},
+		{
+			name:    "aws error",
+			user:    "user1",
+			keyId:   "USER1XXXXXXXXX01",
+			status:  "Inactive",
+			err:     awserr.New(iam.ErrCodeLimitExceededException, "limit exceeded", nil),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &IAM{Service: newMockIAMClient(t, tt.err)}
+			if err := i.UpdateAccessKey(context.TODO(), tt.user, tt.keyId, tt.status); (err != nil) != tt.wantErr {
+				t.Errorf("IAM.UpdateAccessKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestIAM_ListUsers(t *testing.T) {
 	type args struct {
 		ctx  context.Context
@@ -769,6 +994,65 @@ func TestIAM_DeleteUser(t *testing.T) {
 	}
 }
 
+func TestIAM_UpdateUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		userName string
+		newName  string
+		newPath  string
+		err      error
+		wantErr  bool
+	}{
+		{
+			name:    "empty name",
+			newName: "user1-moved",
+			newPath: "/spinup/moved/",
+			wantErr: true,
+		},
+		{
+			name:     "empty new name",
+			userName: "user1",
+			newPath:  "/spinup/moved/",
+			wantErr:  true,
+		},
+		{
+			name:     "empty new path",
+			userName: "user1",
+			newName:  "user1-moved",
+			wantErr:  true,
+		},
+		{
+			name:     "user1",
+			userName: "user1",
+			newName:  "user1-moved",
+			newPath:  "/spinup/moved/",
+		},
+		{
+			name:     "unknown user",
+			userName: "otheruser",
+			newName:  "otheruser-moved",
+			newPath:  "/spinup/moved/",
+			wantErr:  true,
+		},
+		{
+			name:     "aws error",
+			userName: "user1",
+			newName:  "user1-moved",
+			newPath:  "/spinup/moved/",
+			err:      awserr.New(iam.ErrCodeEntityAlreadyExistsException, "exists", nil),
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &IAM{Service: newMockIAMClient(t, tt.err)}
+			if err := i.UpdateUser(context.TODO(), tt.userName, tt.newName, tt.newPath); (err != nil) != tt.wantErr {
+				t.Errorf("IAM.UpdateUser() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestIAM_WaitForUser(t *testing.T) {
 	type args struct {
 		ctx  context.Context
@@ -0,0 +1,59 @@
+package sqs
+
+import (
+	"github.com/YaleSpinup/apierror"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/pkg/errors"
+)
+
+func ErrCode(msg string, err error) error {
+	if aerr, ok := errors.Cause(err).(awserr.Error); ok {
+		switch aerr.Code() {
+		case
+			"AccessDenied",
+
+			// ErrCodeKmsAccessDenied for service response error code
+			// "KmsAccessDenied".
+			//
+			// The caller doesn't have the required KMS access.
+			sqs.ErrCodeKmsAccessDenied:
+
+			return apierror.New(apierror.ErrForbidden, msg, aerr)
+		case
+			// ErrCodeQueueDoesNotExist for service response error code
+			// "AWS.SimpleQueueService.NonExistentQueue".
+			//
+			// The specified queue doesn't exist.
+			sqs.ErrCodeQueueDoesNotExist,
+
+			// ErrCodeResourceNotFoundException for service response error code
+			// "ResourceNotFoundException".
+			//
+			// One or more specified resources don't exist.
+			sqs.ErrCodeResourceNotFoundException:
+
+			return apierror.New(apierror.ErrNotFound, msg, aerr)
+		case
+			// ErrCodeOverLimit for service response error code
+			// "OverLimit".
+			//
+			// The specified action violates a limit. For example, ReceiveMessage returns
+			// this error if the maximum number of in flight messages is reached.
+			sqs.ErrCodeOverLimit,
+
+			// ErrCodeRequestThrottled for service response error code
+			// "RequestThrottled".
+			//
+			// The request was denied due to request throttling.
+			sqs.ErrCodeRequestThrottled:
+
+			return apierror.New(apierror.ErrLimitExceeded, msg, aerr)
+		default:
+			m := msg + ": " + aerr.Message()
+			return apierror.New(apierror.ErrBadRequest, m, aerr)
+		}
+	}
+
+	return apierror.New(apierror.ErrInternalError, msg, err)
+}
@@ -0,0 +1,92 @@
+package sqs
+
+import (
+	"context"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	log "github.com/sirupsen/logrus"
+)
+
+type SQS struct {
+	session *session.Session
+	Service sqsiface.SQSAPI
+}
+
+type SQSOption func(*SQS)
+
+func New(opts ...SQSOption) SQS {
+	s := SQS{}
+
+	for _, opt := range opts {
+		opt(&s)
+	}
+
+	if s.session != nil {
+		s.Service = sqs.New(s.session)
+	}
+
+	return s
+}
+
+func WithSession(sess *session.Session) SQSOption {
+	return func(s *SQS) {
+		log.Debug("using aws session")
+		s.session = sess
+	}
+}
+
+func WithCredentials(key, secret, token, region string) SQSOption {
+	return func(s *SQS) {
+		log.Debugf("creating new session with key id %s in region %s", key, region)
+		sess := session.Must(session.NewSession(&aws.Config{
+			Credentials: credentials.NewStaticCredentials(key, secret, token),
+			Region:      aws.String(region),
+		}))
+		s.session = sess
+	}
+}
+
+// ReceiveMessages long polls the queue for up to max messages, waiting up to wait seconds
+func (s *SQS) ReceiveMessages(ctx context.Context, queueUrl string, max, wait int64) ([]*sqs.Message, error) {
+	if queueUrl == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	log.Debugf("receiving up to %d messages from queue %s", max, queueUrl)
+
+	out, err := s.Service.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+		MaxNumberOfMessages: aws.Int64(max),
+		QueueUrl:            aws.String(queueUrl),
+		WaitTimeSeconds:     aws.Int64(wait),
+	})
+	if err != nil {
+		return nil, ErrCode("failed to receive messages", err)
+	}
+
+	log.Debugf("got output from receive messages %+v", out)
+
+	return out.Messages, nil
+}
+
+// DeleteMessage deletes a message from the queue by its receipt handle
+func (s *SQS) DeleteMessage(ctx context.Context, queueUrl, receiptHandle string) error {
+	if queueUrl == "" || receiptHandle == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	log.Debugf("deleting message from queue %s", queueUrl)
+
+	if _, err := s.Service.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(queueUrl),
+		ReceiptHandle: aws.String(receiptHandle),
+	}); err != nil {
+		return ErrCode("failed to delete message", err)
+	}
+
+	return nil
+}
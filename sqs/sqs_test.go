@@ -0,0 +1,134 @@
+package sqs
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+// mockSQSClient is a fake sqs client
+type mockSQSClient struct {
+	sqsiface.SQSAPI
+	t   *testing.T
+	err error
+}
+
+func newmockSQSClient(t *testing.T, err error) sqsiface.SQSAPI {
+	return &mockSQSClient{
+		t:   t,
+		err: err,
+	}
+}
+
+var tMessages = []*sqs.Message{
+	{
+		Body:          aws.String(`{"detail-type":"ECR Image Scan"}`),
+		MessageId:     aws.String("m-1"),
+		ReceiptHandle: aws.String("r-1"),
+	},
+}
+
+func (m *mockSQSClient) ReceiveMessageWithContext(ctx context.Context, input *sqs.ReceiveMessageInput, opts ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &sqs.ReceiveMessageOutput{Messages: tMessages}, nil
+}
+
+func (m *mockSQSClient) DeleteMessageWithContext(ctx context.Context, input *sqs.DeleteMessageInput, opts ...request.Option) (*sqs.DeleteMessageOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func TestNewSession(t *testing.T) {
+	client := New()
+	to := reflect.TypeOf(client).String()
+	if to != "sqs.SQS" {
+		t.Errorf("expected type to be 'sqs.SQS', got %s", to)
+	}
+}
+
+func TestSQS_ReceiveMessages(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		queueUrl string
+		want     []*sqs.Message
+		wantErr  bool
+	}{
+		{
+			name:     "success",
+			queueUrl: "https://sqs.us-east-1.amazonaws.com/012345678910/ecr-events",
+			want:     tMessages,
+		},
+		{
+			name:    "empty queue url",
+			wantErr: true,
+		},
+		{
+			name:     "aws error",
+			err:      awserr.New(sqs.ErrCodeQueueDoesNotExist, "not found", nil),
+			queueUrl: "https://sqs.us-east-1.amazonaws.com/012345678910/ecr-events",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &SQS{Service: newmockSQSClient(t, tt.err)}
+			got, err := s.ReceiveMessages(context.TODO(), tt.queueUrl, 10, 20)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SQS.ReceiveMessages() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SQS.ReceiveMessages() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQS_DeleteMessage(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		queueUrl      string
+		receiptHandle string
+		wantErr       bool
+	}{
+		{
+			name:          "success",
+			queueUrl:      "https://sqs.us-east-1.amazonaws.com/012345678910/ecr-events",
+			receiptHandle: "r-1",
+		},
+		{
+			name:     "empty receipt handle",
+			queueUrl: "https://sqs.us-east-1.amazonaws.com/012345678910/ecr-events",
+			wantErr:  true,
+		},
+		{
+			name:          "aws error",
+			err:           awserr.New(sqs.ErrCodeReceiptHandleIsInvalid, "invalid", nil),
+			queueUrl:      "https://sqs.us-east-1.amazonaws.com/012345678910/ecr-events",
+			receiptHandle: "r-1",
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &SQS{Service: newmockSQSClient(t, tt.err)}
+			if err := s.DeleteMessage(context.TODO(), tt.queueUrl, tt.receiptHandle); (err != nil) != tt.wantErr {
+				t.Errorf("SQS.DeleteMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
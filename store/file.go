@@ -0,0 +1,207 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/YaleSpinup/apierror"
+	log "github.com/sirupsen/logrus"
+)
+
+var validBucketName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// FileStore is a Store backed by the local filesystem.  Each bucket is kept as a single JSON document
+// in the data directory and rewritten atomically on every change, so it's only suitable for the
+// modest amounts of state the API keeps.
+type FileStore struct {
+	mu   sync.RWMutex
+	path string
+}
+
+// NewFileStore returns a FileStore rooted in the given directory, creating it if it doesn't exist
+func NewFileStore(path string) (*FileStore, error) {
+	if path == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	log.Infof("using file store in %s", path)
+
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, apierror.New(apierror.ErrInternalError, "failed to create data directory", err)
+	}
+
+	return &FileStore{path: path}, nil
+}
+
+// Get returns the value for the key in the bucket
+func (f *FileStore) Get(ctx context.Context, bucket, key string) ([]byte, error) {
+	if key == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	b, err := f.load(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	v, ok := b[key]
+	if !ok {
+		msg := fmt.Sprintf("%s not found", key)
+		return nil, apierror.New(apierror.ErrNotFound, msg, nil)
+	}
+
+	return v, nil
+}
+
+// Put creates or replaces the value for the key in the bucket
+func (f *FileStore) Put(ctx context.Context, bucket, key string, value []byte) error {
+	if key == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	b, err := f.load(bucket)
+	if err != nil {
+		return err
+	}
+
+	b[key] = json.RawMessage(copyBytes(value))
+
+	return f.save(bucket, b)
+}
+
+// Create creates the value for the key in the bucket if the key doesn't exist
+func (f *FileStore) Create(ctx context.Context, bucket, key string, value []byte) (bool, error) {
+	if key == "" {
+		return false, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	b, err := f.load(bucket)
+	if err != nil {
+		return false, err
+	}
+
+	if _, ok := b[key]; ok {
+		return false, nil
+	}
+	b[key] = json.RawMessage(copyBytes(value))
+
+	return true, f.save(bucket, b)
+}
+
+// Delete removes the key from the bucket
+func (f *FileStore) Delete(ctx context.Context, bucket, key string) error {
+	if key == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	b, err := f.load(bucket)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := b[key]; !ok {
+		return nil
+	}
+	delete(b, key)
+
+	return f.save(bucket, b)
+}
+
+// List returns the key/values in the bucket whose key begins with the prefix
+func (f *FileStore) List(ctx context.Context, bucket, prefix string) (map[string][]byte, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	b, err := f.load(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	out := map[string][]byte{}
+	for k, v := range b {
+		if strings.HasPrefix(k, prefix) {
+			out[k] = v
+		}
+	}
+
+	return out, nil
+}
+
+// load reads the bucket document from disk, a missing document is an empty bucket
+func (f *FileStore) load(bucket string) (map[string]json.RawMessage, error) {
+	if !validBucketName.MatchString(bucket) {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid bucket name", nil)
+	}
+
+	b := map[string]json.RawMessage{}
+
+	data, err := os.ReadFile(f.bucketFile(bucket))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return b, nil
+		}
+		return nil, apierror.New(apierror.ErrInternalError, "failed to read bucket "+bucket, err)
+	}
+
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, apierror.New(apierror.ErrInternalError, "failed to decode bucket "+bucket, err)
+	}
+
+	return b, nil
+}
+
+// save writes the bucket document to a temporary file and renames it into place
+func (f *FileStore) save(bucket string, b map[string]json.RawMessage) error {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return apierror.New(apierror.ErrInternalError, "failed to encode bucket "+bucket, err)
+	}
+
+	tmp, err := os.CreateTemp(f.path, bucket+".*.tmp")
+	if err != nil {
+		return apierror.New(apierror.ErrInternalError, "failed to write bucket "+bucket, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return apierror.New(apierror.ErrInternalError, "failed to write bucket "+bucket, err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return apierror.New(apierror.ErrInternalError, "failed to write bucket "+bucket, err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return apierror.New(apierror.ErrInternalError, "failed to write bucket "+bucket, err)
+	}
+
+	if err := os.Rename(tmp.Name(), f.bucketFile(bucket)); err != nil {
+		return apierror.New(apierror.ErrInternalError, "failed to write bucket "+bucket, err)
+	}
+
+	return nil
+}
+
+func (f *FileStore) bucketFile(bucket string) string {
+	return filepath.Join(f.path, bucket+".json")
+}
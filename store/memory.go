@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/YaleSpinup/apierror"
+)
+
+// MemoryStore is an in-memory implementation of Store.  Nothing is persisted across restarts,
+// it's intended for local development and testing.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string][]byte
+}
+
+// NewMemoryStore returns a new, empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: map[string]map[string][]byte{},
+	}
+}
+
+// Get returns the value for the key in the bucket
+func (m *MemoryStore) Get(ctx context.Context, bucket, key string) ([]byte, error) {
+	if bucket == "" || key == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	v, ok := m.buckets[bucket][key]
+	if !ok {
+		msg := fmt.Sprintf("%s not found", key)
+		return nil, apierror.New(apierror.ErrNotFound, msg, nil)
+	}
+
+	return copyBytes(v), nil
+}
+
+// Put creates or replaces the value for the key in the bucket
+func (m *MemoryStore) Put(ctx context.Context, bucket, key string, value []byte) error {
+	if bucket == "" || key == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.buckets[bucket]; !ok {
+		m.buckets[bucket] = map[string][]byte{}
+	}
+	m.buckets[bucket][key] = copyBytes(value)
+
+	return nil
+}
+
+// Create creates the value for the key in the bucket if the key doesn't exist
+func (m *MemoryStore) Create(ctx context.Context, bucket, key string, value []byte) (bool, error) {
+	if bucket == "" || key == "" {
+		return false, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.buckets[bucket]; !ok {
+		m.buckets[bucket] = map[string][]byte{}
+	}
+
+	if _, ok := m.buckets[bucket][key]; ok {
+		return false, nil
+	}
+	m.buckets[bucket][key] = copyBytes(value)
+
+	return true, nil
+}
+
+// Delete removes the key from the bucket
+func (m *MemoryStore) Delete(ctx context.Context, bucket, key string) error {
+	if bucket == "" || key == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.buckets[bucket], key)
+
+	return nil
+}
+
+// List returns the key/values in the bucket whose key begins with the prefix
+func (m *MemoryStore) List(ctx context.Context, bucket, prefix string) (map[string][]byte, error) {
+	if bucket == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := map[string][]byte{}
+	for k, v := range m.buckets[bucket] {
+		if strings.HasPrefix(k, prefix) {
+			out[k] = copyBytes(v)
+		}
+	}
+
+	return out, nil
+}
+
+func copyBytes(b []byte) []byte {
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
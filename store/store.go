@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/YaleSpinup/apierror"
+	log "github.com/sirupsen/logrus"
+)
+
+// Store is a minimal durable key/value store used to persist API state.  Keys are grouped
+// into buckets and values are opaque byte slices, usually JSON documents.
+type Store interface {
+	// Get returns the value for the key in the bucket or an apierror.ErrNotFound if it doesn't exist
+	Get(ctx context.Context, bucket, key string) ([]byte, error)
+	// Put creates or replaces the value for the key in the bucket
+	Put(ctx context.Context, bucket, key string, value []byte) error
+	// Create creates the value for the key in the bucket if the key doesn't exist, it returns false without
+	// changing the value if it does
+	Create(ctx context.Context, bucket, key string, value []byte) (bool, error)
+	// Delete removes the key from the bucket, it is not an error if the key doesn't exist
+	Delete(ctx context.Context, bucket, key string) error
+	// List returns all of the key/values in the bucket whose key begins with the prefix
+	List(ctx context.Context, bucket, prefix string) (map[string][]byte, error)
+}
+
+// GetJSON gets the value for the key in the bucket and unmarshals it into v
+func GetJSON(ctx context.Context, s Store, bucket, key string, v interface{}) error {
+	b, err := s.Get(ctx, bucket, key)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(b, v); err != nil {
+		return apierror.New(apierror.ErrInternalError, "failed to decode stored value", err)
+	}
+
+	return nil
+}
+
+// PutJSON marshals v and stores it as the value for the key in the bucket
+func PutJSON(ctx context.Context, s Store, bucket, key string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return apierror.New(apierror.ErrInternalError, "failed to encode value for storage", err)
+	}
+
+	log.Debugf("storing %s/%s: %s", bucket, key, string(b))
+
+	return s.Put(ctx, bucket, key, b)
+}
+
+// CreateJSON marshals v and stores it as the value for the key in the bucket if the key doesn't exist, it
+// returns false if the key exists
+func CreateJSON(ctx context.Context, s Store, bucket, key string, v interface{}) (bool, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return false, apierror.New(apierror.ErrInternalError, "failed to encode value for storage", err)
+	}
+
+	log.Debugf("creating %s/%s: %s", bucket, key, string(b))
+
+	return s.Create(ctx, bucket, key, b)
+}
@@ -0,0 +1,188 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/pkg/errors"
+)
+
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	if _, err := s.Get(ctx, "things", "missing"); err == nil {
+		t.Error("expected error for missing key, got nil")
+	} else if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrNotFound {
+		t.Errorf("expected not found error for missing key, got %s", err)
+	}
+
+	values := map[string][]byte{
+		"foo/1": []byte(`{"id":"1"}`),
+		"foo/2": []byte(`{"id":"2"}`),
+		"bar/1": []byte(`{"id":"3"}`),
+	}
+
+	for k, v := range values {
+		if err := s.Put(ctx, "things", k, v); err != nil {
+			t.Fatalf("unexpected error putting %s: %s", k, err)
+		}
+	}
+
+	got, err := s.Get(ctx, "things", "foo/2")
+	if err != nil {
+		t.Errorf("unexpected error getting key: %s", err)
+	}
+
+	if string(got) != `{"id":"2"}` {
+		t.Errorf("expected %s, got %s", `{"id":"2"}`, string(got))
+	}
+
+	created, err := s.Create(ctx, "things", "foo/2", []byte(`{"id":"4"}`))
+	if err != nil || created {
+		t.Errorf("expected an existing key not to be created, got %t (%v)", created, err)
+	}
+
+	if got, _ := s.Get(ctx, "things", "foo/2"); string(got) != `{"id":"2"}` {
+		t.Errorf("expected the existing value %s to be kept, got %s", `{"id":"2"}`, string(got))
+	}
+
+	list, err := s.List(ctx, "things", "foo/")
+	if err != nil {
+		t.Errorf("unexpected error listing keys: %s", err)
+	}
+
+	expected := map[string][]byte{
+		"foo/1": []byte(`{"id":"1"}`),
+		"foo/2": []byte(`{"id":"2"}`),
+	}
+	if !reflect.DeepEqual(list, expected) {
+		t.Errorf("expected %s, got %s", expected, list)
+	}
+
+	list, err = s.List(ctx, "otherthings", "")
+	if err != nil {
+		t.Errorf("unexpected error listing empty bucket: %s", err)
+	}
+
+	if len(list) != 0 {
+		t.Errorf("expected empty list for empty bucket, got %s", list)
+	}
+
+	if err := s.Delete(ctx, "things", "foo/1"); err != nil {
+		t.Errorf("unexpected error deleting key: %s", err)
+	}
+
+	if err := s.Delete(ctx, "things", "foo/1"); err != nil {
+		t.Errorf("unexpected error deleting missing key: %s", err)
+	}
+
+	if _, err := s.Get(ctx, "things", "foo/1"); err == nil {
+		t.Error("expected error for deleted key, got nil")
+	}
+
+	type thing struct {
+		Id   string
+		Name string
+	}
+
+	if err := PutJSON(ctx, s, "things", "json", thing{Id: "123", Name: "foo"}); err != nil {
+		t.Errorf("unexpected error putting json: %s", err)
+	}
+
+	th := thing{}
+	if err := GetJSON(ctx, s, "things", "json", &th); err != nil {
+		t.Errorf("unexpected error getting json: %s", err)
+	}
+
+	if th.Id != "123" || th.Name != "foo" {
+		t.Errorf("unexpected thing from store %+v", th)
+	}
+
+	for i, want := range []bool{true, false} {
+		created, err := CreateJSON(ctx, s, "things", "created", thing{Id: fmt.Sprintf("%d", i)})
+		if err != nil {
+			t.Errorf("unexpected error creating json: %s", err)
+		}
+
+		if created != want {
+			t.Errorf("expected create %d to be %t, got %t", i, want, created)
+		}
+	}
+
+	if err := GetJSON(ctx, s, "things", "created", &th); err != nil || th.Id != "0" {
+		t.Errorf("expected the first created thing, got %+v (%v)", th, err)
+	}
+
+	// only one of the concurrent creates of a key creates it
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	creates := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			created, err := s.Create(ctx, "things", "concurrent", []byte(fmt.Sprintf(`{"id":"%d"}`, i)))
+			if err != nil {
+				t.Errorf("unexpected error creating key: %s", err)
+			}
+
+			if created {
+				mu.Lock()
+				creates++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if creates != 1 {
+		t.Errorf("expected 1 concurrent create, got %d", creates)
+	}
+
+	if err := s.Put(ctx, "things", "", []byte("x")); err == nil {
+		t.Error("expected error for empty key, got nil")
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("unexpected error creating file store: %s", err)
+	}
+
+	testStore(t, s)
+
+	// values should persist for a new store in the same directory
+	s2, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("unexpected error creating file store: %s", err)
+	}
+
+	got, err := s2.Get(context.Background(), "things", "bar/1")
+	if err != nil {
+		t.Errorf("unexpected error getting persisted key: %s", err)
+	}
+
+	if string(got) != `{"id":"3"}` {
+		t.Errorf("expected %s, got %s", `{"id":"3"}`, string(got))
+	}
+
+	if _, err := s2.List(context.Background(), "../things", ""); err == nil {
+		t.Error("expected error for invalid bucket name, got nil")
+	}
+
+	if _, err := NewFileStore(""); err == nil {
+		t.Error("expected error for empty path, got nil")
+	}
+}